@@ -381,6 +381,21 @@ func (b *Batch) Get(key []byte) ([]byte, io.Closer, error) {
 	return b.db.getInternal(key, b, nil /* snapshot */)
 }
 
+// MultiGet gets the values for the given keys. The returned values are
+// parallel to keys: values[i] is the value for keys[i], or nil if the Batch
+// does not contain keys[i]. See DB.MultiGet.
+//
+// The caller should not modify the contents of the returned slices, but it is
+// safe to modify the contents of the arguments after MultiGet returns. The
+// returned slices will remain valid until the returned Closer is closed. On
+// success, the caller MUST call closer.Close() or a memory leak will occur.
+func (b *Batch) MultiGet(keys [][]byte) ([][]byte, io.Closer, error) {
+	if b.index == nil {
+		return nil, nil, ErrNotIndexed
+	}
+	return b.db.multiGetInternal(keys, b, nil /* snapshot */)
+}
+
 func (b *Batch) prepareDeferredKeyValueRecord(keyLen, valueLen int, kind InternalKeyKind) {
 	if len(b.data) == 0 {
 		b.init(keyLen + valueLen + 2*binary.MaxVarintLen64 + batchHeaderLen)
@@ -61,12 +61,14 @@ func (d *DB) Checkpoint(destDir string) (err error) {
 	d.mu.Unlock()
 
 	// Wrap the normal filesystem with one which wraps newly created files with
-	// vfs.NewSyncingFile.
+	// vfs.NewSyncingFile. Copies are subject to the write bandwidth limit.
 	fs := syncingFS{
 		FS: d.opts.FS,
 		syncOpts: vfs.SyncingFileOptions{
 			BytesPerSync: d.opts.BytesPerSync,
 		},
+		limiter:  d.writeLimiter,
+		priority: writePriorityCopy,
 	}
 	// TODO(peter): We don't call sync on the parent directory of destDir. In
 	// fact, if multiple directories are created, we don't call sync on any of
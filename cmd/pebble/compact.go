@@ -443,6 +443,10 @@ func teeEventListener(a, b pebble.EventListener) pebble.EventListener {
 			a.CompactionEnd(info)
 			b.CompactionEnd(info)
 		},
+		DiskSlow: func(info pebble.DiskSlowInfo) {
+			a.DiskSlow(info)
+			b.DiskSlow(info)
+		},
 		FlushBegin: func(info pebble.FlushInfo) {
 			a.FlushBegin(info)
 			b.FlushBegin(info)
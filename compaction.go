@@ -1402,6 +1402,9 @@ func (d *DB) runCompaction(
 	}()
 
 	snapshots := d.mu.snapshots.toSlice()
+	// The writer options are constructed while d.mu is held as the per-level
+	// options may be changed concurrently by DB.SetOptions.
+	writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level)
 
 	// Release the d.mu lock while doing I/O.
 	// Note the unusual order: Unlock and then Lock.
@@ -1450,8 +1453,6 @@ func (d *DB) runCompaction(
 		c.outputLevel.level: metrics,
 	}
 
-	writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level)
-
 	newOutput := func() error {
 		d.mu.Lock()
 		fileNum := d.mu.versions.getNextFileNum()
@@ -1476,6 +1477,11 @@ func (d *DB) runCompaction(
 		file = vfs.NewSyncingFile(file, vfs.SyncingFileOptions{
 			BytesPerSync: d.opts.BytesPerSync,
 		})
+		writePri := writePriorityCompaction
+		if c.flushing != nil {
+			writePri = writePriorityFlush
+		}
+		file = newLimitedFile(file, d.writeLimiter, writePri)
 		filenames = append(filenames, filename)
 		cacheOpts := private.SSTableCacheOpts(d.cacheID, fileNum).(sstable.WriterOption)
 		internalTableOpt := private.SSTableInternalTableOpt.(sstable.WriterOption)
@@ -1534,6 +1540,8 @@ func (d *DB) runCompaction(
 		if writerMeta.Properties.NumRangeDeletions == 0 {
 			meta.Stats = manifest.TableStats{
 				Valid:                       true,
+				NumEntries:                  writerMeta.Properties.NumEntries,
+				NumDeletions:                writerMeta.Properties.NumDeletions,
 				RangeDeletionsBytesEstimate: 0,
 			}
 		}
@@ -0,0 +1,122 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/rate"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// The consistency scanner periodically verifies the checksums of every block
+// of every live sstable in order to detect corruption of data at rest before
+// it is read by a user or a compaction. The scanner is enabled by
+// Options.Experimental.ConsistencyScanInterval. Every interval, a scan walks
+// the tables in the current readState, reading each table at a rate of at
+// most Options.Experimental.ConsistencyScanBytesPerSecond. Corruption is
+// reported through EventListener.BackgroundError; the error identifies the
+// file number and the offset of the corrupt block.
+//
+// Only one scan runs at a time. A running scan is tracked by
+// d.mu.consistencyScan.scanning, which Close waits on before closing the
+// table cache.
+
+func (d *DB) maybeStartConsistencyScanner() {
+	if d.opts.ReadOnly || d.opts.Experimental.ConsistencyScanInterval <= 0 {
+		return
+	}
+	go d.runConsistencyScanner()
+}
+
+func (d *DB) runConsistencyScanner() {
+	var limiter *rate.Limiter
+	if bytesPerSec := d.opts.Experimental.ConsistencyScanBytesPerSecond; bytesPerSec > 0 {
+		limiter = rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec)
+	}
+
+	timer := time.NewTimer(d.opts.Experimental.ConsistencyScanInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-d.closedCh:
+			return
+		case <-timer.C:
+		}
+
+		d.mu.Lock()
+		if d.closed.Load() != nil {
+			d.mu.Unlock()
+			return
+		}
+		d.mu.consistencyScan.scanning = true
+		d.mu.Unlock()
+
+		d.scanConsistency(limiter)
+
+		d.mu.Lock()
+		d.mu.consistencyScan.scanning = false
+		d.mu.consistencyScan.cond.Broadcast()
+		d.mu.Unlock()
+
+		timer.Reset(d.opts.Experimental.ConsistencyScanInterval)
+	}
+}
+
+// scanConsistency validates the block checksums of all of the tables in the
+// current readState, reporting any errors through the EventListener. It
+// returns early if the DB is closed.
+func (d *DB) scanConsistency(limiter *rate.Limiter) {
+	rs := d.loadReadState()
+	defer rs.unref()
+
+	for _, levelMetadata := range rs.current.Levels {
+		iter := levelMetadata.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if !d.throttleConsistencyScan(limiter, f.Size) {
+				return
+			}
+			err := d.tableCache.withReader(f, func(r *sstable.Reader) error {
+				return r.ValidateBlockChecksums()
+			})
+			if err != nil {
+				d.opts.EventListener.BackgroundError(
+					errors.Wrapf(err, "pebble: consistency scan of table %s", f.FileNum))
+			}
+		}
+	}
+}
+
+// throttleConsistencyScan waits until the limiter permits n bytes to be read.
+// It returns false if the DB was closed while waiting.
+func (d *DB) throttleConsistencyScan(limiter *rate.Limiter, n uint64) bool {
+	if limiter == nil {
+		return d.closed.Load() == nil
+	}
+	burst := uint64(limiter.Burst())
+	for n > 0 {
+		amount := n
+		if amount > burst {
+			amount = burst
+		}
+		n -= amount
+		delay := limiter.DelayN(time.Now(), int(amount))
+		if delay == rate.InfDuration {
+			return false
+		}
+		if delay == 0 {
+			continue
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-d.closedCh:
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+	}
+	return d.closed.Load() == nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistencyScanner(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), []byte("value"), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// Corrupt the first data block of the table.
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	var tableName string
+	var fileNum FileNum
+	for _, name := range ls {
+		if ft, fn, ok := base.ParseFilename(mem, name); ok && ft == fileTypeTable {
+			tableName, fileNum = name, fn
+		}
+	}
+	require.NotEmpty(t, tableName)
+	f, err := mem.Open(tableName)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data[2] ^= 0xff
+	f, err = mem.Create(tableName)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	errCh := make(chan error, 10)
+	opts := &Options{FS: mem}
+	opts.EventListener.BackgroundError = func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+	opts.Experimental.ConsistencyScanInterval = time.Millisecond
+	opts.Experimental.ConsistencyScanBytesPerSecond = 1 << 20
+	d, err = Open("", opts)
+	require.NoError(t, err)
+
+	select {
+	case err := <-errCh:
+		require.Regexp(t, fmt.Sprintf(`invalid table %s \(checksum mismatch at 0/`, fileNum), err.Error())
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the consistency scanner to report corruption")
+	}
+	require.NoError(t, d.Close())
+}
@@ -66,12 +66,20 @@ func runIterCmd(d *datadriven.TestData, iter *Iterator) string {
 			continue
 		}
 		var valid bool
+		// validityState is only set by the operations that accept a limit.
+		var validityState IterValidityState
 		switch parts[0] {
 		case "seek-ge":
 			if len(parts) != 2 {
 				return fmt.Sprintf("seek-ge <key>\n")
 			}
 			valid = iter.SeekGE([]byte(strings.TrimSpace(parts[1])))
+		case "seek-ge-limit":
+			if len(parts) != 3 {
+				return fmt.Sprintf("seek-ge-limit <key> <limit>\n")
+			}
+			validityState = iter.SeekGEWithLimit([]byte(parts[1]), []byte(parts[2]))
+			valid = validityState == IterValid
 		case "seek-prefix-ge":
 			if len(parts) != 2 {
 				return fmt.Sprintf("seek-prefix-ge <key>\n")
@@ -82,6 +90,12 @@ func runIterCmd(d *datadriven.TestData, iter *Iterator) string {
 				return fmt.Sprintf("seek-lt <key>\n")
 			}
 			valid = iter.SeekLT([]byte(strings.TrimSpace(parts[1])))
+		case "seek-lt-limit":
+			if len(parts) != 3 {
+				return fmt.Sprintf("seek-lt-limit <key> <limit>\n")
+			}
+			validityState = iter.SeekLTWithLimit([]byte(parts[1]), []byte(parts[2]))
+			valid = validityState == IterValid
 		case "first":
 			valid = iter.First()
 		case "last":
@@ -90,6 +104,18 @@ func runIterCmd(d *datadriven.TestData, iter *Iterator) string {
 			valid = iter.Next()
 		case "prev":
 			valid = iter.Prev()
+		case "next-limit":
+			if len(parts) != 2 {
+				return fmt.Sprintf("next-limit <limit>\n")
+			}
+			validityState = iter.NextWithLimit([]byte(parts[1]))
+			valid = validityState == IterValid
+		case "prev-limit":
+			if len(parts) != 2 {
+				return fmt.Sprintf("prev-limit <limit>\n")
+			}
+			validityState = iter.PrevWithLimit([]byte(parts[1]))
+			valid = validityState == IterValid
 		case "set-bounds":
 			if len(parts) <= 1 || len(parts) > 3 {
 				return fmt.Sprintf("set-bounds lower=<lower> upper=<upper>\n")
@@ -118,6 +144,8 @@ func runIterCmd(d *datadriven.TestData, iter *Iterator) string {
 			fmt.Fprintf(&b, "mismatched valid states: %t vs %t\n", valid, iter.Valid())
 		} else if valid {
 			fmt.Fprintf(&b, "%s:%s\n", iter.Key(), iter.Value())
+		} else if validityState == IterAtLimit {
+			fmt.Fprintf(&b, "at-limit\n")
 		} else {
 			fmt.Fprintf(&b, ".\n")
 		}
@@ -519,6 +547,8 @@ func runTableStatsCmd(td *datadriven.TestData, d *DB) string {
 			}
 
 			var b bytes.Buffer
+			fmt.Fprintf(&b, "num-entries: %d\n", f.Stats.NumEntries)
+			fmt.Fprintf(&b, "num-deletions: %d\n", f.Stats.NumDeletions)
 			fmt.Fprintf(&b, "range-deletions-bytes-estimate: %d\n", f.Stats.RangeDeletionsBytesEstimate)
 			return b.String()
 		}
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -170,8 +172,9 @@ type DB struct {
 	split          Split
 	abbreviatedKey AbbreviatedKey
 	// The threshold for determining when a batch is "large" and will skip being
-	// inserted into a memtable.
-	largeBatchThreshold int
+	// inserted into a memtable. Must be accessed atomically as it is updated
+	// when Options.MemTableSize is changed by DB.SetOptions.
+	largeBatchThreshold int64
 	// The current OPTIONS file number.
 	optionsFileNum FileNum
 
@@ -200,11 +203,18 @@ type DB struct {
 	closed   atomic.Value
 	closedCh chan struct{}
 
+	// iterMetrics accumulates the metrics of the iterators which have been
+	// closed. See Metrics.Iterator.
+	iterMetrics iterMetricsAccumulator
+
 	// The count and size of referenced memtables. This includes memtables
 	// present in DB.mu.mem.queue, as well as memtables that have been flushed
 	// but are still referenced by an inuse readState.
 	memTableCount    int64
 	memTableReserved int64 // number of bytes reserved in the cache for memtables
+	// memTableFilterStats counts the checks of memtable filters. See
+	// Metrics.MemTable.
+	memTableFilterStats memTableFilterStats
 
 	compactionLimiter limiter
 
@@ -219,6 +229,14 @@ type DB struct {
 
 	flushLimiter limiter
 
+	// writeLimiter is the write bandwidth limiter shared by flushes,
+	// compactions, ingestion and checkpoint copies, and the WAL. See
+	// Options.MaxWriteBytesPerSecond.
+	writeLimiter *writeLimiter
+
+	// optionsMu serializes calls to SetOptions.
+	optionsMu sync.Mutex
+
 	// The main mutex protecting internal DB state. This mutex encompasses many
 	// fields because those fields need to be accessed and updated atomically. In
 	// particular, the current version, log.*, mem.*, and snapshot list need to
@@ -336,6 +354,14 @@ type DB struct {
 			// them.
 			pending []manifest.NewFileEntry
 		}
+
+		consistencyScan struct {
+			// Condition variable used to signal the completion of a
+			// consistency scan.
+			cond sync.Cond
+			// True when a consistency scan is in progress.
+			scanning bool
+		}
 	}
 
 	// Normally equal to time.Now() but may be overridden in tests.
@@ -538,7 +564,7 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 	if batch.db == nil {
 		batch.refreshMemTableSize()
 	}
-	if int(batch.memTableSize) >= d.largeBatchThreshold {
+	if int64(batch.memTableSize) >= atomic.LoadInt64(&d.largeBatchThreshold) {
 		batch.flushable = newFlushableBatch(batch, d.opts.Comparer)
 	}
 	if err := d.commit.Commit(batch, sync); err != nil {
@@ -667,6 +693,9 @@ func (d *DB) newIterInternal(
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
+	if o != nil && o.Prefix != nil && d.split == nil {
+		panic("pebble: split must be provided for IterOptions.Prefix")
+	}
 
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
@@ -687,14 +716,15 @@ func (d *DB) newIterInternal(
 	buf := iterAllocPool.Get().(*iterAlloc)
 	dbi := &buf.dbi
 	*dbi = Iterator{
-		alloc:     buf,
-		cmp:       d.cmp,
-		equal:     d.equal,
-		iter:      &buf.merging,
-		merge:     d.merge,
-		split:     d.split,
-		readState: readState,
-		keyBuf:    buf.keyBuf,
+		alloc:      buf,
+		cmp:        d.cmp,
+		equal:      d.equal,
+		iter:       &buf.merging,
+		merge:      d.merge,
+		split:      d.split,
+		readState:  readState,
+		keyBuf:     buf.keyBuf,
+		metricsAcc: &d.iterMetrics,
 	}
 	if o != nil {
 		dbi.opts = *o
@@ -706,6 +736,7 @@ func (d *DB) newIterInternal(
 		mlevels = append(mlevels, mergingIterLevel{
 			iter:         batchIter,
 			rangeDelIter: batchRangeDelIter,
+			stats:        &dbi.metrics.MemTableStats,
 		})
 	}
 
@@ -720,6 +751,7 @@ func (d *DB) newIterInternal(
 		mlevels = append(mlevels, mergingIterLevel{
 			iter:         mem.newIter(&dbi.opts),
 			rangeDelIter: mem.newRangeDelIter(&dbi.opts),
+			stats:        &dbi.metrics.MemTableStats,
 		})
 	}
 
@@ -743,7 +775,9 @@ func (d *DB) newIterInternal(
 	mlevels = mlevels[start:]
 
 	levels := buf.levels[:]
-	addLevelIterForFiles := func(files manifest.LevelIterator, level manifest.Level) {
+	addLevelIterForFiles := func(
+		files manifest.LevelIterator, level manifest.Level, stats *InternalIteratorStats,
+	) {
 		if files.Empty() {
 			return
 		}
@@ -756,10 +790,13 @@ func (d *DB) newIterInternal(
 		}
 
 		li.init(dbi.opts, d.cmp, d.newIters, files, level, nil)
+		li.split = d.split
+		li.initStats(stats)
 		li.initRangeDel(&mlevels[0].rangeDelIter)
 		li.initSmallestLargestUserKey(&mlevels[0].smallestUserKey, &mlevels[0].largestUserKey,
 			&mlevels[0].isLargestUserKeyRangeDelSentinel)
 		mlevels[0].iter = li
+		mlevels[0].stats = stats
 		mlevels = mlevels[1:]
 	}
 
@@ -767,12 +804,12 @@ func (d *DB) newIterInternal(
 	// oldest.
 	for i := len(current.L0Sublevels.Levels) - 1; i >= 0; i-- {
 		iter := manifest.NewLevelSlice(current.L0Sublevels.Levels[i]).Iter()
-		addLevelIterForFiles(iter, manifest.L0Sublevel(i))
+		addLevelIterForFiles(iter, manifest.L0Sublevel(i), &dbi.metrics.LevelStats[0])
 	}
 
 	// Add level iterators for the non-empty non-L0 levels.
 	for level := 1; level < len(current.Levels); level++ {
-		addLevelIterForFiles(current.Levels[level].Iter(), manifest.Level(level))
+		addLevelIterForFiles(current.Levels[level].Iter(), manifest.Level(level), &dbi.metrics.LevelStats[level])
 	}
 
 	buf.merging.init(&dbi.opts, d.cmp, finalMLevels...)
@@ -854,6 +891,9 @@ func (d *DB) Close() error {
 	for d.mu.tableStats.loading {
 		d.mu.tableStats.cond.Wait()
 	}
+	for d.mu.consistencyScan.scanning {
+		d.mu.consistencyScan.cond.Wait()
+	}
 
 	var err error
 	if n := len(d.mu.compact.inProgress); n > 0 {
@@ -1055,6 +1095,8 @@ func (d *DB) Metrics() *Metrics {
 	metrics.MemTable.Count = int64(len(d.mu.mem.queue))
 	metrics.MemTable.ZombieCount = atomic.LoadInt64(&d.memTableCount) - metrics.MemTable.Count
 	metrics.MemTable.ZombieSize = uint64(atomic.LoadInt64(&d.memTableReserved)) - metrics.MemTable.Size
+	metrics.MemTable.FilterHits = atomic.LoadUint64(&d.memTableFilterStats.hits)
+	metrics.MemTable.FilterMisses = atomic.LoadUint64(&d.memTableFilterStats.misses)
 	metrics.WAL.ObsoleteFiles = int64(recycledLogs)
 	metrics.WAL.Size = atomic.LoadUint64(&d.mu.log.size)
 	metrics.WAL.BytesIn = d.mu.log.bytesIn // protected by d.mu
@@ -1075,11 +1117,183 @@ func (d *DB) Metrics() *Metrics {
 	d.mu.Unlock()
 
 	metrics.BlockCache = d.opts.Cache.Metrics()
-	metrics.TableCache, metrics.Filter = d.tableCache.metrics()
+	metrics.TableCache, metrics.Filter, metrics.Readahead = d.tableCache.metrics()
 	metrics.TableIters = int64(d.tableCache.iterCount())
+
+	var iterMetrics IteratorMetrics
+	metrics.Iterator.Count, iterMetrics = d.iterMetrics.load()
+	metrics.Iterator.Stats = iterMetrics.Stats
+	metrics.Iterator.MemTableStats = iterMetrics.MemTableStats
+	metrics.Iterator.LevelStats = iterMetrics.LevelStats
+
+	writeMetrics := d.writeLimiter.metrics()
+	metrics.WriteBandwidth.Limit = d.writeLimiter.limit()
+	metrics.WriteBandwidth.WAL = writeMetrics[writePriorityWAL]
+	metrics.WriteBandwidth.Flush = writeMetrics[writePriorityFlush]
+	metrics.WriteBandwidth.Copy = writeMetrics[writePriorityCopy]
+	metrics.WriteBandwidth.Compaction = writeMetrics[writePriorityCompaction]
 	return metrics
 }
 
+// SetMaxWriteBytesPerSecond sets the limit on the combined write bandwidth of
+// flushes, compactions, ingestion and checkpoint copies, and the WAL. A value
+// of zero removes the limit. See Options.MaxWriteBytesPerSecond.
+func (d *DB) SetMaxWriteBytesPerSecond(bytesPerSecond int) {
+	d.mu.Lock()
+	d.opts.MaxWriteBytesPerSecond = bytesPerSecond
+	d.mu.Unlock()
+	d.writeLimiter.setLimit(bytesPerSecond)
+}
+
+// runtimeOptions is the set of options which may be changed by DB.SetOptions,
+// keyed by the section and key used by Options.String and Options.Parse. Level
+// options are keyed using the "Level" section.
+var runtimeOptions = map[string]bool{
+	"Options.l0_compaction_threshold":    true,
+	"Options.l0_stop_writes_threshold":   true,
+	"Options.max_concurrent_compactions": true,
+	"Options.max_write_bytes_per_second": true,
+	"Options.mem_table_size":             true,
+	"Level.target_file_size":             true,
+}
+
+// SetOptions changes the subset of options which may be safely changed while
+// the DB is open: l0_compaction_threshold, l0_stop_writes_threshold,
+// max_concurrent_compactions, max_write_bytes_per_second, mem_table_size and
+// the per-level target_file_size. The map is keyed by the option names used
+// in the OPTIONS file. Per-level options are specified with the level section
+// prefixed, as in `Level "1".target_file_size`, and may only be specified for
+// levels present in Options.Levels. Options in the [Options] section may
+// optionally be prefixed with "Options.".
+//
+// The new values are parsed and validated with Options.Parse and
+// Options.Validate. Either all of the changes are applied or, if an error is
+// returned, none are. On success the OPTIONS file is rewritten so that the
+// changes persist across a reopen of the DB. A change to mem_table_size takes
+// effect when the next memtable is allocated, and a change to
+// target_file_size takes effect for subsequent flushes and compactions.
+func (d *DB) SetOptions(options map[string]string) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	// Group the options by section so that they can be formatted in the
+	// INI-style syntax understood by Options.Parse.
+	sections := make(map[string][]string)
+	for name, value := range options {
+		section, key := "Options", name
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			section, key = name[:i], name[i+1:]
+		}
+		sectionKind := section
+		if strings.HasPrefix(section, "Level ") {
+			sectionKind = "Level"
+		}
+		if !runtimeOptions[sectionKind+"."+key] {
+			return errors.Errorf("pebble: option %s cannot be changed at runtime", errors.Safe(name))
+		}
+		sections[section] = append(sections[section], fmt.Sprintf("%s=%s", key, value))
+	}
+	sectionNames := make([]string, 0, len(sections))
+	for section := range sections {
+		sectionNames = append(sectionNames, section)
+	}
+	sort.Strings(sectionNames)
+	var buf strings.Builder
+	for _, section := range sectionNames {
+		fmt.Fprintf(&buf, "[%s]\n", section)
+		sort.Strings(sections[section])
+		for _, line := range sections[section] {
+			fmt.Fprintf(&buf, "%s\n", line)
+		}
+	}
+
+	d.optionsMu.Lock()
+	defer d.optionsMu.Unlock()
+
+	d.mu.Lock()
+	newOpts := d.opts.Clone()
+	newOpts.Levels = append([]LevelOptions(nil), d.opts.Levels...)
+	if err := newOpts.Parse(buf.String(), nil); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	if err := validateRuntimeOptions(newOpts, len(d.opts.Levels)); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+
+	d.opts.L0CompactionThreshold = newOpts.L0CompactionThreshold
+	d.opts.L0StopWritesThreshold = newOpts.L0StopWritesThreshold
+	d.opts.MaxConcurrentCompactions = newOpts.MaxConcurrentCompactions
+	d.opts.MaxWriteBytesPerSecond = newOpts.MaxWriteBytesPerSecond
+	d.opts.MemTableSize = newOpts.MemTableSize
+	// The Levels slice is replaced rather than modified in place as it may be
+	// shared with the Options passed to Open.
+	d.opts.Levels = newOpts.Levels
+
+	d.writeLimiter.setLimit(d.opts.MaxWriteBytesPerSecond)
+	atomic.StoreInt64(&d.largeBatchThreshold, largeBatchThreshold(d.opts.MemTableSize))
+	if d.mu.mem.nextSize > d.opts.MemTableSize {
+		d.mu.mem.nextSize = d.opts.MemTableSize
+	}
+	optionsStr := d.opts.String()
+	optionsFileNum := d.mu.versions.getNextFileNum()
+	d.maybeScheduleCompaction()
+	// Wake up writes which may be stalled on the previous L0 and memtable
+	// thresholds.
+	d.mu.compact.cond.Broadcast()
+	d.mu.mem.cond.Broadcast()
+	d.mu.Unlock()
+
+	if err := d.writeOptionsFile(optionsFileNum, optionsStr); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.versions.obsoleteOptions = merge(d.mu.versions.obsoleteOptions, []FileNum{d.optionsFileNum})
+	d.optionsFileNum = optionsFileNum
+	jobID := d.mu.nextJobID
+	d.mu.nextJobID++
+	d.deleteObsoleteFiles(jobID)
+	return nil
+}
+
+// validateRuntimeOptions verifies that options changed by DB.SetOptions are
+// valid. numLevels is the number of levels configured when the DB was opened.
+func validateRuntimeOptions(o *Options, numLevels int) error {
+	if len(o.Levels) > numLevels {
+		return errors.Errorf("pebble: options for level %d cannot be changed at runtime: "+
+			"only %d levels are configured", errors.Safe(len(o.Levels)-1), errors.Safe(numLevels))
+	}
+	var buf strings.Builder
+	if o.L0CompactionThreshold <= 0 {
+		fmt.Fprintf(&buf, "L0CompactionThreshold (%d) must be > 0\n", o.L0CompactionThreshold)
+	}
+	if o.MaxConcurrentCompactions <= 0 {
+		fmt.Fprintf(&buf, "MaxConcurrentCompactions (%d) must be > 0\n", o.MaxConcurrentCompactions)
+	}
+	if o.MaxWriteBytesPerSecond < 0 {
+		fmt.Fprintf(&buf, "MaxWriteBytesPerSecond (%d) must be >= 0\n", o.MaxWriteBytesPerSecond)
+	}
+	if o.MemTableSize <= 0 {
+		fmt.Fprintf(&buf, "MemTableSize (%d) must be > 0\n", o.MemTableSize)
+	}
+	for i := range o.Levels {
+		if o.Levels[i].TargetFileSize <= 0 {
+			fmt.Fprintf(&buf, "Levels[%d].TargetFileSize (%d) must be > 0\n", i, o.Levels[i].TargetFileSize)
+		}
+	}
+	if buf.Len() > 0 {
+		return errors.New(buf.String())
+	}
+	return o.Validate()
+}
+
 // SSTables retrieves the current sstables. The returned slice is indexed by
 // level and each level is indexed by the position of the sstable within the
 // level. Note that this information may be out of date due to concurrent
@@ -1170,6 +1384,183 @@ func (d *DB) EstimateDiskUsage(start, end []byte) (uint64, error) {
 	return totalSize, nil
 }
 
+// SpanUsage holds the estimated space usage and key counts for a key range, as
+// returned by DB.EstimateSpanUsage.
+type SpanUsage struct {
+	// DiskBytes is the estimated sstable space used for storing the range. It
+	// is the value returned by DB.EstimateDiskUsage.
+	DiskBytes uint64
+	// LiveBytes is the portion of DiskBytes estimated to hold live data.
+	LiveBytes uint64
+	// GarbageBytes is the portion of DiskBytes estimated to hold deletion
+	// tombstones and the data deleted by range deletions, which compactions
+	// will eventually reclaim. LiveBytes + GarbageBytes == DiskBytes.
+	GarbageBytes uint64
+	// MemTableBytes is the size of the memtable entries within the range. This
+	// data has not yet been flushed and is not included in DiskBytes.
+	MemTableBytes uint64
+	// Keys is the estimated number of entries within the range that are not
+	// deletion tombstones and are not deleted by range deletions, across both
+	// sstables and memtables. A key with multiple versions is counted once per
+	// version.
+	Keys uint64
+	// Deletions is the estimated number of point and range deletion
+	// tombstones within the range.
+	Deletions uint64
+}
+
+// EstimateSpanUsage returns estimates of the space usage and key counts for
+// the range `[start, end]`. Unlike EstimateDiskUsage, the estimate accounts for
+// the memtables, and distinguishes live data from garbage using the table
+// statistics collected in the background. The estimation is computed as
+// follows:
+//
+// - The fraction of each sstable within the range is the fraction of its size
+//   reported by EstimateDiskUsage. The sstable's entry, deletion and range
+//   deletion estimates are scaled by this fraction.
+// - Garbage consists of the space used by point and range deletion tombstones,
+//   assuming entries of the average size of the sstable's entries, plus the
+//   sstable's estimate of the data beneath it deleted by its range deletions.
+//   The data shadowed by point deletions is not known and is counted as live.
+// - The sstable entries are reduced by the fraction of the sstable data that
+//   is estimated to be deleted by range deletions, assuming entries of a
+//   uniform size. Memtable entries are counted even if they are deleted by
+//   range deletions.
+// - Range deletions in the memtables add the estimated size of the sstable
+//   data they delete within the range.
+// - For sstables whose statistics have not been loaded yet, the entry and
+//   deletion counts are read from the sstable properties, and the data beneath
+//   their range deletions is not counted as garbage.
+//
+// No data is scanned other than the entries of the memtables within the range.
+func (d *DB) EstimateSpanUsage(start, end []byte) (SpanUsage, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.Comparer.Compare(start, end) > 0 {
+		return SpanUsage{}, errors.New("invalid key-range specified (start > end)")
+	}
+
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	var usage SpanUsage
+	// The sstable entries, the garbage from point deletion tombstones, and the
+	// garbage from the data deleted by range deletions.
+	var keys, garbage, rangeDelGarbage float64
+	for level, files := range readState.current.Levels {
+		iter := files.Iter()
+		if level > 0 {
+			iter = readState.current.Overlaps(level, d.opts.Comparer.Compare, start, end).Iter()
+		}
+		for file := iter.First(); file != nil; file = iter.Next() {
+			contained := d.opts.Comparer.Compare(start, file.Smallest.UserKey) <= 0 &&
+				d.opts.Comparer.Compare(file.Largest.UserKey, end) <= 0
+			if !contained && (d.opts.Comparer.Compare(file.Smallest.UserKey, end) > 0 ||
+				d.opts.Comparer.Compare(start, file.Largest.UserKey) > 0) {
+				continue
+			}
+
+			// The stats are updated by the table stats collector while
+			// holding DB.mu.
+			d.mu.Lock()
+			stats := file.Stats
+			d.mu.Unlock()
+
+			size := file.Size
+			if !contained || !stats.Valid {
+				err := d.tableCache.withReader(file, func(r *sstable.Reader) (err error) {
+					if !stats.Valid {
+						stats.NumEntries = r.Properties.NumEntries
+						stats.NumDeletions = r.Properties.NumDeletions
+					}
+					if !contained {
+						size, err = r.EstimateDiskUsage(start, end)
+					}
+					return err
+				})
+				if err != nil {
+					return SpanUsage{}, err
+				}
+			}
+			usage.DiskBytes += size
+			if file.Size == 0 || stats.NumEntries == 0 {
+				continue
+			}
+			fraction := float64(size) / float64(file.Size)
+			if fraction > 1 {
+				fraction = 1
+			}
+			keys += fraction * float64(stats.NumEntries-stats.NumDeletions)
+			usage.Deletions += uint64(fraction * float64(stats.NumDeletions))
+			garbage += float64(size) * float64(stats.NumDeletions) / float64(stats.NumEntries)
+			rangeDelGarbage += fraction * float64(stats.RangeDeletionsBytesEstimate)
+		}
+	}
+
+	for _, mem := range readState.memtables {
+		iter := mem.newIter(nil)
+		for key, value := iter.SeekGE(start); key != nil &&
+			d.opts.Comparer.Compare(key.UserKey, end) <= 0; key, value = iter.Next() {
+			usage.MemTableBytes += uint64(key.Size() + len(value))
+			switch key.Kind() {
+			case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+				usage.Deletions++
+			default:
+				usage.Keys++
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return SpanUsage{}, err
+		}
+
+		rangeDelIter := mem.newRangeDelIter(nil)
+		if rangeDelIter == nil {
+			continue
+		}
+		err := foreachDefragmentedTombstone(rangeDelIter, d.cmp,
+			func(startUserKey, endUserKey []byte, _, _ uint64) error {
+				if d.cmp(startUserKey, start) < 0 {
+					startUserKey = start
+				}
+				if d.cmp(endUserKey, end) > 0 {
+					endUserKey = end
+				}
+				if d.cmp(startUserKey, endUserKey) >= 0 {
+					return nil
+				}
+				usage.Deletions++
+				estimate, _, err := d.estimateSizeBeneath(readState.current, -1, nil, startUserKey, endUserKey)
+				rangeDelGarbage += float64(estimate)
+				return err
+			})
+		if err != nil {
+			return SpanUsage{}, err
+		}
+	}
+
+	if usage.DiskBytes > 0 {
+		if deleted := rangeDelGarbage / float64(usage.DiskBytes); deleted < 1 {
+			usage.Keys += uint64(keys * (1 - deleted))
+		}
+	}
+	usage.GarbageBytes = uint64(garbage + rangeDelGarbage)
+	if usage.GarbageBytes > usage.DiskBytes {
+		usage.GarbageBytes = usage.DiskBytes
+	}
+	usage.LiveBytes = usage.DiskBytes - usage.GarbageBytes
+	return usage, nil
+}
+
+// EstimateKeyCount returns the estimated number of keys within the range
+// `[start, end]` that are not deletion tombstones. The estimate is computed
+// from table statistics and sstable indexes, and only the memtables are
+// scanned. See EstimateSpanUsage for details.
+func (d *DB) EstimateKeyCount(start, end []byte) (uint64, error) {
+	usage, err := d.EstimateSpanUsage(start, end)
+	return usage.Keys, err
+}
+
 func (d *DB) walPreallocateSize() int {
 	// Set the WAL preallocate size to 110% of the memtable size. Note that there
 	// is a bit of apples and oranges in units here as the memtabls size
@@ -1198,9 +1589,10 @@ func (d *DB) newMemTable(logNum FileNum, logSeqNum uint64) (*memTable, *flushabl
 	releaseAccountingReservation := d.opts.Cache.Reserve(size)
 
 	mem := newMemTable(memTableOptions{
-		Options:   d.opts,
-		arenaBuf:  manual.New(int(size)),
-		logSeqNum: logSeqNum,
+		Options:     d.opts,
+		arenaBuf:    manual.New(int(size)),
+		logSeqNum:   logSeqNum,
+		filterStats: &d.memTableFilterStats,
 	})
 	if invariants.Enabled {
 		runtime.SetFinalizer(mem, checkMemTable)
@@ -1339,6 +1731,7 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 						BytesPerSync:    d.opts.BytesPerSync,
 						PreallocateSize: d.walPreallocateSize(),
 					})
+					newLogFile = newLimitedFile(newLogFile, d.writeLimiter, writePriorityWAL)
 				}
 			}
 
@@ -448,6 +448,55 @@ func TestGetNoCache(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestGetDataBlockHashIndex(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:          vfs.NewMem(),
+		TableFormat: TableFormatPebblev2,
+		Levels: []LevelOptions{{
+			BlockSize:          512,
+			DataBlockIndexType: DataBlockBinaryAndHash,
+		}},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	for i := 0; i < 1000; i += 2 {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%04d", i)), []byte(fmt.Sprint(i)), nil))
+	}
+	require.NoError(t, d.Flush())
+	for i := 0; i < 1000; i += 10 {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%04d", i)), []byte("new"), nil))
+	}
+	require.NoError(t, d.Flush())
+
+	readState := d.loadReadState()
+	iter := readState.current.Levels[0].Iter()
+	var tables int
+	for f := iter.First(); f != nil; f = iter.Next() {
+		require.NoError(t, d.tableCache.withReader(f, func(r *sstable.Reader) error {
+			require.Equal(t, uint32(DataBlockBinaryAndHash), r.Properties.DataBlockIndexType)
+			return nil
+		}))
+		tables++
+	}
+	readState.unref()
+	require.Equal(t, 2, tables)
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("%04d", i))
+		switch {
+		case i%10 == 0:
+			verifyGet(t, d, key, []byte("new"))
+		case i%2 == 0:
+			verifyGet(t, d, key, []byte(fmt.Sprint(i)))
+		default:
+			verifyGetNotFound(t, d, key)
+		}
+	}
+}
+
 func TestGetMerge(t *testing.T) {
 	d, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -610,6 +659,37 @@ func TestSingleDeleteGet(t *testing.T) {
 	verifyGetNotFound(t, d, key2)
 }
 
+func TestMemTableFilterGet(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Experimental.MemTableFilterSizeRatio = 0.01
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+
+	// The memtable holds no point records for the flushed keys, so its filter
+	// excludes them and Get reads them from the sstable.
+	require.NoError(t, d.Set([]byte("c"), []byte("3"), nil))
+	verifyGet(t, d, []byte("a"), []byte("1"))
+	verifyGet(t, d, []byte("c"), []byte("3"))
+	m := d.Metrics()
+	require.Equal(t, uint64(1), m.MemTable.FilterHits)
+	require.Equal(t, uint64(1), m.MemTable.FilterMisses)
+
+	// A range tombstone in the memtable deletes the flushed key even though
+	// the filter excludes it.
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("b"), nil))
+	verifyGetNotFound(t, d, []byte("a"))
+	verifyGet(t, d, []byte("b"), []byte("2"))
+	m = d.Metrics()
+	require.Equal(t, uint64(3), m.MemTable.FilterHits)
+}
+
 func TestSingleDeleteFlush(t *testing.T) {
 	d, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -921,6 +1001,8 @@ func TestDBClosed(t *testing.T) {
 	require.True(t, errors.Is(catch(func() { _, _ = d.AsyncFlush() }), ErrClosed))
 
 	require.True(t, errors.Is(catch(func() { _, _, _ = d.Get(nil) }), ErrClosed))
+	require.True(t, errors.Is(catch(func() { _, _, _ = d.MultiGet(nil) }), ErrClosed))
+	require.True(t, errors.Is(catch(func() { _, _ = d.SplitRange(nil, nil, 2) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _ = d.Delete(nil, nil) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _ = d.DeleteRange(nil, nil, nil) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _ = d.Ingest(nil) }), ErrClosed))
@@ -929,6 +1011,7 @@ func TestDBClosed(t *testing.T) {
 	require.True(t, errors.Is(catch(func() { _ = d.Set(nil, nil, nil) }), ErrClosed))
 
 	require.True(t, errors.Is(catch(func() { _ = d.NewSnapshot() }), ErrClosed))
+	require.True(t, errors.Is(catch(func() { _, _ = d.EstimateSpanUsage(nil, nil) }), ErrClosed))
 
 	b := d.NewIndexedBatch()
 	require.True(t, errors.Is(catch(func() { _ = b.Commit(nil) }), ErrClosed))
@@ -936,6 +1019,71 @@ func TestDBClosed(t *testing.T) {
 	require.True(t, errors.Is(catch(func() { _ = b.NewIter(nil) }), ErrClosed))
 }
 
+func TestEstimateSpanUsage(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{Compression: NoCompression}},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%04d", i)), value, nil))
+	}
+	start, end := []byte("0000"), []byte("9999")
+
+	// Unflushed entries are only counted in the memtables.
+	usage, err := d.EstimateSpanUsage(start, end)
+	require.NoError(t, err)
+	require.Equal(t, SpanUsage{MemTableBytes: 1000 * (4 + 8 + 100), Keys: 1000}, usage)
+
+	// The table stats do not account for data in L0 beneath a range deletion,
+	// so move the data out of L0.
+	require.NoError(t, d.Compact(start, end))
+	usage, err = d.EstimateSpanUsage(start, end)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), usage.Keys)
+	require.Equal(t, uint64(0), usage.Deletions)
+	require.Equal(t, uint64(0), usage.MemTableBytes)
+	require.Equal(t, uint64(0), usage.GarbageBytes)
+	require.True(t, usage.DiskBytes > 100*1000)
+	require.Equal(t, usage.DiskBytes, usage.LiveBytes)
+
+	// A partially overlapping sstable is counted in proportion to the
+	// overlapping data blocks.
+	keys, err := d.EstimateKeyCount([]byte("0000"), []byte("0499"))
+	require.NoError(t, err)
+	require.True(t, keys > 300 && keys < 700, "keys=%d", keys)
+
+	// An unflushed range deletion makes the data it deletes garbage.
+	require.NoError(t, d.DeleteRange([]byte("0000"), []byte("0500"), nil))
+	usage, err = d.EstimateSpanUsage(start, end)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), usage.Deletions)
+	require.True(t, usage.Keys > 400 && usage.Keys < 600, "keys=%d", usage.Keys)
+	require.True(t, usage.GarbageBytes > 30*1000, "garbage=%d", usage.GarbageBytes)
+	require.Equal(t, usage.DiskBytes, usage.LiveBytes+usage.GarbageBytes)
+
+	// Once flushed, the garbage is estimated from the table stats.
+	require.NoError(t, d.Flush())
+	d.mu.Lock()
+	d.waitTableStats()
+	d.mu.Unlock()
+	usage, err = d.EstimateSpanUsage(start, end)
+	require.NoError(t, err)
+	require.True(t, usage.Keys > 400 && usage.Keys < 600, "keys=%d", usage.Keys)
+	require.Equal(t, uint64(1), usage.Deletions)
+	require.Equal(t, uint64(0), usage.MemTableBytes)
+	require.True(t, usage.GarbageBytes > 30*1000, "garbage=%d", usage.GarbageBytes)
+	require.Equal(t, usage.DiskBytes, usage.LiveBytes+usage.GarbageBytes)
+
+	_, err = d.EstimateSpanUsage(end, start)
+	require.Error(t, err)
+}
+
 func TestDBConcurrentCommitCompactFlush(t *testing.T) {
 	d, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -1149,3 +1297,93 @@ func verifyGetNotFound(t *testing.T, r Reader, key []byte) {
 		t.Fatalf("expected nil, but got %s", val)
 	}
 }
+
+func TestSetOptions(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:     mem,
+		Levels: make([]LevelOptions, 2),
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	readOptionsFile := func() string {
+		var contents []string
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		for _, filename := range ls {
+			if ft, _, ok := base.ParseFilename(mem, filename); ok && ft == fileTypeOptions {
+				f, err := mem.Open(filename)
+				require.NoError(t, err)
+				var buf bytes.Buffer
+				_, err = buf.ReadFrom(f)
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+				contents = append(contents, buf.String())
+			}
+		}
+		require.Equal(t, 1, len(contents))
+		return contents[0]
+	}
+
+	require.NoError(t, d.SetOptions(map[string]string{
+		"max_concurrent_compactions":         "3",
+		"Options.l0_compaction_threshold":    "6",
+		"mem_table_size":                     "8388608",
+		"max_write_bytes_per_second":         "1048576",
+		`Level "1".target_file_size`:         "1234",
+		"Options.l0_stop_writes_threshold":   "20",
+		`Level "0".target_file_size`:         "5678",
+		"Options.max_concurrent_compactions": "3",
+	}))
+	require.Equal(t, 3, d.opts.MaxConcurrentCompactions)
+	require.Equal(t, 6, d.opts.L0CompactionThreshold)
+	require.Equal(t, 20, d.opts.L0StopWritesThreshold)
+	require.Equal(t, 8<<20, d.opts.MemTableSize)
+	require.EqualValues(t, 5678, d.opts.Levels[0].TargetFileSize)
+	require.EqualValues(t, 1234, d.opts.Levels[1].TargetFileSize)
+	require.Equal(t, 1<<20, d.Metrics().WriteBandwidth.Limit)
+	require.Equal(t, largeBatchThreshold(8<<20), atomic.LoadInt64(&d.largeBatchThreshold))
+	// The Options passed to Open are not modified.
+	require.NotEqual(t, int64(1234), opts.Levels[1].TargetFileSize)
+
+	// The rewritten OPTIONS file replaces the previous one and reflects the
+	// new values.
+	contents := readOptionsFile()
+	parsed := &Options{}
+	require.NoError(t, parsed.Parse(contents, &ParseHooks{}))
+	require.Equal(t, 3, parsed.MaxConcurrentCompactions)
+	require.Equal(t, 6, parsed.L0CompactionThreshold)
+	require.Equal(t, 8<<20, parsed.MemTableSize)
+	require.EqualValues(t, 1234, parsed.Levels[1].TargetFileSize)
+
+	// Invalid changes are rejected and leave the options untouched.
+	testCases := []struct {
+		options  map[string]string
+		expected string
+	}{
+		{map[string]string{"comparer": "foo"},
+			"option comparer cannot be changed at runtime"},
+		{map[string]string{`Level "0".block_size`: "10"},
+			`option Level "0".block_size cannot be changed at runtime`},
+		{map[string]string{`Level "2".target_file_size`: "10"},
+			"options for level 2 cannot be changed at runtime"},
+		{map[string]string{"mem_table_size": "foo"},
+			"invalid syntax"},
+		{map[string]string{"max_concurrent_compactions": "0"},
+			"MaxConcurrentCompactions (0) must be > 0"},
+		{map[string]string{"l0_compaction_threshold": "4", "l0_stop_writes_threshold": "2"},
+			"L0StopWritesThreshold (2) must be >= L0CompactionThreshold (4)"},
+	}
+	for _, c := range testCases {
+		err := d.SetOptions(c.options)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), c.expected)
+	}
+	require.Equal(t, 3, d.opts.MaxConcurrentCompactions)
+	require.Equal(t, 6, d.opts.L0CompactionThreshold)
+	require.Equal(t, contents, readOptionsFile())
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package dump
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// Dump writes the records visible to r in the range [lower, upper) to w. A
+// nil bound leaves the range unbounded. Passing a Snapshot dumps the records
+// as of the snapshot; passing a DB dumps the records visible to an iterator
+// created by Dump. Dump does not close w.
+func Dump(r pebble.Reader, lower, upper []byte, w *Writer) error {
+	iter := r.NewIter(&pebble.IterOptions{LowerBound: lower, UpperBound: upper})
+	for valid := iter.First(); valid; valid = iter.Next() {
+		if err := w.Add(iter.Key(), iter.Value()); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+// LoadOptions holds the parameters for Load.
+type LoadOptions struct {
+	// TempDir is the directory in which sstables are built before being
+	// ingested. It is created if it does not exist, and removed once the load
+	// completes if it is empty.
+	TempDir string
+
+	// TargetFileSize is the target size of the sstables built by Load. The
+	// default is 64 MB.
+	TargetFileSize int64
+
+	// Progress, if non-nil, is invoked after each sstable is ingested with the
+	// total number of records loaded.
+	Progress func(records uint64)
+}
+
+// Load loads the records read from r into db, returning the number of records
+// loaded. Rather than applying a write per record, Load builds sorted
+// sstables from the records and ingests them, which places them directly into
+// the bottom level of an empty DB. Load is intended for loading into an empty
+// DB: the loaded records replace any existing values for their keys. The
+// options must be the options db was opened with, and their comparer must
+// match the comparer recorded in the stream.
+func Load(db *pebble.DB, opts *pebble.Options, r *Reader, lopts LoadOptions) (uint64, error) {
+	opts = opts.Clone().EnsureDefaults()
+	if r.ComparerName() != opts.Comparer.Name {
+		return 0, errors.Errorf("dump: comparer name from stream %q != comparer name from options %q",
+			r.ComparerName(), opts.Comparer.Name)
+	}
+	if lopts.TempDir == "" {
+		return 0, errors.New("dump: a temporary directory is required")
+	}
+	if lopts.TargetFileSize <= 0 {
+		lopts.TargetFileSize = 64 << 20
+	}
+	fs := opts.FS
+	if err := fs.MkdirAll(lopts.TempDir, 0755); err != nil {
+		return 0, err
+	}
+
+	var records uint64
+	key, value, err := r.Next()
+	for fileNum := 1; err == nil; fileNum++ {
+		path := fs.PathJoin(lopts.TempDir, fmt.Sprintf("load-%06d.sst", fileNum))
+		f, err1 := fs.Create(path)
+		if err1 != nil {
+			return records, err1
+		}
+		w := sstable.NewWriter(f, opts.MakeWriterOptions(manifest.NumLevels-1))
+		var n uint64
+		for err == nil && w.EstimatedSize() < uint64(lopts.TargetFileSize) {
+			if err1 := w.Set(key, value); err1 != nil {
+				_ = w.Close()
+				return records, err1
+			}
+			n++
+			key, value, err = r.Next()
+		}
+		if err != nil && err != io.EOF {
+			_ = w.Close()
+			return records, err
+		}
+		if err1 := w.Close(); err1 != nil {
+			return records, err1
+		}
+		if err1 := db.Ingest([]string{path}); err1 != nil {
+			return records, err1
+		}
+		records += n
+		if lopts.Progress != nil {
+			lopts.Progress(records)
+		}
+	}
+	if err != io.EOF {
+		return records, err
+	}
+	// Remove the temporary directory, which fails if it is not empty.
+	_ = fs.Remove(lopts.TempDir)
+	return records, nil
+}
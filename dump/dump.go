@@ -0,0 +1,438 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package dump implements a portable logical dump format for the records of a
+// pebble DB, along with functions to dump a DB to, and load a DB from, a dump
+// stream.
+//
+// A dump stream holds the key/value pairs visible to an iterator, in key
+// order, and is encoded in one of two formats. Both formats protect each
+// record with a checksum and end with a trailer holding the number of
+// records, so that corruption and truncation are detected when the stream is
+// read.
+//
+// The binary format is:
+//
+//   header:  magic (8 bytes) | version (1 byte) | comparer name (uvarint
+//            length-prefixed) | checksum (4 bytes)
+//   record:  tagRecord (1 byte) | key (uvarint length-prefixed) |
+//            value (uvarint length-prefixed) | checksum (4 bytes)
+//   trailer: tagEnd (1 byte) | record count (uvarint) | checksum (4 bytes)
+//
+// Checksums are the CRC-32 used throughout pebble (see internal/crc), stored
+// in little-endian order, and cover the bytes of the header, record or trailer
+// which precede them, excluding the magic.
+//
+// The text format is line oriented:
+//
+//   pebble-dump v1 <comparer name>
+//   <key> <value> <checksum>
+//   ...
+//   end <record count>
+//
+// where keys and values are hex encoded, and the checksum of a record is the
+// checksum of the equivalent binary record, printed as 8 hex digits.
+package dump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/crc"
+)
+
+// Format is the encoding of a dump stream.
+type Format int
+
+const (
+	// Binary is a compact binary encoding.
+	Binary Format = iota
+	// Text is a line oriented, hex encoded text encoding.
+	Text
+)
+
+// String implements fmt.Stringer.
+func (f Format) String() string {
+	switch f {
+	case Binary:
+		return "binary"
+	case Text:
+		return "text"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(f))
+	}
+}
+
+// ParseFormat parses the name of a Format.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "binary":
+		return Binary, nil
+	case "text":
+		return Text, nil
+	default:
+		return 0, errors.Errorf("dump: unknown format %q", s)
+	}
+}
+
+// ErrCorrupt marks errors returned when a dump stream is corrupt or truncated.
+var ErrCorrupt = errors.New("dump: corrupt stream")
+
+const (
+	binaryMagic   = "\x00pbldump"
+	binaryVersion = 1
+	textHeader    = "pebble-dump v1 "
+	textEnd       = "end "
+
+	tagRecord = 1
+	tagEnd    = 2
+
+	readChunkSize = 64 << 10
+)
+
+func corruptf(format string, args ...interface{}) error {
+	return errors.Mark(errors.Errorf("dump: "+format, args...), ErrCorrupt)
+}
+
+// recordChecksum returns the checksum of the binary encoding of a record,
+// which is also used by the text format.
+func recordChecksum(buf []byte, key, value []byte) ([]byte, uint32) {
+	buf = append(buf[:0], tagRecord)
+	buf = appendBytes(buf, key)
+	buf = appendBytes(buf, value)
+	return buf, crc.New(buf).Value()
+}
+
+func appendBytes(buf, b []byte) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(len(b)))
+	buf = append(buf, tmp[:n]...)
+	return append(buf, b...)
+}
+
+func appendChecksum(buf []byte, checksum uint32) []byte {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], checksum)
+	return append(buf, tmp[:]...)
+}
+
+// Writer writes a dump stream. Records must be added in key order.
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+	count  uint64
+	buf    []byte
+	err    error
+}
+
+// NewWriter returns a Writer which writes a stream in the specified format to
+// w, and writes the stream's header. The comparer name is recorded in the
+// header so that a load can verify that the keys are ordered by the
+// destination DB's comparer.
+func NewWriter(w io.Writer, format Format, comparerName string) (*Writer, error) {
+	dw := &Writer{w: bufio.NewWriter(w), format: format}
+	switch format {
+	case Binary:
+		dw.buf = append(dw.buf[:0], binaryVersion)
+		dw.buf = appendBytes(dw.buf, []byte(comparerName))
+		dw.buf = appendChecksum(dw.buf, crc.New(dw.buf).Value())
+		_, _ = dw.w.WriteString(binaryMagic)
+		_, dw.err = dw.w.Write(dw.buf)
+	case Text:
+		if strings.ContainsAny(comparerName, "\n") {
+			return nil, errors.Errorf("dump: invalid comparer name %q", comparerName)
+		}
+		_, dw.err = fmt.Fprintf(dw.w, "%s%s\n", textHeader, comparerName)
+	default:
+		return nil, errors.Errorf("dump: unknown format %s", format)
+	}
+	if dw.err != nil {
+		return nil, dw.err
+	}
+	return dw, nil
+}
+
+// Add adds a record to the stream.
+func (w *Writer) Add(key, value []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	var checksum uint32
+	w.buf, checksum = recordChecksum(w.buf, key, value)
+	switch w.format {
+	case Binary:
+		w.buf = appendChecksum(w.buf, checksum)
+		_, w.err = w.w.Write(w.buf)
+	case Text:
+		_, w.err = fmt.Fprintf(w.w, "%x %x %08x\n", key, value, checksum)
+	}
+	w.count++
+	return w.err
+}
+
+// Count returns the number of records added to the stream.
+func (w *Writer) Count() uint64 {
+	return w.count
+}
+
+// Close writes the stream's trailer and flushes the stream. It does not close
+// the underlying io.Writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	switch w.format {
+	case Binary:
+		w.buf = append(w.buf[:0], tagEnd)
+		var tmp [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(tmp[:], w.count)
+		w.buf = append(w.buf, tmp[:n]...)
+		w.buf = appendChecksum(w.buf, crc.New(w.buf).Value())
+		_, w.err = w.w.Write(w.buf)
+	case Text:
+		_, w.err = fmt.Fprintf(w.w, "%s%d\n", textEnd, w.count)
+	}
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("dump: writer is closed")
+	return nil
+}
+
+// Reader reads a dump stream in either format.
+type Reader struct {
+	r            *bufio.Reader
+	format       Format
+	comparerName string
+	count        uint64
+	done         bool
+	buf          []byte
+	key, value   []byte
+}
+
+// NewReader returns a Reader for the stream read from r, reading the stream's
+// header to determine its format.
+func NewReader(r io.Reader) (*Reader, error) {
+	dr := &Reader{r: bufio.NewReader(r)}
+	prefix, err := dr.r.Peek(len(binaryMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case string(prefix) == binaryMagic:
+		dr.format = Binary
+		_, _ = dr.r.Discard(len(binaryMagic))
+		version, err := dr.r.ReadByte()
+		if err != nil {
+			return nil, dr.truncated(err)
+		}
+		if version != binaryVersion {
+			return nil, errors.Errorf("dump: unsupported version %d", version)
+		}
+		dr.buf = append(dr.buf[:0], version)
+		name, err := dr.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		dr.comparerName = string(name)
+		if err := dr.readChecksum(); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(textHeader, string(prefix)) && len(prefix) > 0:
+		dr.format = Text
+		line, err := dr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, textHeader) {
+			return nil, corruptf("invalid header %q", line)
+		}
+		dr.comparerName = strings.TrimPrefix(line, textHeader)
+	default:
+		return nil, corruptf("not a dump stream")
+	}
+	return dr, nil
+}
+
+// Format returns the format of the stream.
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// ComparerName returns the name of the comparer which orders the stream's
+// keys.
+func (r *Reader) ComparerName() string {
+	return r.comparerName
+}
+
+// Next returns the next record in the stream. The returned key and value are
+// only valid until the next call to Next. Next returns io.EOF once the
+// stream's trailer has been read and verified, and an error marked with
+// ErrCorrupt if the stream is corrupt or truncated.
+func (r *Reader) Next() (key, value []byte, err error) {
+	if r.done {
+		return nil, nil, io.EOF
+	}
+	switch r.format {
+	case Binary:
+		key, value, err = r.nextBinary()
+	case Text:
+		key, value, err = r.nextText()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.done {
+		return nil, nil, io.EOF
+	}
+	r.count++
+	return key, value, nil
+}
+
+func (r *Reader) nextBinary() (key, value []byte, err error) {
+	tag, err := r.r.ReadByte()
+	if err != nil {
+		return nil, nil, r.truncated(err)
+	}
+	r.buf = append(r.buf[:0], tag)
+	switch tag {
+	case tagRecord:
+		// The key is copied out of r.buf before reading the value, as reading
+		// the value may grow r.buf.
+		k, err := r.readBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		r.key = append(r.key[:0], k...)
+		if r.value, err = r.readBytes(); err != nil {
+			return nil, nil, err
+		}
+		if err := r.readChecksum(); err != nil {
+			return nil, nil, err
+		}
+		return r.key, r.value, nil
+	case tagEnd:
+		count, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return nil, nil, r.truncated(err)
+		}
+		var tmp [binary.MaxVarintLen64]byte
+		r.buf = append(r.buf, tmp[:binary.PutUvarint(tmp[:], count)]...)
+		if err := r.readChecksum(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, r.end(count)
+	default:
+		return nil, nil, corruptf("invalid record tag %d after %d records", tag, r.count)
+	}
+}
+
+func (r *Reader) nextText() (key, value []byte, err error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.HasPrefix(line, textEnd) {
+		count, err := strconv.ParseUint(strings.TrimPrefix(line, textEnd), 10, 64)
+		if err != nil {
+			return nil, nil, corruptf("invalid trailer %q", line)
+		}
+		return nil, nil, r.end(count)
+	}
+	// Empty keys and values are encoded as empty fields.
+	fields := strings.Split(line, " ")
+	if len(fields) != 3 {
+		return nil, nil, corruptf("invalid record %q", line)
+	}
+	r.key, err = hex.DecodeString(fields[0])
+	if err == nil {
+		r.value, err = hex.DecodeString(fields[1])
+	}
+	var checksum uint64
+	if err == nil {
+		checksum, err = strconv.ParseUint(fields[2], 16, 32)
+	}
+	if err != nil {
+		return nil, nil, corruptf("invalid record %q", line)
+	}
+	var expected uint32
+	r.buf, expected = recordChecksum(r.buf, r.key, r.value)
+	if uint32(checksum) != expected {
+		return nil, nil, corruptf("checksum mismatch in record %d", r.count+1)
+	}
+	return r.key, r.value, nil
+}
+
+// end verifies the record count from the stream's trailer.
+func (r *Reader) end(count uint64) error {
+	if count != r.count {
+		return corruptf("trailer records %d records, but read %d", count, r.count)
+	}
+	r.done = true
+	return nil
+}
+
+// readBytes reads a uvarint length-prefixed byte slice, appending its encoding
+// to r.buf. The returned slice aliases r.buf.
+func (r *Reader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, r.truncated(err)
+	}
+	var tmp [binary.MaxVarintLen64]byte
+	r.buf = append(r.buf, tmp[:binary.PutUvarint(tmp[:], n)]...)
+	start := len(r.buf)
+	// Read in chunks so that a corrupt length does not cause a large
+	// allocation before the stream is found to be truncated.
+	for remaining := n; remaining > 0; {
+		chunk := remaining
+		if chunk > readChunkSize {
+			chunk = readChunkSize
+		}
+		m := len(r.buf)
+		r.buf = append(r.buf, make([]byte, chunk)...)
+		if _, err := io.ReadFull(r.r, r.buf[m:]); err != nil {
+			return nil, r.truncated(err)
+		}
+		remaining -= chunk
+	}
+	return r.buf[start:], nil
+}
+
+// readChecksum reads a checksum and verifies it against the checksum of
+// r.buf.
+func (r *Reader) readChecksum() error {
+	var tmp [4]byte
+	if _, err := io.ReadFull(r.r, tmp[:]); err != nil {
+		return r.truncated(err)
+	}
+	if binary.LittleEndian.Uint32(tmp[:]) != crc.New(r.buf).Value() {
+		return corruptf("checksum mismatch after %d records", r.count)
+	}
+	return nil
+}
+
+func (r *Reader) readLine() (string, error) {
+	line, err := r.r.ReadString('\n')
+	if err != nil {
+		return "", r.truncated(err)
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func (r *Reader) truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return corruptf("truncated stream after %d records", r.count)
+	}
+	return err
+}
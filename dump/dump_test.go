@@ -0,0 +1,179 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+type testRecord struct {
+	key, value string
+}
+
+var testRecords = []testRecord{
+	{"", "empty key"},
+	{"a", ""},
+	{"b", "value b"},
+	{"c d", "value\nwith\nnewlines"},
+	{string(bytes.Repeat([]byte("k"), 1000)), string(bytes.Repeat([]byte("v"), 100000))},
+}
+
+func writeTestStream(t *testing.T, format Format, records []testRecord) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, "test-comparer")
+	require.NoError(t, err)
+	for _, r := range records {
+		require.NoError(t, w.Add([]byte(r.key), []byte(r.value)))
+	}
+	require.Equal(t, uint64(len(records)), w.Count())
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func readTestStream(data []byte) ([]testRecord, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var records []testRecord
+	for {
+		key, value, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, testRecord{string(key), string(value)})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{Binary, Text} {
+		t.Run(format.String(), func(t *testing.T) {
+			for _, records := range [][]testRecord{nil, testRecords} {
+				data := writeTestStream(t, format, records)
+				r, err := NewReader(bytes.NewReader(data))
+				require.NoError(t, err)
+				require.Equal(t, format, r.Format())
+				require.Equal(t, "test-comparer", r.ComparerName())
+
+				read, err := readTestStream(data)
+				require.NoError(t, err)
+				require.Equal(t, records, read)
+			}
+		})
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	data := writeTestStream(t, Text, testRecords[:3])
+	require.Equal(t, `pebble-dump v1 test-comparer
+ 656d707479206b6579 a7634b83
+61  3f643193
+62 76616c75652062 95567caa
+end 3
+`, string(data))
+}
+
+func TestCorruption(t *testing.T) {
+	for _, format := range []Format{Binary, Text} {
+		t.Run(format.String(), func(t *testing.T) {
+			data := writeTestStream(t, format, testRecords[:4])
+
+			// Every truncation of the stream must be detected.
+			for i := 0; i < len(data); i++ {
+				_, err := readTestStream(data[:i])
+				require.Error(t, err, "truncated to %d bytes", i)
+				if i > 0 {
+					require.True(t, errors.Is(err, ErrCorrupt), "truncated to %d bytes: %v", i, err)
+				}
+			}
+
+			// Every modification of a byte must be detected, except in the
+			// text header, which is not checksummed.
+			start := 0
+			if format == Text {
+				start = bytes.IndexByte(data, '\n') + 1
+			}
+			for i := start; i < len(data); i++ {
+				corrupt := append([]byte(nil), data...)
+				corrupt[i] ^= 0x01
+				records, err := readTestStream(corrupt)
+				require.Error(t, err, "modified byte %d: %v", i, records)
+			}
+		})
+	}
+}
+
+func TestDumpLoad(t *testing.T) {
+	mem := vfs.NewMem()
+	src, err := pebble.Open("src", &pebble.Options{FS: mem})
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, src.Set([]byte(fmt.Sprintf("%04d", i)), []byte(fmt.Sprint(i)), nil))
+	}
+	snap := src.NewSnapshot()
+	// Writes after the snapshot are not dumped.
+	require.NoError(t, src.Set([]byte("0100"), []byte("after snapshot"), nil))
+
+	for _, format := range []Format{Binary, Text} {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, format, pebble.DefaultComparer.Name)
+			require.NoError(t, err)
+			require.NoError(t, Dump(snap, []byte("0100"), []byte("0900"), w))
+			require.NoError(t, w.Close())
+			require.Equal(t, uint64(800), w.Count())
+
+			opts := &pebble.Options{FS: mem}
+			dst, err := pebble.Open("dst-"+format.String(), opts)
+			require.NoError(t, err)
+			r, err := NewReader(&buf)
+			require.NoError(t, err)
+			var progress []uint64
+			n, err := Load(dst, opts, r, LoadOptions{
+				TempDir:        "tmp",
+				TargetFileSize: 4096,
+				Progress:       func(records uint64) { progress = append(progress, records) },
+			})
+			require.NoError(t, err)
+			require.Equal(t, uint64(800), n)
+			require.True(t, len(progress) > 1)
+			require.Equal(t, uint64(800), progress[len(progress)-1])
+			_, err = mem.Stat("tmp")
+			require.Error(t, err)
+
+			iter := dst.NewIter(nil)
+			i := 100
+			for valid := iter.First(); valid; valid = iter.Next() {
+				require.Equal(t, fmt.Sprintf("%04d", i), string(iter.Key()))
+				require.Equal(t, fmt.Sprint(i), string(iter.Value()))
+				i++
+			}
+			require.NoError(t, iter.Close())
+			require.Equal(t, 900, i)
+			require.NoError(t, dst.Close())
+		})
+	}
+
+	// A stream ordered by a different comparer cannot be loaded.
+	data := writeTestStream(t, Binary, nil)
+	r, err := NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	opts := &pebble.Options{FS: mem}
+	_, err = Load(src, opts, r, LoadOptions{TempDir: "tmp"})
+	require.Regexp(t, `comparer name from stream "test-comparer"`, err)
+
+	require.NoError(t, snap.Close())
+	require.NoError(t, src.Close())
+}
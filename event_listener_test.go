@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -373,3 +374,78 @@ func TestEventListenerRedact(t *testing.T) {
 	})
 	require.Equal(t, "[JOB 5] WAL delete error: ‹×›\n", log.String())
 }
+
+// stallingFS is an FS whose files block in Sync while stall is set.
+type stallingFS struct {
+	vfs.FS
+	stall   *int32
+	unblock chan struct{}
+}
+
+func (fs stallingFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return stallingFile{File: f, fs: fs}, nil
+}
+
+type stallingFile struct {
+	vfs.File
+	fs stallingFS
+}
+
+func (f stallingFile) Sync() error {
+	if atomic.LoadInt32(f.fs.stall) == 1 {
+		<-f.fs.unblock
+	}
+	return f.File.Sync()
+}
+
+func TestEventListenerDiskSlow(t *testing.T) {
+	var stall int32
+	fs := stallingFS{FS: vfs.NewMem(), stall: &stall, unblock: make(chan struct{})}
+	slowCh := make(chan DiskSlowInfo, 1)
+	stallCh := make(chan DiskSlowInfo, 1)
+	d, err := Open("db", &Options{
+		FS: fs,
+		EventListener: EventListener{
+			DiskSlow: func(info DiskSlowInfo) {
+				select {
+				case slowCh <- info:
+				default:
+				}
+			},
+		},
+		DiskSlowThreshold:  10 * time.Millisecond,
+		DiskStallThreshold: 50 * time.Millisecond,
+		DiskStallHandler: func(info DiskSlowInfo) {
+			select {
+			case stallCh <- info:
+			default:
+			}
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	atomic.StoreInt32(&stall, 1)
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Set([]byte("a"), nil, Sync) }()
+
+	for _, ch := range []chan DiskSlowInfo{slowCh, stallCh} {
+		select {
+		case info := <-ch:
+			require.Equal(t, "db/000002.log", info.Path)
+			require.Contains(t, info.String(), "disk slowness detected: operation on file db/000002.log")
+		case <-time.After(10 * time.Second):
+			t.Fatalf("disk slowness not reported")
+		}
+	}
+
+	atomic.StoreInt32(&stall, 0)
+	close(fs.unblock)
+	require.NoError(t, <-errCh)
+}
@@ -0,0 +1,356 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// ExportFilename is the name of the file in an export directory which records
+// the sstables written by DB.Export.
+const ExportFilename = "EXPORT"
+
+// ExportOptions holds the optional parameters for DB.Export.
+type ExportOptions struct {
+	// IncludeRangeDeletions adds a range deletion to each exported sstable
+	// spanning the sstable's portion of the exported key range. Ingesting the
+	// sstables then also removes any keys in the range which are not present
+	// in the export, making the range in the destination an exact copy of the
+	// range in the source. Requires a non-nil end key.
+	IncludeRangeDeletions bool
+
+	// Progress, if non-nil, is invoked after each sstable is written.
+	Progress func(ExportedFile)
+}
+
+// ExportedFile describes an sstable written by DB.Export.
+type ExportedFile struct {
+	// Path is the path of the sstable.
+	Path string
+	// Start and End are the inclusive-exclusive bounds of the portion of the
+	// exported key range covered by the sstable. A nil End is unbounded.
+	Start, End []byte
+	// Keys is the number of keys in the sstable.
+	Keys uint64
+	// Size is the size of the sstable in bytes.
+	Size uint64
+}
+
+// Export writes the keys in the range [start, end) as of a consistent
+// snapshot of the DB to sstables in dir, suitable for passing to DB.Ingest.
+// The sstables are written in key order, each being finished once it reaches
+// targetFileSize bytes, and hold user keys only: the value of each key is the
+// value visible to an Iterator. A nil start or end leaves the range unbounded.
+//
+// Export is resumable: the sstables are recorded in dir as they are written,
+// and calling Export again with the same key range and dir continues after the
+// last sstable written. Note that a resumed export reads the keys which
+// remain from a new snapshot. Export returns all of the sstables in the
+// export, including those written by earlier calls.
+func (d *DB) Export(
+	start, end []byte, dir string, targetFileSize int64, opts *ExportOptions,
+) ([]ExportedFile, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	if opts.IncludeRangeDeletions && end == nil {
+		return nil, errors.New("pebble: export with range deletions requires an end key")
+	}
+	if start != nil && end != nil && d.cmp(start, end) >= 0 {
+		return nil, errors.Errorf("pebble: export start key %s is not less than end key %s",
+			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
+	}
+	if targetFileSize <= 0 {
+		targetFileSize = d.opts.Level(0).TargetFileSize
+	}
+
+	fs := d.opts.FS
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	e := &exporter{fs: fs, dir: dir, start: start, end: end}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	if e.done {
+		return e.files, nil
+	}
+
+	// Continue after the last sstable written by an earlier call.
+	fileStart := start
+	if n := len(e.files); n > 0 {
+		fileStart = e.files[n-1].End
+		if fileStart == nil || (end != nil && d.cmp(fileStart, end) >= 0) {
+			// The last sstable reached the end of the range.
+			return e.files, e.finish()
+		}
+	}
+
+	snap := d.NewSnapshot()
+	defer snap.Close()
+	iter := snap.NewIter(&IterOptions{LowerBound: fileStart, UpperBound: end})
+	valid := iter.First()
+	// With range deletions, sstables are written until the range is covered
+	// even if no keys remain.
+	for valid || (opts.IncludeRangeDeletions && d.cmp(fileStart, end) < 0) {
+		f, err := e.writeFile(d, iter, &valid, fileStart, targetFileSize, opts.IncludeRangeDeletions)
+		if err != nil {
+			_ = iter.Close()
+			return nil, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(f)
+		}
+		fileStart = f.End
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return e.files, e.finish()
+}
+
+// exporter tracks the state of an export directory.
+type exporter struct {
+	fs         vfs.FS
+	dir        string
+	start, end []byte
+	files      []ExportedFile
+	done       bool
+}
+
+// load reads the sstables recorded by an earlier export to the directory, if
+// any, verifying that the earlier export was of the same key range.
+func (e *exporter) load() error {
+	files, done, start, end, err := readExport(e.fs, e.dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Equal(start, e.start) || !bytes.Equal(end, e.end) {
+		return errors.Errorf("pebble: export directory %q holds an export of a different key range", e.dir)
+	}
+	e.files, e.done = files, done
+	return nil
+}
+
+// writeFile writes the keys from iter, starting at its current position, to
+// the next sstable of the export, stopping after the sstable reaches
+// targetFileSize bytes. The sstable covers the range from start to the key
+// at which iter stops, or the end of the export if iter is exhausted. The
+// sstable is written to a temporary file which is renamed once the sstable
+// is complete, and removed if an error occurs.
+func (e *exporter) writeFile(
+	d *DB, iter *Iterator, valid *bool, start []byte, targetFileSize int64, rangeDels bool,
+) (_ ExportedFile, retErr error) {
+	name := fmt.Sprintf("%06d.sst", len(e.files)+1)
+	f := ExportedFile{
+		Path:  e.fs.PathJoin(e.dir, name),
+		Start: append([]byte(nil), start...),
+	}
+	tmpPath := f.Path + ".tmp"
+	file, err := e.fs.Create(tmpPath)
+	if err != nil {
+		return ExportedFile{}, err
+	}
+	defer func() {
+		if retErr != nil {
+			_ = e.fs.Remove(tmpPath)
+		}
+	}()
+	w := sstable.NewWriter(file, d.opts.MakeWriterOptions(0))
+	for *valid {
+		if err := w.Set(iter.Key(), iter.Value()); err != nil {
+			_ = w.Close()
+			return ExportedFile{}, err
+		}
+		f.Keys++
+		*valid = iter.Next()
+		if w.EstimatedSize() >= uint64(targetFileSize) {
+			break
+		}
+	}
+	if err := iter.Error(); err != nil {
+		_ = w.Close()
+		return ExportedFile{}, err
+	}
+	if *valid {
+		f.End = append([]byte(nil), iter.Key()...)
+	} else if e.end != nil {
+		f.End = append([]byte(nil), e.end...)
+	}
+	if rangeDels {
+		if err := w.DeleteRange(f.Start, f.End); err != nil {
+			_ = w.Close()
+			return ExportedFile{}, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return ExportedFile{}, err
+	}
+	meta, err := w.Metadata()
+	if err != nil {
+		return ExportedFile{}, err
+	}
+	f.Size = meta.Size
+	if err := e.fs.Rename(tmpPath, f.Path); err != nil {
+		return ExportedFile{}, err
+	}
+
+	e.files = append(e.files, f)
+	if err := e.writeManifest(); err != nil {
+		return ExportedFile{}, err
+	}
+	return f, nil
+}
+
+// finish marks the export as complete.
+func (e *exporter) finish() error {
+	e.done = true
+	return e.writeManifest()
+}
+
+// writeManifest atomically replaces the EXPORT file with one recording the
+// current state of the export. The format of the file is:
+//
+//   range <start> <end>
+//   file <name> <start> <end> <keys> <size>
+//   ...
+//   done
+//
+// where keys are hex encoded, and "-" denotes a nil or empty key. The final
+// "done" line is only present once the export is complete.
+func (e *exporter) writeManifest() error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "range %s %s\n", encodeExportKey(e.start), encodeExportKey(e.end))
+	for _, f := range e.files {
+		fmt.Fprintf(&buf, "file %s %s %s %d %d\n", e.fs.PathBase(f.Path),
+			encodeExportKey(f.Start), encodeExportKey(f.End), f.Keys, f.Size)
+	}
+	if e.done {
+		fmt.Fprintf(&buf, "done\n")
+	}
+
+	path := e.fs.PathJoin(e.dir, ExportFilename)
+	tmpPath := path + ".tmp"
+	file, err := e.fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := e.fs.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	dir, err := e.fs.OpenDir(e.dir)
+	if err != nil {
+		return err
+	}
+	if err := dir.Sync(); err != nil {
+		_ = dir.Close()
+		return err
+	}
+	return dir.Close()
+}
+
+// ReadExport returns the sstables recorded in an export directory written by
+// DB.Export, and whether the export is complete.
+func ReadExport(fs vfs.FS, dir string) (files []ExportedFile, done bool, err error) {
+	files, done, _, _, err = readExport(fs, dir)
+	return files, done, err
+}
+
+func readExport(
+	fs vfs.FS, dir string,
+) (files []ExportedFile, done bool, start, end []byte, err error) {
+	f, err := fs.Open(fs.PathJoin(dir, ExportFilename))
+	if err != nil {
+		return nil, false, nil, nil, err
+	}
+	defer f.Close()
+
+	corrupt := func(line string) error {
+		return errors.Errorf("pebble: corrupt %s file in %q: %q", ExportFilename, dir, line)
+	}
+	s := bufio.NewScanner(f)
+	var haveRange bool
+	for s.Scan() {
+		line := s.Text()
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "range" && !haveRange:
+			if start, err = decodeExportKey(fields[1]); err != nil {
+				return nil, false, nil, nil, corrupt(line)
+			}
+			if end, err = decodeExportKey(fields[2]); err != nil {
+				return nil, false, nil, nil, corrupt(line)
+			}
+			haveRange = true
+		case len(fields) == 6 && fields[0] == "file" && haveRange && !done:
+			ef := ExportedFile{Path: fs.PathJoin(dir, fields[1])}
+			ef.Start, err = decodeExportKey(fields[2])
+			if err == nil {
+				ef.End, err = decodeExportKey(fields[3])
+			}
+			if err == nil {
+				ef.Keys, err = strconv.ParseUint(fields[4], 10, 64)
+			}
+			if err == nil {
+				ef.Size, err = strconv.ParseUint(fields[5], 10, 64)
+			}
+			if err != nil {
+				return nil, false, nil, nil, corrupt(line)
+			}
+			files = append(files, ef)
+		case len(fields) == 1 && fields[0] == "done" && haveRange:
+			done = true
+		default:
+			return nil, false, nil, nil, corrupt(line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, false, nil, nil, err
+	}
+	if !haveRange {
+		return nil, false, nil, nil, corrupt("")
+	}
+	return files, done, start, end, nil
+}
+
+func encodeExportKey(key []byte) string {
+	if len(key) == 0 {
+		return "-"
+	}
+	return hex.EncodeToString(key)
+}
+
+func decodeExportKey(s string) ([]byte, error) {
+	if s == "-" {
+		return nil, nil
+	}
+	return hex.DecodeString(s)
+}
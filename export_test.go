@@ -0,0 +1,194 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/errorfs"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func exportTestKeys(t *testing.T, d *DB) string {
+	var buf bytes.Buffer
+	iter := d.NewIter(nil)
+	for valid := iter.First(); valid; valid = iter.Next() {
+		fmt.Fprintf(&buf, "%s:%s ", iter.Key(), iter.Value())
+	}
+	require.NoError(t, iter.Close())
+	return strings.TrimSpace(buf.String())
+}
+
+func exportTestPaths(files []ExportedFile) []string {
+	paths := make([]string, len(files))
+	for i := range files {
+		paths[i] = files[i].Path
+	}
+	return paths
+}
+
+func TestExport(t *testing.T) {
+	mem := vfs.NewMem()
+	src, err := Open("src", &Options{FS: mem})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, src.Set([]byte(fmt.Sprintf("%03d", i)), bytes.Repeat([]byte("v"), 100), nil))
+	}
+	require.NoError(t, src.Delete([]byte("050"), nil))
+	require.NoError(t, src.Flush())
+	require.NoError(t, src.Set([]byte("020"), []byte("new"), nil))
+
+	for _, rangeDels := range []bool{false, true} {
+		t.Run(fmt.Sprintf("range-dels=%t", rangeDels), func(t *testing.T) {
+			dir := fmt.Sprintf("export-%t", rangeDels)
+			var progress []ExportedFile
+			files, err := src.Export([]byte("010"), []byte("060"), dir, 1024, &ExportOptions{
+				IncludeRangeDeletions: rangeDels,
+				Progress:              func(f ExportedFile) { progress = append(progress, f) },
+			})
+			require.NoError(t, err)
+			require.True(t, len(files) > 1)
+			require.Equal(t, files, progress)
+			var keys uint64
+			for i := range files {
+				keys += files[i].Keys
+				if i > 0 {
+					require.Equal(t, files[i-1].End, files[i].Start)
+				}
+			}
+			require.Equal(t, uint64(49), keys)
+			require.Equal(t, "010", string(files[0].Start))
+			require.Equal(t, "060", string(files[len(files)-1].End))
+
+			readFiles, done, err := ReadExport(mem, dir)
+			require.NoError(t, err)
+			require.True(t, done)
+			require.Equal(t, files, readFiles)
+
+			// Ingest the export into a DB holding a key inside the exported
+			// range, which is only removed if range deletions were included.
+			dst, err := Open("dst-"+dir, &Options{FS: mem})
+			require.NoError(t, err)
+			require.NoError(t, dst.Set([]byte("050"), []byte("stale"), nil))
+			require.NoError(t, dst.Set([]byte("100"), []byte("outside"), nil))
+			require.NoError(t, dst.Ingest(exportTestPaths(files)))
+
+			v, closer, err := dst.Get([]byte("020"))
+			require.NoError(t, err)
+			require.Equal(t, "new", string(v))
+			require.NoError(t, closer.Close())
+			_, _, err = dst.Get([]byte("060"))
+			require.Equal(t, ErrNotFound, err)
+			v, closer, err = dst.Get([]byte("050"))
+			if rangeDels {
+				require.Equal(t, ErrNotFound, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, "stale", string(v))
+				require.NoError(t, closer.Close())
+			}
+			v, closer, err = dst.Get([]byte("100"))
+			require.NoError(t, err)
+			require.Equal(t, "outside", string(v))
+			require.NoError(t, closer.Close())
+			require.NoError(t, dst.Close())
+		})
+	}
+	require.NoError(t, src.Close())
+}
+
+func TestExportResume(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	defer d.Close()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), bytes.Repeat([]byte("v"), 100), nil))
+	}
+
+	files, err := d.Export(nil, nil, "export", 2048, nil)
+	require.NoError(t, err)
+	require.True(t, len(files) > 2)
+	require.Nil(t, files[len(files)-1].End)
+
+	// Simulate an export interrupted after writing its second file.
+	f, err := mem.Open(mem.PathJoin("export", ExportFilename))
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	lines := strings.SplitAfter(string(data), "\n")
+	f, err = mem.Create(mem.PathJoin("export", ExportFilename))
+	require.NoError(t, err)
+	_, err = f.Write([]byte(strings.Join(lines[:3], "")))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	partial, done, err := ReadExport(mem, "export")
+	require.NoError(t, err)
+	require.False(t, done)
+	require.Equal(t, files[:2], partial)
+
+	resumed, err := d.Export(nil, nil, "export", 2048, nil)
+	require.NoError(t, err)
+	require.Equal(t, files, resumed)
+
+	// A different key range cannot resume the export.
+	_, err = d.Export([]byte("a"), nil, "export", 2048, nil)
+	require.Regexp(t, "holds an export of a different key range", err)
+
+	_, err = d.Export(nil, nil, "export-2", 2048, &ExportOptions{IncludeRangeDeletions: true})
+	require.Regexp(t, "requires an end key", err)
+}
+
+func TestExportErrors(t *testing.T) {
+	mem := vfs.NewMem()
+	inj := errorfs.OnIndex(-1)
+	d, err := Open("", &Options{FS: errorfs.Wrap(mem, inj)})
+	require.NoError(t, err)
+	defer d.Close()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), bytes.Repeat([]byte("v"), 100), nil))
+	}
+	require.NoError(t, d.Flush())
+
+	// Inject an error into each successive filesystem operation of the export
+	// until it succeeds. A failed export must not leave behind a partially
+	// written sstable.
+	for i := int32(0); ; i++ {
+		dir := fmt.Sprintf("export-%d", i)
+		inj.SetIndex(i)
+		_, err := d.Export(nil, nil, dir, 2048, nil)
+		inj.SetIndex(-1)
+
+		names, listErr := mem.List(dir)
+		if !os.IsNotExist(listErr) {
+			require.NoError(t, listErr)
+		}
+		for _, name := range names {
+			require.False(t, strings.HasSuffix(name, ".sst.tmp"), "index %d: %s", i, name)
+			if !strings.HasSuffix(name, ".sst") {
+				continue
+			}
+			f, openErr := mem.Open(mem.PathJoin(dir, name))
+			require.NoError(t, openErr)
+			r, openErr := sstable.NewReader(f, sstable.ReaderOptions{})
+			require.NoError(t, openErr, "index %d: %s", i, name)
+			require.NoError(t, r.Close())
+		}
+		if err == nil {
+			require.True(t, i > 0)
+			break
+		}
+		require.True(t, errors.Is(err, errorfs.ErrInjected), "index %d: %v", i, err)
+	}
+}
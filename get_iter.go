@@ -130,9 +130,20 @@ func (g *getIter) Next() (*InternalKey, []byte) {
 		// Create iterators from memtables from newest to oldest.
 		if n := len(g.mem); n > 0 {
 			m := g.mem[n-1]
+			g.mem = g.mem[:n-1]
+			if mem, ok := m.flushable.(*memTable); ok && !mem.mayContain(g.key) {
+				// The memtable's filter shows that it contains no point records
+				// for the key, so it doesn't need to be seeked. Its range
+				// tombstones may still delete the key in older memtables and
+				// levels, and are checked using an empty point iterator.
+				if g.rangeDelIter = m.newRangeDelIter(nil); g.rangeDelIter != nil {
+					g.iter = emptyIter
+					g.iterKey, g.iterValue = nil, nil
+				}
+				continue
+			}
 			g.iter = m.newIter(nil)
 			g.rangeDelIter = m.newRangeDelIter(nil)
-			g.mem = g.mem[:n-1]
 			g.iterKey, g.iterValue = g.iter.SeekGE(g.key)
 			continue
 		}
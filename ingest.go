@@ -81,6 +81,8 @@ func ingestLoad1(
 	// calculating stats before we can remove the original link.
 	if r.Properties.NumRangeDeletions == 0 {
 		meta.Stats.Valid = true
+		meta.Stats.NumEntries = r.Properties.NumEntries
+		meta.Stats.NumDeletions = r.Properties.NumDeletions
 		meta.Stats.RangeDeletionsBytesEstimate = 0
 	}
 
@@ -228,15 +230,22 @@ func ingestCleanup(fs vfs.FS, dirname string, meta []*fileMetadata) error {
 }
 
 func ingestLink(
-	jobID int, opts *Options, dirname string, paths []string, meta []*fileMetadata,
+	jobID int,
+	opts *Options,
+	limiter *writeLimiter,
+	dirname string,
+	paths []string,
+	meta []*fileMetadata,
 ) error {
 	// Wrap the normal filesystem with one which wraps newly created files with
-	// vfs.NewSyncingFile.
+	// vfs.NewSyncingFile. Copies are subject to the write bandwidth limit.
 	fs := syncingFS{
 		FS: opts.FS,
 		syncOpts: vfs.SyncingFileOptions{
 			BytesPerSync: opts.BytesPerSync,
 		},
+		limiter:  limiter,
+		priority: writePriorityCopy,
 	}
 
 	for i := range paths {
@@ -537,7 +546,7 @@ func (d *DB) Ingest(paths []string) error {
 	// (e.g. because the files reside on a different filesystem), ingestLink will
 	// fall back to copying, and if that fails we undo our work and return an
 	// error.
-	if err := ingestLink(jobID, d.opts, d.dirname, paths, meta); err != nil {
+	if err := ingestLink(jobID, d.opts, d.writeLimiter, d.dirname, paths, meta); err != nil {
 		return err
 	}
 	// Fsync the directory we added the tables to. We need to do this at some
@@ -29,4 +29,10 @@ const (
 // InternalKey exports the base.InternalKey type.
 type InternalKey = base.InternalKey
 
+// InternalIteratorStats exports the base.InternalIteratorStats type.
+type InternalIteratorStats = base.InternalIteratorStats
+
+// InternalIterator exports the base.InternalIterator type.
+type InternalIterator = base.InternalIterator
+
 type internalIterator = base.InternalIterator
@@ -67,6 +67,21 @@ func (a *Arena) Capacity() uint32 {
 	return uint32(len(a.buf))
 }
 
+// Alloc allocates a buffer of the specified size from the arena, returning
+// its offset within the arena. The buffer is not aligned, and is accessed
+// using Bytes. ErrArenaFull is returned if the arena does not have enough
+// space remaining. Alloc is thread-safe.
+func (a *Arena) Alloc(size uint32) (uint32, error) {
+	offset, _, err := a.alloc(size, 0, 0)
+	return offset, err
+}
+
+// Bytes returns the buffer of the specified size at the specified offset,
+// which must have been allocated by Alloc.
+func (a *Arena) Bytes(offset, size uint32) []byte {
+	return a.buf[offset : offset+size : offset+size]
+}
+
 func (a *Arena) alloc(size, align, overflow uint32) (uint32, uint32, error) {
 	// Verify that the arena isn't already full.
 	origSize := atomic.LoadUint64(&a.n)
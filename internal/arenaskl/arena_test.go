@@ -50,3 +50,23 @@ func TestArenaSizeOverflow(t *testing.T) {
 	require.Equal(t, ErrArenaFull, err)
 	require.Equal(t, uint32(math.MaxUint32), a.Size())
 }
+
+func TestArenaAlloc(t *testing.T) {
+	a := newArena(16)
+
+	offset, err := a.Alloc(5)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), offset)
+	require.Equal(t, uint32(6), a.Size())
+	b := a.Bytes(offset, 5)
+	require.Equal(t, 5, len(b))
+	require.Equal(t, 5, cap(b))
+
+	offset, err = a.Alloc(0)
+	require.NoError(t, err)
+	require.Equal(t, uint32(6), offset)
+	require.Equal(t, 0, len(a.Bytes(offset, 0)))
+
+	_, err = a.Alloc(11)
+	require.Equal(t, ErrArenaFull, err)
+}
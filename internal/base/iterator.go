@@ -166,3 +166,45 @@ type InternalIterator interface {
 
 	fmt.Stringer
 }
+
+// InternalIteratorStats contains statistics accumulated by internal iterators
+// while they are positioned. The counters are not synchronized, so a set of
+// stats must only be updated by the iterators of a single top-level iterator.
+type InternalIteratorStats struct {
+	// The number of times the iterators were positioned by a seek.
+	Seeks uint64
+	// The number of sstable data blocks loaded, and the number of those blocks
+	// which were found in the block cache.
+	BlocksLoaded uint64
+	BlocksCached uint64
+	// The number of bytes in the sstable data blocks loaded, and the number of
+	// those bytes read from disk because the blocks were not in the block
+	// cache. Both count the blocks' on-disk (compressed) sizes.
+	BlockBytes     uint64
+	BlockBytesRead uint64
+	// The number of times an sstable filter was consulted by a prefix seek and
+	// showed the table does not contain the prefix (a hit), or may contain it
+	// (a miss).
+	FilterHits   uint64
+	FilterMisses uint64
+	// The number of point keys skipped over because they were deleted by a
+	// point deletion, including the deletion tombstones themselves.
+	PointsDeleted uint64
+	// The number of point keys found to be deleted by a range deletion. Keys
+	// which are skipped by seeking past a range deletion are not counted
+	// individually.
+	RangeDeleted uint64
+}
+
+// Merge adds the stats in from to s.
+func (s *InternalIteratorStats) Merge(from InternalIteratorStats) {
+	s.Seeks += from.Seeks
+	s.BlocksLoaded += from.BlocksLoaded
+	s.BlocksCached += from.BlocksCached
+	s.BlockBytes += from.BlockBytes
+	s.BlockBytesRead += from.BlockBytesRead
+	s.FilterHits += from.FilterHits
+	s.FilterMisses += from.FilterMisses
+	s.PointsDeleted += from.PointsDeleted
+	s.RangeDeleted += from.RangeDeleted
+}
@@ -4,6 +4,11 @@
 
 package base
 
+import (
+	"strconv"
+	"strings"
+)
+
 // SSTable block defaults.
 const (
 	DefaultBlockRestartInterval = 16
@@ -63,3 +68,64 @@ type FilterPolicy interface {
 	// NewWriter creates a new FilterWriter.
 	NewWriter(ftype FilterType) FilterWriter
 }
+
+// PrefixExtractor extracts a prefix from a user key. When configured on an
+// sstable writer, the extracted prefixes are added to the table's filter in
+// addition to the keys (or Comparer.Split prefixes) that are normally added,
+// which allows iterators whose bounds share a common prefix to skip tables
+// that do not contain that prefix.
+//
+// All keys with the same prefix must be contiguous in the key ordering, and a
+// key's prefix must sort at or before the key itself. Readers additionally
+// assume that the keys with a prefix sort before the prefix incremented as a
+// byte string, so prefixes are only used to skip tables written with the
+// bytewise DefaultComparer. Tables written with other comparers are never
+// skipped.
+//
+// Every PrefixExtractor has a name which is recorded in the sstable
+// properties. A filter is only consulted for a prefix if the extractor named
+// in the table's properties is known to the reader.
+type PrefixExtractor interface {
+	// Name names the prefix extractor.
+	Name() string
+
+	// Prefix returns the prefix of the specified key. If the key is not in
+	// the domain of the extractor (for example, it is too short), ok is false.
+	Prefix(key []byte) (prefix []byte, ok bool)
+}
+
+// fixedPrefixExtractorName is the prefix of the name of fixed-length prefix
+// extractors. The length of the prefix is appended to the name.
+const fixedPrefixExtractorName = "pebble.FixedPrefix."
+
+// FixedPrefixExtractor is a PrefixExtractor which extracts the first N bytes
+// of a key. Keys shorter than N bytes are not in the domain of the extractor.
+type FixedPrefixExtractor int
+
+var _ PrefixExtractor = FixedPrefixExtractor(0)
+
+// Name implements the PrefixExtractor interface.
+func (e FixedPrefixExtractor) Name() string {
+	return fixedPrefixExtractorName + strconv.Itoa(int(e))
+}
+
+// Prefix implements the PrefixExtractor interface.
+func (e FixedPrefixExtractor) Prefix(key []byte) ([]byte, bool) {
+	if len(key) < int(e) {
+		return nil, false
+	}
+	return key[:e], true
+}
+
+// ParseFixedPrefixExtractor parses the name of a FixedPrefixExtractor,
+// returning false if the name does not name a FixedPrefixExtractor.
+func ParseFixedPrefixExtractor(name string) (FixedPrefixExtractor, bool) {
+	if !strings.HasPrefix(name, fixedPrefixExtractorName) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[len(fixedPrefixExtractorName):])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return FixedPrefixExtractor(n), true
+}
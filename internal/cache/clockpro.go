@@ -122,7 +122,9 @@ func (c *shard) Get(id uint64, fileNum base.FileNum, offset uint64) Handle {
 	return Handle{value: value}
 }
 
-func (c *shard) Set(id uint64, fileNum base.FileNum, offset uint64, value *Value) Handle {
+func (c *shard) Set(
+	id uint64, fileNum base.FileNum, offset uint64, value *Value, pri Priority,
+) Handle {
 	if n := value.refs(); n != 1 {
 		panic(fmt.Sprintf("pebble: Value has already been added to the cache: refs=%d", n))
 	}
@@ -138,13 +140,21 @@ func (c *shard) Set(id uint64, fileNum base.FileNum, offset uint64, value *Value
 		// no cache entry? add it
 		e = newEntry(c, k, int64(len(value.buf)))
 		e.setValue(value)
-		if c.metaAdd(k, e) {
-			value.ref.trace("add-cold")
-			c.sizeCold += e.size
-		} else {
+		if pri == HighPriority {
+			// High priority entries start out hot, which requires the hot hand
+			// to sweep past them before they become candidates for eviction.
+			e.ptype = etHot
+		}
+		if !c.metaAdd(k, e) {
 			value.ref.trace("skip-cold")
 			e.free()
 			e = nil
+		} else if e.ptype == etHot {
+			value.ref.trace("add-hot")
+			c.sizeHot += e.size
+		} else {
+			value.ref.trace("add-cold")
+			c.sizeCold += e.size
 		}
 
 	case e.peekValue() != nil:
@@ -474,6 +484,32 @@ func (c *shard) runHandTest() {
 	c.handTest = c.handTest.next()
 }
 
+// Priority is a hint provided when adding a value to the cache, indicating how
+// eagerly the value may be evicted relative to other values.
+type Priority int8
+
+const (
+	// NormalPriority values are added to the cache as cold pages. A cold page
+	// which is not accessed before the cold hand sweeps past it is evicted.
+	NormalPriority Priority = iota
+	// HighPriority values are added to the cache as hot pages. Hot pages are
+	// only demoted to cold pages once the hot hand sweeps past them without
+	// an intervening access, so they survive longer under memory pressure.
+	// This is intended for small blocks which are used to locate other blocks,
+	// such as the top-level index of a partitioned filter.
+	HighPriority
+)
+
+func (p Priority) String() string {
+	switch p {
+	case NormalPriority:
+		return "normal"
+	case HighPriority:
+		return "high"
+	}
+	return "unknown"
+}
+
 // Metrics holds metrics for the cache.
 type Metrics struct {
 	// The number of bytes inuse by the cache.
@@ -655,7 +691,15 @@ func (c *Cache) Get(id uint64, fileNum base.FileNum, offset uint64) Handle {
 // retrieval of the cached value than Get (lock-free and avoidance of the map
 // lookup). The value must have been allocated by Cache.Alloc.
 func (c *Cache) Set(id uint64, fileNum base.FileNum, offset uint64, value *Value) Handle {
-	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value)
+	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value, NormalPriority)
+}
+
+// SetWithPriority is like Set, but allows the caller to provide a hint about
+// the importance of the value. See Priority.
+func (c *Cache) SetWithPriority(
+	id uint64, fileNum base.FileNum, offset uint64, value *Value, pri Priority,
+) Handle {
+	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value, pri)
 }
 
 // Delete deletes the cached value for the specified file and offset.
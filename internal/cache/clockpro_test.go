@@ -132,6 +132,37 @@ func TestEvictAll(t *testing.T) {
 	cache.Set(1, 1, 0, testValue(cache, "a", 101)).Release()
 }
 
+func TestCachePriority(t *testing.T) {
+	for _, pri := range []Priority{NormalPriority, HighPriority} {
+		t.Run(fmt.Sprint(pri), func(t *testing.T) {
+			cache := newShards(100, 1)
+			defer cache.Unref()
+
+			for i := 0; i < 20; i++ {
+				cache.Set(1, 1, uint64(i), testValue(cache, "b", 10)).Release()
+			}
+			cache.SetWithPriority(1, 0, 0, testValue(cache, "a", 10), pri).Release()
+			// Scan through a number of blocks which are never accessed again.
+			for i := 20; i < 70; i++ {
+				cache.Set(1, 1, uint64(i), testValue(cache, "b", 10)).Release()
+			}
+			h := cache.Get(1, 0, 0)
+			defer h.Release()
+			// A high priority block survives the scan, while a normal priority
+			// block is evicted by it.
+			require.Equal(t, pri == HighPriority, h.Get() != nil)
+		})
+	}
+
+	// High priority blocks are still subject to eviction.
+	cache := newShards(100, 1)
+	defer cache.Unref()
+	for i := 0; i < 50; i++ {
+		cache.SetWithPriority(1, 0, uint64(i), testValue(cache, "a", 10), HighPriority).Release()
+		require.True(t, cache.Size() <= 100, "size %d", cache.Size())
+	}
+}
+
 func TestMultipleDBs(t *testing.T) {
 	cache := newShards(100, 1)
 	defer cache.Unref()
@@ -8,6 +8,7 @@ import (
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/vfs"
 	"golang.org/x/exp/rand"
 )
@@ -24,8 +25,11 @@ func parseOptions(opts *testOptions, data string) error {
 	hooks := &pebble.ParseHooks{
 		NewCache: pebble.NewCache,
 		NewFilterPolicy: func(name string) (pebble.FilterPolicy, error) {
-			if name == "none" {
+			switch name {
+			case "none":
 				return nil, nil
+			case ribbon.FilterPolicy(10).Name():
+				return ribbon.FilterPolicy(10), nil
 			}
 			return bloom.FilterPolicy(10), nil
 		},
@@ -165,6 +169,10 @@ func standardOptions() []*testOptions {
 		19: `
 [TestOptions]
   ingest_using_apply=true
+`,
+		20: `
+[Options]
+  mem_table_rep=pebble.vector
 `,
 	}
 
@@ -197,6 +205,15 @@ func randomOptions(rng *rand.Rand) *testOptions {
 	opts.MaxManifestFileSize = 1 << uint(rng.Intn(30)) // 1B  - 1GB
 	opts.MemTableSize = 1 << (10 + uint(rng.Intn(17))) // 1KB - 256MB
 	opts.MemTableStopWritesThreshold = 2 + rng.Intn(5) // 2 - 5
+	if rng.Intn(2) == 0 {
+		opts.MemTableRep = pebble.VectorMemTableRep
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.ParallelMemTableInsertThreshold = 1 << (7 + uint(rng.Intn(4))) // 128 - 1024
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.MemTableFilterSizeRatio = 0.001 * float64(1+rng.Intn(20)) // 0.001 - 0.02
+	}
 	if rng.Intn(2) == 0 {
 		opts.WALDir = "wal"
 	}
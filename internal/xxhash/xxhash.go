@@ -0,0 +1,148 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package xxhash implements the 64-bit variant of the xxHash algorithm
+// (XXH64), as described at https://github.com/Cyan4973/xxHash.
+//
+// RocksDB's kxxHash64 block checksum is the low 32 bits of the XXH64 hash of
+// the block data and block type, with a seed of 0.
+package xxhash // import "github.com/cockroachdb/pebble/internal/xxhash"
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// Digest computes the XXH64 hash of data written to it incrementally. The
+// zero value is a digest with a seed of 0.
+type Digest struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	mem            [32]byte
+	n              int // number of bytes buffered in mem
+	init           bool
+}
+
+// New returns the result of adding the bytes to a zero-seeded digest.
+func New(b []byte) *Digest {
+	d := &Digest{}
+	d.Write(b)
+	return d
+}
+
+func (d *Digest) reset() {
+	// NB: The initial accumulators rely on wrapping arithmetic, which is not
+	// permitted for constant expressions.
+	p1, p2 := prime1, prime2
+	d.v1 = p1 + p2
+	d.v2 = p2
+	d.v3 = 0
+	d.v4 = -p1
+	d.init = true
+}
+
+// Write adds more data to the running hash. It never returns an error.
+func (d *Digest) Write(b []byte) (int, error) {
+	if !d.init {
+		d.reset()
+	}
+	n := len(b)
+	d.total += uint64(n)
+
+	if d.n+n < 32 {
+		// Not enough data to process a full stripe.
+		copy(d.mem[d.n:], b)
+		d.n += n
+		return n, nil
+	}
+
+	if d.n > 0 {
+		// Complete the buffered stripe.
+		c := copy(d.mem[d.n:], b)
+		d.v1 = round(d.v1, binary.LittleEndian.Uint64(d.mem[0:8]))
+		d.v2 = round(d.v2, binary.LittleEndian.Uint64(d.mem[8:16]))
+		d.v3 = round(d.v3, binary.LittleEndian.Uint64(d.mem[16:24]))
+		d.v4 = round(d.v4, binary.LittleEndian.Uint64(d.mem[24:32]))
+		b = b[c:]
+		d.n = 0
+	}
+
+	for ; len(b) >= 32; b = b[32:] {
+		d.v1 = round(d.v1, binary.LittleEndian.Uint64(b[0:8]))
+		d.v2 = round(d.v2, binary.LittleEndian.Uint64(b[8:16]))
+		d.v3 = round(d.v3, binary.LittleEndian.Uint64(b[16:24]))
+		d.v4 = round(d.v4, binary.LittleEndian.Uint64(b[24:32]))
+	}
+	d.n = copy(d.mem[:], b)
+	return n, nil
+}
+
+// Sum64 returns the current hash.
+func (d *Digest) Sum64() uint64 {
+	if !d.init {
+		d.reset()
+	}
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) +
+			bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = mergeRound(h, d.v1)
+		h = mergeRound(h, d.v2)
+		h = mergeRound(h, d.v3)
+		h = mergeRound(h, d.v4)
+	} else {
+		h = d.v3 + prime5
+	}
+	h += d.total
+
+	b := d.mem[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		k1 := round(0, binary.LittleEndian.Uint64(b))
+		h ^= k1
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
+
+// Sum64 returns the XXH64 hash of b with a seed of 0.
+func Sum64(b []byte) uint64 {
+	var d Digest
+	d.Write(b)
+	return d.Sum64()
+}
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func mergeRound(acc, val uint64) uint64 {
+	val = round(0, val)
+	acc ^= val
+	return acc*prime1 + prime4
+}
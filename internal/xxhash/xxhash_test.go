@@ -0,0 +1,50 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package xxhash
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSum64(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"as", 0x1c330fb2d66be179},
+		{"asd", 0x631c37ce72a97393},
+		{"asdf", 0x415872f599cea71e},
+		{"Call me Ishmael. Some years ago--never mind how long precisely-", 0x02a2e85470d6fd96},
+	}
+	for _, c := range testCases {
+		t.Run(fmt.Sprintf("%q", c.input), func(t *testing.T) {
+			require.Equal(t, c.want, Sum64([]byte(c.input)))
+
+			// Writing the input in pieces must produce the same hash.
+			for i := 0; i <= len(c.input); i++ {
+				d := New([]byte(c.input[:i]))
+				d.Write([]byte(c.input[i:]))
+				require.Equal(t, c.want, d.Sum64())
+			}
+		})
+	}
+}
+
+func BenchmarkSum64(b *testing.B) {
+	for _, n := range []int{8, 64, 4096} {
+		buf := make([]byte, n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(n))
+			for i := 0; i < b.N; i++ {
+				Sum64(buf)
+			}
+		})
+	}
+}
@@ -6,9 +6,12 @@ package pebble
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/fastrand"
 )
 
 type iterPos int8
@@ -17,8 +20,47 @@ const (
 	iterPosCur  iterPos = 0
 	iterPosNext iterPos = 1
 	iterPosPrev iterPos = -1
+
+	// iterPosCurForwardPaused and iterPosCurReversePaused indicate that
+	// iteration stopped at a limit (see NextWithLimit and PrevWithLimit). The
+	// underlying iterator is positioned at an entry that has not been
+	// consumed: the newest entry of the first user key at or after the limit
+	// when paused in the forward direction, and the oldest entry of the first
+	// user key before the limit when paused in the reverse direction.
+	iterPosCurForwardPaused iterPos = 2
+	iterPosCurReversePaused iterPos = -2
+)
+
+// IterValidityState captures the state of an Iterator after a positioning
+// method that accepts a limit.
+type IterValidityState int8
+
+const (
+	// IterExhausted indicates that the iterator is exhausted, or that it
+	// encountered an error.
+	IterExhausted IterValidityState = iota
+	// IterValid indicates that the iterator is positioned at a valid
+	// key/value pair.
+	IterValid
+	// IterAtLimit indicates that the iterator reached the limit without
+	// finding a key/value pair. The iterator is not exhausted, and iteration
+	// may be resumed in either direction.
+	IterAtLimit
 )
 
+func (s IterValidityState) String() string {
+	switch s {
+	case IterExhausted:
+		return "exhausted"
+	case IterValid:
+		return "valid"
+	case IterAtLimit:
+		return "at-limit"
+	default:
+		return fmt.Sprintf("IterValidityState(%d)", int8(s))
+	}
+}
+
 var errReversePrefixIteration = errors.New("pebble: unsupported reverse prefix iteration")
 
 // IteratorMetrics holds per-iterator metrics.
@@ -28,6 +70,62 @@ type IteratorMetrics struct {
 	// amplification generally results in slower reads, though allowing higher
 	// read amplification can also result in faster writes.
 	ReadAmp int
+	// Stats holds the statistics accumulated by the iterator: the sum of
+	// MemTableStats and LevelStats, along with the point keys skipped by the
+	// iterator because of point deletions, which are not attributed to a
+	// level.
+	Stats InternalIteratorStats
+	// MemTableStats holds the statistics accumulated while iterating over the
+	// memtables, and the batch for an iterator created by Batch.NewIter.
+	MemTableStats InternalIteratorStats
+	// LevelStats holds the statistics accumulated while iterating over the
+	// sstables in each level of the LSM. The statistics of the L0 sublevels are
+	// accumulated into LevelStats[0].
+	LevelStats [numLevels]InternalIteratorStats
+}
+
+// merge adds the statistics in from to m. ReadAmp is not merged.
+func (m *IteratorMetrics) merge(from *IteratorMetrics) {
+	m.Stats.Merge(from.Stats)
+	m.MemTableStats.Merge(from.MemTableStats)
+	for level := range m.LevelStats {
+		m.LevelStats[level].Merge(from.LevelStats[level])
+	}
+}
+
+// iterMetricsShards is the number of shards in an iterMetricsAccumulator.
+const iterMetricsShards = 16
+
+// iterMetricsAccumulator accumulates the metrics of closed iterators for
+// Metrics.Iterator. The metrics are sharded, with each closed iterator added
+// to a random shard, so that iterators closed concurrently rarely contend on
+// the same mutex. The shards are summed when the metrics are read.
+type iterMetricsAccumulator struct {
+	shards [iterMetricsShards]struct {
+		sync.Mutex
+		count   int64
+		metrics IteratorMetrics
+	}
+}
+
+func (a *iterMetricsAccumulator) add(m *IteratorMetrics) {
+	s := &a.shards[fastrand.Uint32()%iterMetricsShards]
+	s.Lock()
+	s.count++
+	s.metrics.merge(m)
+	s.Unlock()
+}
+
+// load returns the number of closed iterators and the sum of their metrics.
+func (a *iterMetricsAccumulator) load() (count int64, m IteratorMetrics) {
+	for i := range a.shards {
+		s := &a.shards[i]
+		s.Lock()
+		count += s.count
+		m.merge(&s.metrics)
+		s.Unlock()
+	}
+	return count, m
 }
 
 // Iterator iterates over a DB's key/value pairs in key order.
@@ -69,9 +167,34 @@ type Iterator struct {
 	pos         iterPos
 	alloc       *iterAlloc
 	prefix      []byte
+	// prefixSeeked is true if iter was last positioned by SeekPrefixGE, in
+	// which case it does not support reverse iteration and must be
+	// repositioned before iterating in reverse in prefix iteration mode.
+	prefixSeeked bool
+	// seekBuf holds a copy of the key used to reposition iter when switching
+	// to reverse iteration in prefix iteration mode.
+	seekBuf []byte
+	// metrics accumulates the iterator's statistics. The levels of iter
+	// accumulate into metrics.MemTableStats and metrics.LevelStats, while
+	// metrics.Stats only holds the statistics of the Iterator itself until it
+	// is summed by Metrics.
+	metrics IteratorMetrics
+	// metricsAcc, if non-nil, accumulates the metrics of the iterator when it
+	// is closed.
+	metricsAcc *iterMetricsAccumulator
+}
+
+// hasPrefix returns true if the prefix of key is i.prefix.
+func (i *Iterator) hasPrefix(key []byte) bool {
+	n := i.split(key)
+	return bytes.Equal(i.prefix, key[:n])
 }
 
-func (i *Iterator) findNextEntry() bool {
+// findNextEntry finds the next visible entry, starting at the entry the
+// underlying iterator is positioned at. If limit is non-nil, the search stops
+// at the first user key greater than or equal to limit, leaving the iterator
+// paused.
+func (i *Iterator) findNextEntry(limit []byte) bool {
 	i.valid = false
 	i.pos = iterPosCur
 
@@ -87,15 +210,18 @@ func (i *Iterator) findNextEntry() bool {
 	for i.iterKey != nil {
 		key := *i.iterKey
 
-		if i.prefix != nil {
-			if n := i.split(key.UserKey); !bytes.Equal(i.prefix, key.UserKey[:n]) {
-				return false
-			}
+		if i.prefix != nil && !i.hasPrefix(key.UserKey) {
+			return false
+		}
+
+		if limit != nil && i.cmp(limit, key.UserKey) <= 0 {
+			i.pos = iterPosCurForwardPaused
+			return false
 		}
 
 		switch key.Kind() {
 		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
-			i.nextUserKey()
+			i.metrics.Stats.PointsDeleted += uint64(i.nextUserKey())
 			continue
 
 		case InternalKeyKindSet:
@@ -125,17 +251,21 @@ func (i *Iterator) findNextEntry() bool {
 	return false
 }
 
-func (i *Iterator) nextUserKey() {
+// nextUserKey advances the underlying iterator to the next user key, and
+// returns the number of entries stepped over.
+func (i *Iterator) nextUserKey() int {
 	if i.iterKey == nil {
-		return
+		return 0
 	}
 	done := i.iterKey.SeqNum() == 0
 	if !i.valid {
 		i.keyBuf = append(i.keyBuf[:0], i.iterKey.UserKey...)
 		i.key = i.keyBuf
 	}
+	n := 0
 	for {
 		i.iterKey, i.iterValue = i.iter.Next()
+		n++
 		if done || i.iterKey == nil {
 			break
 		}
@@ -144,9 +274,13 @@ func (i *Iterator) nextUserKey() {
 		}
 		done = i.iterKey.SeqNum() == 0
 	}
+	return n
 }
 
-func (i *Iterator) findPrevEntry() bool {
+// findPrevEntry finds the previous visible entry, starting at the entry the
+// underlying iterator is positioned at. If limit is non-nil, the search stops
+// at the first user key less than limit, leaving the iterator paused.
+func (i *Iterator) findPrevEntry(limit []byte) bool {
 	i.valid = false
 	i.pos = iterPosCur
 
@@ -160,6 +294,9 @@ func (i *Iterator) findPrevEntry() bool {
 	}
 
 	var valueMerger ValueMerger
+	// pending is the number of entries for the current user key which have
+	// been stepped over since the last deletion.
+	var pending uint64
 	for i.iterKey != nil {
 		key := *i.iterKey
 
@@ -174,8 +311,24 @@ func (i *Iterator) findPrevEntry() bool {
 			}
 		}
 
+		// In prefix iteration mode the underlying iterator is never positioned
+		// beyond the prefix when iterating in reverse (see seekLT), so a key
+		// without the prefix precedes the prefix.
+		if i.prefix != nil && !i.valid && !i.hasPrefix(key.UserKey) {
+			return false
+		}
+
+		// If i.valid, the key is the current user key, which is not less than
+		// the limit.
+		if limit != nil && i.cmp(key.UserKey, limit) < 0 {
+			i.pos = iterPosCurReversePaused
+			return false
+		}
+
 		switch key.Kind() {
 		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+			i.metrics.Stats.PointsDeleted += pending + 1
+			pending = 0
 			i.value = nil
 			i.valid = false
 			valueMerger = nil
@@ -183,6 +336,7 @@ func (i *Iterator) findPrevEntry() bool {
 			continue
 
 		case InternalKeyKindSet:
+			pending++
 			i.keyBuf = append(i.keyBuf[:0], key.UserKey...)
 			i.key = i.keyBuf
 			// iterValue is owned by i.iter and could change after the Prev()
@@ -197,6 +351,7 @@ func (i *Iterator) findPrevEntry() bool {
 			continue
 
 		case InternalKeyKindMerge:
+			pending++
 			if !i.valid {
 				i.keyBuf = append(i.keyBuf[:0], key.UserKey...)
 				i.key = i.keyBuf
@@ -310,14 +465,34 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 // than or equal to the given key. Returns true if the iterator is pointing at
 // a valid entry and false otherwise.
 func (i *Iterator) SeekGE(key []byte) bool {
+	return i.SeekGEWithLimit(key, nil) == IterValid
+}
+
+// SeekGEWithLimit moves the iterator to the first key/value pair whose key is
+// greater than or equal to the given key, stopping at the limit. If the first
+// such key is greater than or equal to limit, IterAtLimit is returned and the
+// iterator is not positioned at a key/value pair. A nil limit is ignored. See
+// NextWithLimit for the semantics of the limit.
+func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
 	i.err = nil // clear cached iteration error
-	i.prefix = nil
+	i.prefix = i.opts.Prefix
 	if lowerBound := i.opts.GetLowerBound(); lowerBound != nil && i.cmp(key, lowerBound) < 0 {
 		key = lowerBound
 	}
 
-	i.iterKey, i.iterValue = i.iter.SeekGE(key)
-	return i.findNextEntry()
+	if i.prefix != nil {
+		// The prefix sorts before all of the keys with the prefix.
+		if i.cmp(key, i.prefix) < 0 {
+			key = i.prefix
+		}
+		i.iterKey, i.iterValue = i.iter.SeekPrefixGE(i.prefix, key)
+		i.prefixSeeked = true
+	} else {
+		i.iterKey, i.iterValue = i.iter.SeekGE(key)
+		i.prefixSeeked = false
+	}
+	i.findNextEntry(limit)
+	return i.validityState()
 }
 
 // SeekPrefixGE moves the iterator to the first key/value pair whose key is
@@ -350,6 +525,9 @@ func (i *Iterator) SeekGE(key []byte) bool {
 //   SeekPrefixGE("a@0") -> "a@1"
 //   Next()              -> "a@2"
 //   Next()              -> EOF
+//
+// If the iterator was created with IterOptions.Prefix, the prefix of the key
+// must be equal to it, and SeekPrefixGE is equivalent to SeekGE.
 func (i *Iterator) SeekPrefixGE(key []byte) bool {
 	i.err = nil // clear cached iteration error
 
@@ -357,6 +535,16 @@ func (i *Iterator) SeekPrefixGE(key []byte) bool {
 		panic("pebble: split must be provided for SeekPrefixGE")
 	}
 
+	if i.opts.Prefix != nil {
+		if n := i.split(key); !bytes.Equal(i.opts.Prefix, key[:n]) {
+			i.prefix = i.opts.Prefix
+			i.valid = false
+			i.err = errors.New("pebble: SeekPrefixGE supplied with key outside of the iterator prefix")
+			return false
+		}
+		return i.SeekGE(key)
+	}
+
 	// Make a copy of the prefix so that modifications to the key after
 	// SeekPrefixGE returns does not affect the stored prefix.
 	prefixLen := i.split(key)
@@ -372,54 +560,135 @@ func (i *Iterator) SeekPrefixGE(key []byte) bool {
 	}
 
 	i.iterKey, i.iterValue = i.iter.SeekPrefixGE(i.prefix, key)
-	return i.findNextEntry()
+	i.prefixSeeked = true
+	return i.findNextEntry(nil)
 }
 
 // SeekLT moves the iterator to the last key/value pair whose key is less than
 // the given key. Returns true if the iterator is pointing at a valid entry and
 // false otherwise.
 func (i *Iterator) SeekLT(key []byte) bool {
+	return i.SeekLTWithLimit(key, nil) == IterValid
+}
+
+// SeekLTWithLimit moves the iterator to the last key/value pair whose key is
+// less than the given key, stopping at the limit. If the last such key is less
+// than limit, IterAtLimit is returned and the iterator is not positioned at a
+// key/value pair. A nil limit is ignored. See PrevWithLimit for the semantics
+// of the limit.
+func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
 	i.err = nil // clear cached iteration error
-	i.prefix = nil
+	i.prefix = i.opts.Prefix
 	if upperBound := i.opts.GetUpperBound(); upperBound != nil && i.cmp(key, upperBound) >= 0 {
 		key = upperBound
 	}
 
+	i.seekLT(key)
+	i.findPrevEntry(limit)
+	return i.validityState()
+}
+
+// seekLT positions the underlying iterator at the last entry whose key is
+// less than the given key. In prefix iteration mode, if that entry lies
+// beyond the prefix, the underlying iterator is instead positioned at the
+// last entry with the prefix.
+func (i *Iterator) seekLT(key []byte) {
+	i.prefixSeeked = false
 	i.iterKey, i.iterValue = i.iter.SeekLT(key)
-	return i.findPrevEntry()
+	if i.prefix != nil && i.iterKey != nil {
+		if k := i.iterKey.UserKey; i.cmp(k[:i.split(k)], i.prefix) > 0 {
+			i.seekPrefixLast()
+		}
+	}
+}
+
+// seekPrefixLast positions the underlying iterator at the last entry with the
+// prefix, or at an entry preceding the prefix if there are none. The end of a
+// prefix cannot be derived from Comparer.Split, so the underlying iterator
+// steps forward over the entries with the prefix and then reverses direction.
+// A SeekPrefixGE is performed first so that the bloom filters avoid the work
+// when the prefix does not exist.
+func (i *Iterator) seekPrefixLast() {
+	key := i.prefix
+	if lowerBound := i.opts.GetLowerBound(); lowerBound != nil && i.cmp(key, lowerBound) < 0 {
+		key = lowerBound
+	}
+	i.iterKey, i.iterValue = i.iter.SeekPrefixGE(i.prefix, key)
+	if i.iterKey == nil || !i.hasPrefix(i.iterKey.UserKey) {
+		i.iterKey, i.iterValue = nil, nil
+		i.prefixSeeked = true
+		return
+	}
+
+	i.seekBuf = append(i.seekBuf[:0], i.iterKey.UserKey...)
+	i.iterKey, i.iterValue = i.iter.SeekGE(i.seekBuf)
+	i.prefixSeeked = false
+	for i.iterKey != nil && i.hasPrefix(i.iterKey.UserKey) {
+		i.iterKey, i.iterValue = i.iter.Next()
+	}
+	if i.iterKey != nil {
+		i.iterKey, i.iterValue = i.iter.Prev()
+	} else if upperBound := i.opts.GetUpperBound(); upperBound != nil {
+		i.iterKey, i.iterValue = i.iter.SeekLT(upperBound)
+	} else {
+		i.iterKey, i.iterValue = i.iter.Last()
+	}
 }
 
 // First moves the iterator the the first key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) First() bool {
+	if i.opts.Prefix != nil {
+		return i.SeekGE(i.opts.Prefix)
+	}
 	i.err = nil // clear cached iteration error
 	i.prefix = nil
+	i.prefixSeeked = false
 	if lowerBound := i.opts.GetLowerBound(); lowerBound != nil {
 		i.iterKey, i.iterValue = i.iter.SeekGE(lowerBound)
 	} else {
 		i.iterKey, i.iterValue = i.iter.First()
 	}
-	return i.findNextEntry()
+	return i.findNextEntry(nil)
 }
 
 // Last moves the iterator the the last key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Last() bool {
 	i.err = nil // clear cached iteration error
-	i.prefix = nil
+	i.prefix = i.opts.Prefix
+	i.prefixSeeked = false
 	if upperBound := i.opts.GetUpperBound(); upperBound != nil {
-		i.iterKey, i.iterValue = i.iter.SeekLT(upperBound)
+		i.seekLT(upperBound)
+	} else if i.prefix != nil {
+		i.seekPrefixLast()
 	} else {
 		i.iterKey, i.iterValue = i.iter.Last()
 	}
-	return i.findPrevEntry()
+	return i.findPrevEntry(nil)
 }
 
 // Next moves the iterator to the next key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Next() bool {
+	return i.NextWithLimit(nil) == IterValid
+}
+
+// NextWithLimit moves the iterator to the next key/value pair, stopping at the
+// limit. The limit is exclusive: if the next key/value pair has a key greater
+// than or equal to limit, IterAtLimit is returned and the iterator is not
+// positioned at a key/value pair. A nil limit is ignored.
+//
+// Unlike the upper bound, the limit does not restrict the underlying
+// iterators. Its purpose is to bound the work done by a single call when
+// stepping over a region dense with deleted keys: a caller can step to a
+// nearby limit, interleave other work, and then resume iteration with another
+// call to NextWithLimit (with a larger limit) or Next. Iteration may also be
+// resumed in the reverse direction with Prev or PrevWithLimit, which return
+// the last key/value pair before the key at which iteration stopped.
+func (i *Iterator) NextWithLimit(limit []byte) IterValidityState {
 	if i.err != nil {
-		return false
+		return IterExhausted
 	}
 	switch i.pos {
 	case iterPosCur:
@@ -442,20 +711,54 @@ func (i *Iterator) Next() bool {
 			i.nextUserKey()
 		}
 		i.nextUserKey()
-	case iterPosNext:
+	case iterPosCurReversePaused:
+		// The underlying iterator is positioned at the oldest entry of the
+		// user key at which reverse iteration stopped. That user key was not
+		// consumed, but it precedes the iterator's position, so step over it.
+		i.valid = false
+		i.nextUserKey()
+	case iterPosNext, iterPosCurForwardPaused:
 	}
-	return i.findNextEntry()
+	i.findNextEntry(limit)
+	return i.validityState()
 }
 
 // Prev moves the iterator to the previous key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Prev() bool {
+	return i.PrevWithLimit(nil) == IterValid
+}
+
+// PrevWithLimit moves the iterator to the previous key/value pair, stopping at
+// the limit. The limit is inclusive: if the previous key/value pair has a key
+// less than limit, IterAtLimit is returned and the iterator is not positioned
+// at a key/value pair. A nil limit is ignored. See NextWithLimit for how
+// iteration may be resumed.
+func (i *Iterator) PrevWithLimit(limit []byte) IterValidityState {
 	if i.err != nil {
-		return false
+		return IterExhausted
 	}
-	if i.prefix != nil {
+	if i.prefix != nil && i.opts.Prefix == nil {
 		i.err = errReversePrefixIteration
-		return false
+		return IterExhausted
+	}
+	if i.prefixSeeked {
+		// The underlying iterator was positioned by SeekPrefixGE, and must be
+		// repositioned at the current position in order to iterate in reverse.
+		switch {
+		case i.valid:
+			i.seekBuf = append(i.seekBuf[:0], i.key...)
+			i.seekLT(i.seekBuf)
+		case i.pos == iterPosCurForwardPaused:
+			i.seekBuf = append(i.seekBuf[:0], i.iterKey.UserKey...)
+			i.seekLT(i.seekBuf)
+		default:
+			// Forward iteration exhausted the prefix.
+			i.prefixSeeked = false
+			i.seekPrefixLast()
+		}
+		i.findPrevEntry(limit)
+		return i.validityState()
 	}
 	switch i.pos {
 	case iterPosCur:
@@ -478,9 +781,31 @@ func (i *Iterator) Prev() bool {
 			i.prevUserKey()
 		}
 		i.prevUserKey()
-	case iterPosPrev:
+	case iterPosCurForwardPaused:
+		// The underlying iterator is positioned at the newest entry of the
+		// user key at which forward iteration stopped. That user key was not
+		// consumed, but it follows the iterator's position, so step over it.
+		i.valid = false
+		i.prevUserKey()
+	case iterPosPrev, iterPosCurReversePaused:
+	}
+	i.findPrevEntry(limit)
+	return i.validityState()
+}
+
+// validityState returns the IterValidityState corresponding to the current
+// position of the iterator.
+func (i *Iterator) validityState() IterValidityState {
+	switch {
+	case i.err != nil:
+		return IterExhausted
+	case i.valid:
+		return IterValid
+	case i.pos == iterPosCurForwardPaused || i.pos == iterPosCurReversePaused:
+		return IterAtLimit
+	default:
+		return IterExhausted
 	}
-	return i.findPrevEntry()
 }
 
 // Key returns the key of the current key/value pair, or nil if done. The
@@ -526,6 +851,12 @@ func (i *Iterator) Close() error {
 	}
 	err := i.err
 
+	if i.metricsAcc != nil {
+		m := i.Metrics()
+		i.metricsAcc.add(&m)
+		i.metricsAcc = nil
+	}
+
 	if i.readState != nil {
 		i.readState.unref()
 		i.readState = nil
@@ -556,7 +887,8 @@ func (i *Iterator) Close() error {
 // iterator will always be invalidated and must be repositioned with a call to
 // SeekGE, SeekPrefixGE, SeekLT, First, or Last.
 func (i *Iterator) SetBounds(lower, upper []byte) {
-	i.prefix = nil
+	i.prefix = i.opts.Prefix
+	i.prefixSeeked = false
 	i.iterKey = nil
 	i.iterValue = nil
 	i.pos = iterPosCur
@@ -569,11 +901,14 @@ func (i *Iterator) SetBounds(lower, upper []byte) {
 
 // Metrics returns per-iterator metrics.
 func (i *Iterator) Metrics() IteratorMetrics {
-	m := IteratorMetrics{
-		ReadAmp: 1,
-	}
+	m := i.metrics
+	m.ReadAmp = 1
 	if mi, ok := i.iter.(*mergingIter); ok {
 		m.ReadAmp = len(mi.levels)
 	}
+	m.Stats.Merge(m.MemTableStats)
+	for level := range m.LevelStats {
+		m.Stats.Merge(m.LevelStats[level])
+	}
 	return m
 }
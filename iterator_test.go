@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/datadriven"
 	"github.com/cockroachdb/pebble/vfs"
@@ -692,3 +693,234 @@ func BenchmarkIteratorPrev(b *testing.B) {
 		iter.Prev()
 	}
 }
+
+func BenchmarkIteratorOpenCloseParallel(b *testing.B) {
+	d, err := Open("", &Options{
+		FS: vfs.NewMem(),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := d.Set([]byte(fmt.Sprintf("%03d", i)), nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := d.Flush(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			iter := d.NewIter(nil)
+			iter.First()
+			if err := iter.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+
+	if err := d.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func TestIteratorPrefix(t *testing.T) {
+	var d *DB
+	defer func() {
+		if d != nil {
+			require.NoError(t, d.Close())
+		}
+	}()
+
+	// The prefix of a key is the portion before the "@", if any.
+	comparer := *DefaultComparer
+	comparer.Split = func(a []byte) int {
+		if i := bytes.IndexByte(a, '@'); i >= 0 {
+			return i
+		}
+		return len(a)
+	}
+
+	datadriven.RunTest(t, "testdata/iterator_prefix", func(td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "define":
+			if d != nil {
+				if err := d.Close(); err != nil {
+					return err.Error()
+				}
+			}
+			opts := &Options{
+				Comparer: &comparer,
+				Levels:   []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+			}
+			var err error
+			if d, err = runDBDefineCmd(td, opts); err != nil {
+				return err.Error()
+			}
+			d.mu.Lock()
+			s := d.mu.versions.currentVersion().String()
+			d.mu.Unlock()
+			return s
+
+		case "iter":
+			var opts IterOptions
+			for _, arg := range td.CmdArgs {
+				if len(arg.Vals) != 1 {
+					return fmt.Sprintf("%s: %s=<value>", td.Cmd, arg.Key)
+				}
+				switch arg.Key {
+				case "prefix":
+					opts.Prefix = []byte(arg.Vals[0])
+				case "lower":
+					opts.LowerBound = []byte(arg.Vals[0])
+				case "upper":
+					opts.UpperBound = []byte(arg.Vals[0])
+				default:
+					return fmt.Sprintf("%s: unknown arg: %s", td.Cmd, arg.Key)
+				}
+			}
+			// runDBDefineCmd doesn't update the visible sequence number, so
+			// use a snapshot with a very large sequence number.
+			snap := Snapshot{
+				db:     d,
+				seqNum: InternalKeySeqNumMax,
+			}
+			iter := snap.NewIter(&opts)
+			defer iter.Close()
+			return runIterCmd(td, iter)
+
+		case "filter-metrics":
+			m := d.Metrics()
+			return fmt.Sprintf("hits=%d misses=%d\n", m.Filter.Hits, m.Filter.Misses)
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
+
+func TestIteratorPrefixExtractorBounds(t *testing.T) {
+	opts := &Options{
+		FS:                    vfs.NewMem(),
+		L0CompactionThreshold: 100,
+		L0StopWritesThreshold: 100,
+		Levels: []LevelOptions{{
+			FilterPolicy:    bloom.FilterPolicy(10),
+			PrefixExtractor: FixedPrefixExtractor(3),
+		}},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// Create overlapping sstables. The last table contains a range deletion
+	// of keys in the second table, but no point keys with that prefix.
+	require.NoError(t, d.Set([]byte("aaa1"), nil, nil))
+	require.NoError(t, d.Set([]byte("ccc1"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("bbb1"), nil, nil))
+	require.NoError(t, d.Set([]byte("ddd1"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("aaa2"), nil, nil))
+	require.NoError(t, d.DeleteRange([]byte("bbb0"), []byte("bbb5"), nil))
+	require.NoError(t, d.Set([]byte("ccc2"), nil, nil))
+	require.NoError(t, d.Flush())
+
+	scan := func(lower, upper string) string {
+		iter := d.NewIter(&IterOptions{
+			LowerBound: []byte(lower),
+			UpperBound: []byte(upper),
+		})
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		return strings.Join(keys, ",")
+	}
+
+	hits := d.Metrics().Filter.Hits
+	require.Equal(t, "aaa1,aaa2", scan("aaa", "aab"))
+	require.Equal(t, "", scan("bbb", "bbc"))
+	require.Equal(t, "ccc1,ccc2", scan("ccc", "ccc9"))
+	require.Equal(t, "ddd1", scan("ddd", "dde"))
+	require.True(t, d.Metrics().Filter.Hits > hits)
+
+	// Bounds which do not share a common prefix do not skip any tables.
+	hits = d.Metrics().Filter.Hits
+	require.Equal(t, "aaa1,aaa2,ccc1,ccc2,ddd1", scan("a", "e"))
+	require.Equal(t, hits, d.Metrics().Filter.Hits)
+}
+
+func TestIteratorMetrics(t *testing.T) {
+	comparer := *DefaultComparer
+	comparer.Split = func(a []byte) int { return len(a) }
+	d, err := Open("", &Options{
+		Comparer: &comparer,
+		FS:       vfs.NewMem(),
+		Levels:   []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), []byte("x"), nil))
+	}
+	require.NoError(t, d.Compact([]byte("0"), []byte("1")))
+	require.NoError(t, d.DeleteRange([]byte("010"), []byte("020"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Delete([]byte("050"), nil))
+
+	// Scanning forward skips over the range-deleted keys in L6, by seeking
+	// past them, and over the point tombstone in the memtable along with the
+	// key it deletes in L6.
+	iter := d.NewIter(nil)
+	n := 0
+	for valid := iter.First(); valid; valid = iter.Next() {
+		n++
+	}
+	require.Equal(t, 89, n)
+	m := iter.Metrics()
+	require.Equal(t, uint64(2), m.Stats.PointsDeleted)
+	require.Equal(t, uint64(0), m.MemTableStats.Seeks)
+	require.Equal(t, uint64(1), m.LevelStats[6].Seeks)
+	require.Equal(t, uint64(1), m.LevelStats[6].RangeDeleted)
+	require.Equal(t, uint64(1), m.Stats.RangeDeleted)
+	require.True(t, m.LevelStats[6].BlocksLoaded > 0)
+	require.Equal(t, m.LevelStats[0].BlocksLoaded+m.LevelStats[6].BlocksLoaded, m.Stats.BlocksLoaded)
+	require.True(t, m.Stats.BlockBytes >= m.Stats.BlockBytesRead)
+	require.NoError(t, iter.Close())
+
+	// The blocks are now cached, so scanning in reverse doesn't read any
+	// blocks from disk.
+	iter = d.NewIter(nil)
+	for valid := iter.Last(); valid; valid = iter.Prev() {
+	}
+	m = iter.Metrics()
+	require.Equal(t, uint64(2), m.Stats.PointsDeleted)
+	require.True(t, m.Stats.BlocksLoaded > 0)
+	require.Equal(t, m.Stats.BlocksLoaded, m.Stats.BlocksCached)
+	require.Equal(t, uint64(0), m.Stats.BlockBytesRead)
+
+	// A prefix seek for a missing key is ruled out by the L6 filter.
+	require.False(t, iter.SeekPrefixGE([]byte("0505")))
+	m = iter.Metrics()
+	require.Equal(t, uint64(1), m.MemTableStats.Seeks)
+	require.Equal(t, uint64(1), m.LevelStats[0].Seeks)
+	require.Equal(t, uint64(1), m.LevelStats[6].FilterHits)
+	require.NoError(t, iter.Close())
+
+	metrics := d.Metrics()
+	require.Equal(t, int64(2), metrics.Iterator.Count)
+	require.Equal(t, uint64(4), metrics.Iterator.Stats.PointsDeleted)
+	require.Equal(t, uint64(1), metrics.Iterator.LevelStats[6].FilterHits)
+	require.Equal(t, metrics.Iterator.LevelStats[0].BlocksLoaded+metrics.Iterator.LevelStats[6].BlocksLoaded,
+		metrics.Iterator.Stats.BlocksLoaded)
+}
@@ -45,6 +45,9 @@ type tableNewIters func(
 type levelIter struct {
 	logger Logger
 	cmp    Compare
+	// The key prefix function, used by SeekPrefixGE to avoid loading files
+	// which cannot contain the prefix. May be nil.
+	split Split
 	// The lower/upper bounds for iteration as specified at creation or the most
 	// recent call to SetBounds.
 	lower []byte
@@ -164,6 +167,7 @@ func (l *levelIter) init(
 	l.lower = opts.LowerBound
 	l.upper = opts.UpperBound
 	l.tableOpts.TableFilter = opts.TableFilter
+	l.tableOpts.stats = opts.stats
 	l.cmp = cmp
 	l.iterFile = nil
 	l.newIters = newIters
@@ -171,6 +175,12 @@ func (l *levelIter) init(
 	l.bytesIterated = bytesIterated
 }
 
+// initStats sets the stats accumulated by the sstable iterators opened by the
+// levelIter.
+func (l *levelIter) initStats(stats *InternalIteratorStats) {
+	l.tableOpts.stats = stats
+}
+
 func (l *levelIter) initRangeDel(rangeDelIter *internalIterator) {
 	l.rangeDelIter = rangeDelIter
 }
@@ -356,7 +366,19 @@ func (l *levelIter) SeekPrefixGE(prefix, key []byte) (*InternalKey, []byte) {
 
 	// NB: the top-level Iterator has already adjusted key based on
 	// IterOptions.LowerBound.
-	if !l.loadFile(l.findFileGE(key), +1) {
+	f := l.findFileGE(key)
+	// If the prefix of the file's smallest key is greater than the search
+	// prefix, then every key in the file, and in the subsequent files in the
+	// level, is greater than all of the keys with the search prefix (see
+	// Comparer.Split). The file's range tombstones cannot delete keys with the
+	// search prefix either, so there is no need to load it.
+	if f != nil && l.split != nil {
+		smallest := f.Smallest.UserKey
+		if l.cmp(smallest[:l.split(smallest)], prefix) > 0 {
+			f = nil
+		}
+	}
+	if !l.loadFile(f, +1) {
 		return nil, nil
 	}
 	if key, val := l.iter.SeekPrefixGE(prefix, key); key != nil {
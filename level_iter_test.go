@@ -357,7 +357,7 @@ func buildLevelIterTables(
 		if err != nil {
 			b.Fatal(err)
 		}
-		defer f.Close()
+		// NB: the file is closed by sstable.Writer.Close.
 		files[i] = f
 	}
 
@@ -509,3 +509,52 @@ func BenchmarkLevelIterPrev(b *testing.B) {
 			})
 	}
 }
+
+// BenchmarkLevelIterScan compares the throughput of full forward and reverse
+// scans of a level.
+func BenchmarkLevelIterScan(b *testing.B) {
+	const blockSize = 32 << 10
+	const restartInterval = 16
+	const count = 5
+
+	readers, metas, _ := buildLevelIterTables(b, blockSize, restartInterval, count)
+	defer func() {
+		for _, r := range readers {
+			if err := r.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}()
+	newIters := func(
+		file manifest.LevelFile, _ *IterOptions, _ *uint64,
+	) (internalIterator, internalIterator, error) {
+		iter, err := readers[file.FileNum].NewIter(nil /* lower */, nil /* upper */)
+		return iter, nil, err
+	}
+
+	for _, reverse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reverse=%t", reverse), func(b *testing.B) {
+			l := newLevelIter(IterOptions{}, DefaultComparer.Compare,
+				newIters, metas.Iter(), manifest.Level(level), nil)
+			defer l.Close()
+
+			b.ResetTimer()
+			var n int
+			for i := 0; i < b.N; i++ {
+				if reverse {
+					for key, _ := l.Last(); key != nil; key, _ = l.Prev() {
+						n++
+					}
+				} else {
+					for key, _ := l.First(); key != nil; key, _ = l.Next() {
+						n++
+					}
+				}
+			}
+			b.StopTimer()
+			if n == 0 {
+				b.Fatal("empty scan")
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"unsafe"
@@ -18,12 +19,16 @@ import (
 	"github.com/cockroachdb/pebble/internal/rangedel"
 )
 
+// minParallelInsertRecords is the minimum number of records in each part of
+// a batch applied to a memtable in parallel.
+const minParallelInsertRecords = 128
+
 func memTableEntrySize(keyBytes, valueBytes int) uint32 {
 	return arenaskl.MaxNodeSize(uint32(keyBytes)+8, uint32(valueBytes))
 }
 
-// memTableEmptySize is the amount of allocated space in the arena when the
-// memtable is empty.
+// memTableEmptySize is the amount of allocated space in the arena when a
+// memtable using the default SkiplistMemTableRep is empty.
 var memTableEmptySize = func() uint32 {
 	var pointSkl arenaskl.Skiplist
 	var rangeDelSkl arenaskl.Skiplist
@@ -38,12 +43,15 @@ var memTableEmptySize = func() uint32 {
 // via tombstones, but it is up to higher level code (see Iterator) to support
 // processing those tombstones.
 //
-// A memTable is implemented on top of a lock-free arena-backed skiplist. An
-// arena is a fixed size contiguous chunk of memory (see
-// Options.MemTableSize). A memTable's memory consumption is thus fixed at the
-// time of creation (with the exception of the cached fragmented range
-// tombstones). The arena-backed skiplist provides both forward and reverse
-// links which makes forward and reverse iteration the same speed.
+// A memTable stores its point records in a MemTableRep (see
+// Options.MemTableRep), which is by default a lock-free arena-backed
+// skiplist, and its range tombstones in a separate skiplist. An arena is a
+// fixed size contiguous chunk of memory (see Options.MemTableSize) from which
+// the records of both are allocated. A memTable's memory consumption is thus
+// fixed at the time of creation (with the exception of the cached fragmented
+// range tombstones, and of the bookkeeping of reps such as
+// VectorMemTableRep). The arena-backed skiplist provides both forward and
+// reverse links which makes forward and reverse iteration the same speed.
 //
 // A batch is "applied" to a memTable in a two step process: prepare(batch) ->
 // apply(batch). memTable.prepare() is not thread-safe and must be called with
@@ -62,8 +70,12 @@ type memTable struct {
 	cmp         Compare
 	equal       Equal
 	arenaBuf    []byte
-	skl         arenaskl.Skiplist
+	arena       *arenaskl.Arena
+	rep         MemTableRep
 	rangeDelSkl arenaskl.Skiplist
+	// emptySize is the amount of allocated space in the arena when the
+	// memtable is empty, which depends on the rep.
+	emptySize uint32
 	// reserved tracks the amount of space used by the memtable, both by actual
 	// data stored in the memtable as well as inflight batch commit
 	// operations. This value is incremented pessimistically by prepare() in
@@ -76,6 +88,16 @@ type memTable struct {
 	// drops to zero.
 	writerRefs int32
 	tombstones rangeTombstoneCache
+	// filter is the bloom filter over the prefixes of the point keys in the
+	// memtable, or nil if the memtable has no filter. See
+	// Options.Experimental.MemTableFilterSizeRatio.
+	filter      *memTableFilter
+	filterStats *memTableFilterStats
+	split       Split
+	// parallelInsertThreshold is the minimum number of records in a batch for
+	// it to be applied in parallel. See
+	// Options.Experimental.ParallelMemTableInsertThreshold.
+	parallelInsertThreshold int
 	// The current logSeqNum at the time the memtable was created. This is
 	// guaranteed to be less than or equal to any seqnum stored in the memtable.
 	logSeqNum uint64
@@ -86,9 +108,10 @@ type memTable struct {
 // which is used by tests.
 type memTableOptions struct {
 	*Options
-	arenaBuf  []byte
-	size      int
-	logSeqNum uint64
+	arenaBuf    []byte
+	size        int
+	logSeqNum   uint64
+	filterStats *memTableFilterStats
 }
 
 func checkMemTable(obj interface{}) {
@@ -113,15 +136,27 @@ func newMemTable(opts memTableOptions) *memTable {
 		arenaBuf:   opts.arenaBuf,
 		writerRefs: 1,
 		logSeqNum:  opts.logSeqNum,
+
+		parallelInsertThreshold: opts.Experimental.ParallelMemTableInsertThreshold,
 	}
 
 	if m.arenaBuf == nil {
 		m.arenaBuf = make([]byte, opts.size)
 	}
 
-	arena := arenaskl.NewArena(m.arenaBuf)
-	m.skl.Reset(arena, m.cmp)
-	m.rangeDelSkl.Reset(arena, m.cmp)
+	if ratio := opts.Experimental.MemTableFilterSizeRatio; ratio > 0 {
+		m.filter = newMemTableFilter(len(m.arenaBuf), ratio)
+		m.filterStats = opts.filterStats
+		if m.filterStats == nil {
+			m.filterStats = &memTableFilterStats{}
+		}
+		m.split = opts.Comparer.Split
+	}
+
+	m.arena = arenaskl.NewArena(m.arenaBuf)
+	m.rangeDelSkl.Reset(m.arena, m.cmp)
+	m.rep = opts.MemTableRep.NewRep(m.arena, m.cmp)
+	m.emptySize = m.arena.Size()
 	return m
 }
 
@@ -150,7 +185,7 @@ func (m *memTable) readyForFlush() bool {
 // Get gets the value for the given key. It returns ErrNotFound if the DB does
 // not contain the key.
 func (m *memTable) get(key []byte) (value []byte, err error) {
-	it := m.skl.NewIter(nil, nil)
+	it := m.rep.NewIter(nil, nil)
 	ikey, val := it.SeekGE(key)
 	if ikey == nil {
 		return nil, ErrNotFound
@@ -166,6 +201,29 @@ func (m *memTable) get(key []byte) (value []byte, err error) {
 	}
 }
 
+// prefix returns the prefix of the key which is added to the filter.
+func (m *memTable) prefix(key []byte) []byte {
+	if m.split == nil {
+		return key
+	}
+	return key[:m.split(key)]
+}
+
+// mayContain returns false if the filter shows that the memtable contains no
+// point records for the key, and true otherwise, recording the outcome in the
+// filter stats. It returns true if the memtable has no filter.
+func (m *memTable) mayContain(key []byte) bool {
+	if m.filter == nil {
+		return true
+	}
+	if m.filter.mayContain(m.prefix(key)) {
+		atomic.AddUint64(&m.filterStats.misses, 1)
+		return true
+	}
+	atomic.AddUint64(&m.filterStats.hits, 1)
+	return false
+}
+
 // Prepare reserves space for the batch in the memtable and references the
 // memtable preventing it from being flushed until the batch is applied. Note
 // that prepare is not thread-safe, while apply is. The caller must call
@@ -187,10 +245,49 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 			errors.Safe(seqNum), errors.Safe(m.logSeqNum))
 	}
 
-	var ins arenaskl.Inserter
-	var tombstoneCount uint32
 	startSeqNum := seqNum
-	for r := batch.Reader(); ; seqNum++ {
+	var tombstoneCount uint32
+	var err error
+	if parts := m.applyParts(batch); parts > 1 {
+		seqNum, tombstoneCount, err = m.applyParallel(batch.Reader(), seqNum, int(batch.Count()), parts)
+	} else {
+		seqNum, tombstoneCount, err = m.applyRecords(batch.Reader(), seqNum)
+	}
+	if err != nil {
+		return err
+	}
+	if seqNum != startSeqNum+uint64(batch.Count()) {
+		panic(errors.Errorf("pebble: inconsistent batch count: %d vs %d",
+			errors.Safe(seqNum), errors.Safe(startSeqNum+uint64(batch.Count()))))
+	}
+	if tombstoneCount != 0 {
+		m.tombstones.invalidate(tombstoneCount)
+	}
+	return nil
+}
+
+// applyParts returns the number of parts into which the records of the
+// batch are split to be applied in parallel. See
+// Options.Experimental.ParallelMemTableInsertThreshold.
+func (m *memTable) applyParts(batch *Batch) int {
+	count := int(batch.Count())
+	if m.parallelInsertThreshold <= 0 || count < m.parallelInsertThreshold {
+		return 1
+	}
+	parts := runtime.GOMAXPROCS(0)
+	if maxParts := count / minParallelInsertRecords; parts > maxParts {
+		parts = maxParts
+	}
+	return parts
+}
+
+// applyRecords adds the records read from r to the memtable, assigning them
+// sequence numbers starting at seqNum. It returns the sequence number
+// following the last record, and the number of range tombstones added.
+func (m *memTable) applyRecords(r BatchReader, seqNum uint64) (uint64, uint32, error) {
+	var ins MemTableInserter
+	var tombstoneCount uint32
+	for ; ; seqNum++ {
 		kind, ukey, value, ok := r.Next()
 		if !ok {
 			break
@@ -206,31 +303,90 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 			// to the memtable.
 			seqNum--
 		default:
-			err = ins.Add(&m.skl, ikey, value)
+			if ins == nil {
+				ins = m.rep.NewInserter()
+			}
+			if err = ins.Add(ikey, value); err == nil && m.filter != nil {
+				m.filter.add(m.prefix(ukey))
+			}
 		}
 		if err != nil {
-			return err
+			return seqNum, tombstoneCount, err
 		}
 	}
-	if seqNum != startSeqNum+uint64(batch.Count()) {
-		panic(errors.Errorf("pebble: inconsistent batch count: %d vs %d",
-			errors.Safe(seqNum), errors.Safe(startSeqNum+uint64(batch.Count()))))
+	return seqNum, tombstoneCount, nil
+}
+
+// applyParallel splits the count records read from r into the specified
+// number of parts, and applies the parts concurrently using applyRecords.
+// The first part is applied by the calling goroutine. applyParallel returns
+// once all of the parts have been applied, so the records of the batch only
+// become visible once they have all been added to the memtable (see
+// commitPipeline.publish).
+func (m *memTable) applyParallel(
+	r BatchReader, seqNum uint64, count, parts int,
+) (uint64, uint32, error) {
+	type part struct {
+		r              BatchReader
+		seqNum         uint64
+		tombstoneCount uint32
+		err            error
 	}
-	if tombstoneCount != 0 {
-		m.tombstones.invalidate(tombstoneCount)
+
+	// Split the records by decoding them, recording the sequence number at
+	// which each part starts.
+	perPart := (count + parts - 1) / parts
+	split := make([]part, 0, parts)
+	start, startSeqNum, n := r, seqNum, 0
+	for len(r) > 0 {
+		kind, _, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		if kind == InternalKeyKindLogData {
+			continue
+		}
+		seqNum++
+		if n++; n == perPart {
+			split = append(split, part{r: start[:len(start)-len(r)], seqNum: startSeqNum})
+			start, startSeqNum, n = r, seqNum, 0
+		}
 	}
-	return nil
+	if len(start) > 0 {
+		split = append(split, part{r: start, seqNum: startSeqNum})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(split) - 1)
+	for i := 1; i < len(split); i++ {
+		go func(p *part) {
+			defer wg.Done()
+			_, p.tombstoneCount, p.err = m.applyRecords(p.r, p.seqNum)
+		}(&split[i])
+	}
+	p := &split[0]
+	_, p.tombstoneCount, p.err = m.applyRecords(p.r, p.seqNum)
+	wg.Wait()
+
+	var tombstoneCount uint32
+	for i := range split {
+		if split[i].err != nil {
+			return seqNum, tombstoneCount, split[i].err
+		}
+		tombstoneCount += split[i].tombstoneCount
+	}
+	return seqNum, tombstoneCount, nil
 }
 
 // newIter returns an iterator that is unpositioned (Iterator.Valid() will
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekLT, First or Last.
 func (m *memTable) newIter(o *IterOptions) internalIterator {
-	return m.skl.NewIter(o.GetLowerBound(), o.GetUpperBound())
+	return m.rep.NewIter(o.GetLowerBound(), o.GetUpperBound())
 }
 
 func (m *memTable) newFlushIter(o *IterOptions, bytesFlushed *uint64) internalIterator {
-	return m.skl.NewFlushIter(bytesFlushed)
+	return m.rep.NewFlushIter(bytesFlushed)
 }
 
 func (m *memTable) newRangeDelIter(*IterOptions) internalIterator {
@@ -242,7 +398,7 @@ func (m *memTable) newRangeDelIter(*IterOptions) internalIterator {
 }
 
 func (m *memTable) availBytes() uint32 {
-	a := m.skl.Arena()
+	a := m.arena
 	if atomic.LoadInt32(&m.writerRefs) == 1 {
 		// If there are no other concurrent apply operations, we can update the
 		// reserved bytes setting to accurately reflect how many bytes of been
@@ -253,11 +409,11 @@ func (m *memTable) availBytes() uint32 {
 }
 
 func (m *memTable) inuseBytes() uint64 {
-	return uint64(m.skl.Size() - memTableEmptySize)
+	return uint64(m.arena.Size() - m.emptySize)
 }
 
 func (m *memTable) totalBytes() uint64 {
-	return uint64(m.skl.Arena().Capacity())
+	return uint64(m.arena.Capacity())
 }
 
 func (m *memTable) close() error {
@@ -266,7 +422,7 @@ func (m *memTable) close() error {
 
 // empty returns whether the MemTable has no key/value pairs.
 func (m *memTable) empty() bool {
-	return m.skl.Size() == memTableEmptySize
+	return m.arena.Size() == m.emptySize
 }
 
 // A rangeTombstoneFrags holds a set of fragmented range tombstones generated
@@ -0,0 +1,88 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import "sync/atomic"
+
+// memTableFilterProbes is the number of bits set in a memTableFilter for each
+// key added. It is optimal for filters with around 9 bits per key.
+const memTableFilterProbes = 6
+
+// memTableFilterStats holds the counts of the checks of memtable filters made
+// by DB.Get. See Metrics.MemTable. The fields are accessed atomically.
+type memTableFilterStats struct {
+	hits   uint64
+	misses uint64
+}
+
+// memTableFilter is a bloom filter over the prefixes (see Comparer.Split) of
+// the point keys in a memtable. Unlike the filters of sstables, it is built
+// incrementally as records are added to the memtable, and is safe for
+// concurrent use by writers and readers. Its size is fixed when the memtable
+// is created, so the false positive rate rises as the memtable fills.
+type memTableFilter struct {
+	bits    []uint32
+	numBits uint32
+}
+
+// newMemTableFilter returns a filter sized as the specified fraction of the
+// size of a memtable, or nil if the filter would be empty.
+func newMemTableFilter(memTableSize int, ratio float64) *memTableFilter {
+	numWords := (uint64(float64(memTableSize)*ratio*8) + 31) / 32
+	if numWords == 0 {
+		return nil
+	}
+	return &memTableFilter{
+		bits:    make([]uint32, numWords),
+		numBits: uint32(numWords * 32),
+	}
+}
+
+// memTableFilterHash returns the 64-bit FNV-1a hash of the key with the
+// SplitMix64 finalizer applied, whose halves are used for double hashing.
+func memTableFilterHash(b []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// add adds the prefix to the filter.
+func (f *memTableFilter) add(prefix []byte) {
+	h := memTableFilterHash(prefix)
+	h1, delta := uint32(h), uint32(h>>32)|1
+	for j := 0; j < memTableFilterProbes; j++ {
+		bit := h1 % f.numBits
+		word, mask := &f.bits[bit/32], uint32(1)<<(bit%32)
+		for {
+			old := atomic.LoadUint32(word)
+			if old&mask != 0 || atomic.CompareAndSwapUint32(word, old, old|mask) {
+				break
+			}
+		}
+		h1 += delta
+	}
+}
+
+// mayContain returns false if no key with the prefix was added to the filter.
+func (f *memTableFilter) mayContain(prefix []byte) bool {
+	h := memTableFilterHash(prefix)
+	h1, delta := uint32(h), uint32(h>>32)|1
+	for j := 0; j < memTableFilterProbes; j++ {
+		bit := h1 % f.numBits
+		if atomic.LoadUint32(&f.bits[bit/32])&(uint32(1)<<(bit%32)) == 0 {
+			return false
+		}
+		h1 += delta
+	}
+	return true
+}
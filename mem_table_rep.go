@@ -0,0 +1,390 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/pebble/internal/arenaskl"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// MemTableArena is the fixed size chunk of memory from which a memtable
+// allocates its records. See Options.MemTableSize.
+type MemTableArena = arenaskl.Arena
+
+// MemTableRep is the data structure holding the point records of a memtable:
+// all records other than range deletions, which are held separately by the
+// memtable.
+type MemTableRep interface {
+	// NewInserter returns an inserter used to add a sequence of records, such
+	// as the point records of a batch, to the rep. An inserter is used by a
+	// single goroutine, but several inserters may add records to the rep
+	// concurrently, and concurrently with the iterators of the rep.
+	NewInserter() MemTableInserter
+
+	// NewIter returns an unpositioned iterator over the records of the rep.
+	// The iterator observes at least the records added before NewIter was
+	// called. Like the iterators of the other levels of the LSM, the lower
+	// bound only needs to be checked when positioning backward, and the upper
+	// bound only when positioning forward.
+	NewIter(lower, upper []byte) InternalIterator
+
+	// NewFlushIter returns an iterator used to flush the rep to an sstable.
+	// Only First and Next are called on it. As each record is returned, the
+	// number of arena bytes it occupies is added to *bytesFlushed.
+	NewFlushIter(bytesFlushed *uint64) InternalIterator
+}
+
+// MemTableInserter adds records to a MemTableRep. An inserter may retain
+// state between calls to Add, such as the position of the last record added
+// to the rep, to speed up adding records in sorted order.
+type MemTableInserter interface {
+	// Add adds a record to the rep. The key and value must be copied into
+	// memory allocated from the rep's arena, and the error returned by
+	// MemTableArena.Alloc must be returned if the arena is full. The same
+	// internal key is never added twice.
+	Add(key InternalKey, value []byte) error
+}
+
+// MemTableRepFactory creates the MemTableRep of each memtable. See
+// Options.MemTableRep.
+type MemTableRepFactory interface {
+	// Name is the name of the rep. It is stored in the OPTIONS file.
+	Name() string
+
+	// NewRep returns an empty rep which allocates its records from the arena
+	// and orders them using the comparison function.
+	NewRep(arena *MemTableArena, cmp Compare) MemTableRep
+}
+
+// SkiplistMemTableRep is the default MemTableRepFactory. Its reps are
+// lock-free skiplists with forward and reverse links, which support
+// concurrent insertion and iteration with a cost of O(log n) for each record
+// inserted or seek performed.
+var SkiplistMemTableRep MemTableRepFactory = skiplistRepFactory{}
+
+// VectorMemTableRep is a MemTableRepFactory whose reps append records to an
+// unsorted vector, and sort the records once they are iterated over. Inserts
+// are cheaper than with SkiplistMemTableRep, but each iterator created after
+// records were added must sort them first, including the iterators used by
+// point lookups. It is suited to bulk loads, in which the memtables are
+// rarely read before being flushed.
+var VectorMemTableRep MemTableRepFactory = vectorRepFactory{}
+
+type skiplistRepFactory struct{}
+
+func (skiplistRepFactory) Name() string {
+	return "pebble.skiplist"
+}
+
+func (skiplistRepFactory) NewRep(arena *MemTableArena, cmp Compare) MemTableRep {
+	return (*skiplistRep)(arenaskl.NewSkiplist(arena, cmp))
+}
+
+// skiplistRep implements MemTableRep using an arenaskl.Skiplist.
+type skiplistRep arenaskl.Skiplist
+
+func (s *skiplistRep) NewInserter() MemTableInserter {
+	return &skiplistInserter{list: (*arenaskl.Skiplist)(s)}
+}
+
+func (s *skiplistRep) NewIter(lower, upper []byte) InternalIterator {
+	return (*arenaskl.Skiplist)(s).NewIter(lower, upper)
+}
+
+func (s *skiplistRep) NewFlushIter(bytesFlushed *uint64) InternalIterator {
+	return (*arenaskl.Skiplist)(s).NewFlushIter(bytesFlushed)
+}
+
+// skiplistInserter implements MemTableInserter using an arenaskl.Inserter,
+// which caches the position of the last record added.
+type skiplistInserter struct {
+	list *arenaskl.Skiplist
+	ins  arenaskl.Inserter
+}
+
+func (i *skiplistInserter) Add(key InternalKey, value []byte) error {
+	return i.ins.Add(i.list, key, value)
+}
+
+type vectorRepFactory struct{}
+
+func (vectorRepFactory) Name() string {
+	return "pebble.vector"
+}
+
+func (vectorRepFactory) NewRep(arena *MemTableArena, cmp Compare) MemTableRep {
+	return &vectorRep{arena: arena, cmp: cmp}
+}
+
+// vectorEntry locates a record in the arena of a vectorRep, where it is
+// stored as the encoded internal key followed by the value. The entries hold
+// no pointers, so that the vector is cheap to grow and to scan for the
+// garbage collector.
+type vectorEntry struct {
+	offset    uint32
+	keySize   uint32
+	valueSize uint32
+}
+
+// vectorRep implements MemTableRep using a vector of records in insertion
+// order. The records are allocated from the arena, but the vector itself is
+// not.
+type vectorRep struct {
+	arena *MemTableArena
+	cmp   Compare
+	mu    struct {
+		sync.Mutex
+		// entries holds the records in the order they were added.
+		entries []vectorEntry
+		// sorted holds the first len(sorted) records of entries in sorted
+		// order. It is never modified once created as it may be in use by
+		// iterators.
+		sorted []vectorEntry
+	}
+}
+
+// NewInserter returns the rep itself, as the records are simply appended to
+// the vector.
+func (v *vectorRep) NewInserter() MemTableInserter {
+	return v
+}
+
+func (v *vectorRep) Add(key InternalKey, value []byte) error {
+	e := vectorEntry{
+		keySize:   uint32(key.Size()),
+		valueSize: uint32(len(value)),
+	}
+	var err error
+	if e.offset, err = v.arena.Alloc(e.keySize + e.valueSize); err != nil {
+		return err
+	}
+	buf := v.arena.Bytes(e.offset, e.keySize+e.valueSize)
+	key.Encode(buf)
+	copy(buf[e.keySize:], value)
+
+	v.mu.Lock()
+	v.mu.entries = append(v.mu.entries, e)
+	v.mu.Unlock()
+	return nil
+}
+
+// key returns the internal key of the record.
+func (v *vectorRep) key(e vectorEntry) InternalKey {
+	return base.DecodeInternalKey(v.arena.Bytes(e.offset, e.keySize))
+}
+
+// value returns the value of the record.
+func (v *vectorRep) value(e vectorEntry) []byte {
+	return v.arena.Bytes(e.offset+e.keySize, e.valueSize)
+}
+
+func (v *vectorRep) less(a, b vectorEntry) bool {
+	return base.InternalCompare(v.cmp, v.key(a), v.key(b)) < 0
+}
+
+// sorted returns the records added so far in sorted order. The records added
+// since the last call are sorted and merged with the previously sorted
+// records.
+func (v *vectorRep) sorted() []vectorEntry {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	a := v.mu.sorted
+	if len(a) == len(v.mu.entries) {
+		return a
+	}
+	b := append([]vectorEntry(nil), v.mu.entries[len(a):]...)
+	sort.Slice(b, func(i, j int) bool {
+		return v.less(b[i], b[j])
+	})
+	if len(a) == 0 {
+		v.mu.sorted = b
+		return b
+	}
+
+	merged := make([]vectorEntry, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if v.less(a[0], b[0]) {
+			merged, a = append(merged, a[0]), a[1:]
+		} else {
+			merged, b = append(merged, b[0]), b[1:]
+		}
+	}
+	merged = append(append(merged, a...), b...)
+	v.mu.sorted = merged
+	return merged
+}
+
+func (v *vectorRep) NewIter(lower, upper []byte) InternalIterator {
+	return &vectorIter{
+		rep:     v,
+		entries: v.sorted(),
+		lower:   lower,
+		upper:   upper,
+	}
+}
+
+func (v *vectorRep) NewFlushIter(bytesFlushed *uint64) InternalIterator {
+	return &vectorFlushIter{
+		vectorIter: vectorIter{
+			rep:     v,
+			entries: v.sorted(),
+		},
+		bytesFlushed: bytesFlushed,
+	}
+}
+
+// vectorIter is an iterator over the sorted records of a vectorRep.
+type vectorIter struct {
+	rep     *vectorRep
+	entries []vectorEntry
+	// pos is the index of the current record. It is -1 or len(entries) if the
+	// iterator is exhausted.
+	pos   int
+	key   InternalKey
+	lower []byte
+	upper []byte
+}
+
+// vectorIter implements the base.InternalIterator interface.
+var _ base.InternalIterator = (*vectorIter)(nil)
+
+// seek returns the index of the first record with a user key greater than or
+// equal to key.
+func (it *vectorIter) seek(key []byte) int {
+	return sort.Search(len(it.entries), func(i int) bool {
+		return it.rep.cmp(it.rep.key(it.entries[i]).UserKey, key) >= 0
+	})
+}
+
+// forward returns the current record, or (nil, nil) if the iterator is
+// exhausted or the record is at or after the upper bound.
+func (it *vectorIter) forward() (*InternalKey, []byte) {
+	if it.pos >= len(it.entries) {
+		return nil, nil
+	}
+	e := it.entries[it.pos]
+	it.key = it.rep.key(e)
+	if it.upper != nil && it.rep.cmp(it.upper, it.key.UserKey) <= 0 {
+		it.pos = len(it.entries)
+		return nil, nil
+	}
+	return &it.key, it.rep.value(e)
+}
+
+// backward returns the current record, or (nil, nil) if the iterator is
+// exhausted or the record is before the lower bound.
+func (it *vectorIter) backward() (*InternalKey, []byte) {
+	if it.pos < 0 {
+		return nil, nil
+	}
+	e := it.entries[it.pos]
+	it.key = it.rep.key(e)
+	if it.lower != nil && it.rep.cmp(it.lower, it.key.UserKey) > 0 {
+		it.pos = -1
+		return nil, nil
+	}
+	return &it.key, it.rep.value(e)
+}
+
+func (it *vectorIter) SeekGE(key []byte) (*InternalKey, []byte) {
+	it.pos = it.seek(key)
+	return it.forward()
+}
+
+func (it *vectorIter) SeekPrefixGE(prefix, key []byte) (*InternalKey, []byte) {
+	return it.SeekGE(key)
+}
+
+func (it *vectorIter) SeekLT(key []byte) (*InternalKey, []byte) {
+	it.pos = it.seek(key) - 1
+	return it.backward()
+}
+
+func (it *vectorIter) First() (*InternalKey, []byte) {
+	it.pos = 0
+	return it.forward()
+}
+
+func (it *vectorIter) Last() (*InternalKey, []byte) {
+	it.pos = len(it.entries) - 1
+	return it.backward()
+}
+
+func (it *vectorIter) Next() (*InternalKey, []byte) {
+	if it.pos < len(it.entries) {
+		it.pos++
+	}
+	return it.forward()
+}
+
+func (it *vectorIter) Prev() (*InternalKey, []byte) {
+	if it.pos >= 0 {
+		it.pos--
+	}
+	return it.backward()
+}
+
+func (it *vectorIter) Error() error {
+	return nil
+}
+
+func (it *vectorIter) Close() error {
+	it.entries = nil
+	return nil
+}
+
+func (it *vectorIter) SetBounds(lower, upper []byte) {
+	it.lower = lower
+	it.upper = upper
+}
+
+func (it *vectorIter) String() string {
+	return "memtable"
+}
+
+// vectorFlushIter is the iterator used to flush a vectorRep.
+type vectorFlushIter struct {
+	vectorIter
+	bytesFlushed *uint64
+}
+
+func (it *vectorFlushIter) SeekGE(key []byte) (*InternalKey, []byte) {
+	panic("pebble: SeekGE unimplemented")
+}
+
+func (it *vectorFlushIter) SeekPrefixGE(prefix, key []byte) (*InternalKey, []byte) {
+	panic("pebble: SeekPrefixGE unimplemented")
+}
+
+func (it *vectorFlushIter) SeekLT(key []byte) (*InternalKey, []byte) {
+	panic("pebble: SeekLT unimplemented")
+}
+
+func (it *vectorFlushIter) First() (*InternalKey, []byte) {
+	return it.flushed(it.vectorIter.First())
+}
+
+func (it *vectorFlushIter) Next() (*InternalKey, []byte) {
+	return it.flushed(it.vectorIter.Next())
+}
+
+func (it *vectorFlushIter) Last() (*InternalKey, []byte) {
+	panic("pebble: Last unimplemented")
+}
+
+func (it *vectorFlushIter) Prev() (*InternalKey, []byte) {
+	panic("pebble: Prev unimplemented")
+}
+
+func (it *vectorFlushIter) flushed(key *InternalKey, val []byte) (*InternalKey, []byte) {
+	if key != nil {
+		*it.bytesFlushed += uint64(key.Size() + len(val))
+	}
+	return key, val
+}
@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"strconv"
 	"strings"
@@ -32,7 +33,13 @@ func (m *memTable) set(key InternalKey, value []byte) error {
 		m.tombstones.invalidate(1)
 		return nil
 	}
-	return m.skl.Add(key, value)
+	if err := m.rep.NewInserter().Add(key, value); err != nil {
+		return err
+	}
+	if m.filter != nil {
+		m.filter.add(m.prefix(key.UserKey))
+	}
+	return nil
 }
 
 // count returns the number of entries in a DB.
@@ -63,6 +70,9 @@ func (m *memTable) bytesIterated(t *testing.T) (bytesIterated uint64) {
 	return bytesIterated
 }
 
+// memTableReps holds the MemTableRepFactories which are tested.
+var memTableReps = []MemTableRepFactory{SkiplistMemTableRep, VectorMemTableRep}
+
 func ikey(s string) InternalKey {
 	return base.MakeInternalKey([]byte(s), 0, InternalKeyKindSet)
 }
@@ -120,7 +130,15 @@ func TestMemTableBasic(t *testing.T) {
 }
 
 func TestMemTableCount(t *testing.T) {
-	m := newMemTable(memTableOptions{})
+	for _, rep := range memTableReps {
+		t.Run(rep.Name(), func(t *testing.T) {
+			testMemTableCount(t, rep)
+		})
+	}
+}
+
+func testMemTableCount(t *testing.T, rep MemTableRepFactory) {
+	m := newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
 	for i := 0; i < 200; i++ {
 		if j := m.count(); j != i {
 			t.Fatalf("count: got %d, want %d", j, i)
@@ -131,7 +149,15 @@ func TestMemTableCount(t *testing.T) {
 }
 
 func TestMemTableBytesIterated(t *testing.T) {
-	m := newMemTable(memTableOptions{})
+	for _, rep := range memTableReps {
+		t.Run(rep.Name(), func(t *testing.T) {
+			testMemTableBytesIterated(t, rep)
+		})
+	}
+}
+
+func testMemTableBytesIterated(t *testing.T, rep MemTableRepFactory) {
+	m := newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
 	for i := 0; i < 200; i++ {
 		bytesIterated := m.bytesIterated(t)
 		expected := m.inuseBytes()
@@ -144,7 +170,15 @@ func TestMemTableBytesIterated(t *testing.T) {
 }
 
 func TestMemTableEmpty(t *testing.T) {
-	m := newMemTable(memTableOptions{})
+	for _, rep := range memTableReps {
+		t.Run(rep.Name(), func(t *testing.T) {
+			testMemTableEmpty(t, rep)
+		})
+	}
+}
+
+func testMemTableEmpty(t *testing.T, rep MemTableRepFactory) {
+	m := newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
 	if !m.empty() {
 		t.Errorf("got !empty, want empty")
 	}
@@ -156,9 +190,17 @@ func TestMemTableEmpty(t *testing.T) {
 }
 
 func TestMemTable1000Entries(t *testing.T) {
+	for _, rep := range memTableReps {
+		t.Run(rep.Name(), func(t *testing.T) {
+			testMemTable1000Entries(t, rep)
+		})
+	}
+}
+
+func testMemTable1000Entries(t *testing.T, rep MemTableRepFactory) {
 	// Initialize the DB.
 	const N = 1000
-	m0 := newMemTable(memTableOptions{})
+	m0 := newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
 	for i := 0; i < N; i++ {
 		k := ikey(strconv.Itoa(i))
 		v := []byte(strings.Repeat("x", i))
@@ -231,13 +273,21 @@ func TestMemTable1000Entries(t *testing.T) {
 }
 
 func TestMemTableIter(t *testing.T) {
+	for _, rep := range memTableReps {
+		t.Run(rep.Name(), func(t *testing.T) {
+			testMemTableIter(t, rep)
+		})
+	}
+}
+
+func testMemTableIter(t *testing.T, rep MemTableRepFactory) {
 	var mem *memTable
 	for _, testdata := range []string{
 		"testdata/internal_iter_next", "testdata/internal_iter_bounds"} {
 		datadriven.RunTest(t, testdata, func(d *datadriven.TestData) string {
 			switch d.Cmd {
 			case "define":
-				mem = newMemTable(memTableOptions{})
+				mem = newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
 				for _, key := range strings.Split(d.Input, "\n") {
 					j := strings.Index(key, ":")
 					if err := mem.set(base.ParseInternalKey(key[:j]), []byte(key[j+1:])); err != nil {
@@ -278,6 +328,14 @@ func TestMemTableIter(t *testing.T) {
 }
 
 func TestMemTableDeleteRange(t *testing.T) {
+	for _, rep := range memTableReps {
+		t.Run(rep.Name(), func(t *testing.T) {
+			testMemTableDeleteRange(t, rep)
+		})
+	}
+}
+
+func testMemTableDeleteRange(t *testing.T, rep MemTableRepFactory) {
 	var mem *memTable
 	var seqNum uint64
 
@@ -294,7 +352,7 @@ func TestMemTableDeleteRange(t *testing.T) {
 				return err.Error()
 			}
 			if mem == nil {
-				mem = newMemTable(memTableOptions{})
+				mem = newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
 			}
 			if err := mem.apply(b, seqNum); err != nil {
 				return err.Error()
@@ -369,6 +427,101 @@ func TestMemTableConcurrentDeleteRange(t *testing.T) {
 	wg.Wait()
 }
 
+func TestMemTableParallelApply(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	b := newBatch(nil)
+	for i := 0; i < 2000; i++ {
+		key := []byte(fmt.Sprintf("%04d", rng.Intn(1000)))
+		switch rng.Intn(10) {
+		case 0:
+			require.NoError(t, b.Delete(key, nil))
+		case 1:
+			require.NoError(t, b.Merge(key, key, nil))
+		case 2:
+			end := []byte(fmt.Sprintf("%04d", rng.Intn(1000)))
+			require.NoError(t, b.DeleteRange(key, end, nil))
+		case 3:
+			require.NoError(t, b.LogData(key, nil))
+		default:
+			require.NoError(t, b.Set(key, key, nil))
+		}
+	}
+
+	contents := func(m *memTable) string {
+		var buf bytes.Buffer
+		for _, iter := range []internalIterator{m.newIter(nil), m.newRangeDelIter(nil)} {
+			for key, val := iter.First(); key != nil; key, val = iter.Next() {
+				fmt.Fprintf(&buf, "%s:%s\n", key, val)
+			}
+			require.NoError(t, iter.Close())
+		}
+		return buf.String()
+	}
+
+	const seqNum = 10
+	for _, rep := range memTableReps {
+		t.Run(rep.Name(), func(t *testing.T) {
+			m := newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
+			require.NoError(t, m.apply(b, seqNum))
+			expected := contents(m)
+
+			for _, parts := range []int{2, 3, 7, 16} {
+				m := newMemTable(memTableOptions{Options: &Options{MemTableRep: rep}})
+				next, tombstoneCount, err := m.applyParallel(b.Reader(), seqNum, int(b.Count()), parts)
+				require.NoError(t, err)
+				require.Equal(t, uint64(seqNum)+uint64(b.Count()), next)
+				m.tombstones.invalidate(tombstoneCount)
+				require.Equal(t, expected, contents(m), "parts=%d", parts)
+			}
+		})
+	}
+}
+
+func TestMemTableFilter(t *testing.T) {
+	var stats memTableFilterStats
+	opts := &Options{}
+	opts.Experimental.MemTableFilterSizeRatio = 0.02
+	m := newMemTable(memTableOptions{Options: opts, size: 1 << 20, filterStats: &stats})
+	require.NotNil(t, m.filter)
+
+	// Add the keys both serially and in parallel.
+	b := newBatch(nil)
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("a%04d", i)), nil, nil))
+	}
+	require.NoError(t, m.apply(b, 1))
+	b = newBatch(nil)
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("b%04d", i)), nil, nil))
+	}
+	_, _, err := m.applyParallel(b.Reader(), 2001, int(b.Count()), 4)
+	require.NoError(t, err)
+
+	// The filter has no false negatives.
+	for _, prefix := range []string{"a", "b"} {
+		for i := 0; i < 2000; i++ {
+			require.True(t, m.mayContain([]byte(fmt.Sprintf("%s%04d", prefix, i))))
+		}
+	}
+	require.Equal(t, uint64(4000), atomic.LoadUint64(&stats.misses))
+	require.Equal(t, uint64(0), atomic.LoadUint64(&stats.hits))
+
+	// Most of the absent keys are excluded by the filter.
+	for i := 0; i < 2000; i++ {
+		m.mayContain([]byte(fmt.Sprintf("c%04d", i)))
+	}
+	hits := atomic.LoadUint64(&stats.hits)
+	require.True(t, hits > 1900, "hits=%d", hits)
+
+	// Without a ratio, the memtable has no filter.
+	m = newMemTable(memTableOptions{Options: &Options{}})
+	require.Nil(t, m.filter)
+	require.True(t, m.mayContain([]byte("a")))
+}
+
 func buildMemTable(b *testing.B) (*memTable, [][]byte) {
 	m := newMemTable(memTableOptions{})
 	var keys [][]byte
@@ -422,3 +575,65 @@ func BenchmarkMemTableIterPrev(b *testing.B) {
 		_ = key
 	}
 }
+
+func BenchmarkMemTableApply(b *testing.B) {
+	const batchSize = 100
+	for _, rep := range memTableReps {
+		b.Run(rep.Name(), func(b *testing.B) {
+			opts := memTableOptions{Options: &Options{MemTableRep: rep}}
+			m := newMemTable(opts)
+			key := make([]byte, 8)
+			var seqNum uint64
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batch := newBatch(nil)
+				for j := 0; j < batchSize; j++ {
+					binary.BigEndian.PutUint64(key, uint64(i*batchSize+j))
+					_ = batch.Set(key, nil, nil)
+				}
+				if err := m.prepare(batch); err == arenaskl.ErrArenaFull {
+					m = newMemTable(opts)
+					err = m.prepare(batch)
+				}
+				if err := m.apply(batch, seqNum); err != nil {
+					b.Fatal(err)
+				}
+				m.writerUnref()
+				seqNum += batchSize
+			}
+		})
+	}
+}
+
+func BenchmarkMemTableApplyParallel(b *testing.B) {
+	const batchSize = 10000
+	batch := newBatch(nil)
+	key := make([]byte, 8)
+	for i := 0; i < batchSize; i++ {
+		binary.BigEndian.PutUint64(key, uint64(i))
+		_ = batch.Set(key, key, nil)
+	}
+
+	for _, threshold := range []int{0, 1000} {
+		b.Run(fmt.Sprintf("threshold=%d", threshold), func(b *testing.B) {
+			opts := &Options{MemTableSize: 64 << 20}
+			opts.Experimental.ParallelMemTableInsertThreshold = threshold
+			m := newMemTable(memTableOptions{Options: opts})
+			var seqNum uint64
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := m.prepare(batch); err == arenaskl.ErrArenaFull {
+					m = newMemTable(memTableOptions{Options: opts})
+					err = m.prepare(batch)
+				}
+				if err := m.apply(batch, seqNum); err != nil {
+					b.Fatal(err)
+				}
+				m.writerUnref()
+				seqNum += batchSize
+			}
+		})
+	}
+}
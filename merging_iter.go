@@ -39,6 +39,10 @@ type mergingIterLevel struct {
 	// positioning tombstones at lower levels which cannot possibly shadow the
 	// current key.
 	tombstone rangedel.Tombstone
+
+	// stats, if non-nil, accumulates the seeks of the level's iterator and the
+	// keys in the level which are deleted by range deletions.
+	stats *InternalIteratorStats
 }
 
 // mergingIter provides a merged view of multiple iterators from different
@@ -594,10 +598,12 @@ func (m *mergingIter) isNextEntryDeleted(item *mergingIterItem) bool {
 				if l.largestUserKey != nil && m.heap.cmp(l.largestUserKey, seekKey) < 0 {
 					seekKey = l.largestUserKey
 				}
+				m.recordRangeDeleted(item.index)
 				m.seekGE(seekKey, item.index)
 				return true
 			}
 			if l.tombstone.Deletes(item.key.SeqNum()) {
+				m.recordRangeDeleted(item.index)
 				m.nextEntry(item)
 				return true
 			}
@@ -606,6 +612,14 @@ func (m *mergingIter) isNextEntryDeleted(item *mergingIterItem) bool {
 	return false
 }
 
+// recordRangeDeleted records that the current key of the level at index was
+// found to be deleted by a range deletion.
+func (m *mergingIter) recordRangeDeleted(index int) {
+	if stats := m.levels[index].stats; stats != nil {
+		stats.RangeDeleted++
+	}
+}
+
 // Starting from the current entry, finds the first (next) entry that can be returned.
 func (m *mergingIter) findNextEntry() (*InternalKey, []byte) {
 	for m.heap.len() > 0 && m.err == nil {
@@ -736,10 +750,12 @@ func (m *mergingIter) isPrevEntryDeleted(item *mergingIterItem) bool {
 				if l.smallestUserKey != nil && m.heap.cmp(l.smallestUserKey, seekKey) > 0 {
 					seekKey = l.smallestUserKey
 				}
+				m.recordRangeDeleted(item.index)
 				m.seekLT(seekKey, item.index)
 				return true
 			}
 			if l.tombstone.Deletes(item.key.SeqNum()) {
+				m.recordRangeDeleted(item.index)
 				m.prevEntry(item)
 				return true
 			}
@@ -793,6 +809,9 @@ func (m *mergingIter) seekGE(key []byte, level int) {
 		}
 
 		l := &m.levels[level]
+		if l.stats != nil {
+			l.stats.Seeks++
+		}
 		if m.prefix != nil {
 			l.iterKey, l.iterValue = l.iter.SeekPrefixGE(m.prefix, key)
 		} else {
@@ -876,6 +895,9 @@ func (m *mergingIter) seekLT(key []byte, level int) {
 		}
 
 		l := &m.levels[level]
+		if l.stats != nil {
+			l.stats.Seeks++
+		}
 		l.iterKey, l.iterValue = l.iter.SeekLT(key)
 
 		if rangeDelIter := l.rangeDelIter; rangeDelIter != nil {
@@ -7,6 +7,7 @@ package pebble
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/humanize"
@@ -19,6 +20,10 @@ type CacheMetrics = cache.Metrics
 // FilterMetrics holds metrics for the filter policy
 type FilterMetrics = sstable.FilterMetrics
 
+// ReadaheadMetrics holds metrics for the background prefetching of data blocks
+// by sstable iterators.
+type ReadaheadMetrics = sstable.ReadaheadMetrics
+
 func formatCacheMetrics(buf *bytes.Buffer, m *CacheMetrics, name string) {
 	fmt.Fprintf(buf, "%7s %9s %7s %6.1f%%  (score == hit-rate)\n",
 		name,
@@ -114,6 +119,15 @@ func (m *LevelMetrics) format(buf *bytes.Buffer, score string) {
 		m.WriteAmp())
 }
 
+// WriteCategoryMetrics holds the metrics for a single class of writes subject
+// to the write bandwidth limit.
+type WriteCategoryMetrics struct {
+	// The number of bytes written.
+	BytesWritten uint64
+	// The cumulative time writes spent waiting on the write bandwidth limit.
+	ThrottledDuration time.Duration
+}
+
 // Metrics holds metrics for various subsystems of the DB such as the Cache,
 // Compactions, WAL, and per-Level metrics.
 //
@@ -138,8 +152,24 @@ type Metrics struct {
 
 	Filter FilterMetrics
 
+	// Iterator holds the statistics of the iterators which have been closed.
+	// The statistics of open iterators are not included.
+	Iterator struct {
+		// The number of closed iterators.
+		Count int64
+		// The sums of the corresponding IteratorMetrics fields of the closed
+		// iterators.
+		Stats         InternalIteratorStats
+		MemTableStats InternalIteratorStats
+		LevelStats    [numLevels]InternalIteratorStats
+	}
+
 	Levels [numLevels]LevelMetrics
 
+	// Readahead holds metrics for the background prefetching of data blocks
+	// into the block cache. See Options.Experimental.ReadaheadBlocks.
+	Readahead ReadaheadMetrics
+
 	MemTable struct {
 		// The number of bytes allocated by memtables and large (flushable)
 		// batches.
@@ -151,6 +181,11 @@ type Metrics struct {
 		ZombieSize uint64
 		// The count of zombie memtables.
 		ZombieCount int64
+		// The number of times Get consulted the bloom filter of a memtable
+		// and it showed the memtable does not contain the key (a hit), or may
+		// contain it (a miss). See Options.Experimental.MemTableFilterSizeRatio.
+		FilterHits   uint64
+		FilterMisses uint64
 	}
 
 	Table struct {
@@ -179,6 +214,18 @@ type Metrics struct {
 		// Number of bytes written to the WAL.
 		BytesWritten uint64
 	}
+
+	WriteBandwidth struct {
+		// The current write bandwidth limit in bytes per second, or zero if
+		// unlimited. See Options.MaxWriteBytesPerSecond.
+		Limit int
+		// Per-category write metrics. WAL writes are accounted against the limit
+		// but never delayed.
+		WAL        WriteCategoryMetrics
+		Flush      WriteCategoryMetrics
+		Copy       WriteCategoryMetrics
+		Compaction WriteCategoryMetrics
+	}
 }
 
 // ReadAmp returns the current read amplification of the database.
@@ -256,6 +303,7 @@ func (m *Metrics) formatWAL(buf *bytes.Buffer) {
 //    tcache         0     0 B    0.0%  (score == hit-rate)
 //    titers         0
 //    filter         -       -    0.0%  (score == utility)
+//    rahead        12    48 K   75.0%  (score == used-rate)
 //
 // The WAL "in" metric is the size of the batches written to the WAL. The WAL
 // "write" metric is the size of the physical data written to the WAL which
@@ -311,6 +359,15 @@ func (m *Metrics) String() string {
 		notApplicable,
 		notApplicable,
 		hitRate(m.Filter.Hits, m.Filter.Misses))
+	fmt.Fprintf(&buf, " rahead %9d %7s %6.1f%%  (score == used-rate)\n",
+		m.Readahead.Count,
+		humanize.IEC.Int64(m.Readahead.Bytes),
+		hitRate(m.Readahead.BytesUsed, m.Readahead.BytesWasted))
+	fmt.Fprintf(&buf, "  iters %9d %7s %6.1f%%  (size == read, score == block-hit-rate)\n",
+		m.Iterator.Count,
+		humanize.IEC.Uint64(m.Iterator.Stats.BlockBytesRead),
+		hitRate(int64(m.Iterator.Stats.BlocksCached),
+			int64(m.Iterator.Stats.BlocksLoaded-m.Iterator.Stats.BlocksCached)))
 	return buf.String()
 }
 
@@ -25,6 +25,14 @@ func TestMetricsFormat(t *testing.T) {
 	m.Flush.Count = 7
 	m.Filter.Hits = 8
 	m.Filter.Misses = 9
+	m.Readahead.Count = 10
+	m.Readahead.Bytes = 11
+	m.Readahead.BytesUsed = 8
+	m.Readahead.BytesWasted = 3
+	m.Iterator.Count = 12
+	m.Iterator.Stats.BlocksLoaded = 9
+	m.Iterator.Stats.BlocksCached = 6
+	m.Iterator.Stats.BlockBytesRead = 13
 	m.MemTable.Size = 10
 	m.MemTable.Count = 11
 	m.MemTable.ZombieSize = 12
@@ -81,6 +89,8 @@ zmemtbl        13    12 B
  tcache        17    16 B   48.6%  (score == hit-rate)
  titers        20
  filter         -       -   47.1%  (score == utility)
+ rahead        10    11 B   72.7%  (score == used-rate)
+  iters        12    13 B   66.7%  (size == read, score == block-hit-rate)
 `
 	if s := "\n" + m.String(); expected != s {
 		t.Fatalf("expected%s\nbut found%s", expected, s)
@@ -0,0 +1,353 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/internal/rangedel"
+)
+
+// MultiGet gets the values for the given keys. The returned values are
+// parallel to keys: values[i] is the value for keys[i], or nil if the DB does
+// not contain keys[i]. A key which is present with an empty value has a
+// non-nil, empty value.
+//
+// MultiGet is equivalent to calling Get for each of the keys, but it reads
+// all of the keys from a single consistent view of the DB, and it visits each
+// memtable and level once for the whole set of keys rather than once per key.
+//
+// The caller should not modify the contents of the returned slices, but it is
+// safe to modify the contents of the arguments after MultiGet returns. The
+// returned slices will remain valid until the returned Closer is closed. On
+// success, the caller MUST call closer.Close() or a memory leak will occur.
+func (d *DB) MultiGet(keys [][]byte) ([][]byte, io.Closer, error) {
+	return d.multiGetInternal(keys, nil /* batch */, nil /* snapshot */)
+}
+
+// multiGetResult holds the values returned by MultiGet. The values point into
+// buf, which is reused via multiGetResultPool once the result is closed.
+type multiGetResult struct {
+	values [][]byte
+	buf    []byte
+}
+
+var multiGetResultPool = sync.Pool{
+	New: func() interface{} {
+		return &multiGetResult{}
+	},
+}
+
+// Close implements io.Closer, releasing the values returned by MultiGet.
+func (r *multiGetResult) Close() error {
+	for i := range r.values {
+		r.values[i] = nil
+	}
+	r.values = r.values[:0]
+	r.buf = r.buf[:0]
+	multiGetResultPool.Put(r)
+	return nil
+}
+
+// multiGetKey tracks the lookup state for a single key in a MultiGet.
+type multiGetKey struct {
+	key []byte
+	// index is the position of key in the slice of keys passed to MultiGet.
+	index int
+	// done is set once the value of the key has been determined. No further
+	// memtables or levels need to be searched for the key.
+	done bool
+	// found is set if the key has a value, which is stored in
+	// multiGet.res.buf[start:end].
+	found      bool
+	start, end int
+	// merger accumulates the Merge operands found for the key, from newest to
+	// oldest.
+	merger ValueMerger
+}
+
+// multiGet performs a batch of point lookups. The keys are sorted, so that
+// each memtable and level can be searched with a sequence of increasing
+// seeks. For the levels, the seeks are performed by a levelIter which keeps
+// the current table open until a key lies beyond it, and uses
+// SeekPrefixGE so that a table's bloom filter can skip the table.
+type multiGet struct {
+	cmp      Compare
+	equal    Equal
+	merge    Merge
+	split    Split
+	snapshot uint64
+	keys     []multiGetKey
+	res      *multiGetResult
+	err      error
+}
+
+func (d *DB) multiGetInternal(
+	keys [][]byte, b *Batch, s *Snapshot,
+) ([][]byte, io.Closer, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+
+	// Grab and reference the current readState. This prevents the underlying
+	// files in the associated version from being deleted if there is a current
+	// compaction. The values are copied out before the readState is unref'd.
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	// Determine the seqnum to read at after grabbing the read state (current and
+	// memtables) above.
+	var seqNum uint64
+	if s != nil {
+		seqNum = s.seqNum
+	} else {
+		seqNum = atomic.LoadUint64(&d.mu.versions.visibleSeqNum)
+	}
+
+	m := &multiGet{
+		cmp:      d.cmp,
+		equal:    d.equal,
+		merge:    d.merge,
+		split:    d.split,
+		snapshot: seqNum,
+		keys:     make([]multiGetKey, len(keys)),
+		res:      multiGetResultPool.Get().(*multiGetResult),
+	}
+	for i := range keys {
+		m.keys[i] = multiGetKey{key: keys[i], index: i}
+	}
+	sort.Slice(m.keys, func(i, j int) bool {
+		return m.cmp(m.keys[i].key, m.keys[j].key) < 0
+	})
+
+	if b != nil {
+		m.searchBatch(b)
+	}
+
+	// Strip off memtables which cannot possibly contain the seqNum being read
+	// at.
+	memtables := readState.memtables
+	for len(memtables) > 0 {
+		n := len(memtables)
+		if logSeqNum := memtables[n-1].logSeqNum; logSeqNum < seqNum {
+			break
+		}
+		memtables = memtables[:n-1]
+	}
+	for i := len(memtables) - 1; i >= 0 && m.pending(); i-- {
+		mem := memtables[i]
+		m.search(mem.newIter(nil), mem.newRangeDelIter(nil))
+	}
+
+	// Search the L0 sublevels from newest to oldest, followed by L1-L6.
+	var li levelIter
+	iterOpts := IterOptions{logger: d.opts.Logger}
+	current := readState.current
+	for i := len(current.L0Sublevels.Levels) - 1; i >= 0 && m.pending(); i-- {
+		files := manifest.NewLevelSlice(current.L0Sublevels.Levels[i]).Iter()
+		li.init(iterOpts, d.cmp, d.newIters, files, manifest.L0Sublevel(i), nil)
+		m.searchLevel(&li)
+	}
+	for level := 1; level < numLevels && m.pending(); level++ {
+		files := current.Levels[level].Iter()
+		if files.Empty() {
+			continue
+		}
+		li.init(iterOpts, d.cmp, d.newIters, files, manifest.Level(level), nil)
+		m.searchLevel(&li)
+	}
+
+	// Any keys which are still pending have reached the bottom of the LSM.
+	for i := range m.keys {
+		if k := &m.keys[i]; !k.done {
+			m.finish(k)
+		}
+	}
+	if m.err != nil {
+		_ = m.res.Close()
+		return nil, nil, m.err
+	}
+
+	res := m.res
+	res.values = append(res.values[:0], make([][]byte, len(keys))...)
+	for i := range m.keys {
+		if k := &m.keys[i]; k.found {
+			v := res.buf[k.start:k.end:k.end]
+			if v == nil {
+				v = []byte{}
+			}
+			res.values[k.index] = v
+		}
+	}
+	return res.values, res, nil
+}
+
+// pending returns true if the value of any of the keys is yet to be
+// determined.
+func (m *multiGet) pending() bool {
+	if m.err != nil {
+		return false
+	}
+	for i := range m.keys {
+		if !m.keys[i].done {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *multiGet) searchBatch(b *Batch) {
+	m.search(b.newInternalIter(nil), b.newRangeDelIter(nil))
+}
+
+// search looks up the pending keys in a batch or memtable, closing the
+// iterators when done.
+func (m *multiGet) search(iter, rangeDelIter internalIterator) {
+	m.searchIter(iter, &rangeDelIter, nil /* levelIter */)
+	m.err = firstError(m.err, iter.Close())
+	if rangeDelIter != nil {
+		m.err = firstError(m.err, rangeDelIter.Close())
+	}
+}
+
+// searchLevel looks up the pending keys in an L0 sublevel or a level, closing
+// the levelIter when done.
+func (m *multiGet) searchLevel(li *levelIter) {
+	var rangeDelIter internalIterator
+	li.initRangeDel(&rangeDelIter)
+	li.split = m.split
+	m.searchIter(li, &rangeDelIter, li)
+	m.err = firstError(m.err, li.Close())
+}
+
+// searchIter looks up each of the pending keys in iter, in order. The range
+// tombstones which apply to the entries returned by iter are read from
+// *rangeDelIter. If iter is a levelIter, li is non-nil and *rangeDelIter is
+// updated as li moves between tables.
+func (m *multiGet) searchIter(
+	iter internalIterator, rangeDelIter *internalIterator, li *levelIter,
+) {
+	for i := range m.keys {
+		k := &m.keys[i]
+		if k.done {
+			continue
+		}
+
+		var ikey *InternalKey
+		var value []byte
+		if li != nil {
+			p := k.key
+			if m.split != nil {
+				p = k.key[:m.split(k.key)]
+			}
+			ikey, value = iter.SeekPrefixGE(p, k.key)
+		} else {
+			ikey, value = iter.SeekGE(k.key)
+		}
+
+		var tombstone rangedel.Tombstone
+		var tombstoneFile *fileMetadata
+		checked := false
+		for ; ; ikey, value = iter.Next() {
+			// A single user-key can be spread across multiple tables in a level,
+			// and every move of a levelIter potentially switches to a new table
+			// with its own range tombstones.
+			if t := *rangeDelIter; t != nil && (!checked || (li != nil && li.iterFile != tombstoneFile)) {
+				checked = true
+				if li != nil {
+					tombstoneFile = li.iterFile
+				}
+				tombstone = rangedel.Get(m.cmp, t, k.key, m.snapshot)
+			}
+			if ikey == nil || !m.equal(k.key, ikey.UserKey) {
+				break
+			}
+			if tombstone.Deletes(ikey.SeqNum()) {
+				break
+			}
+			// A levelIter returns range deletion boundary keys at the end of
+			// tables containing range tombstones. These are not point entries.
+			if !ikey.Visible(m.snapshot) || ikey.Kind() == InternalKeyKindRangeDelete {
+				continue
+			}
+			if m.add(k, ikey, value) || m.err != nil {
+				break
+			}
+		}
+		if m.err == nil {
+			m.err = iter.Error()
+		}
+		if m.err != nil {
+			return
+		}
+
+		// If we have a tombstone from this level it is guaranteed to delete the
+		// key in lower levels.
+		if !k.done && !tombstone.Empty() {
+			m.finish(k)
+		}
+	}
+}
+
+// add processes an entry for k, from newest to oldest. It returns true once
+// the value of the key has been determined.
+func (m *multiGet) add(k *multiGetKey, ikey *InternalKey, value []byte) bool {
+	switch ikey.Kind() {
+	case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		m.finish(k)
+		return true
+
+	case InternalKeyKindSet:
+		if k.merger != nil {
+			m.err = k.merger.MergeOlder(value)
+		} else {
+			m.setValue(k, value)
+		}
+		m.finish(k)
+		return true
+
+	case InternalKeyKindMerge:
+		if k.merger == nil {
+			k.merger, m.err = m.merge(k.key, value)
+		} else {
+			m.err = k.merger.MergeOlder(value)
+		}
+		return false
+
+	default:
+		m.err = errors.Errorf("pebble: invalid internal key kind: %d", errors.Safe(ikey.Kind()))
+		return true
+	}
+}
+
+// finish marks the value of k as determined, completing any pending merge.
+func (m *multiGet) finish(k *multiGetKey) {
+	k.done = true
+	if k.merger == nil || m.err != nil {
+		return
+	}
+	value, closer, err := k.merger.Finish()
+	k.merger = nil
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.setValue(k, value)
+	if closer != nil {
+		m.err = closer.Close()
+	}
+}
+
+func (m *multiGet) setValue(k *multiGetKey, value []byte) {
+	k.found = true
+	k.start = len(m.res.buf)
+	m.res.buf = append(m.res.buf, value...)
+	k.end = len(m.res.buf)
+}
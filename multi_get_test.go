@@ -0,0 +1,206 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/rand"
+)
+
+// checkMultiGet verifies that MultiGet returns the same values as calling Get
+// for each of the keys.
+func checkMultiGet(
+	t *testing.T,
+	get func([]byte) ([]byte, io.Closer, error),
+	multiGet func([][]byte) ([][]byte, io.Closer, error),
+	keys [][]byte,
+) {
+	values, closer, err := multiGet(keys)
+	require.NoError(t, err)
+	defer closer.Close()
+	require.Equal(t, len(keys), len(values))
+
+	for i, key := range keys {
+		v, c, err := get(key)
+		if errors.Is(err, ErrNotFound) {
+			if values[i] != nil {
+				t.Fatalf("%q: expected not found, but got %q", key, values[i])
+			}
+			continue
+		}
+		require.NoError(t, err)
+		if values[i] == nil || !bytes.Equal(v, values[i]) {
+			t.Fatalf("%q: expected %q, but got %q", key, v, values[i])
+		}
+		require.NoError(t, c.Close())
+	}
+}
+
+func TestMultiGet(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	d, err := Open("", &Options{
+		FS:                    vfs.NewMem(),
+		L0CompactionThreshold: 4,
+		Levels:                []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+		MemTableSize:          64 << 10,
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	const keyCount = 200
+	key := func() []byte {
+		return []byte(fmt.Sprintf("%04d", rng.Intn(keyCount)))
+	}
+	randomKeys := func() [][]byte {
+		keys := make([][]byte, rng.Intn(50))
+		for i := range keys {
+			keys[i] = key()
+		}
+		return keys
+	}
+
+	var snapshots []*Snapshot
+	for i := 0; i < 5000; i++ {
+		switch n := rng.Intn(100); {
+		case n < 50:
+			require.NoError(t, d.Set(key(), []byte(fmt.Sprint(i)), nil))
+		case n < 70:
+			require.NoError(t, d.Merge(key(), []byte(fmt.Sprint(i)), nil))
+		case n < 85:
+			require.NoError(t, d.Delete(key(), nil))
+		case n < 87:
+			start, end := key(), key()
+			if bytes.Compare(start, end) > 0 {
+				start, end = end, start
+			}
+			require.NoError(t, d.DeleteRange(start, end, nil))
+		case n < 89:
+			require.NoError(t, d.Flush())
+		case n < 90:
+			snapshots = append(snapshots, d.NewSnapshot())
+		default:
+			keys := randomKeys()
+			checkMultiGet(t, d.Get, d.MultiGet, keys)
+			if len(snapshots) > 0 {
+				s := snapshots[rng.Intn(len(snapshots))]
+				checkMultiGet(t, s.Get, s.MultiGet, keys)
+			}
+
+			b := d.NewIndexedBatch()
+			for j := 0; j < 10; j++ {
+				switch rng.Intn(4) {
+				case 0:
+					require.NoError(t, b.Set(key(), []byte(fmt.Sprintf("b%d", j)), nil))
+				case 1:
+					require.NoError(t, b.Merge(key(), []byte(fmt.Sprintf("b%d", j)), nil))
+				case 2:
+					require.NoError(t, b.Delete(key(), nil))
+				case 3:
+					start, end := key(), key()
+					if bytes.Compare(start, end) > 0 {
+						start, end = end, start
+					}
+					require.NoError(t, b.DeleteRange(start, end, nil))
+				}
+			}
+			checkMultiGet(t, b.Get, b.MultiGet, keys)
+			require.NoError(t, b.Close())
+		}
+	}
+	for _, s := range snapshots {
+		require.NoError(t, s.Close())
+	}
+}
+
+func TestMultiGetEmptyValue(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	values, closer, err := d.MultiGet([][]byte{[]byte("b"), []byte("a")})
+	require.NoError(t, err)
+	require.Nil(t, values[0])
+	require.NotNil(t, values[1])
+	require.Equal(t, 0, len(values[1]))
+	require.NoError(t, closer.Close())
+
+	_, _, err = d.NewBatch().MultiGet(nil)
+	require.Equal(t, ErrNotIndexed, err)
+}
+
+func BenchmarkMultiGet(b *testing.B) {
+	const keyCount = 100000
+	d, err := Open("", &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+
+	val := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < keyCount; i++ {
+		if err := d.Set([]byte(fmt.Sprintf("%08d", 2*i)), val, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := d.Compact([]byte("0"), []byte("9")); err != nil {
+		b.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	for _, n := range []int{10, 100, 1000} {
+		// Half of the keys are present in the DB.
+		keys := make([][]byte, n)
+		for i := range keys {
+			keys[i] = []byte(fmt.Sprintf("%08d", rng.Intn(2*keyCount)))
+		}
+
+		b.Run(fmt.Sprintf("keys=%d/get", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, key := range keys {
+					_, closer, err := d.Get(key)
+					if err == nil {
+						closer.Close()
+					} else if err != ErrNotFound {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("keys=%d/multi-get", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, closer, err := d.MultiGet(keys)
+				if err != nil {
+					b.Fatal(err)
+				}
+				closer.Close()
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"runtime"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -37,6 +38,47 @@ const (
 	maxMemTableSize = 4 << 30 // 4 GB
 )
 
+// writeOptionsFile writes the serialized options to the OPTIONS file with the
+// specified file number and syncs the data directory.
+func (d *DB) writeOptionsFile(fileNum FileNum, options string) error {
+	optionsFile, err := d.opts.FS.Create(
+		base.MakeFilename(d.opts.FS, d.dirname, fileTypeOptions, fileNum))
+	if err != nil {
+		return err
+	}
+	if _, err := optionsFile.Write([]byte(options)); err != nil {
+		return err
+	}
+	_ = optionsFile.Sync()
+	_ = optionsFile.Close()
+	return d.dataDir.Sync()
+}
+
+// largeBatchThreshold returns the threshold at which a batch is considered
+// "large" for the given memtable size.
+func largeBatchThreshold(memTableSize int) int64 {
+	return int64(memTableSize-int(memTableEmptySize)) / 2
+}
+
+// wrapDiskHealthChecks wraps opts.FS in order to report slow and stalled disk
+// operations according to the disk health checking options. The FS is
+// returned unwrapped if disk health checking is disabled.
+func wrapDiskHealthChecks(opts *Options) vfs.FS {
+	healthOpts := vfs.DiskHealthCheckingOptions{
+		SlowThreshold: opts.DiskSlowThreshold,
+		OnSlowDisk: func(path string, duration time.Duration) {
+			opts.EventListener.DiskSlow(DiskSlowInfo{Path: path, Duration: duration})
+		},
+	}
+	if opts.DiskStallHandler != nil {
+		healthOpts.StallThreshold = opts.DiskStallThreshold
+		healthOpts.OnStall = func(path string, duration time.Duration) {
+			opts.DiskStallHandler(DiskSlowInfo{Path: path, Duration: duration})
+		}
+	}
+	return vfs.NewDiskHealthCheckingFS(opts.FS, healthOpts)
+}
+
 // Open opens a DB whose files live in the given directory.
 func Open(dirname string, opts *Options) (db *DB, _ error) {
 	// Make a copy of the options so that we don't mutate the passed in options.
@@ -45,6 +87,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	if err := opts.Validate(); err != nil {
 		return nil, err
 	}
+	opts.FS = wrapDiskHealthChecks(opts)
 
 	if opts.Cache == nil {
 		opts.Cache = cache.New(cacheDefaultSize)
@@ -62,7 +105,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		merge:               opts.Merger.Merge,
 		split:               opts.Comparer.Split,
 		abbreviatedKey:      opts.Comparer.AbbreviatedKey,
-		largeBatchThreshold: (opts.MemTableSize - int(memTableEmptySize)) / 2,
+		largeBatchThreshold: largeBatchThreshold(opts.MemTableSize),
 		logRecycler:         logRecycler{limit: opts.MemTableStopWritesThreshold + 1},
 		closedCh:            make(chan struct{}),
 	}
@@ -107,6 +150,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	})
 	d.compactionLimiter = rate.NewLimiter(rate.Limit(d.opts.MinCompactionRate), d.opts.MinCompactionRate)
 	d.flushLimiter = rate.NewLimiter(rate.Limit(d.opts.MinFlushRate), d.opts.MinFlushRate)
+	d.writeLimiter = newWriteLimiter(d.opts.MaxWriteBytesPerSecond)
 	d.mu.nextJobID = 1
 	d.mu.mem.nextSize = opts.MemTableSize
 	if d.mu.mem.nextSize > initialMemTableSize {
@@ -301,6 +345,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			BytesPerSync:    d.opts.BytesPerSync,
 			PreallocateSize: d.walPreallocateSize(),
 		})
+		logFile = newLimitedFile(logFile, d.writeLimiter, writePriorityWAL)
 		d.mu.log.LogWriter = record.NewLogWriter(logFile, newLogNum)
 		d.mu.log.LogWriter.SetMinSyncInterval(d.opts.WALMinSyncInterval)
 		d.mu.versions.metrics.WAL.Files++
@@ -321,17 +366,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	if !d.opts.ReadOnly {
 		// Write the current options to disk.
 		d.optionsFileNum = d.mu.versions.getNextFileNum()
-		optionsFile, err := opts.FS.Create(
-			base.MakeFilename(opts.FS, dirname, fileTypeOptions, d.optionsFileNum))
-		if err != nil {
-			return nil, err
-		}
-		if _, err := optionsFile.Write([]byte(opts.String())); err != nil {
-			return nil, err
-		}
-		_ = optionsFile.Sync()
-		_ = optionsFile.Close()
-		if err := d.dataDir.Sync(); err != nil {
+		if err := d.writeOptionsFile(d.optionsFileNum, opts.String()); err != nil {
 			return nil, err
 		}
 	}
@@ -347,6 +382,8 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	if !d.opts.ReadOnly && !d.opts.private.disableTableStats {
 		d.maybeCollectTableStats()
 	}
+	d.mu.consistencyScan.cond.L = &d.mu.Mutex
+	d.maybeStartConsistencyScanner()
 	d.maybeScheduleFlush()
 	d.maybeScheduleCompaction()
 
@@ -513,7 +550,7 @@ func (d *DB) replayWAL(
 		seqNum := b.SeqNum()
 		maxSeqNum = seqNum + uint64(b.Count())
 
-		if b.memTableSize >= uint32(d.largeBatchThreshold) {
+		if int64(b.memTableSize) >= atomic.LoadInt64(&d.largeBatchThreshold) {
 			flushMem()
 			// Make a copy of the data slice since it is currently owned by buf and will
 			// be reused in the next iteration.
@@ -47,6 +47,12 @@ type FilterWriter = base.FilterWriter
 // FilterPolicy exports the base.FilterPolicy type.
 type FilterPolicy = base.FilterPolicy
 
+// PrefixExtractor exports the base.PrefixExtractor type.
+type PrefixExtractor = base.PrefixExtractor
+
+// FixedPrefixExtractor exports the base.FixedPrefixExtractor type.
+type FixedPrefixExtractor = base.FixedPrefixExtractor
+
 // TableFormat exports the base.TableFormat type.
 type TableFormat = sstable.TableFormat
 
@@ -54,6 +60,17 @@ type TableFormat = sstable.TableFormat
 const (
 	TableFormatRocksDBv2 = sstable.TableFormatRocksDBv2
 	TableFormatLevelDB   = sstable.TableFormatLevelDB
+	TableFormatPebblev1  = sstable.TableFormatPebblev1
+	TableFormatPebblev2  = sstable.TableFormatPebblev2
+)
+
+// DataBlockIndexType exports the sstable.DataBlockIndexType type.
+type DataBlockIndexType = sstable.DataBlockIndexType
+
+// Exported DataBlockIndexType constants.
+const (
+	DataBlockBinarySearch  = sstable.DataBlockBinarySearch
+	DataBlockBinaryAndHash = sstable.DataBlockBinaryAndHash
 )
 
 // TablePropertyCollector exports the sstable.TablePropertyCollector type.
@@ -77,6 +94,20 @@ type IterOptions struct {
 	// boundary the iterator will return Valid()==false. Setting UpperBound
 	// effectively truncates the key space visible to the iterator.
 	UpperBound []byte
+	// Prefix, if non-nil, restricts iteration to the keys whose prefix, as
+	// determined by Comparer.Split, is equal to Prefix. Every seek uses the
+	// prefix to consult the sstable bloom filters and skip files which cannot
+	// contain the prefix, and the iterator becomes invalid as soon as it moves
+	// past the keys with the prefix in either direction. Prefix may be combined
+	// with LowerBound and UpperBound. The Comparer must provide a Split
+	// function.
+	//
+	// Unlike SeekPrefixGE, reverse iteration is supported. Note that the end of
+	// a prefix cannot be derived from Comparer.Split, so positioning at the
+	// last key with the prefix (via Last, a SeekLT beyond the prefix, or a Prev
+	// after forward iteration exhausted the prefix) steps forward over the
+	// prefix's keys before iterating in reverse.
+	Prefix []byte
 	// TableFilter can be used to filter the tables that are scanned during
 	// iteration based on the user properties. Return true to scan the table and
 	// false to skip scanning.
@@ -84,6 +115,9 @@ type IterOptions struct {
 
 	// Internal options.
 	logger Logger
+	// stats, if non-nil, accumulates the statistics of the sstable iterators
+	// created with these options.
+	stats *InternalIteratorStats
 }
 
 // GetLowerBound returns the LowerBound or nil if the receiver is nil.
@@ -163,6 +197,14 @@ type LevelOptions struct {
 	// The default value is 90
 	BlockSizeThreshold int
 
+	// DataBlockIndexType specifies the index used to search within data
+	// blocks. DataBlockBinaryAndHash adds a hash index to each data block
+	// which speeds up point lookups. The option is ignored unless
+	// Options.TableFormat is TableFormatPebblev2.
+	//
+	// The default value is DataBlockBinarySearch.
+	DataBlockIndexType DataBlockIndexType
+
 	// Compression defines the per-block compression to use.
 	//
 	// The default value (DefaultCompression) uses snappy compression.
@@ -172,7 +214,8 @@ type LevelOptions struct {
 	// reduce disk reads for Get calls.
 	//
 	// One such implementation is bloom.FilterPolicy(10) from the pebble/bloom
-	// package.
+	// package. ribbon.FilterPolicy from the pebble/ribbon package uses less
+	// space for the same false positive rate at a higher construction cost.
 	//
 	// The default value means to use no filter.
 	FilterPolicy FilterPolicy
@@ -195,6 +238,24 @@ type LevelOptions struct {
 	// The default value is the value of BlockSize.
 	IndexBlockSize int
 
+	// PartitionFilters, if true, partitions the table filter of sstables with
+	// a two-level index into one filter partition per index partition. Only the
+	// small top-level filter index needs to remain in the block cache, while
+	// the partitions are loaded on demand and may be evicted. The option has no
+	// effect if FilterPolicy is nil.
+	PartitionFilters bool
+
+	// PrefixExtractor, if non-nil, causes the prefix of each key extracted by
+	// the PrefixExtractor to be added to the filter. Iterators whose lower and
+	// upper bounds share a common extracted prefix skip sstables whose filter
+	// rules the prefix out. The option has no effect if FilterPolicy is nil.
+	// A PrefixExtractor requires the DefaultComparer, as skipping tables
+	// relies on the keys sharing a byte prefix being contiguous under a
+	// bytewise ordering.
+	//
+	// The default value means to use no prefix extractor.
+	PrefixExtractor PrefixExtractor
+
 	// The target file size for the level.
 	TargetFileSize int64
 }
@@ -268,6 +329,23 @@ type Options struct {
 	// TODO(peter): untested
 	DisableWAL bool
 
+	// DiskSlowThreshold is the duration after which an outstanding write, sync,
+	// create or remove of a file is reported via EventListener.DiskSlow. Disk
+	// slowness detection is disabled if zero (the default).
+	DiskSlowThreshold time.Duration
+
+	// DiskStallThreshold is the duration after which an outstanding write,
+	// sync, create or remove of a file is considered stalled and
+	// DiskStallHandler is invoked. It should be larger than DiskSlowThreshold.
+	// Disk stall detection is disabled if zero (the default) or if
+	// DiskStallHandler is nil.
+	DiskStallThreshold time.Duration
+
+	// DiskStallHandler is invoked when a disk operation has been outstanding
+	// for longer than DiskStallThreshold. It is typically used to terminate the
+	// process, as a DB whose disk is wedged will otherwise hang indefinitely.
+	DiskStallHandler func(DiskSlowInfo)
+
 	// ErrorIfExists is whether it is an error if the database already exists.
 	//
 	// The default value is false.
@@ -322,6 +400,40 @@ type Options struct {
 		// deletion. Disk space cannot be reclaimed until the range deletion
 		// is flushed. No automatic flush occurs if zero.
 		DeleteRangeFlushDelay time.Duration
+
+		// ConsistencyScanInterval configures how long the database waits
+		// between background consistency scans. A consistency scan reads
+		// every block of every live sstable and verifies its checksum,
+		// reporting corruption through EventListener.BackgroundError. No
+		// consistency scans are performed if zero.
+		ConsistencyScanInterval time.Duration
+
+		// ConsistencyScanBytesPerSecond limits the rate at which consistency
+		// scans read sstables. The rate is unlimited if zero.
+		ConsistencyScanBytesPerSecond int
+
+		// ReadaheadBlocks is the maximum number of data blocks an sstable
+		// iterator prefetches into the block cache in the background once it
+		// is reading blocks sequentially. No blocks are prefetched if zero. See
+		// sstable.ReaderOptions.ReadaheadBlocks.
+		ReadaheadBlocks int
+
+		// ParallelMemTableInsertThreshold is the minimum number of records in
+		// a batch for the batch to be inserted into the memtable by several
+		// goroutines in parallel, rather than by the committing goroutine
+		// alone. The records are split into up to GOMAXPROCS parts of at least
+		// 128 records each. The batch only becomes visible once all of the
+		// parts have been inserted. Batches are always inserted by a single
+		// goroutine if zero.
+		ParallelMemTableInsertThreshold int
+
+		// MemTableFilterSizeRatio is the size of the bloom filter maintained
+		// by each MemTable, as a fraction of the MemTable's size. The filter
+		// holds the prefixes (see Comparer.Split) of the point keys in the
+		// MemTable, and allows Get to skip MemTables which don't contain the
+		// key. A ratio of 0.02 gives a filter of around 10 bits per key for
+		// records of 50 bytes. MemTables have no filters if zero.
+		MemTableFilterSizeRatio float64
 	}
 
 	// Filters is a map from filter policy name to filter policy. It is used for
@@ -330,6 +442,11 @@ type Options struct {
 	// map during normal usage of a DB.
 	Filters map[string]FilterPolicy
 
+	// PrefixExtractors is a map from prefix extractor name to prefix
+	// extractor. Like Filters, it is used for debugging tools and does not
+	// need to be populated during normal usage of a DB.
+	PrefixExtractors map[string]PrefixExtractor
+
 	// FS provides the interface for persistent file storage.
 	//
 	// The default value uses the underlying operating system's file system.
@@ -381,6 +498,14 @@ type Options struct {
 	// the queued MemTables.
 	MemTableSize int
 
+	// MemTableRep creates the data structure holding the point records of each
+	// MemTable. The choice of rep does not affect the contents of the DB, and
+	// may be changed when the DB is reopened.
+	//
+	// The default is SkiplistMemTableRep. VectorMemTableRep is faster for
+	// bulk loads which rarely read from the MemTables.
+	MemTableRep MemTableRepFactory
+
 	// Hard limit on the size of queued of MemTables. Writes are stopped when the
 	// sum of the queued memtable sizes exceeds
 	// MemTableStopWritesThreshold*MemTableSize. This value should be at least 2
@@ -401,6 +526,17 @@ type Options struct {
 	// default is 1 MB/s.
 	MinFlushRate int
 
+	// MaxWriteBytesPerSecond is a limit on the combined write bandwidth of
+	// flushes, compactions, the copies performed by ingestion and checkpoints
+	// when hard linking is not possible, and the WAL. Writes are admitted in
+	// priority order: WAL writes are accounted for but never delayed, and
+	// flushes take precedence over copies which take precedence over
+	// compactions. The limit can be changed at runtime via
+	// DB.SetMaxWriteBytesPerSecond.
+	//
+	// The default value is 0 which means no limit.
+	MaxWriteBytesPerSecond int
+
 	// MaxConcurrentCompactions specifies the maximum number of concurrent
 	// compactions. The default is 1. Concurrent compactions are only performed
 	// when L0 read-amplification passes the L0CompactionConcurrency threshold.
@@ -415,7 +551,12 @@ type Options struct {
 	// TableFormat specifies the format version for writing sstables. The default
 	// is TableFormatRocksDBv2 which creates RocksDB compatible sstables. Use
 	// TableFormatLevelDB to create LevelDB compatible sstable which can be used
-	// by a wider range of tools and libraries.
+	// by a wider range of tools and libraries. Use TableFormatPebblev1 to store
+	// data blocks in a columnar layout which separates key prefixes (as defined
+	// by Comparer.Split), key suffixes and values, reducing the CPU and block
+	// cache cost of scans over keys with many versions. Use TableFormatPebblev2
+	// to allow data blocks to carry a hash index for point lookups (see
+	// LevelOptions.DataBlockIndexType).
 	TableFormat TableFormat
 
 	// TablePropertyCollectors is a list of TablePropertyCollector creation
@@ -521,6 +662,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.MemTableSize <= 0 {
 		o.MemTableSize = 4 << 20
 	}
+	if o.MemTableRep == nil {
+		o.MemTableRep = SkiplistMemTableRep
+	}
 	if o.MemTableStopWritesThreshold <= 0 {
 		o.MemTableStopWritesThreshold = 2
 	}
@@ -541,7 +685,8 @@ func (o *Options) EnsureDefaults() *Options {
 	return o
 }
 
-// initMaps initializes the Comparers, Filters, and Mergers maps.
+// initMaps initializes the Comparers, Filters, PrefixExtractors, and Mergers
+// maps.
 func (o *Options) initMaps() {
 	for i := range o.Levels {
 		l := &o.Levels[i]
@@ -554,6 +699,15 @@ func (o *Options) initMaps() {
 				o.Filters[name] = l.FilterPolicy
 			}
 		}
+		if l.PrefixExtractor != nil {
+			if o.PrefixExtractors == nil {
+				o.PrefixExtractors = make(map[string]PrefixExtractor)
+			}
+			name := l.PrefixExtractor.Name()
+			if _, ok := o.PrefixExtractors[name]; !ok {
+				o.PrefixExtractors[name] = l.PrefixExtractor
+			}
+		}
 	}
 }
 
@@ -586,6 +740,13 @@ func filterPolicyName(p FilterPolicy) string {
 	return p.Name()
 }
 
+func prefixExtractorName(e PrefixExtractor) string {
+	if e == nil {
+		return "none"
+	}
+	return e.Name()
+}
+
 func (o *Options) String() string {
 	var buf bytes.Buffer
 
@@ -602,6 +763,8 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  cache_size=%d\n", cacheSize)
 	fmt.Fprintf(&buf, "  cleaner=%s\n", o.Cleaner)
 	fmt.Fprintf(&buf, "  comparer=%s\n", o.Comparer.Name)
+	fmt.Fprintf(&buf, "  consistency_scan_bytes_per_second=%d\n", o.Experimental.ConsistencyScanBytesPerSecond)
+	fmt.Fprintf(&buf, "  consistency_scan_interval=%s\n", o.Experimental.ConsistencyScanInterval)
 	fmt.Fprintf(&buf, "  delete_range_flush_delay=%s\n", o.Experimental.DeleteRangeFlushDelay)
 	fmt.Fprintf(&buf, "  disable_wal=%t\n", o.DisableWAL)
 	fmt.Fprintf(&buf, "  flush_split_bytes=%d\n", o.Experimental.FlushSplitBytes)
@@ -613,11 +776,16 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  max_concurrent_compactions=%d\n", o.MaxConcurrentCompactions)
 	fmt.Fprintf(&buf, "  max_manifest_file_size=%d\n", o.MaxManifestFileSize)
 	fmt.Fprintf(&buf, "  max_open_files=%d\n", o.MaxOpenFiles)
+	fmt.Fprintf(&buf, "  max_write_bytes_per_second=%d\n", o.MaxWriteBytesPerSecond)
+	fmt.Fprintf(&buf, "  mem_table_filter_size_ratio=%g\n", o.Experimental.MemTableFilterSizeRatio)
+	fmt.Fprintf(&buf, "  mem_table_rep=%s\n", o.MemTableRep.Name())
 	fmt.Fprintf(&buf, "  mem_table_size=%d\n", o.MemTableSize)
 	fmt.Fprintf(&buf, "  mem_table_stop_writes_threshold=%d\n", o.MemTableStopWritesThreshold)
 	fmt.Fprintf(&buf, "  min_compaction_rate=%d\n", o.MinCompactionRate)
 	fmt.Fprintf(&buf, "  min_flush_rate=%d\n", o.MinFlushRate)
 	fmt.Fprintf(&buf, "  merger=%s\n", o.Merger.Name)
+	fmt.Fprintf(&buf, "  parallel_mem_table_insert_threshold=%d\n", o.Experimental.ParallelMemTableInsertThreshold)
+	fmt.Fprintf(&buf, "  readahead_blocks=%d\n", o.Experimental.ReadaheadBlocks)
 	fmt.Fprintf(&buf, "  table_property_collectors=[")
 	for i := range o.TablePropertyCollectors {
 		if i > 0 {
@@ -637,9 +805,12 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  block_restart_interval=%d\n", l.BlockRestartInterval)
 		fmt.Fprintf(&buf, "  block_size=%d\n", l.BlockSize)
 		fmt.Fprintf(&buf, "  compression=%s\n", l.Compression)
+		fmt.Fprintf(&buf, "  data_block_index_type=%s\n", l.DataBlockIndexType)
 		fmt.Fprintf(&buf, "  filter_policy=%s\n", filterPolicyName(l.FilterPolicy))
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
 		fmt.Fprintf(&buf, "  index_block_size=%d\n", l.IndexBlockSize)
+		fmt.Fprintf(&buf, "  partition_filters=%t\n", l.PartitionFilters)
+		fmt.Fprintf(&buf, "  prefix_extractor=%s\n", prefixExtractorName(l.PrefixExtractor))
 		fmt.Fprintf(&buf, "  target_file_size=%d\n", l.TargetFileSize)
 	}
 
@@ -702,7 +873,13 @@ type ParseHooks struct {
 	NewComparer     func(name string) (*Comparer, error)
 	NewFilterPolicy func(name string) (FilterPolicy, error)
 	NewMerger       func(name string) (*Merger, error)
-	SkipUnknown     func(name string) bool
+	// NewMemTableRep is called for memtable reps other than the built-in
+	// SkiplistMemTableRep and VectorMemTableRep.
+	NewMemTableRep func(name string) (MemTableRepFactory, error)
+	// NewPrefixExtractor is called for prefix extractors other than "none"
+	// and the built-in FixedPrefixExtractors.
+	NewPrefixExtractor func(name string) (PrefixExtractor, error)
+	SkipUnknown        func(name string) bool
 }
 
 // Parse parses the options from the specified string. Note that certain
@@ -756,6 +933,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 						o.Comparer, err = hooks.NewComparer(value)
 					}
 				}
+			case "consistency_scan_bytes_per_second":
+				o.Experimental.ConsistencyScanBytesPerSecond, err = strconv.Atoi(value)
+			case "consistency_scan_interval":
+				o.Experimental.ConsistencyScanInterval, err = time.ParseDuration(value)
 			case "delete_range_flush_delay":
 				o.Experimental.DeleteRangeFlushDelay, err = time.ParseDuration(value)
 			case "disable_wal":
@@ -778,6 +959,21 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.MaxManifestFileSize, err = strconv.ParseInt(value, 10, 64)
 			case "max_open_files":
 				o.MaxOpenFiles, err = strconv.Atoi(value)
+			case "max_write_bytes_per_second":
+				o.MaxWriteBytesPerSecond, err = strconv.Atoi(value)
+			case "mem_table_filter_size_ratio":
+				o.Experimental.MemTableFilterSizeRatio, err = strconv.ParseFloat(value, 64)
+			case "mem_table_rep":
+				switch value {
+				case SkiplistMemTableRep.Name():
+					o.MemTableRep = SkiplistMemTableRep
+				case VectorMemTableRep.Name():
+					o.MemTableRep = VectorMemTableRep
+				default:
+					if hooks != nil && hooks.NewMemTableRep != nil {
+						o.MemTableRep, err = hooks.NewMemTableRep(value)
+					}
+				}
 			case "mem_table_size":
 				o.MemTableSize, err = strconv.Atoi(value)
 			case "mem_table_stop_writes_threshold":
@@ -797,12 +993,20 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 						o.Merger, err = hooks.NewMerger(value)
 					}
 				}
+			case "parallel_mem_table_insert_threshold":
+				o.Experimental.ParallelMemTableInsertThreshold, err = strconv.Atoi(value)
+			case "readahead_blocks":
+				o.Experimental.ReadaheadBlocks, err = strconv.Atoi(value)
 			case "table_format":
 				switch value {
 				case "leveldb":
 					o.TableFormat = TableFormatLevelDB
 				case "rocksdbv2":
 					o.TableFormat = TableFormatRocksDBv2
+				case "pebblev1":
+					o.TableFormat = TableFormatPebblev1
+				case "pebblev2":
+					o.TableFormat = TableFormatPebblev2
 				default:
 					return errors.Errorf("pebble: unknown table format: %q", errors.Safe(value))
 				}
@@ -854,6 +1058,15 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				default:
 					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
 				}
+			case "data_block_index_type":
+				switch value {
+				case "binary_search":
+					l.DataBlockIndexType = DataBlockBinarySearch
+				case "binary_search_and_hash":
+					l.DataBlockIndexType = DataBlockBinaryAndHash
+				default:
+					return errors.Errorf("pebble: unknown data block index type: %q", errors.Safe(value))
+				}
 			case "filter_policy":
 				if hooks != nil && hooks.NewFilterPolicy != nil {
 					l.FilterPolicy, err = hooks.NewFilterPolicy(value)
@@ -867,6 +1080,16 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				}
 			case "index_block_size":
 				l.IndexBlockSize, err = strconv.Atoi(value)
+			case "partition_filters":
+				l.PartitionFilters, err = strconv.ParseBool(value)
+			case "prefix_extractor":
+				if value == "none" {
+					l.PrefixExtractor = nil
+				} else if e, ok := base.ParseFixedPrefixExtractor(value); ok {
+					l.PrefixExtractor = e
+				} else if hooks != nil && hooks.NewPrefixExtractor != nil {
+					l.PrefixExtractor, err = hooks.NewPrefixExtractor(value)
+				}
 			case "target_file_size":
 				l.TargetFileSize, err = strconv.ParseInt(value, 10, 64)
 			default:
@@ -935,6 +1158,13 @@ func (o *Options) Validate() error {
 	case TableFormatLevelDB:
 		fmt.Fprintf(&buf, "TableFormatLevelDB not supported for DB\n")
 	}
+	for i := range o.Levels {
+		if o.Levels[i].PrefixExtractor != nil && o.Comparer.Name != DefaultComparer.Name {
+			fmt.Fprintf(&buf, "PrefixExtractor (%s) requires comparer %s, not %s\n",
+				o.Levels[i].PrefixExtractor.Name(), DefaultComparer.Name, o.Comparer.Name)
+			break
+		}
+	}
 	if buf.Len() == 0 {
 		return nil
 	}
@@ -949,6 +1179,8 @@ func (o *Options) MakeReaderOptions() sstable.ReaderOptions {
 		readerOpts.Cache = o.Cache
 		readerOpts.Comparer = o.Comparer
 		readerOpts.Filters = o.Filters
+		readerOpts.PrefixExtractors = o.PrefixExtractors
+		readerOpts.ReadaheadBlocks = o.Experimental.ReadaheadBlocks
 		if o.Merger != nil {
 			readerOpts.MergerName = o.Merger.Name
 		}
@@ -974,8 +1206,11 @@ func (o *Options) MakeWriterOptions(level int) sstable.WriterOptions {
 	writerOpts.BlockSize = levelOpts.BlockSize
 	writerOpts.BlockSizeThreshold = levelOpts.BlockSizeThreshold
 	writerOpts.Compression = levelOpts.Compression
+	writerOpts.DataBlockIndexType = levelOpts.DataBlockIndexType
 	writerOpts.FilterPolicy = levelOpts.FilterPolicy
 	writerOpts.FilterType = levelOpts.FilterType
+	writerOpts.PartitionFilters = levelOpts.PartitionFilters
+	writerOpts.PrefixExtractor = levelOpts.PrefixExtractor
 	writerOpts.IndexBlockSize = levelOpts.IndexBlockSize
 	return writerOpts
 }
@@ -48,6 +48,8 @@ func TestOptionsString(t *testing.T) {
   cache_size=8388608
   cleaner=delete
   comparer=leveldb.BytewiseComparator
+  consistency_scan_bytes_per_second=0
+  consistency_scan_interval=0s
   delete_range_flush_delay=0s
   disable_wal=false
   flush_split_bytes=0
@@ -59,11 +61,16 @@ func TestOptionsString(t *testing.T) {
   max_concurrent_compactions=1
   max_manifest_file_size=134217728
   max_open_files=1000
+  max_write_bytes_per_second=0
+  mem_table_filter_size_ratio=0
+  mem_table_rep=pebble.skiplist
   mem_table_size=4194304
   mem_table_stop_writes_threshold=2
   min_compaction_rate=4194304
   min_flush_rate=1048576
   merger=pebble.concatenate
+  parallel_mem_table_insert_threshold=0
+  readahead_blocks=0
   table_property_collectors=[]
   wal_dir=
 
@@ -71,9 +78,12 @@ func TestOptionsString(t *testing.T) {
   block_restart_interval=16
   block_size=4096
   compression=Snappy
+  data_block_index_type=binary_search
   filter_policy=none
   filter_type=table
   index_block_size=4096
+  partition_filters=false
+  prefix_extractor=none
   target_file_size=2097152
 `
 
@@ -170,25 +180,34 @@ func TestOptionsParse(t *testing.T) {
 	}
 
 	testCases := []struct {
-		cleaner  Cleaner
-		comparer *Comparer
-		merger   *Merger
+		cleaner     Cleaner
+		comparer    *Comparer
+		merger      *Merger
+		memTableRep MemTableRepFactory
 	}{
-		{testCleaner{}, nil, nil},
-		{nil, &testComparer, nil},
-		{nil, nil, &testMerger},
+		{testCleaner{}, nil, nil, nil},
+		{nil, &testComparer, nil, nil},
+		{nil, nil, &testMerger, nil},
+		{nil, nil, nil, VectorMemTableRep},
 	}
 	for _, c := range testCases {
 		t.Run("", func(t *testing.T) {
 			var opts Options
 			opts.Comparer = c.comparer
 			opts.Merger = c.merger
+			opts.MemTableRep = c.memTableRep
 			opts.WALDir = "wal"
 			opts.Levels = make([]LevelOptions, 3)
 			opts.Levels[0].BlockSize = 1024
 			opts.Levels[1].BlockSize = 2048
+			opts.Levels[1].PrefixExtractor = FixedPrefixExtractor(4)
+			opts.Levels[1].PartitionFilters = true
 			opts.Levels[2].BlockSize = 4096
+			opts.Levels[2].DataBlockIndexType = DataBlockBinaryAndHash
 			opts.Experimental.DeleteRangeFlushDelay = 10 * time.Second
+			opts.Experimental.ConsistencyScanInterval = time.Minute
+			opts.Experimental.ConsistencyScanBytesPerSecond = 1 << 20
+			opts.Experimental.ReadaheadBlocks = 16
 			opts.EnsureDefaults()
 			str := opts.String()
 
@@ -203,6 +222,10 @@ func TestOptionsParse(t *testing.T) {
 			require.NotEqual(t, newCacheSize, 0)
 		})
 	}
+
+	var opts Options
+	require.NoError(t, opts.Parse("[Options]\n  table_format=pebblev2\n", nil))
+	require.Equal(t, TableFormatPebblev2, opts.TableFormat)
 }
 
 func TestOptionsValidate(t *testing.T) {
@@ -258,4 +281,14 @@ func TestOptionsValidate(t *testing.T) {
 			}
 		})
 	}
+
+	// A PrefixExtractor requires the bytewise DefaultComparer.
+	opts := &Options{
+		Comparer: &Comparer{Name: "test-comparer"},
+		Levels:   []LevelOptions{{PrefixExtractor: FixedPrefixExtractor(3)}},
+	}
+	opts.EnsureDefaults()
+	require.Regexp(t, `PrefixExtractor \(pebble.FixedPrefix.3\) requires comparer`, opts.Validate())
+	opts.Comparer = DefaultComparer
+	require.NoError(t, opts.Validate())
 }
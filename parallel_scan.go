@@ -0,0 +1,236 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// splitSamplesPerPart is the number of keys sampled from each sstable for
+// each part requested from SplitRange. Sampling more keys than parts allows
+// the samples from different levels to be combined into balanced parts.
+const splitSamplesPerPart = 4
+
+// SplitRange returns up to n-1 keys which divide the range [start, end) into
+// up to n parts holding roughly equal amounts of sstable data. A nil start or
+// end leaves that side of the range unbounded. The keys are in increasing
+// order and lie strictly within the range.
+//
+// The estimate is computed from the sstables overlapping the range: the size
+// of each sstable within the range is estimated as in EstimateDiskUsage, and
+// is assumed to be distributed evenly between keys sampled from the
+// sstable's index and the sstable's largest key. L0 data is instead assumed
+// to be distributed evenly between the L0 flush split keys (see
+// Options.Experimental.FlushSplitBytes), if there are any within the range.
+// Data in the memtables is not considered. Fewer than n-1 keys are returned
+// if the range does not contain enough data to be split n ways.
+func (d *DB) SplitRange(start, end []byte, n int) ([][]byte, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if start != nil && end != nil && d.cmp(start, end) >= 0 {
+		return nil, errors.New("invalid key-range specified (start >= end)")
+	}
+	if n <= 1 {
+		return nil, nil
+	}
+
+	// Grab and reference the current readState. This prevents the underlying
+	// files in the associated version from being deleted if there is a
+	// concurrent compaction.
+	readState := d.loadReadState()
+	defer readState.unref()
+	current := readState.current
+
+	// The data within the range is represented by weighted keys: the weight
+	// of a key is the number of bytes estimated to lie between the key and
+	// the preceding key sampled from the same source.
+	type weightedKey struct {
+		key    []byte
+		weight uint64
+		// atEnd is set for the end of the range, which has no key.
+		atEnd bool
+	}
+	var keys []weightedKey
+	// add spreads size bytes evenly across the sampled keys. The last share,
+	// holding the data after the final sample, is assigned to last, or to the
+	// end of the range if last is nil.
+	add := func(samples [][]byte, last []byte, size uint64) {
+		w := size / uint64(len(samples)+1)
+		for _, k := range samples {
+			keys = append(keys, weightedKey{key: k, weight: w})
+		}
+		keys = append(keys, weightedKey{
+			key:    last,
+			weight: size - w*uint64(len(samples)),
+			atEnd:  last == nil,
+		})
+	}
+
+	var l0FlushSplits [][]byte
+	for _, k := range current.L0Sublevels.FlushSplitKeys() {
+		if (start == nil || d.cmp(k, start) > 0) && (end == nil || d.cmp(k, end) < 0) {
+			l0FlushSplits = append(l0FlushSplits, k)
+		}
+	}
+
+	var l0Size uint64
+	for level := range current.Levels {
+		iter := current.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if (end != nil && d.cmp(f.Smallest.UserKey, end) >= 0) ||
+				(start != nil && d.cmp(f.Largest.UserKey, start) < 0) {
+				continue
+			}
+			sampleL0 := level == 0 && len(l0FlushSplits) > 0
+			var size uint64
+			var samples [][]byte
+			err := d.tableCache.withReader(f, func(r *sstable.Reader) (err error) {
+				lo, hi := start, end
+				if lo == nil || d.cmp(lo, f.Smallest.UserKey) < 0 {
+					lo = f.Smallest.UserKey
+				}
+				if hi == nil || d.cmp(f.Largest.UserKey, hi) < 0 {
+					hi = f.Largest.UserKey
+				}
+				if size, err = r.EstimateDiskUsage(lo, hi); err != nil || sampleL0 {
+					return err
+				}
+				samples, err = r.EstimateSplitKeys(start, end, n*splitSamplesPerPart)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			if sampleL0 {
+				l0Size += size
+			} else {
+				// The data after the table's final sample ends at its largest
+				// key, unless the table extends beyond the range.
+				var last []byte
+				if end == nil || d.cmp(f.Largest.UserKey, end) < 0 {
+					last = f.Largest.UserKey
+				}
+				add(samples, last, size)
+			}
+		}
+	}
+	if l0Size > 0 {
+		add(l0FlushSplits, nil /* last */, l0Size)
+	}
+
+	// Sort the weighted keys, with the end of the range last, and pick the
+	// keys at which the cumulative weight crosses each multiple of 1/n of the
+	// total.
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].atEnd || keys[j].atEnd {
+			return !keys[i].atEnd && keys[j].atEnd
+		}
+		return d.cmp(keys[i].key, keys[j].key) < 0
+	})
+	var total uint64
+	for i := range keys {
+		total += keys[i].weight
+	}
+	var splits [][]byte
+	var cum uint64
+	for i := range keys {
+		if keys[i].atEnd || len(splits) == n-1 {
+			break
+		}
+		cum += keys[i].weight
+		// The key is a split if the data before it reaches the next multiple
+		// of total/n, which is computed without overflowing.
+		target := total / uint64(n) * uint64(len(splits)+1)
+		if cum < target || cum == 0 {
+			continue
+		}
+		// The largest key of a table may be at or before start, which is not
+		// strictly within the range.
+		if start != nil && d.cmp(keys[i].key, start) <= 0 {
+			continue
+		}
+		if len(splits) > 0 && d.cmp(splits[len(splits)-1], keys[i].key) >= 0 {
+			continue
+		}
+		splits = append(splits, append([]byte(nil), keys[i].key...))
+	}
+	return splits, nil
+}
+
+// ParallelScan is a set of iterators over consecutive, disjoint parts of a key
+// range, which all read from a common snapshot of the DB. The iterators are
+// independent, so each may be used by a different goroutine, and together
+// they see the same data as a single iterator over the whole range on the
+// snapshot. See DB.NewParallelScan.
+type ParallelScan struct {
+	snapshot *Snapshot
+	// Iters holds the iterators, in key order. Iters[i] is bounded by
+	// [Bounds[i], Bounds[i+1]). The iterators are owned by the ParallelScan,
+	// and are closed by ParallelScan.Close.
+	Iters []*Iterator
+	// Bounds holds the len(Iters)+1 bounds of the parts of the range. The
+	// first and last bounds are the start and end of the range, and may be
+	// nil if the range is unbounded.
+	Bounds [][]byte
+}
+
+// NewParallelScan splits the range [start, end) into up to n parts holding
+// roughly equal amounts of data using SplitRange, and returns a ParallelScan
+// with an unpositioned iterator over each part. The iterators read from a
+// snapshot taken by NewParallelScan, so the results of scanning the parts in
+// parallel are consistent with each other. A nil start or end leaves that
+// side of the range unbounded.
+//
+// The iterators are created using the options o, except that the iterator
+// bounds are those of the parts, and the Prefix option is ignored. The
+// caller must call ParallelScan.Close once it is done with the iterators.
+func (d *DB) NewParallelScan(start, end []byte, n int, o *IterOptions) (*ParallelScan, error) {
+	splits, err := d.SplitRange(start, end, n)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the bounds, preserving nil (unbounded) bounds.
+	copyBound := func(k []byte) []byte {
+		if k == nil {
+			return nil
+		}
+		return append(make([]byte, 0, len(k)), k...)
+	}
+	s := &ParallelScan{
+		snapshot: d.NewSnapshot(),
+		Bounds:   make([][]byte, 0, len(splits)+2),
+	}
+	s.Bounds = append(s.Bounds, copyBound(start))
+	s.Bounds = append(s.Bounds, splits...)
+	s.Bounds = append(s.Bounds, copyBound(end))
+
+	s.Iters = make([]*Iterator, len(s.Bounds)-1)
+	for i := range s.Iters {
+		var opts IterOptions
+		if o != nil {
+			opts = *o
+		}
+		opts.LowerBound = s.Bounds[i]
+		opts.UpperBound = s.Bounds[i+1]
+		opts.Prefix = nil
+		s.Iters[i] = s.snapshot.NewIter(&opts)
+	}
+	return s, nil
+}
+
+// Close closes the iterators and releases the snapshot.
+func (s *ParallelScan) Close() error {
+	var err error
+	for _, iter := range s.Iters {
+		err = firstError(err, iter.Close())
+	}
+	s.Iters = nil
+	return firstError(err, s.snapshot.Close())
+}
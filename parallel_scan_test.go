@@ -0,0 +1,208 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitRange(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{BlockSize: 256, Compression: NoCompression}},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// An empty DB can't be split.
+	splits, err := d.SplitRange(nil, nil, 4)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(splits))
+
+	// Write most of the data in the first half of the key space, so that an
+	// even split of the key space would not be balanced.
+	value := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 4000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("a%04d", i)), value, nil))
+	}
+	for i := 0; i < 400; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("b%04d", i)), value, nil))
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("c")))
+	for i := 0; i < 4000; i += 2 {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("a%04d", i)), value, nil))
+	}
+	require.NoError(t, d.Flush())
+
+	_, err = d.SplitRange([]byte("b"), []byte("a"), 4)
+	require.Error(t, err)
+
+	for _, bounds := range [][2][]byte{
+		{nil, nil},
+		{[]byte("a1000"), []byte("b0200")},
+	} {
+		start, end := bounds[0], bounds[1]
+		t.Run(fmt.Sprintf("%s-%s", start, end), func(t *testing.T) {
+			const n = 4
+			splits, err := d.SplitRange(start, end, n)
+			require.NoError(t, err)
+			require.Equal(t, n-1, len(splits))
+
+			keys := append(append([][]byte{start}, splits...), end)
+			for i := 1; i <= n; i++ {
+				if keys[i-1] != nil && keys[i] != nil {
+					require.True(t, bytes.Compare(keys[i-1], keys[i]) < 0)
+				}
+			}
+
+			// Each part should hold roughly a quarter of the data.
+			if keys[0] == nil {
+				keys[0] = []byte("a")
+			}
+			if keys[n] == nil {
+				keys[n] = []byte("c")
+			}
+			total, err := d.EstimateDiskUsage(keys[0], keys[n])
+			require.NoError(t, err)
+			for i := 0; i < n; i++ {
+				size, err := d.EstimateDiskUsage(keys[i], keys[i+1])
+				require.NoError(t, err)
+				require.True(t, size > total/n/2 && size < total/n*2,
+					"part %d [%s,%s): %d of %d", i, keys[i], keys[i+1], size, total)
+			}
+		})
+	}
+}
+
+func TestSplitRangeSingleBlockTables(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// Ingest tables which each hold a single data block, so the only key
+	// sampled from each table is the separator of its last block.
+	value := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 16; i++ {
+		path := fmt.Sprintf("ext%d", i)
+		f, err := mem.Create(path)
+		require.NoError(t, err)
+		w := sstable.NewWriter(f, sstable.WriterOptions{})
+		for j := 0; j < 10; j++ {
+			require.NoError(t, w.Set([]byte(fmt.Sprintf("%c%02d", 'a'+i, j)), value))
+		}
+		require.NoError(t, w.Close())
+		require.NoError(t, d.Ingest([]string{path}))
+	}
+
+	const n = 4
+	splits, err := d.SplitRange(nil, nil, n)
+	require.NoError(t, err)
+	require.Equal(t, n-1, len(splits))
+	keys := append(append([][]byte{[]byte("a")}, splits...), []byte("q"))
+	total, err := d.EstimateDiskUsage(keys[0], keys[n])
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		size, err := d.EstimateDiskUsage(keys[i], keys[i+1])
+		require.NoError(t, err)
+		require.True(t, size > total/n/2 && size < total/n*2,
+			"part %d [%s,%s): %d of %d", i, keys[i], keys[i+1], size, total)
+	}
+}
+
+func TestSplitRangeStartAtLargestKey(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// The first table ends at the start of the range, so the only data it
+	// contributes lies at its largest key.
+	value := bytes.Repeat([]byte("x"), 100)
+	for i, keys := range [][]string{{"a", "b", "c"}, {"d", "e", "f"}} {
+		path := fmt.Sprintf("ext%d", i)
+		f, err := mem.Create(path)
+		require.NoError(t, err)
+		w := sstable.NewWriter(f, sstable.WriterOptions{})
+		for _, k := range keys {
+			require.NoError(t, w.Set([]byte(k), value))
+		}
+		require.NoError(t, w.Close())
+		require.NoError(t, d.Ingest([]string{path}))
+	}
+
+	splits, err := d.SplitRange([]byte("c"), nil, 4)
+	require.NoError(t, err)
+	for _, k := range splits {
+		require.True(t, bytes.Compare(k, []byte("c")) > 0, "split %q", k)
+	}
+}
+
+func TestParallelScan(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{BlockSize: 256}},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%04d", i)), []byte(fmt.Sprint(i)), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.DeleteRange([]byte("0100"), []byte("0200"), nil))
+
+	scan, err := d.NewParallelScan(nil, []byte("1500"), 4, nil)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(scan.Iters))
+	require.Equal(t, len(scan.Iters)+1, len(scan.Bounds))
+
+	// Writes after the scan was created are not visible to it.
+	require.NoError(t, d.Set([]byte("0500a"), nil, nil))
+	require.NoError(t, d.Delete([]byte("0600"), nil))
+
+	parts := make([][]string, len(scan.Iters))
+	var wg sync.WaitGroup
+	for i, iter := range scan.Iters {
+		wg.Add(1)
+		go func(i int, iter *Iterator) {
+			defer wg.Done()
+			for valid := iter.First(); valid; valid = iter.Next() {
+				parts[i] = append(parts[i], string(iter.Key()))
+			}
+		}(i, iter)
+	}
+	wg.Wait()
+
+	var keys []string
+	for i := range parts {
+		require.NotEqual(t, 0, len(parts[i]))
+		keys = append(keys, parts[i]...)
+	}
+	require.NoError(t, scan.Close())
+
+	var expected []string
+	for i := 0; i < 1500; i++ {
+		if i < 100 || i >= 200 {
+			expected = append(expected, fmt.Sprintf("%04d", i))
+		}
+	}
+	require.Equal(t, expected, keys)
+}
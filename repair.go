@@ -0,0 +1,978 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/internal/private"
+	"github.com/cockroachdb/pebble/internal/rangedel"
+	"github.com/cockroachdb/pebble/internal/record"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// QuarantineDir is the name of the subdirectory of a database directory into
+// which Repair moves files that it could not read, and tables that it
+// replaced with a merged table.
+const QuarantineDir = "quarantine"
+
+// LostTable describes an sstable whose data was lost during a repair, either
+// because the table could not be read or because it was missing.
+type LostTable struct {
+	FileNum FileNum
+	// Smallest and Largest are the bounds of the lost key range, as recorded
+	// in the MANIFEST. BoundsKnown is false if the MANIFEST could not be read,
+	// in which case the bounds are unknown.
+	Smallest    InternalKey
+	Largest     InternalKey
+	BoundsKnown bool
+	// Err is the error encountered while reading the table.
+	Err error
+}
+
+// MergedTable describes a table written by Repair to replace a group of tables
+// whose data could not be placed in distinct levels. See Repair.
+type MergedTable struct {
+	FileNum FileNum
+	// Inputs lists the tables which were merged. They were moved to the
+	// quarantine directory.
+	Inputs []FileNum
+}
+
+// LostWALData describes a region of a WAL file containing records that could
+// not be salvaged during a repair.
+type LostWALData struct {
+	FileNum FileNum
+	Offset  int64
+	Length  int64
+}
+
+// RepairReport describes the changes made to a database by Repair.
+type RepairReport struct {
+	// Tables is the number of sstables in the repaired MANIFEST.
+	Tables int
+	// WALRecords is the number of records salvaged from WAL files which will
+	// be replayed when the database is opened.
+	WALRecords int
+	// Quarantined lists the names of the files moved to the quarantine
+	// directory.
+	Quarantined []string
+	// LostTables lists the sstables whose key ranges were lost.
+	LostTables []LostTable
+	// LostWALData lists the regions of WAL files which were lost.
+	LostWALData []LostWALData
+	// MergedTables lists the tables written to replace tables with
+	// interleaved data.
+	MergedTables []MergedTable
+	// PossiblyObsolete lists the tables which may have been obsolete when the
+	// MANIFEST was lost. See Repair.
+	PossiblyObsolete []FileNum
+
+	formatKey base.FormatKey
+}
+
+func (r *RepairReport) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "recovered %d tables and %d WAL records\n", r.Tables, r.WALRecords)
+	for _, name := range r.Quarantined {
+		fmt.Fprintf(&buf, "quarantined %s\n", name)
+	}
+	for _, t := range r.LostTables {
+		if t.BoundsKnown {
+			fmt.Fprintf(&buf, "lost table %s: [%s-%s]: %v\n",
+				t.FileNum, t.Smallest.Pretty(r.formatKey), t.Largest.Pretty(r.formatKey), t.Err)
+		} else {
+			fmt.Fprintf(&buf, "lost table %s: unknown key range: %v\n", t.FileNum, t.Err)
+		}
+	}
+	for _, w := range r.LostWALData {
+		fmt.Fprintf(&buf, "lost WAL %s: bytes [%d,%d)\n", w.FileNum, w.Offset, w.Offset+w.Length)
+	}
+	for _, m := range r.MergedTables {
+		fmt.Fprintf(&buf, "merged tables %s into %s\n", m.Inputs, m.FileNum)
+	}
+	for _, fileNum := range r.PossiblyObsolete {
+		fmt.Fprintf(&buf, "possibly obsolete table %s\n", fileNum)
+	}
+	return buf.String()
+}
+
+// repairPrior holds the state recovered from the MANIFEST named by CURRENT.
+type repairPrior struct {
+	levels             map[FileNum]int
+	metas              map[FileNum]*fileMetadata
+	minUnflushedLogNum FileNum
+	nextFileNum        FileNum
+	lastSeqNum         uint64
+}
+
+// Repair rebuilds the MANIFEST of the database in dirname from the sstables
+// present in the directory so that the database can be opened after
+// corruption of its MANIFEST, sstables or WAL files. The database must not be
+// in use by another process.
+//
+// Each sstable is read in full and its block checksums are verified. Tables
+// which cannot be read are moved to the quarantine subdirectory (see
+// QuarantineDir) and their key ranges are reported as lost. If the current
+// MANIFEST can be read without error, the repaired MANIFEST preserves its
+// level structure and ignores obsolete tables it does not reference.
+// Otherwise, every readable table is added and tables are assigned to levels
+// such that tables with newer data are placed above overlapping tables with
+// older data. Overlapping tables whose sequence numbers interleave cannot be
+// ordered this way, and are merged into a single table (see MergedTable).
+//
+// Without a MANIFEST, obsolete tables which had not yet been deleted cannot be
+// told apart from live tables, and are added as well. Such a table may restore
+// keys whose deletion has since been compacted away. The inputs of a merge
+// which contain the same key at the same sequence number are likely to be
+// obsolete compaction inputs or orphaned compaction outputs, and are reported
+// in RepairReport.PossiblyObsolete. Obsolete tables are not detected in
+// general.
+//
+// WAL files are read in recovery mode, skipping over corrupt regions. A
+// damaged WAL is moved to the quarantine subdirectory and replaced by a WAL
+// containing the salvaged records, which are replayed when the database is
+// next opened.
+func Repair(dirname string, opts *Options) (*RepairReport, error) {
+	opts = opts.Clone()
+	opts = opts.EnsureDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	fs := opts.FS
+	walDirname := opts.WALDir
+	if walDirname == "" {
+		walDirname = dirname
+	}
+
+	fileLock, err := fs.Lock(base.MakeFilename(fs, dirname, fileTypeLock, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer fileLock.Close()
+
+	report := &RepairReport{formatKey: opts.Comparer.FormatKey}
+	r := &repairer{
+		dirname:    dirname,
+		walDirname: walDirname,
+		opts:       opts,
+		report:     report,
+	}
+	if err := r.run(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+type repairer struct {
+	dirname    string
+	walDirname string
+	opts       *Options
+	report     *RepairReport
+
+	prior       *repairPrior
+	nextFileNum FileNum
+	tables      []*fileMetadata
+	levels      map[FileNum]int
+	lastSeqNum  uint64
+}
+
+func (r *repairer) run() error {
+	fs := r.opts.FS
+	ls, err := fs.List(r.dirname)
+	if err != nil {
+		return err
+	}
+	var walLs []string
+	if r.walDirname != r.dirname {
+		if walLs, err = fs.List(r.walDirname); err != nil {
+			return err
+		}
+	}
+
+	r.nextFileNum = 1
+	var tableNums, logNums []FileNum
+	parse := func(filename string) (fileType, FileNum, bool) {
+		ft, fn, ok := base.ParseFilename(fs, filename)
+		if ok && r.nextFileNum <= fn {
+			r.nextFileNum = fn + 1
+		}
+		return ft, fn, ok
+	}
+	for _, filename := range ls {
+		ft, fn, ok := parse(filename)
+		if !ok {
+			continue
+		}
+		switch ft {
+		case fileTypeOptions:
+			// Verify that the comparer and merger match the ones the database
+			// was created with. A mismatch would cause every table to appear
+			// unreadable.
+			if err := checkOptions(r.opts, fs.PathJoin(r.dirname, filename)); err != nil {
+				return err
+			}
+		case fileTypeTable:
+			tableNums = append(tableNums, fn)
+		case fileTypeLog:
+			if r.walDirname == r.dirname {
+				logNums = append(logNums, fn)
+			}
+		}
+	}
+	if r.walDirname != r.dirname {
+		for _, filename := range walLs {
+			if ft, fn, ok := parse(filename); ok && ft == fileTypeLog {
+				logNums = append(logNums, fn)
+			}
+		}
+	}
+	sort.Slice(tableNums, func(i, j int) bool { return tableNums[i] < tableNums[j] })
+	sort.Slice(logNums, func(i, j int) bool { return logNums[i] < logNums[j] })
+
+	if err := r.loadPrior(); err != nil {
+		return err
+	}
+	if r.prior != nil && r.nextFileNum < r.prior.nextFileNum {
+		r.nextFileNum = r.prior.nextFileNum
+	}
+
+	if err := r.loadTables(tableNums); err != nil {
+		return err
+	}
+	if r.prior == nil {
+		if err := r.mergeInterleaved(); err != nil {
+			return err
+		}
+	}
+	minUnflushedLogNum, err := r.salvageWALs(logNums)
+	if err != nil {
+		return err
+	}
+	r.assignLevels()
+	return r.writeManifest(minUnflushedLogNum)
+}
+
+// loadPrior replays the MANIFEST named by the CURRENT file. The MANIFEST is
+// only used if it can be read in its entirety. A corrupt MANIFEST is moved to
+// the quarantine directory.
+func (r *repairer) loadPrior() error {
+	fs := r.opts.FS
+	current, err := fs.Open(base.MakeFilename(fs, r.dirname, fileTypeCurrent, 0))
+	if err != nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(current)
+	current.Close()
+	if err != nil {
+		return nil
+	}
+	b = bytes.TrimSpace(b)
+	ft, _, ok := base.ParseFilename(fs, string(b))
+	if !ok || ft != fileTypeManifest {
+		return nil
+	}
+	manifestName := string(b)
+	f, err := fs.Open(fs.PathJoin(r.dirname, manifestName))
+	if err != nil {
+		return nil
+	}
+
+	prior := &repairPrior{}
+	var bve bulkVersionEdit
+	err = func() error {
+		defer f.Close()
+		rr := record.NewReader(f, 0 /* logNum */)
+		for {
+			rec, err := rr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var ve versionEdit
+			if err := ve.Decode(rec); err != nil {
+				return err
+			}
+			if ve.ComparerName != "" && ve.ComparerName != r.opts.Comparer.Name {
+				return errors.Mark(errors.Errorf("pebble: manifest file %q for DB %q: "+
+					"comparer name from file %q != comparer name from Options %q",
+					errors.Safe(manifestName), r.dirname, errors.Safe(ve.ComparerName),
+					errors.Safe(r.opts.Comparer.Name)), errRepairComparerMismatch)
+			}
+			bve.Accumulate(&ve)
+			if ve.MinUnflushedLogNum != 0 {
+				prior.minUnflushedLogNum = ve.MinUnflushedLogNum
+			}
+			if ve.NextFileNum != 0 {
+				prior.nextFileNum = ve.NextFileNum
+			}
+			if ve.LastSeqNum != 0 {
+				prior.lastSeqNum = ve.LastSeqNum
+			}
+		}
+	}()
+	var v *version
+	if err == nil {
+		v, _, err = bve.Apply(nil, r.opts.Comparer.Compare, r.opts.Comparer.FormatKey,
+			r.opts.Experimental.FlushSplitBytes)
+	}
+	if err != nil {
+		if errors.Is(err, errRepairComparerMismatch) {
+			return err
+		}
+		return r.quarantine(r.dirname, manifestName)
+	}
+
+	prior.levels = make(map[FileNum]int)
+	prior.metas = make(map[FileNum]*fileMetadata)
+	for level := range v.Levels {
+		iter := v.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			prior.levels[f.FileNum] = level
+			prior.metas[f.FileNum] = f
+		}
+	}
+	r.prior = prior
+	return nil
+}
+
+var (
+	errRepairComparerMismatch = errors.New("pebble: comparer mismatch")
+	errRepairCorruptBatch     = errors.New("pebble: corrupt batch")
+)
+
+// loadTables reads and validates the specified tables, quarantining tables
+// which cannot be read.
+func (r *repairer) loadTables(tableNums []FileNum) error {
+	fs := r.opts.FS
+	c := cache.New(8 << 20 /* 8 MB */)
+	defer c.Unref()
+	cacheID := c.NewID()
+
+	present := make(map[FileNum]bool, len(tableNums))
+	for _, fileNum := range tableNums {
+		present[fileNum] = true
+		if r.prior != nil {
+			if _, ok := r.prior.levels[fileNum]; !ok {
+				// The table is obsolete.
+				continue
+			}
+		}
+		meta, err := repairLoadTable(r.opts, c, cacheID, r.dirname, fileNum)
+		if err != nil {
+			r.report.LostTables = append(r.report.LostTables, r.lostTable(fileNum, err))
+			name := fs.PathBase(base.MakeFilename(fs, r.dirname, fileTypeTable, fileNum))
+			if err := r.quarantine(r.dirname, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if meta == nil {
+			continue
+		}
+		r.tables = append(r.tables, meta)
+		if r.lastSeqNum < meta.LargestSeqNum {
+			r.lastSeqNum = meta.LargestSeqNum
+		}
+	}
+
+	if r.prior != nil {
+		var missing []FileNum
+		for fileNum := range r.prior.levels {
+			if !present[fileNum] {
+				missing = append(missing, fileNum)
+			}
+		}
+		sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+		for _, fileNum := range missing {
+			r.report.LostTables = append(r.report.LostTables,
+				r.lostTable(fileNum, errors.New("pebble: table is missing")))
+		}
+		if r.lastSeqNum < r.prior.lastSeqNum {
+			r.lastSeqNum = r.prior.lastSeqNum
+		}
+	}
+	r.report.Tables = len(r.tables)
+	return nil
+}
+
+func (r *repairer) lostTable(fileNum FileNum, err error) LostTable {
+	t := LostTable{FileNum: fileNum, Err: err}
+	if r.prior != nil {
+		if m, ok := r.prior.metas[fileNum]; ok {
+			t.Smallest, t.Largest, t.BoundsKnown = m.Smallest, m.Largest, true
+		}
+	}
+	return t
+}
+
+// repairLoadTable reads every key of the specified table, verifying all of
+// its block checksums, and returns its metadata. It returns nil metadata if
+// the table is empty.
+func repairLoadTable(
+	opts *Options, c *cache.Cache, cacheID uint64, dirname string, fileNum FileNum,
+) (*fileMetadata, error) {
+	path := base.MakeFilename(opts.FS, dirname, fileTypeTable, fileNum)
+	stat, err := opts.FS.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := opts.FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	readerOpts := opts.MakeReaderOptions()
+	readerOpts.Cache = c
+	cacheOpts := private.SSTableCacheOpts(cacheID, fileNum).(sstable.ReaderOption)
+	reader, err := sstable.NewReader(f, readerOpts, cacheOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if err := reader.ValidateBlockChecksums(); err != nil {
+		return nil, err
+	}
+
+	meta := &fileMetadata{
+		FileNum:        fileNum,
+		Size:           uint64(stat.Size()),
+		CreationTime:   time.Now().Unix(),
+		SmallestSeqNum: InternalKeySeqNumMax,
+	}
+	cmp := opts.Comparer.Compare
+	empty := true
+	update := func(smallest, largest InternalKey, seqNum uint64) {
+		if empty || base.InternalCompare(cmp, smallest, meta.Smallest) < 0 {
+			meta.Smallest = smallest.Clone()
+		}
+		if empty || base.InternalCompare(cmp, largest, meta.Largest) > 0 {
+			meta.Largest = largest.Clone()
+		}
+		if meta.SmallestSeqNum > seqNum {
+			meta.SmallestSeqNum = seqNum
+		}
+		if meta.LargestSeqNum < seqNum {
+			meta.LargestSeqNum = seqNum
+		}
+		empty = false
+	}
+
+	iter, err := reader.NewIter(nil /* lower */, nil /* upper */)
+	if err != nil {
+		return nil, err
+	}
+	for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+		update(*key, *key, key.SeqNum())
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	rangeDelIter, err := reader.NewRawRangeDelIter()
+	if err != nil {
+		return nil, err
+	}
+	if rangeDelIter != nil {
+		for key, val := rangeDelIter.First(); key != nil; key, val = rangeDelIter.Next() {
+			update(*key, base.MakeRangeDeleteSentinelKey(val), key.SeqNum())
+		}
+		if err := rangeDelIter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if empty {
+		return nil, nil
+	}
+	return meta, nil
+}
+
+// salvageWALs reads the WAL files in recovery mode, replacing damaged WALs
+// with the salvaged records. It returns the MinUnflushedLogNum for the
+// repaired MANIFEST.
+func (r *repairer) salvageWALs(logNums []FileNum) (FileNum, error) {
+	var minUnflushedLogNum FileNum
+	if r.prior != nil {
+		minUnflushedLogNum = r.prior.minUnflushedLogNum
+	}
+	inferred := FileNum(0)
+	for _, logNum := range logNums {
+		if logNum < minUnflushedLogNum {
+			continue
+		}
+		records, maxSeqNum, lost, err := r.salvageWAL(logNum)
+		if err != nil {
+			return 0, err
+		}
+		if r.prior == nil && maxSeqNum <= r.lastSeqNum {
+			// Without a MANIFEST, a WAL is considered to be flushed if all of
+			// its records are older than the newest table.
+			continue
+		}
+		if inferred == 0 {
+			inferred = logNum
+		}
+		r.report.WALRecords += len(records)
+		if len(lost) == 0 {
+			continue
+		}
+		r.report.LostWALData = append(r.report.LostWALData, lost...)
+		if err := r.rewriteWAL(logNum, records); err != nil {
+			return 0, err
+		}
+	}
+	if r.prior == nil {
+		minUnflushedLogNum = inferred
+		if minUnflushedLogNum == 0 {
+			minUnflushedLogNum = r.nextFileNum
+		}
+	}
+	return minUnflushedLogNum, nil
+}
+
+// salvageWAL returns the records which can be read from the specified WAL,
+// along with the largest sequence number they contain and the regions of the
+// WAL which could not be read.
+func (r *repairer) salvageWAL(
+	logNum FileNum,
+) (records [][]byte, maxSeqNum uint64, lost []LostWALData, _ error) {
+	fs := r.opts.FS
+	f, err := fs.Open(base.MakeFilename(fs, r.walDirname, fileTypeLog, logNum))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer f.Close()
+
+	// lostOffset is the offset of the first unreadable record that has not
+	// been reported yet, or -1 if there is no such record.
+	lostOffset := int64(-1)
+	reportLost := func(end int64) {
+		if lostOffset >= 0 && end > lostOffset {
+			lost = append(lost, LostWALData{FileNum: logNum, Offset: lostOffset, Length: end - lostOffset})
+		}
+		lostOffset = -1
+	}
+
+	rr := record.NewReader(f, logNum)
+	for {
+		offset := rr.Offset()
+		rec, err := rr.Next()
+		var buf bytes.Buffer
+		if err == nil {
+			_, err = io.Copy(&buf, rec)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err == nil && buf.Len() < batchHeaderLen {
+			err = errRepairCorruptBatch
+		}
+		if err != nil {
+			if !record.IsInvalidRecord(err) && err != errRepairCorruptBatch {
+				return nil, 0, nil, err
+			}
+			if lostOffset < 0 {
+				lostOffset = offset
+			}
+			rr.Recover()
+			continue
+		}
+		reportLost(offset)
+
+		var b Batch
+		if err := b.SetRepr(buf.Bytes()); err != nil {
+			return nil, 0, nil, err
+		}
+		if seqNum := b.SeqNum() + uint64(b.Count()) - 1; maxSeqNum < seqNum {
+			maxSeqNum = seqNum
+		}
+		records = append(records, buf.Bytes())
+	}
+	if lostOffset >= 0 {
+		stat, err := f.Stat()
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		reportLost(stat.Size())
+	}
+	return records, maxSeqNum, lost, nil
+}
+
+// rewriteWAL moves the specified WAL to the quarantine directory and replaces
+// it with a WAL containing the specified records.
+func (r *repairer) rewriteWAL(logNum FileNum, records [][]byte) error {
+	fs := r.opts.FS
+	tmpName := base.MakeFilename(fs, r.walDirname, fileTypeTemp, logNum)
+	f, err := fs.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	w := record.NewWriter(f)
+	for _, rec := range records {
+		if _, err := w.WriteRecord(rec); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	logName := base.MakeFilename(fs, r.walDirname, fileTypeLog, logNum)
+	if err := r.quarantine(r.walDirname, fs.PathBase(logName)); err != nil {
+		return err
+	}
+	return fs.Rename(tmpName, logName)
+}
+
+// quarantine moves the named file in dir to the quarantine directory.
+func (r *repairer) quarantine(dir, name string) error {
+	fs := r.opts.FS
+	quarantineDir := fs.PathJoin(r.dirname, QuarantineDir)
+	if err := fs.MkdirAll(quarantineDir, 0755); err != nil {
+		return err
+	}
+	if err := fs.Rename(fs.PathJoin(dir, name), fs.PathJoin(quarantineDir, name)); err != nil {
+		return err
+	}
+	r.report.Quarantined = append(r.report.Quarantined, name)
+	return nil
+}
+
+// assignLevels assigns the tables to levels. The levels recorded in the prior
+// MANIFEST are preserved if it was readable. Otherwise, tables are processed
+// from newest to oldest and each table is placed one layer below the deepest
+// layer holding an overlapping newer table. The deepest layer is then mapped
+// to the bottommost level. This relies on mergeInterleaved having merged the
+// overlapping tables whose sequence numbers interleave, so that every key in
+// a table is newer than the keys in the overlapping tables placed below it.
+func (r *repairer) assignLevels() {
+	r.levels = make(map[FileNum]int, len(r.tables))
+	if r.prior != nil {
+		for _, t := range r.tables {
+			r.levels[t.FileNum] = r.prior.levels[t.FileNum]
+		}
+		return
+	}
+
+	cmp := r.opts.Comparer.Compare
+	tables := append([]*fileMetadata(nil), r.tables...)
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].LargestSeqNum != tables[j].LargestSeqNum {
+			return tables[i].LargestSeqNum > tables[j].LargestSeqNum
+		}
+		return tables[i].FileNum > tables[j].FileNum
+	})
+	layers := make([]int, len(tables))
+	numLayers := 0
+	for i, t := range tables {
+		layer := 0
+		for j := 0; j < i; j++ {
+			if repairTablesOverlap(cmp, t, tables[j]) && layer <= layers[j] {
+				layer = layers[j] + 1
+			}
+		}
+		layers[i] = layer
+		if numLayers <= layer {
+			numLayers = layer + 1
+		}
+	}
+	for i, t := range tables {
+		// Layers beyond the number of non-zero levels are placed in L0,
+		// which permits overlapping tables.
+		level := numLevels - numLayers + layers[i]
+		if level < 0 {
+			level = 0
+		}
+		r.levels[t.FileNum] = level
+	}
+}
+
+// repairTablesOverlap returns true if the key ranges of the tables overlap.
+func repairTablesOverlap(cmp Compare, t, u *fileMetadata) bool {
+	return cmp(t.Smallest.UserKey, u.Largest.UserKey) <= 0 &&
+		cmp(u.Smallest.UserKey, t.Largest.UserKey) <= 0
+}
+
+// mergeInterleaved merges each group of tables whose key ranges overlap and
+// whose sequence number ranges interleave into a single table. Neither table
+// of such a pair can be placed above the other, as each may hold newer
+// versions of keys in the other. Merging is repeated until no tables
+// interleave, as a merged table spans the key and sequence number ranges of
+// its inputs.
+func (r *repairer) mergeInterleaved() error {
+	cmp := r.opts.Comparer.Compare
+	for {
+		// Group the interleaving tables using a union-find over the tables.
+		parent := make([]int, len(r.tables))
+		for i := range parent {
+			parent[i] = i
+		}
+		find := func(i int) int {
+			for parent[i] != i {
+				parent[i] = parent[parent[i]]
+				i = parent[i]
+			}
+			return i
+		}
+		merges := false
+		for i, t := range r.tables {
+			for j, u := range r.tables[:i] {
+				if repairTablesOverlap(cmp, t, u) &&
+					t.SmallestSeqNum <= u.LargestSeqNum && u.SmallestSeqNum <= t.LargestSeqNum {
+					parent[find(i)] = find(j)
+					merges = true
+				}
+			}
+		}
+		if !merges {
+			r.report.Tables = len(r.tables)
+			return nil
+		}
+
+		groups := make(map[int][]*fileMetadata)
+		var roots []int
+		for i, t := range r.tables {
+			root := find(i)
+			if _, ok := groups[root]; !ok {
+				roots = append(roots, root)
+			}
+			groups[root] = append(groups[root], t)
+		}
+		var tables []*fileMetadata
+		for _, root := range roots {
+			group := groups[root]
+			if len(group) == 1 {
+				tables = append(tables, group[0])
+				continue
+			}
+			meta, err := r.mergeTables(group)
+			if err != nil {
+				return err
+			}
+			tables = append(tables, meta)
+		}
+		r.tables = tables
+	}
+}
+
+// mergeTables writes a table containing every point key and range tombstone
+// in the specified tables, and moves the tables to the quarantine directory.
+// Keys present in more than one of the tables are written once.
+func (r *repairer) mergeTables(tables []*fileMetadata) (_ *fileMetadata, err error) {
+	fs := r.opts.FS
+	cmp := r.opts.Comparer.Compare
+	c := cache.New(8 << 20 /* 8 MB */)
+	defer c.Unref()
+	cacheID := c.NewID()
+	readerOpts := r.opts.MakeReaderOptions()
+	readerOpts.Cache = c
+
+	var readers []*sstable.Reader
+	defer func() {
+		for _, reader := range readers {
+			err = firstError(err, reader.Close())
+		}
+	}()
+	var iters []internalIterator
+	defer func() {
+		// The iterators are closed by the merging iterator once it is created.
+		for _, iter := range iters {
+			err = firstError(err, iter.Close())
+		}
+	}()
+	var tombstones []rangedel.Tombstone
+	m := MergedTable{Inputs: make([]FileNum, len(tables))}
+	for i, t := range tables {
+		m.Inputs[i] = t.FileNum
+		f, err := fs.Open(base.MakeFilename(fs, r.dirname, fileTypeTable, t.FileNum))
+		if err != nil {
+			return nil, err
+		}
+		cacheOpts := private.SSTableCacheOpts(cacheID, t.FileNum).(sstable.ReaderOption)
+		reader, err := sstable.NewReader(f, readerOpts, cacheOpts)
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, reader)
+		iter, err := reader.NewIter(nil /* lower */, nil /* upper */)
+		if err != nil {
+			return nil, err
+		}
+		iters = append(iters, iter)
+		rangeDelIter, err := reader.NewRawRangeDelIter()
+		if err != nil {
+			return nil, err
+		}
+		if rangeDelIter != nil {
+			for key, val := rangeDelIter.First(); key != nil; key, val = rangeDelIter.Next() {
+				tombstones = append(tombstones, rangedel.Tombstone{
+					Start: key.Clone(),
+					End:   append([]byte(nil), val...),
+				})
+			}
+			if err := rangeDelIter.Close(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(m.Inputs, func(i, j int) bool { return m.Inputs[i] < m.Inputs[j] })
+
+	m.FileNum = r.nextFileNum
+	r.nextFileNum++
+	filename := base.MakeFilename(fs, r.dirname, fileTypeTable, m.FileNum)
+	f, err := fs.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := sstable.NewWriter(f, r.opts.MakeWriterOptions(0))
+
+	// duplicates is set if a key is found in more than one of the tables.
+	duplicates := false
+	iter := newMergingIter(r.opts.Logger, cmp, iters...)
+	iters = nil
+	var prev InternalKey
+	first := true
+	for key, val := iter.First(); key != nil; key, val = iter.Next() {
+		if !first && base.InternalCompare(cmp, prev, *key) == 0 {
+			duplicates = true
+			continue
+		}
+		if err = w.Add(*key, val); err != nil {
+			break
+		}
+		prev.UserKey = append(prev.UserKey[:0], key.UserKey...)
+		prev.Trailer = key.Trailer
+		first = false
+	}
+	err = firstError(err, iter.Close())
+
+	// The tombstones of each table are fragmented, but the tombstones of
+	// different tables must be fragmented together.
+	sort.Slice(tombstones, func(i, j int) bool {
+		return base.InternalCompare(cmp, tombstones[i].Start, tombstones[j].Start) < 0
+	})
+	frag := rangedel.Fragmenter{
+		Cmp: cmp,
+		Emit: func(fragments []rangedel.Tombstone) {
+			for i, t := range fragments {
+				if i > 0 && fragments[i-1].Start.Trailer == t.Start.Trailer {
+					duplicates = true
+					continue
+				}
+				if err == nil {
+					err = w.Add(t.Start, t.End)
+				}
+			}
+		},
+	}
+	for _, t := range tombstones {
+		frag.Add(t.Start, t.End)
+	}
+	frag.Finish()
+
+	err = firstError(err, w.Close())
+	if err != nil {
+		fs.Remove(filename)
+		return nil, err
+	}
+	meta, err := repairLoadTable(r.opts, c, cacheID, r.dirname, m.FileNum)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fileNum := range m.Inputs {
+		name := fs.PathBase(base.MakeFilename(fs, r.dirname, fileTypeTable, fileNum))
+		if err := r.quarantine(r.dirname, name); err != nil {
+			return nil, err
+		}
+	}
+	r.report.MergedTables = append(r.report.MergedTables, m)
+	if duplicates {
+		r.report.PossiblyObsolete = append(r.report.PossiblyObsolete, m.Inputs...)
+	}
+	return meta, nil
+}
+
+// writeManifest writes a new MANIFEST containing the tables and points the
+// CURRENT file at it.
+func (r *repairer) writeManifest(minUnflushedLogNum FileNum) error {
+	fs := r.opts.FS
+	manifestNum := r.nextFileNum
+	r.nextFileNum++
+	if minUnflushedLogNum == 0 || minUnflushedLogNum == manifestNum {
+		minUnflushedLogNum = r.nextFileNum
+	}
+
+	ve := versionEdit{
+		ComparerName:       r.opts.Comparer.Name,
+		MinUnflushedLogNum: minUnflushedLogNum,
+		NextFileNum:        r.nextFileNum,
+		LastSeqNum:         r.lastSeqNum,
+	}
+	for _, t := range r.tables {
+		ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: r.levels[t.FileNum], Meta: t})
+	}
+	var bve bulkVersionEdit
+	bve.Accumulate(&ve)
+	if _, _, err := bve.Apply(nil, r.opts.Comparer.Compare, r.opts.Comparer.FormatKey,
+		r.opts.Experimental.FlushSplitBytes); err != nil {
+		return errors.Wrap(err, "pebble: unable to repair MANIFEST")
+	}
+
+	filename := base.MakeFilename(fs, r.dirname, fileTypeManifest, manifestNum)
+	f, err := fs.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		w := record.NewWriter(f)
+		rw, err := w.Next()
+		if err != nil {
+			return err
+		}
+		if err := ve.Encode(rw); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fs.Remove(filename)
+		return err
+	}
+	if err := setCurrentFile(r.dirname, fs, manifestNum); err != nil {
+		return err
+	}
+	dir, err := fs.OpenDir(r.dirname)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
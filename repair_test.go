@@ -0,0 +1,247 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func repairTestFiles(t *testing.T, fs vfs.FS, typ fileType) []FileNum {
+	ls, err := fs.List("")
+	require.NoError(t, err)
+	var nums []FileNum
+	for _, name := range ls {
+		if ft, fn, ok := base.ParseFilename(fs, name); ok && ft == typ {
+			nums = append(nums, fn)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	return nums
+}
+
+func repairTestCorrupt(t *testing.T, fs vfs.FS, name string, offset int) {
+	f, err := fs.Open(name)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data[offset] ^= 0xff
+	f, err = fs.Create(name)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func repairTestGet(t *testing.T, d *DB, key string) string {
+	v, closer, err := d.Get([]byte(key))
+	if err == ErrNotFound {
+		return ""
+	}
+	require.NoError(t, err)
+	defer closer.Close()
+	return string(v)
+}
+
+// repairTestDB creates a DB with three L0 tables holding {a, b}, {c, d} and
+// {a, b, e} respectively.
+func repairTestDB(t *testing.T) vfs.FS {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem}
+	opts.private.disableAutomaticCompactions = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	for i, keys := range [][]string{{"a", "b"}, {"c", "d"}, {"a", "b", "e"}} {
+		for _, k := range keys {
+			require.NoError(t, d.Set([]byte(k), []byte(fmt.Sprint(i)), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Close())
+	return mem
+}
+
+func TestRepairCorruptTable(t *testing.T) {
+	mem := repairTestDB(t)
+	tables := repairTestFiles(t, mem, fileTypeTable)
+	require.Len(t, tables, 3)
+
+	// Corrupt the table holding c and d.
+	lost := tables[1]
+	repairTestCorrupt(t, mem, base.MakeFilename(mem, "", fileTypeTable, lost), 0)
+
+	report, err := Repair("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Tables)
+	require.Equal(t, []string{fmt.Sprintf("%s.sst", lost)}, report.Quarantined)
+	require.Len(t, report.LostTables, 1)
+	require.Equal(t, lost, report.LostTables[0].FileNum)
+	require.True(t, report.LostTables[0].BoundsKnown)
+	require.Equal(t, "c", string(report.LostTables[0].Smallest.UserKey))
+	require.Equal(t, "d", string(report.LostTables[0].Largest.UserKey))
+	require.Regexp(t, "checksum mismatch", report.LostTables[0].Err)
+	require.Regexp(t, fmt.Sprintf(`lost table %s: \[c#\d+,SET-d#\d+,SET\]`, lost), report.String())
+
+	_, err = mem.Stat(mem.PathJoin(QuarantineDir, fmt.Sprintf("%s.sst", lost)))
+	require.NoError(t, err)
+
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, "2", repairTestGet(t, d, "a"))
+	require.Equal(t, "", repairTestGet(t, d, "c"))
+	require.Equal(t, "", repairTestGet(t, d, "d"))
+	require.Equal(t, "2", repairTestGet(t, d, "e"))
+	require.NoError(t, d.Close())
+}
+
+func TestRepairCorruptManifest(t *testing.T) {
+	mem := repairTestDB(t)
+	manifests := repairTestFiles(t, mem, fileTypeManifest)
+	require.Len(t, manifests, 1)
+	manifestName := base.MakeFilename(mem, "", fileTypeManifest, manifests[0])
+	repairTestCorrupt(t, mem, manifestName, 10)
+
+	_, err := Open("", &Options{FS: mem})
+	require.Error(t, err)
+
+	report, err := Repair("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Tables)
+	require.Equal(t, []string{mem.PathBase(manifestName)}, report.Quarantined)
+	require.Empty(t, report.LostTables)
+
+	// The tables are placed in levels from their sequence numbers, so the
+	// newest values of a and b are visible.
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	for k, v := range map[string]string{"a": "2", "b": "2", "c": "1", "d": "1", "e": "2"} {
+		require.Equal(t, v, repairTestGet(t, d, k), k)
+	}
+	require.NoError(t, d.CheckLevels(nil))
+	require.NoError(t, d.Close())
+}
+
+func TestRepairCorruptWAL(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	// Write values large enough that each one spans a WAL block, so that
+	// corrupting one record only loses the records in its block.
+	value := bytes.Repeat([]byte("x"), 40<<10)
+	const n = 5
+	for i := 0; i < n; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprint(i)), value, nil))
+	}
+	require.NoError(t, d.Close())
+
+	logs := repairTestFiles(t, mem, fileTypeLog)
+	require.NotEmpty(t, logs)
+	logNum := logs[len(logs)-1]
+	logName := base.MakeFilename(mem, "", fileTypeLog, logNum)
+	// Corrupt the payload of the second record.
+	repairTestCorrupt(t, mem, logName, 60<<10)
+
+	report, err := Repair("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, n-1, report.WALRecords)
+	require.Equal(t, []string{mem.PathBase(logName)}, report.Quarantined)
+	require.Len(t, report.LostWALData, 1)
+	require.Equal(t, logNum, report.LostWALData[0].FileNum)
+	require.True(t, report.LostWALData[0].Length > 0)
+
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	var missing []string
+	for i := 0; i < n; i++ {
+		if repairTestGet(t, d, fmt.Sprint(i)) == "" {
+			missing = append(missing, fmt.Sprint(i))
+		}
+	}
+	require.Equal(t, []string{"1"}, missing)
+	require.NoError(t, d.Close())
+}
+
+// repairTestWriteTable writes a table holding the specified keys, which are
+// strings of the form "key#seqnum" for sets and "start-end#seqnum" for range
+// deletions. The value of a set is its key and sequence number.
+func repairTestWriteTable(t *testing.T, fs vfs.FS, fileNum FileNum, keys ...string) {
+	f, err := fs.Create(base.MakeFilename(fs, "", fileTypeTable, fileNum))
+	require.NoError(t, err)
+	w := sstable.NewWriter(f, sstable.WriterOptions{})
+	for _, k := range keys {
+		var seqNum uint64
+		i := strings.IndexByte(k, '#')
+		_, err := fmt.Sscan(k[i+1:], &seqNum)
+		require.NoError(t, err)
+		if j := strings.IndexByte(k[:i], '-'); j >= 0 {
+			key := base.MakeInternalKey([]byte(k[:j]), seqNum, InternalKeyKindRangeDelete)
+			require.NoError(t, w.Add(key, []byte(k[j+1:i])))
+		} else {
+			key := base.MakeInternalKey([]byte(k[:i]), seqNum, InternalKeyKindSet)
+			require.NoError(t, w.Add(key, []byte(k)))
+		}
+	}
+	require.NoError(t, w.Close())
+}
+
+func TestRepairInterleavedTables(t *testing.T) {
+	// Without a MANIFEST, the tables must be placed in levels from their
+	// sequence numbers alone. The sequence numbers of the tables interleave, so
+	// neither can be placed above the other: table 1 holds the newest values
+	// of c and d, and table 2 the newest value of a.
+	mem := vfs.NewMem()
+	repairTestWriteTable(t, mem, 1, "a#5", "c#20", "d-e#30")
+	repairTestWriteTable(t, mem, 2, "a#10", "b#15", "d#25")
+
+	report, err := Repair("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Tables)
+	require.Equal(t, []MergedTable{{FileNum: 3, Inputs: []FileNum{1, 2}}}, report.MergedTables)
+	require.Empty(t, report.PossiblyObsolete)
+	require.Equal(t, []string{"000001.sst", "000002.sst"}, report.Quarantined)
+	require.Regexp(t, `merged tables \[000001 000002\] into 000003`, report.String())
+
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	for k, v := range map[string]string{"a": "a#10", "b": "b#15", "c": "c#20", "d": ""} {
+		require.Equal(t, v, repairTestGet(t, d, k), k)
+	}
+	require.NoError(t, d.CheckLevels(nil))
+	require.NoError(t, d.Close())
+}
+
+func TestRepairPossiblyObsoleteTables(t *testing.T) {
+	// Table 1 is an input of the compaction which wrote table 2, and was not
+	// deleted before the MANIFEST was lost. The tables share keys.
+	mem := vfs.NewMem()
+	repairTestWriteTable(t, mem, 1, "a#5", "b#6", "b-c#7")
+	repairTestWriteTable(t, mem, 2, "a#5", "b#6", "b-c#7", "c#8")
+	repairTestWriteTable(t, mem, 3, "x#1")
+
+	report, err := Repair("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Tables)
+	require.Equal(t, []MergedTable{{FileNum: 4, Inputs: []FileNum{1, 2}}}, report.MergedTables)
+	require.Equal(t, []FileNum{1, 2}, report.PossiblyObsolete)
+	require.Regexp(t, `possibly obsolete table 000001`, report.String())
+
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	for k, v := range map[string]string{"a": "a#5", "b": "", "c": "c#8", "x": "x#1"} {
+		require.Equal(t, v, repairTestGet(t, d, k), k)
+	}
+	require.NoError(t, d.CheckLevels(nil))
+	require.NoError(t, d.Close())
+}
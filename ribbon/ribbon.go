@@ -0,0 +1,347 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package ribbon implements Ribbon filters.
+//
+// A Ribbon filter is a static probabilistic set membership structure which
+// answers queries with a false positive rate comparable to a Bloom filter
+// while using ~30% less space. The implementation is a "standard Ribbon"
+// filter (see "Ribbon filter: practically smaller than Bloom and Xor", Peter
+// C. Dillinger and Stefan Walzer, 2021) with 64-bit wide coefficient rows.
+//
+// Each key is hashed to a starting slot, a 64-bit coefficient row and an
+// r-bit result. Building the filter solves the linear system (over GF(2))
+// where, for every key, the XOR of the solution rows selected by the
+// coefficient bits starting at the key's starting slot equals the key's
+// result. A query recomputes the XOR and compares it against the key's
+// result. Non-members match with probability 2^-r.
+package ribbon // import "github.com/cockroachdb/pebble/ribbon"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+const (
+	// coeffBits is the width of a coefficient row. A key's coefficient row
+	// covers coeffBits consecutive slots beginning at its starting slot.
+	coeffBits = 64
+	// maxResultBits is the maximum number of result bits per key, which
+	// bounds the false positive rate at 2^-maxResultBits.
+	maxResultBits = 32
+	// overheadPercent is the space overhead of the initial number of slots
+	// relative to the number of keys. Construction fails with low
+	// probability at this overhead, in which case it is retried with a
+	// different seed and, eventually, more slots.
+	overheadPercent = 8
+	// seedsPerSize is the number of seeds attempted for a given number of
+	// slots before the number of slots is increased.
+	seedsPerSize = 4
+	// trailerLen is the length of the filter trailer: the number of slots (4
+	// bytes), the seed (4 bytes) and the number of result bits (1 byte).
+	trailerLen = 9
+)
+
+// resultBits returns the number of result bits per key for the specified
+// number of bits per key, accounting for the space overhead of the filter.
+func resultBits(bitsPerKey int) uint32 {
+	r := uint32(bitsPerKey * 100 / (100 + overheadPercent))
+	if r < 1 {
+		r = 1
+	}
+	if r > maxResultBits {
+		r = maxResultBits
+	}
+	return r
+}
+
+// numSlotsForKeys returns the initial number of slots for a filter holding n
+// keys. The number of slots is always a multiple of coeffBits.
+func numSlotsForKeys(n int) uint32 {
+	slots := n + n*overheadPercent/100 + coeffBits
+	return uint32((slots + coeffBits - 1) / coeffBits * coeffBits)
+}
+
+// mix64 is the 64-bit finalizer from SplitMix64.
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// hash returns a 64-bit hash of the key.
+func hash(b []byte) uint64 {
+	const m = 0x9e3779b97f4a7c15
+	h := uint64(len(b)) * m
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= mix64(binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*m + 0x52dce729
+	}
+	var tail uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		tail = tail<<8 | uint64(b[i])
+	}
+	h ^= mix64(tail ^ uint64(len(b)))
+	return mix64(h)
+}
+
+// slot holds the parameters of a key's equation in the linear system.
+type slot struct {
+	start  uint32
+	coeff  uint64
+	result uint32
+}
+
+// derive computes the equation for the key with the specified hash, given
+// the seed, the number of possible starting slots, and the result mask.
+func derive(h uint64, seed uint32, numStarts uint32, resultMask uint32) slot {
+	h = mix64(h + uint64(seed)*0x9e3779b97f4a7c15)
+	g := mix64(h ^ 0xa0761d6478bd642f)
+	return slot{
+		start: uint32((uint64(uint32(h>>32)) * uint64(numStarts)) >> 32),
+		// The low bit of the coefficient row is always set, so the first
+		// slot covered by the row is the key's starting slot.
+		coeff:  g | 1,
+		result: uint32(h) & resultMask,
+	}
+}
+
+type tableFilter []byte
+
+// MayContain returns whether the filter may contain the given key. False
+// positives are possible, where it returns true for keys not in the original
+// set.
+func (f tableFilter) MayContain(key []byte) bool {
+	if len(f) < trailerLen {
+		return false
+	}
+	n := len(f) - trailerLen
+	numSlots := binary.LittleEndian.Uint32(f[n:])
+	seed := binary.LittleEndian.Uint32(f[n+4:])
+	r := uint32(f[n+8])
+	if numSlots == 0 {
+		return false
+	}
+	if numSlots%coeffBits != 0 || r == 0 || r > maxResultBits ||
+		n != int(r)*int(numSlots/8) {
+		// Unknown encoding. Consider it a match.
+		return true
+	}
+
+	s := derive(hash(key), seed, numSlots-coeffBits+1, resultMask(r))
+	colLen := int(numSlots / 8)
+	word, shift := int(s.start/64)*8, s.start%64
+	var result uint32
+	for j := uint32(0); j < r; j++ {
+		col := f[int(j)*colLen:]
+		window := binary.LittleEndian.Uint64(col[word:]) >> shift
+		if shift != 0 {
+			window |= binary.LittleEndian.Uint64(col[word+8:]) << (64 - shift)
+		}
+		result |= uint32(bits.OnesCount64(window&s.coeff)&1) << j
+	}
+	return result == s.result
+}
+
+func resultMask(r uint32) uint32 {
+	return uint32(1<<r - 1)
+}
+
+// extend appends n zero bytes to b. It returns the overall slice (of length
+// n+len(originalB)) and the slice of n trailing zeroes.
+func extend(b []byte, n int) (overall, trailer []byte) {
+	want := n + len(b)
+	if want <= cap(b) {
+		overall = b[:want]
+		trailer = overall[len(b):]
+		for i := range trailer {
+			trailer[i] = 0
+		}
+	} else {
+		overall = make([]byte, want)
+		trailer = overall[len(b):]
+		copy(overall, b)
+	}
+	return overall, trailer
+}
+
+// banding holds the partially solved linear system while a filter is being
+// built. Row i, if non-zero, is an equation whose lowest coefficient is slot
+// i.
+type banding struct {
+	coeffs  []uint64
+	results []uint32
+}
+
+func (b *banding) reset(numSlots uint32) {
+	if uint32(cap(b.coeffs)) < numSlots {
+		b.coeffs = make([]uint64, numSlots)
+		b.results = make([]uint32, numSlots)
+		return
+	}
+	b.coeffs = b.coeffs[:numSlots]
+	b.results = b.results[:numSlots]
+	for i := range b.coeffs {
+		b.coeffs[i] = 0
+		b.results[i] = 0
+	}
+}
+
+// add adds the equation for a key to the system, returning false if the
+// equation is inconsistent with the existing equations.
+func (b *banding) add(s slot) bool {
+	i, c, r := s.start, s.coeff, s.result
+	for {
+		if b.coeffs[i] == 0 {
+			b.coeffs[i] = c
+			b.results[i] = r
+			return true
+		}
+		c ^= b.coeffs[i]
+		r ^= b.results[i]
+		if c == 0 {
+			// The equation is a linear combination of existing equations. This
+			// is the case for duplicate keys, which are consistent.
+			return r == 0
+		}
+		tz := uint32(bits.TrailingZeros64(c))
+		c >>= tz
+		i += tz
+	}
+}
+
+// solve performs back substitution, writing the solution to f in column
+// major order: r columns of numSlots bits each.
+func (b *banding) solve(f []byte, r uint32) {
+	numSlots := uint32(len(b.coeffs))
+	colLen := int(numSlots / 8)
+	// state[j] holds the bits of column j for the coeffBits slots following
+	// the current slot, with the bit for the slot i+k at position k.
+	var state [maxResultBits]uint64
+	for i := int(numSlots) - 1; i >= 0; i-- {
+		c := b.coeffs[i]
+		res := b.results[i]
+		for j := uint32(0); j < r; j++ {
+			// For a non-zero row, the solution bit at slot i is chosen such
+			// that the row's equation holds. The coefficient's low bit (slot i
+			// itself) is always set and does not contribute to the parity as
+			// the state does not yet include slot i. Zero rows are free
+			// variables and are set to zero.
+			var bit uint64
+			if c != 0 {
+				bit = uint64(bits.OnesCount64((c>>1)&state[j])&1) ^ uint64((res>>j)&1)
+			}
+			state[j] = state[j]<<1 | bit
+			if bit != 0 {
+				col := f[int(j)*colLen:]
+				col[i/8] |= 1 << (uint(i) % 8)
+			}
+		}
+	}
+}
+
+type tableFilterWriter struct {
+	bitsPerKey int
+	hashes     []uint64
+	banding    banding
+}
+
+// AddKey implements the base.FilterWriter interface.
+func (w *tableFilterWriter) AddKey(key []byte) {
+	h := hash(key)
+	if n := len(w.hashes); n == 0 || h != w.hashes[n-1] {
+		w.hashes = append(w.hashes, h)
+	}
+}
+
+// Finish implements the base.FilterWriter interface.
+func (w *tableFilterWriter) Finish(buf []byte) []byte {
+	if len(w.hashes) == 0 {
+		buf, _ = extend(buf, trailerLen)
+		return buf
+	}
+
+	r := resultBits(w.bitsPerKey)
+	mask := resultMask(r)
+	numSlots := numSlotsForKeys(len(w.hashes))
+	var seed uint32
+	for attempt := 1; ; attempt++ {
+		w.banding.reset(numSlots)
+		ok := true
+		for _, h := range w.hashes {
+			if !w.banding.add(derive(h, seed, numSlots-coeffBits+1, mask)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			break
+		}
+		seed++
+		if attempt%seedsPerSize == 0 {
+			// Repeated failures indicate the system is too dense. Grow the
+			// number of slots by ~1/16th, which quickly drives the probability
+			// of failure to zero.
+			numSlots += (numSlots/16 + coeffBits - 1) / coeffBits * coeffBits
+		}
+	}
+
+	nBytes := int(r) * int(numSlots/8)
+	buf, filter := extend(buf, nBytes+trailerLen)
+	w.banding.solve(filter[:nBytes], r)
+	binary.LittleEndian.PutUint32(filter[nBytes:], numSlots)
+	binary.LittleEndian.PutUint32(filter[nBytes+4:], seed)
+	filter[nBytes+8] = byte(r)
+
+	w.hashes = w.hashes[:0]
+	return buf
+}
+
+// FilterPolicy implements the FilterPolicy interface from the pebble package.
+//
+// The integer value is the approximate number of bits used per key, as with
+// bloom.FilterPolicy. For the same number of bits per key a Ribbon filter has
+// a substantially lower false positive rate than a Bloom filter: a value of 10
+// yields a filter with ~0.2% false positive rate, while a value of 8 yields
+// ~0.8%. Ribbon filters are more expensive to construct, so they are best
+// suited to the bottom levels of the LSM where filter memory dominates.
+//
+// It is valid to use the other API in this package (pebble/ribbon) without
+// using this type or the pebble package.
+type FilterPolicy int
+
+// Name implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) Name() string {
+	// The filter format is not compatible with RocksDB's Ribbon filter, so
+	// the name must differ from RocksDB's.
+	return "pebble.RibbonFilter"
+}
+
+// MayContain implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) MayContain(ftype base.FilterType, f, key []byte) bool {
+	switch ftype {
+	case base.TableFilter:
+		return tableFilter(f).MayContain(key)
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
+
+// NewWriter implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) NewWriter(ftype base.FilterType) base.FilterWriter {
+	switch ftype {
+	case base.TableFilter:
+		return &tableFilterWriter{
+			bitsPerKey: int(p),
+		}
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
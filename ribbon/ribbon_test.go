@@ -0,0 +1,205 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package ribbon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/stretchr/testify/require"
+)
+
+func newTableFilter(keys [][]byte, bitsPerKey int) tableFilter {
+	w := FilterPolicy(bitsPerKey).NewWriter(base.TableFilter)
+	for _, key := range keys {
+		w.AddKey(key)
+	}
+	return tableFilter(w.Finish(nil))
+}
+
+func le32(i int) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(i))
+	return b
+}
+
+func TestEmptyFilter(t *testing.T) {
+	f := newTableFilter(nil, 10)
+	require.False(t, f.MayContain([]byte("hello")))
+	require.False(t, f.MayContain(nil))
+	require.False(t, tableFilter(nil).MayContain([]byte("hello")))
+}
+
+func TestSmallFilter(t *testing.T) {
+	f := newTableFilter([][]byte{
+		[]byte("hello"),
+		[]byte("world"),
+	}, 10)
+
+	m := map[string]bool{
+		"hello": true,
+		"world": true,
+		"x":     false,
+		"foo":   false,
+	}
+	for k, want := range m {
+		got := f.MayContain([]byte(k))
+		if got != want {
+			t.Errorf("MayContain: k=%q: got %v, want %v", k, got, want)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	var keys [][]byte
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, le32(i%10))
+	}
+	f := newTableFilter(keys, 10)
+	for i := 0; i < 10; i++ {
+		require.True(t, f.MayContain(le32(i)))
+	}
+}
+
+func TestFilter(t *testing.T) {
+	nextLength := func(x int) int {
+		if x < 10 {
+			return x + 1
+		}
+		if x < 100 {
+			return x + 10
+		}
+		if x < 1000 {
+			return x + 100
+		}
+		return x + 1000
+	}
+
+	for _, bitsPerKey := range []int{5, 10, 20} {
+		expectedRate := 1.0
+		for i := uint32(0); i < resultBits(bitsPerKey); i++ {
+			expectedRate /= 2
+		}
+
+		for length := 1; length <= 10000; length = nextLength(length) {
+			keys := make([][]byte, 0, length)
+			for i := 0; i < length; i++ {
+				keys = append(keys, le32(i))
+			}
+			f := newTableFilter(keys, bitsPerKey)
+
+			// All added keys must match.
+			for _, key := range keys {
+				if !f.MayContain(key) {
+					t.Fatalf("bits=%d, length=%d: did not contain key %q", bitsPerKey, length, key)
+				}
+			}
+
+			// Check the false positive rate.
+			nFalsePositive := 0
+			for i := 0; i < 10000; i++ {
+				if f.MayContain(le32(1e9 + i)) {
+					nFalsePositive++
+				}
+			}
+			rate := float64(nFalsePositive) / 10000
+			if rate > 2*expectedRate+0.005 {
+				t.Errorf("bits=%d, length=%d: false positive rate %.4f exceeds %.4f",
+					bitsPerKey, length, rate, 2*expectedRate+0.005)
+			}
+
+			// The filter should use roughly bitsPerKey bits per key for large
+			// numbers of keys.
+			if length >= 10000 {
+				bitsUsed := float64(8*len(f)) / float64(length)
+				if bitsUsed > 1.1*float64(bitsPerKey) {
+					t.Errorf("bits=%d, length=%d: used %.2f bits per key", bitsPerKey, length, bitsUsed)
+				}
+			}
+		}
+	}
+}
+
+func TestFilterWriterReuse(t *testing.T) {
+	w := FilterPolicy(10).NewWriter(base.TableFilter)
+	for i := 0; i < 100; i++ {
+		w.AddKey(le32(i))
+	}
+	f1 := tableFilter(w.Finish(nil))
+	for i := 100; i < 200; i++ {
+		w.AddKey(le32(i))
+	}
+	f2 := tableFilter(w.Finish(nil))
+	for i := 0; i < 100; i++ {
+		require.True(t, f1.MayContain(le32(i)))
+		require.True(t, f2.MayContain(le32(i+100)))
+	}
+}
+
+func benchmarkKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%012d", i))
+	}
+	return keys
+}
+
+var benchmarkPolicies = []struct {
+	name   string
+	policy base.FilterPolicy
+}{
+	{"bloom-10", bloom.FilterPolicy(10)},
+	{"ribbon-7", FilterPolicy(7)},
+	{"ribbon-10", FilterPolicy(10)},
+}
+
+func BenchmarkFilterBuild(b *testing.B) {
+	const n = 100000
+	keys := benchmarkKeys(n)
+	for _, p := range benchmarkPolicies {
+		b.Run(p.name, func(b *testing.B) {
+			w := p.policy.NewWriter(base.TableFilter)
+			var buf []byte
+			for i := 0; i < b.N; i++ {
+				for _, key := range keys {
+					w.AddKey(key)
+				}
+				buf = w.Finish(buf[:0])
+			}
+			b.ReportMetric(float64(8*len(buf))/n, "bits/key")
+		})
+	}
+}
+
+func BenchmarkFilterMayContain(b *testing.B) {
+	const n = 100000
+	keys := benchmarkKeys(n)
+	for _, p := range benchmarkPolicies {
+		b.Run(p.name, func(b *testing.B) {
+			w := p.policy.NewWriter(base.TableFilter)
+			for _, key := range keys {
+				w.AddKey(key)
+			}
+			filter := w.Finish(nil)
+			missing := make([][]byte, n)
+			for i := range missing {
+				missing[i] = []byte(fmt.Sprintf("missing-%012d", i))
+			}
+
+			b.ResetTimer()
+			var falsePositives int
+			for i := 0; i < b.N; i++ {
+				if p.policy.MayContain(base.TableFilter, filter, missing[i%n]) {
+					falsePositives++
+				}
+			}
+			b.ReportMetric(float64(falsePositives)/float64(b.N), "fp-rate")
+			b.ReportMetric(float64(8*len(filter))/n, "bits/key")
+		})
+	}
+}
@@ -35,6 +35,21 @@ func (s *Snapshot) Get(key []byte) ([]byte, io.Closer, error) {
 	return s.db.getInternal(key, nil /* batch */, s)
 }
 
+// MultiGet gets the values for the given keys. The returned values are
+// parallel to keys: values[i] is the value for keys[i], or nil if the Snapshot
+// does not contain keys[i]. See DB.MultiGet.
+//
+// The caller should not modify the contents of the returned slices, but it is
+// safe to modify the contents of the arguments after MultiGet returns. The
+// returned slices will remain valid until the returned Closer is closed. On
+// success, the caller MUST call closer.Close() or a memory leak will occur.
+func (s *Snapshot) MultiGet(keys [][]byte) ([][]byte, io.Closer, error) {
+	if s.db == nil {
+		panic(ErrClosed)
+	}
+	return s.db.multiGetInternal(keys, nil /* batch */, s)
+}
+
 // NewIter returns an iterator that is unpositioned (Iterator.Valid() will
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekLT, First or Last.
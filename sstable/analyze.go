@@ -0,0 +1,120 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/golang/snappy"
+)
+
+// The functions in this file support analyzing the effect of alternative
+// compression and block settings on a table's data blocks: the records of
+// existing data blocks are read with DataBlockRecords, re-encoded with a
+// DataBlockRewriter, and compressed with CompressBlock.
+
+// DataBlockRecords calls fn for each record in the data block with the
+// specified handle. The key and value passed to fn are only valid for the
+// duration of the call.
+func (r *Reader) DataBlockRecords(bh BlockHandle, fn func(key *InternalKey, value []byte)) error {
+	h, err := r.readBlock(bh, nil /* transform */, nil /* readaheadState */)
+	if err != nil {
+		return err
+	}
+	defer h.Release()
+
+	if r.tableFormat == TableFormatPebblev1 {
+		return decodeColumnarBlockRows(r.Compare, h.Get(), fn)
+	}
+	iter, err := newBlockIter(r.Compare, h.Get())
+	if err != nil {
+		return err
+	}
+	for key, value := iter.First(); key != nil; key, value = iter.Next() {
+		fn(key, value)
+	}
+	return iter.Close()
+}
+
+// DataBlockRewriter encodes records into row-oriented data blocks using the
+// specified block size and restart interval, mirroring the way a Writer
+// splits its data blocks.
+type DataBlockRewriter struct {
+	block              blockWriter
+	blockSize          int
+	blockSizeThreshold int
+	blocks             [][]byte
+}
+
+// NewDataBlockRewriter returns a DataBlockRewriter which produces blocks of
+// approximately blockSize bytes with a restart point every restartInterval
+// keys.
+func NewDataBlockRewriter(blockSize, restartInterval int) *DataBlockRewriter {
+	return &DataBlockRewriter{
+		block:              blockWriter{restartInterval: restartInterval},
+		blockSize:          blockSize,
+		blockSizeThreshold: (blockSize*base.DefaultBlockSizeThreshold + 99) / 100,
+	}
+}
+
+// Add adds a record to the current block, finishing the block first if the
+// record would take it past the target block size. Records must be added in
+// increasing key order.
+func (w *DataBlockRewriter) Add(key InternalKey, value []byte) {
+	if shouldFlush(key, value, &w.block, w.blockSize, w.blockSizeThreshold) {
+		w.finishBlock()
+	}
+	w.block.add(key, value)
+}
+
+func (w *DataBlockRewriter) finishBlock() {
+	w.blocks = append(w.blocks, append([]byte(nil), w.block.finish()...))
+}
+
+// Finish finishes the current block and returns the uncompressed encoded
+// blocks. The rewriter may be reused after Finish returns.
+func (w *DataBlockRewriter) Finish() [][]byte {
+	if w.block.nEntries > 0 {
+		w.finishBlock()
+	}
+	blocks := w.blocks
+	w.blocks = nil
+	return blocks
+}
+
+// CompressBlock compresses b as a Writer would before writing it to a table,
+// appending the result to dst[:0]. It returns false, along with b itself, if
+// the block would be stored uncompressed because the compression is
+// NoCompression or does not shrink the block sufficiently.
+func CompressBlock(compression Compression, dst, b []byte) ([]byte, bool) {
+	if compression != SnappyCompression {
+		return b, false
+	}
+	compressed := snappy.Encode(dst[:cap(dst)], b)
+	if !compressionWorthwhile(len(b), len(compressed)) {
+		return b, false
+	}
+	return compressed, true
+}
+
+// DecompressBlock decompresses a block compressed by CompressBlock, appending
+// the result to dst[:0].
+func DecompressBlock(compression Compression, dst, b []byte) ([]byte, error) {
+	switch compression {
+	case NoCompression:
+		return append(dst[:0], b...), nil
+	case SnappyCompression:
+		return snappy.Decode(dst[:cap(dst)], b)
+	default:
+		return nil, errors.Errorf("pebble/table: unknown block compression: %s", errors.Safe(compression))
+	}
+}
+
+// compressionWorthwhile returns true if a block of the specified size should
+// be stored in its compressed form: the compression must shrink the block by
+// at least 12.5%.
+func compressionWorthwhile(size, compressedSize int) bool {
+	return compressedSize < size-size/8
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataBlockRewriter(t *testing.T) {
+	var keys []InternalKey
+	for i := 0; i < 2000; i++ {
+		keys = append(keys, base.MakeInternalKey([]byte(fmt.Sprintf("key-%05d", i)), 1, InternalKeyKindSet))
+	}
+
+	for _, format := range []TableFormat{TableFormatRocksDBv2, TableFormatPebblev1} {
+		t.Run(fmt.Sprintf("format=%d", format), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(f, WriterOptions{TableFormat: format})
+			for _, k := range keys {
+				require.NoError(t, w.Add(k, bytes.Repeat(k.UserKey, 4)))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			r, err := NewReader(f, ReaderOptions{})
+			require.NoError(t, err)
+			defer r.Close()
+			layout, err := r.Layout()
+			require.NoError(t, err)
+
+			for _, blockSize := range []int{512, 4096, 32768} {
+				for _, restartInterval := range []int{1, 16} {
+					rw := NewDataBlockRewriter(blockSize, restartInterval)
+					for _, bh := range layout.Data {
+						require.NoError(t, r.DataBlockRecords(bh, func(key *InternalKey, value []byte) {
+							rw.Add(*key, value)
+						}))
+					}
+					blocks := rw.Finish()
+					require.NotEmpty(t, blocks)
+
+					// The rewritten blocks must hold the original records, and
+					// survive a compression round trip.
+					var i int
+					for _, b := range blocks {
+						require.True(t, len(b) < blockSize+256, "block of %d bytes", len(b))
+						for _, compression := range []Compression{NoCompression, SnappyCompression} {
+							compressed, ok := CompressBlock(compression, nil, b)
+							require.Equal(t, compression == SnappyCompression, ok)
+							if !ok {
+								continue
+							}
+							require.True(t, len(compressed) < len(b))
+							decompressed, err := DecompressBlock(compression, nil, compressed)
+							require.NoError(t, err)
+							require.Equal(t, b, decompressed)
+						}
+
+						iter, err := newBlockIter(bytes.Compare, b)
+						require.NoError(t, err)
+						for key, value := iter.First(); key != nil; key, value = iter.Next() {
+							require.Equal(t, keys[i], *key)
+							require.Equal(t, bytes.Repeat(keys[i].UserKey, 4), value)
+							i++
+						}
+					}
+					require.Equal(t, len(keys), i)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package sstable
 
 import (
+	"bytes"
 	"encoding/binary"
 	"unsafe"
 
@@ -32,6 +33,9 @@ type blockWriter struct {
 	curValue        []byte
 	prevKey         []byte
 	tmp             [4]byte
+	// hashIndex, if non-nil, builds a hash index of the block's keys which is
+	// written after the restart points. See DataBlockBinaryAndHash.
+	hashIndex *dataBlockHashIndexBuilder
 }
 
 func (w *blockWriter) store(keySize int, value []byte) {
@@ -122,6 +126,9 @@ func (w *blockWriter) add(key InternalKey, value []byte) {
 	key.Encode(w.curKey)
 
 	w.store(size, value)
+	if w.hashIndex != nil {
+		w.hashIndex.add(key.UserKey, len(w.restarts)-1)
+	}
 }
 
 func (w *blockWriter) finish() []byte {
@@ -140,7 +147,14 @@ func (w *blockWriter) finish() []byte {
 		binary.LittleEndian.PutUint32(tmp4, x)
 		w.buf = append(w.buf, tmp4...)
 	}
-	binary.LittleEndian.PutUint32(tmp4, uint32(len(w.restarts)))
+	numRestarts := uint32(len(w.restarts))
+	if w.hashIndex != nil {
+		var ok bool
+		if w.buf, ok = w.hashIndex.finish(w.buf); ok {
+			numRestarts |= dataBlockHashIndexFlag
+		}
+	}
+	binary.LittleEndian.PutUint32(tmp4, numRestarts)
 	w.buf = append(w.buf, tmp4...)
 	result := w.buf
 
@@ -153,7 +167,11 @@ func (w *blockWriter) finish() []byte {
 }
 
 func (w *blockWriter) estimatedSize() int {
-	return len(w.buf) + 4*(len(w.restarts)+1)
+	size := len(w.buf) + 4*(len(w.restarts)+1)
+	if w.hashIndex != nil {
+		size += w.hashIndex.estimatedSize()
+	}
+	return size
 }
 
 type blockEntry struct {
@@ -198,11 +216,16 @@ type blockIter struct {
 	// i.ptr[i.restarts:len(block)-4], while numRestarts is encoded in the last
 	// 4 bytes of the block as a uint32 (i.ptr[len(block)-4:]). i.restarts can
 	// therefore be seen as the point where data in the block ends, and a list
-	// of offsets of all restart points begins.
+	// of offsets of all restart points begins. If the block has a hash index
+	// (see DataBlockBinaryAndHash), the high bit of the encoded restart count
+	// is set and the hash index sits between the restart points and the
+	// restart count.
 	restarts int32
 	// Number of restart points in this block. Encoded at the end of the block
 	// as a uint32.
-	numRestarts  int32
+	numRestarts int32
+	// hashIndex holds the buckets of the block's hash index, if present.
+	hashIndex    []byte
 	globalSeqNum uint64
 	ptr          unsafe.Pointer
 	data         []byte
@@ -236,9 +259,14 @@ type blockIter struct {
 	// For a block encoded with a restart interval of 1, cached and cachedBuf
 	// will not be used as there are no prefix compressed entries between the
 	// restart points.
-	cached      []blockEntry
-	cachedBuf   []byte
-	cacheHandle cache.Handle
+	cached    []blockEntry
+	cachedBuf []byte
+	// cachedRestart is the index of the restart point at which the restart
+	// interval most recently decoded by cacheInterval begins. Once Prev has
+	// stepped back to that restart point, it uses cachedRestart to locate the
+	// preceding restart interval without searching the restart points.
+	cachedRestart int32
+	cacheHandle   cache.Handle
 }
 
 // blockIter implements the base.InternalIterator interface.
@@ -254,13 +282,30 @@ func (i *blockIter) String() string {
 }
 
 func (i *blockIter) init(cmp Compare, block block, globalSeqNum uint64) error {
-	numRestarts := int32(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	numRestarts := binary.LittleEndian.Uint32(block[len(block)-4:])
+	end := len(block) - 4
+	i.hashIndex = nil
+	if numRestarts&dataBlockHashIndexFlag != 0 {
+		numRestarts &^= dataBlockHashIndexFlag
+		if end < 2 {
+			return errors.New("pebble/table: invalid table (corrupt block hash index)")
+		}
+		numBuckets := int(binary.LittleEndian.Uint16(block[end-2:]))
+		end -= 2 + numBuckets
+		if end < 0 {
+			return errors.New("pebble/table: invalid table (corrupt block hash index)")
+		}
+		i.hashIndex = block[end : end+numBuckets]
+	}
 	if numRestarts == 0 {
 		return errors.New("pebble/table: invalid table (block has no restart points)")
 	}
+	if uint64(numRestarts)*4 > uint64(end) {
+		return errors.New("pebble/table: invalid table (corrupt block restart points)")
+	}
 	i.cmp = cmp
-	i.restarts = int32(len(block)) - 4*(1+numRestarts)
-	i.numRestarts = numRestarts
+	i.restarts = int32(end) - 4*int32(numRestarts)
+	i.numRestarts = int32(numRestarts)
 	i.globalSeqNum = globalSeqNum
 	i.ptr = unsafe.Pointer(&block[0])
 	i.data = block
@@ -282,6 +327,7 @@ func (i *blockIter) invalidate() {
 	i.nextOffset = 0
 	i.restarts = 0
 	i.numRestarts = 0
+	i.hashIndex = nil
 	i.data = nil
 }
 
@@ -397,6 +443,73 @@ func (i *blockIter) clearCache() {
 	i.cachedBuf = i.cachedBuf[:0]
 }
 
+// restartOffset returns the offset of the restart point at the specified
+// index.
+func (i *blockIter) restartOffset(index int32) int32 {
+	return int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*index:]))
+}
+
+// cacheInterval decodes the entries from the restart point at the specified
+// index up to, but excluding, the entry at offset end, and positions the
+// iterator at the last of them. The preceding entries are cached for Prev.
+//
+// The keys are decoded directly into cachedBuf, with each key's shared prefix
+// copied from the previous cached key, so that every entry in the interval is
+// decoded and copied once. If the interval holds a single entry (as is always
+// the case for a restart interval of 1), the entry is read in place, and ikey
+// is backed by the block, providing the key stability guarantee.
+func (i *blockIter) cacheInterval(index, end int32) {
+	i.clearCache()
+	i.cachedRestart = index
+	i.offset = i.restartOffset(index)
+	i.readEntry()
+	if i.nextOffset >= end {
+		i.decodeInternalKey(i.key)
+		return
+	}
+	i.cacheEntry()
+
+	// NB: cached and cachedBuf are held in local variables while decoding to
+	// avoid the write barriers of storing them in the iterator on every
+	// entry.
+	cached, cachedBuf := i.cached, i.cachedBuf
+	offset := i.nextOffset
+	var prevKeyStart int32
+	for {
+		ptr := unsafe.Pointer(uintptr(i.ptr) + uintptr(offset))
+		shared, ptr := decodeVarint(ptr)
+		unshared, ptr := decodeVarint(ptr)
+		value, ptr := decodeVarint(ptr)
+
+		keyStart := int32(len(cachedBuf))
+		cachedBuf = append(cachedBuf, cachedBuf[prevKeyStart:prevKeyStart+int32(shared)]...)
+		cachedBuf = append(cachedBuf, getBytes(ptr, int(unshared))...)
+		valStart := int32(uintptr(ptr)-uintptr(i.ptr)) + int32(unshared)
+		cached = append(cached, blockEntry{
+			offset:   offset,
+			keyStart: keyStart,
+			keyEnd:   int32(len(cachedBuf)),
+			valStart: valStart,
+			valSize:  int32(value),
+		})
+		prevKeyStart = keyStart
+		offset = valStart + int32(value)
+		if offset >= end {
+			break
+		}
+	}
+
+	// Position the iterator at the last entry, which is removed from the cache.
+	n := len(cached) - 1
+	e := &cached[n]
+	i.offset = e.offset
+	i.nextOffset = offset
+	i.key = cachedBuf[e.keyStart:e.keyEnd]
+	i.val = getBytes(unsafe.Pointer(uintptr(i.ptr)+uintptr(e.valStart)), int(e.valSize))
+	i.decodeInternalKey(i.key)
+	i.cached, i.cachedBuf = cached[:n], cachedBuf
+}
+
 func (i *blockIter) cacheEntry() {
 	var valStart int32
 	valSize := int32(len(i.val))
@@ -518,6 +631,45 @@ func (i *blockIter) SeekGE(key []byte) (*InternalKey, []byte) {
 	return nil, nil
 }
 
+// seekHash uses the block's hash index to position the iterator at the first
+// key in the block whose prefix is the specified prefix, which must equal its
+// own prefix as computed by split. It returns ok=false if the hash index is
+// absent or inconclusive, or if the block contains no key with the prefix. In
+// that case the iterator position is undefined and the caller should fall
+// back to SeekGE, as the first key >= prefix may still be present in the
+// block or in a subsequent block.
+func (i *blockIter) seekHash(prefix []byte, split Split) (*InternalKey, []byte, bool) {
+	restart, ok := lookupDataBlockHashIndex(i.hashIndex, i.numRestarts, prefix)
+	if !ok || restart < 0 {
+		return nil, nil, false
+	}
+	i.clearCache()
+	i.offset = int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*restart:]))
+	end := i.restarts
+	if restart+1 < i.numRestarts {
+		end = int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*(restart+1):]))
+	}
+	i.readEntry()
+	i.decodeInternalKey(i.key)
+
+	// Scan the restart interval for the first key with the prefix. Keys with a
+	// smaller prefix sort before it, and the interval contains every key with
+	// the prefix unless the bucket was populated by a different prefix.
+	for ; i.offset < end; i.Next() {
+		if c := i.cmp(i.ikey.UserKey, prefix); c >= 0 {
+			n := len(i.ikey.UserKey)
+			if split != nil {
+				n = split(i.ikey.UserKey)
+			}
+			if n != len(prefix) || !bytes.Equal(i.ikey.UserKey[:n], prefix) {
+				return nil, nil, false
+			}
+			return &i.ikey, i.val, true
+		}
+	}
+	return nil, nil, false
+}
+
 // SeekPrefixGE implements internalIterator.SeekPrefixGE, as documented in the
 // pebble package.
 func (i *blockIter) SeekPrefixGE(prefix, key []byte) (*InternalKey, []byte) {
@@ -611,54 +763,33 @@ func (i *blockIter) SeekLT(key []byte) (*InternalKey, []byte) {
 
 	// Since keys are strictly increasing, if index > 0 then the restart point at
 	// index-1 will be the largest whose key is < the key sought.
-	targetOffset := i.restarts
-	if index > 0 {
-		i.offset = int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*(index-1):]))
-		if index < i.numRestarts {
-			targetOffset = int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*(index):]))
-		}
-	} else if index == 0 {
+	if index == 0 {
 		// If index == 0 then all keys in this block are larger than the key
 		// sought.
 		i.offset = -1
 		i.nextOffset = 0
 		return nil, nil
 	}
-
-	// Iterate from that restart point to somewhere >= the key sought, then back
-	// up to the previous entry. The expectation is that we'll be performing
-	// reverse iteration, so we cache the entries as we advance forward.
-	i.nextOffset = i.offset
-
-	for {
-		i.offset = i.nextOffset
-		i.readEntry()
-		i.decodeInternalKey(i.key)
-
-		if i.cmp(i.ikey.UserKey, ikey.UserKey) >= 0 {
-			// The current key is greater than or equal to our search key. Back up to
-			// the previous key which was less than our search key. Note that his for
-			// loop will execute at least once with this if-block not being true, so
-			// the key we are backing up to is the last one this loop cached.
-			i.Prev()
-			return &i.ikey, i.val
-		}
-
-		if i.nextOffset >= targetOffset {
-			// We've reached the end of the current restart block. Return the current
-			// key. When the restart interval is 1, the first iteration of the for
-			// loop will bring us here. In that case ikey is backed by the block so
-			// we get the desired key stability guarantee for the lifetime of the
-			// blockIter.
-			break
-		}
-
-		i.cacheEntry()
-	}
-
+	i.offset = i.restartOffset(index - 1)
 	if !i.Valid() {
+		// The block is empty.
 		return nil, nil
 	}
+	targetOffset := i.restarts
+	if index < i.numRestarts {
+		targetOffset = i.restartOffset(index)
+	}
+
+	// Decode the restart interval at index-1, then back up to the last entry
+	// which is less than the key sought. The expectation is that we'll be
+	// performing reverse iteration, so the decoded entries are cached. When
+	// the restart interval is 1, the interval holds a single entry, which is
+	// less than the key sought, and ikey is backed by the block so we get the
+	// desired key stability guarantee for the lifetime of the blockIter.
+	i.cacheInterval(index-1, targetOffset)
+	for len(i.cached) > 0 && i.cmp(i.ikey.UserKey, ikey.UserKey) >= 0 {
+		i.Prev()
+	}
 	return &i.ikey, i.val
 }
 
@@ -683,16 +814,7 @@ func (i *blockIter) Last() (*InternalKey, []byte) {
 		return nil, nil
 	}
 
-	i.readEntry()
-	i.clearCache()
-
-	for i.nextOffset < i.restarts {
-		i.cacheEntry()
-		i.offset = i.nextOffset
-		i.readEntry()
-	}
-
-	i.decodeInternalKey(i.key)
+	i.cacheInterval(i.numRestarts-1, i.restarts)
 	return &i.ikey, i.val
 }
 
@@ -757,8 +879,8 @@ func (i *blockIter) Prev() (*InternalKey, []byte) {
 		return &i.ikey, i.val
 	}
 
-	i.clearCache()
 	if i.offset <= 0 {
+		i.clearCache()
 		i.offset = -1
 		i.nextOffset = 0
 		return nil, nil
@@ -767,7 +889,12 @@ func (i *blockIter) Prev() (*InternalKey, []byte) {
 	targetOffset := i.offset
 	var index int32
 
-	{
+	if k := i.cachedRestart; k > 0 && k < i.numRestarts && i.restartOffset(k) == targetOffset {
+		// The iterator stepped back to the start of the restart interval it last
+		// decoded, so the preceding interval starts at the previous restart
+		// point.
+		index = k
+	} else {
 		// NB: manually inlined sort.Sort is ~5% faster.
 		//
 		// Define f(-1) == false and f(n) == true.
@@ -787,20 +914,10 @@ func (i *blockIter) Prev() (*InternalKey, []byte) {
 		// => answer is index.
 	}
 
-	i.offset = 0
-	if index > 0 {
-		i.offset = int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*(index-1):]))
-	}
-
-	i.readEntry()
-
-	for i.nextOffset < targetOffset {
-		i.cacheEntry()
-		i.offset = i.nextOffset
-		i.readEntry()
-	}
-
-	i.decodeInternalKey(i.key)
+	// Decode the entries preceding the current entry, starting at the restart
+	// point before it. Note that index > 0 since targetOffset > 0 and the first
+	// restart point is at offset 0.
+	i.cacheInterval(index-1, targetOffset)
 	return &i.ikey, i.val
 }
 
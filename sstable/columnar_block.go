@@ -0,0 +1,725 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+)
+
+// Columnar data blocks are used by TableFormatPebblev1. Rather than
+// storing a sequence of prefix compressed key/value entries, a columnar data
+// block stores each component of the entries in a separate column. Every key
+// is split by Comparer.Split into a prefix and a suffix (e.g. an MVCC
+// timestamp), and the block is laid out as:
+//
+//   header:
+//     number of rows         (uint32)
+//     number of prefixes     (uint32)
+//     column offsets         (5 * uint32)
+//   prefix index column      (uint column, one entry per row)
+//   prefix column            (bytes column, bundled)
+//   suffix column            (bytes column, one entry per row)
+//   trailer column           (uint column, one entry per row)
+//   value column             (bytes column, one entry per row)
+//
+// Consecutive rows with the same prefix (e.g. multiple versions of the same
+// MVCC key) share a single entry in the prefix column, and the prefix index
+// column maps each row to the ordinal of its prefix. Distinct prefixes are
+// grouped into bundles of columnarBundleSize prefixes. Each bundle is stored
+// as the prefix shared by all of the prefixes in the bundle, followed by the
+// remainder of each prefix after the bundle prefix.
+//
+// A uint column is encoded as a 1-byte width, an 8-byte little-endian base
+// value, and then each value minus the base as a little-endian integer of the
+// given width (0, 1, 2, 4 or 8 bytes). The offsets of each column are thus
+// bitpacked to the smallest width that can hold them.
+//
+// A bytes column holding n entries is encoded as a uint column of n+1
+// offsets, followed by the concatenated entries. Entry i spans
+// [offset[i], offset[i+1]) of the data following the offsets.
+//
+// Seeks binary search the rows directly, and iteration in either direction
+// only materializes the prefix of a key when it differs from the prefix of
+// the previous key.
+
+const (
+	columnarBundleSize  = 16
+	columnarNumColumns  = 5
+	columnarHeaderLen   = 8 + 4*columnarNumColumns
+	uintColumnHeaderLen = 9
+
+	columnarPrefixIndexColumn = 0
+	columnarPrefixColumn      = 1
+	columnarSuffixColumn      = 2
+	columnarTrailerColumn     = 3
+	columnarValueColumn       = 4
+)
+
+var errCorruptColumnarBlock = errors.New("pebble/table: corrupt columnar data block")
+
+// uintColumnWidth returns the number of bytes needed to encode every value
+// in [min, max] as a delta from min.
+func uintColumnWidth(min, max uint64) int {
+	switch delta := max - min; {
+	case delta == 0:
+		return 0
+	case delta < 1<<8:
+		return 1
+	case delta < 1<<16:
+		return 2
+	case delta < 1<<32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func appendUintColumn(buf []byte, vals []uint64) []byte {
+	var min, max uint64
+	if len(vals) > 0 {
+		min, max = vals[0], vals[0]
+		for _, v := range vals[1:] {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+	}
+	width := uintColumnWidth(min, max)
+	buf = append(buf, byte(width))
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], min)
+	buf = append(buf, tmp[:]...)
+	for _, v := range vals {
+		binary.LittleEndian.PutUint64(tmp[:], v-min)
+		buf = append(buf, tmp[:width]...)
+	}
+	return buf
+}
+
+// uintColumn is a decoded uint column.
+type uintColumn struct {
+	width int
+	base  uint64
+	data  []byte
+}
+
+// decodeUintColumn decodes a uint column of n values from the start of b,
+// returning the column and its encoded length.
+func decodeUintColumn(b []byte, n int) (uintColumn, int, error) {
+	if len(b) < uintColumnHeaderLen {
+		return uintColumn{}, 0, errCorruptColumnarBlock
+	}
+	c := uintColumn{
+		width: int(b[0]),
+		base:  binary.LittleEndian.Uint64(b[1:]),
+	}
+	switch c.width {
+	case 0, 1, 2, 4, 8:
+	default:
+		return uintColumn{}, 0, errCorruptColumnarBlock
+	}
+	size := uintColumnHeaderLen + n*c.width
+	if len(b) < size {
+		return uintColumn{}, 0, errCorruptColumnarBlock
+	}
+	c.data = b[uintColumnHeaderLen:size]
+	return c, size, nil
+}
+
+func (c *uintColumn) at(i int) uint64 {
+	switch c.width {
+	case 0:
+		return c.base
+	case 1:
+		return c.base + uint64(c.data[i])
+	case 2:
+		return c.base + uint64(binary.LittleEndian.Uint16(c.data[2*i:]))
+	case 4:
+		return c.base + uint64(binary.LittleEndian.Uint32(c.data[4*i:]))
+	default:
+		return c.base + binary.LittleEndian.Uint64(c.data[8*i:])
+	}
+}
+
+// bytesColumn is a decoded bytes column.
+type bytesColumn struct {
+	offsets uintColumn
+	data    []byte
+}
+
+// decodeBytesColumn decodes a bytes column of n entries from b.
+func decodeBytesColumn(b []byte, n int) (bytesColumn, error) {
+	offsets, size, err := decodeUintColumn(b, n+1)
+	if err != nil {
+		return bytesColumn{}, err
+	}
+	c := bytesColumn{offsets: offsets, data: b[size:]}
+	if n > 0 && (c.offsets.at(n) > uint64(len(c.data)) || c.offsets.at(0) > c.offsets.at(n)) {
+		return bytesColumn{}, errCorruptColumnarBlock
+	}
+	return c, nil
+}
+
+func (c *bytesColumn) at(i int) []byte {
+	start, end := c.offsets.at(i), c.offsets.at(i+1)
+	return c.data[start:end:end]
+}
+
+// columnarBlockWriter builds columnar data blocks.
+type columnarBlockWriter struct {
+	split    Split
+	nEntries int
+	// curKey is the encoded internal key of the most recently added entry.
+	curKey []byte
+
+	// prefixBuf holds the distinct prefixes, which start at prefixStarts.
+	prefixBuf    []byte
+	prefixStarts []uint64
+	prefixIdx    []uint64
+	suffixBuf    []byte
+	suffixEnds   []uint64
+	trailers     []uint64
+	minTrailer   uint64
+	maxTrailer   uint64
+	valueBuf     []byte
+	valueEnds    []uint64
+
+	buf     []byte
+	offsets []uint64
+	bundles []byte
+}
+
+func (w *columnarBlockWriter) add(key InternalKey, value []byte) {
+	size := key.Size()
+	if cap(w.curKey) < size {
+		w.curKey = make([]byte, 0, size*2)
+	}
+	w.curKey = w.curKey[:size]
+	key.Encode(w.curKey)
+
+	n := len(key.UserKey)
+	if w.split != nil {
+		n = w.split(key.UserKey)
+	}
+	prefix, suffix := key.UserKey[:n], key.UserKey[n:]
+	if m := len(w.prefixStarts); m == 0 || !bytes.Equal(w.prefixBuf[w.prefixStarts[m-1]:], prefix) {
+		w.prefixStarts = append(w.prefixStarts, uint64(len(w.prefixBuf)))
+		w.prefixBuf = append(w.prefixBuf, prefix...)
+	}
+	w.prefixIdx = append(w.prefixIdx, uint64(len(w.prefixStarts)-1))
+
+	w.suffixBuf = append(w.suffixBuf, suffix...)
+	w.suffixEnds = append(w.suffixEnds, uint64(len(w.suffixBuf)))
+	if w.nEntries == 0 || key.Trailer < w.minTrailer {
+		w.minTrailer = key.Trailer
+	}
+	if w.nEntries == 0 || key.Trailer > w.maxTrailer {
+		w.maxTrailer = key.Trailer
+	}
+	w.trailers = append(w.trailers, key.Trailer)
+	w.valueBuf = append(w.valueBuf, value...)
+	w.valueEnds = append(w.valueEnds, uint64(len(w.valueBuf)))
+	w.nEntries++
+}
+
+// estimatedSize returns the approximate size of the block if it were
+// finished with the entries added so far.
+func (w *columnarBlockWriter) estimatedSize() int {
+	n := w.nEntries
+	m := len(w.prefixStarts)
+	size := columnarHeaderLen + columnarNumColumns*uintColumnHeaderLen
+	size += n * uintColumnWidth(0, uint64(m))
+	size += len(w.prefixBuf) + (m+m/columnarBundleSize+2)*uintColumnWidth(0, uint64(len(w.prefixBuf)))
+	size += len(w.suffixBuf) + (n+1)*uintColumnWidth(0, uint64(len(w.suffixBuf)))
+	size += n * uintColumnWidth(w.minTrailer, w.maxTrailer)
+	size += len(w.valueBuf) + (n+1)*uintColumnWidth(0, uint64(len(w.valueBuf)))
+	return size
+}
+
+// shouldFlush is the columnar analog of shouldFlush for row-oriented blocks.
+func (w *columnarBlockWriter) shouldFlush(
+	key InternalKey, value []byte, blockSize, sizeThreshold int,
+) bool {
+	if w.nEntries == 0 {
+		return false
+	}
+
+	size := w.estimatedSize()
+	if size >= blockSize {
+		return true
+	}
+	if size <= sizeThreshold {
+		return false
+	}
+	// Assume the worst case of a new prefix and 8 bytes of overhead per
+	// column.
+	newSize := size + key.Size() + len(value) + 8*columnarNumColumns
+	return newSize > blockSize
+}
+
+// appendBundles appends the bundled prefix column data to w.bundles and the
+// end offset of each bundle entry to w.offsets.
+func (w *columnarBlockWriter) appendBundles() {
+	m := len(w.prefixStarts)
+	prefixAt := func(p int) []byte {
+		end := uint64(len(w.prefixBuf))
+		if p+1 < m {
+			end = w.prefixStarts[p+1]
+		}
+		return w.prefixBuf[w.prefixStarts[p]:end]
+	}
+	w.offsets = append(w.offsets[:0], 0)
+	w.bundles = w.bundles[:0]
+	for start := 0; start < m; start += columnarBundleSize {
+		end := start + columnarBundleSize
+		if end > m {
+			end = m
+		}
+		shared := prefixAt(start)
+		for p := start + 1; p < end; p++ {
+			shared = shared[:base.SharedPrefixLen(shared, prefixAt(p))]
+		}
+		w.bundles = append(w.bundles, shared...)
+		w.offsets = append(w.offsets, uint64(len(w.bundles)))
+		for p := start; p < end; p++ {
+			w.bundles = append(w.bundles, prefixAt(p)[len(shared):]...)
+			w.offsets = append(w.offsets, uint64(len(w.bundles)))
+		}
+	}
+}
+
+func (w *columnarBlockWriter) finish() []byte {
+	n, m := w.nEntries, len(w.prefixStarts)
+	w.buf = append(w.buf[:0], make([]byte, columnarHeaderLen)...)
+	binary.LittleEndian.PutUint32(w.buf[0:], uint32(n))
+	binary.LittleEndian.PutUint32(w.buf[4:], uint32(m))
+	setColumnOffset := func(col int) {
+		binary.LittleEndian.PutUint32(w.buf[8+4*col:], uint32(len(w.buf)))
+	}
+
+	setColumnOffset(columnarPrefixIndexColumn)
+	w.buf = appendUintColumn(w.buf, w.prefixIdx)
+
+	setColumnOffset(columnarPrefixColumn)
+	w.appendBundles()
+	w.buf = appendUintColumn(w.buf, w.offsets)
+	w.buf = append(w.buf, w.bundles...)
+
+	setColumnOffset(columnarSuffixColumn)
+	w.offsets = append(append(w.offsets[:0], 0), w.suffixEnds...)
+	w.buf = appendUintColumn(w.buf, w.offsets)
+	w.buf = append(w.buf, w.suffixBuf...)
+
+	setColumnOffset(columnarTrailerColumn)
+	w.buf = appendUintColumn(w.buf, w.trailers)
+
+	setColumnOffset(columnarValueColumn)
+	w.offsets = append(append(w.offsets[:0], 0), w.valueEnds...)
+	w.buf = appendUintColumn(w.buf, w.offsets)
+	w.buf = append(w.buf, w.valueBuf...)
+	result := w.buf
+
+	// Reset the block state.
+	w.nEntries = 0
+	w.prefixBuf = w.prefixBuf[:0]
+	w.prefixStarts = w.prefixStarts[:0]
+	w.prefixIdx = w.prefixIdx[:0]
+	w.suffixBuf = w.suffixBuf[:0]
+	w.suffixEnds = w.suffixEnds[:0]
+	w.trailers = w.trailers[:0]
+	w.valueBuf = w.valueBuf[:0]
+	w.valueEnds = w.valueEnds[:0]
+	w.buf = nil
+	return result
+}
+
+// numPrefixEntries returns the number of entries in the bundled prefix column
+// for m distinct prefixes.
+func numPrefixEntries(m int) int {
+	return m + (m+columnarBundleSize-1)/columnarBundleSize
+}
+
+// columnarBlockIter is an iterator over a columnar data block. It implements
+// the same positioning contract as blockIter.
+type columnarBlockIter struct {
+	cmp          Compare
+	globalSeqNum uint64
+	data         []byte
+	numRows      int32
+	// row is the current row, -1 if the iterator is positioned before the
+	// first row, or numRows if positioned after the last row.
+	row       int32
+	prefixIdx uintColumn
+	prefixes  bytesColumn
+	suffixes  bytesColumn
+	trailers  uintColumn
+	values    bytesColumn
+	// keyBuf holds the user key of the current row. The first keyBundleLen
+	// bytes hold the shared prefix of bundle keyBundle, and the first
+	// keyPrefixLen bytes hold the prefix with ordinal keyPrefix. Stepping to a
+	// row with the same prefix only replaces the suffix, and stepping to a
+	// prefix in the same bundle only replaces the prefix remainder.
+	keyBuf       []byte
+	keyBundle    int
+	keyBundleLen int
+	keyPrefix    int
+	keyPrefixLen int
+	ikey         InternalKey
+	val          []byte
+}
+
+func (i *columnarBlockIter) init(cmp Compare, block block, globalSeqNum uint64) error {
+	*i = columnarBlockIter{keyBuf: i.keyBuf[:0]}
+	if len(block) < columnarHeaderLen {
+		return errCorruptColumnarBlock
+	}
+	n := int(binary.LittleEndian.Uint32(block[0:]))
+	m := int(binary.LittleEndian.Uint32(block[4:]))
+	var cols [columnarNumColumns][]byte
+	for c := range cols {
+		start := int(binary.LittleEndian.Uint32(block[8+4*c:]))
+		end := len(block)
+		if c+1 < columnarNumColumns {
+			end = int(binary.LittleEndian.Uint32(block[8+4*(c+1):]))
+		}
+		if start < columnarHeaderLen || start > end || end > len(block) {
+			return errCorruptColumnarBlock
+		}
+		cols[c] = block[start:end]
+	}
+
+	var err error
+	if i.prefixIdx, _, err = decodeUintColumn(cols[columnarPrefixIndexColumn], n); err != nil {
+		return err
+	}
+	if i.prefixes, err = decodeBytesColumn(cols[columnarPrefixColumn], numPrefixEntries(m)); err != nil {
+		return err
+	}
+	if i.suffixes, err = decodeBytesColumn(cols[columnarSuffixColumn], n); err != nil {
+		return err
+	}
+	if i.trailers, _, err = decodeUintColumn(cols[columnarTrailerColumn], n); err != nil {
+		return err
+	}
+	if i.values, err = decodeBytesColumn(cols[columnarValueColumn], n); err != nil {
+		return err
+	}
+	if n > 0 && int(i.prefixIdx.at(n-1)) >= m {
+		return errCorruptColumnarBlock
+	}
+	i.cmp = cmp
+	i.globalSeqNum = globalSeqNum
+	i.data = block
+	i.numRows = int32(n)
+	i.keyBundle = -1
+	i.keyPrefix = -1
+	return nil
+}
+
+func (i *columnarBlockIter) invalidate() {
+	i.data = nil
+	i.numRows = 0
+	i.row = 0
+	i.keyBundle = -1
+	i.keyPrefix = -1
+	i.val = nil
+}
+
+// loadKey materializes the user key of row r in keyBuf.
+func (i *columnarBlockIter) loadKey(r int32) {
+	if p := int(i.prefixIdx.at(int(r))); p != i.keyPrefix {
+		b := p / columnarBundleSize
+		entry := b * (columnarBundleSize + 1)
+		if b != i.keyBundle {
+			i.keyBuf = append(i.keyBuf[:0], i.prefixes.at(entry)...)
+			i.keyBundle = b
+			i.keyBundleLen = len(i.keyBuf)
+		}
+		i.keyBuf = append(i.keyBuf[:i.keyBundleLen], i.prefixes.at(entry+1+p%columnarBundleSize)...)
+		i.keyPrefix = p
+		i.keyPrefixLen = len(i.keyBuf)
+	}
+	i.keyBuf = append(i.keyBuf[:i.keyPrefixLen], i.suffixes.at(int(r))...)
+}
+
+// load materializes the key and value of row r.
+func (i *columnarBlockIter) load(r int32) {
+	i.row = r
+	i.loadKey(r)
+	i.ikey.UserKey = i.keyBuf
+	i.ikey.Trailer = i.trailers.at(int(r))
+	if i.globalSeqNum != 0 {
+		i.ikey.SetSeqNum(i.globalSeqNum)
+	}
+	i.val = i.values.at(int(r))
+}
+
+// searchGE returns the index of the first row whose user key is >= key, or
+// numRows if there is no such row. Only the keys of the probed rows are
+// materialized.
+func (i *columnarBlockIter) searchGE(key []byte) int32 {
+	index, upper := int32(0), i.numRows
+	for index < upper {
+		h := int32(uint(index+upper) >> 1)
+		i.loadKey(h)
+		if i.cmp(i.keyBuf, key) < 0 {
+			index = h + 1
+		} else {
+			upper = h
+		}
+	}
+	return index
+}
+
+// SeekGE implements internalIterator.SeekGE, as documented in the pebble
+// package.
+func (i *columnarBlockIter) SeekGE(key []byte) (*InternalKey, []byte) {
+	r := i.searchGE(key)
+	if r >= i.numRows {
+		i.row = i.numRows
+		return nil, nil
+	}
+	i.load(r)
+	return &i.ikey, i.val
+}
+
+// SeekLT implements internalIterator.SeekLT, as documented in the pebble
+// package.
+func (i *columnarBlockIter) SeekLT(key []byte) (*InternalKey, []byte) {
+	r := i.searchGE(key) - 1
+	if r < 0 {
+		i.row = -1
+		return nil, nil
+	}
+	i.load(r)
+	return &i.ikey, i.val
+}
+
+// First implements internalIterator.First, as documented in the pebble
+// package.
+func (i *columnarBlockIter) First() (*InternalKey, []byte) {
+	if i.numRows == 0 {
+		i.row = 0
+		return nil, nil
+	}
+	i.load(0)
+	return &i.ikey, i.val
+}
+
+// Last implements internalIterator.Last, as documented in the pebble package.
+func (i *columnarBlockIter) Last() (*InternalKey, []byte) {
+	if i.numRows == 0 {
+		i.row = 0
+		return nil, nil
+	}
+	i.load(i.numRows - 1)
+	return &i.ikey, i.val
+}
+
+// Next implements internalIterator.Next, as documented in the pebble package.
+func (i *columnarBlockIter) Next() (*InternalKey, []byte) {
+	if i.row+1 >= i.numRows {
+		i.row = i.numRows
+		return nil, nil
+	}
+	i.load(i.row + 1)
+	return &i.ikey, i.val
+}
+
+// Prev implements internalIterator.Prev, as documented in the pebble package.
+func (i *columnarBlockIter) Prev() (*InternalKey, []byte) {
+	if i.row <= 0 {
+		i.row = -1
+		return nil, nil
+	}
+	i.load(i.row - 1)
+	return &i.ikey, i.val
+}
+
+// Valid implements internalIterator.Valid, as documented in the pebble
+// package.
+func (i *columnarBlockIter) Valid() bool {
+	return i.row >= 0 && i.row < i.numRows
+}
+
+// nextOffset returns the approximate offset within the block of the entry
+// following the current one, for use in computing bytes iterated.
+func (i *columnarBlockIter) nextOffset() int32 {
+	if i.numRows == 0 {
+		return 0
+	}
+	return int32(int64(i.row+1) * int64(len(i.data)) / int64(i.numRows))
+}
+
+// dataBlockIter is an iterator over a data block, which is either a
+// row-oriented block (see blockIter) or a columnar block (see
+// columnarBlockIter), depending on the table format.
+type dataBlockIter struct {
+	blockIter
+	columnar bool
+	// hashIndexed is set if the table format allows data blocks to contain a
+	// Pebble hash index (TableFormatPebblev2). Hash indexes found in blocks of
+	// other tables, such as RocksDB's, are built with a different hash function
+	// and are ignored.
+	hashIndexed bool
+	col         columnarBlockIter
+}
+
+func (i *dataBlockIter) initHandle(cmp Compare, h cache.Handle, globalSeqNum uint64) error {
+	if !i.columnar {
+		return i.blockIter.initHandle(cmp, h, globalSeqNum)
+	}
+	i.blockIter.cacheHandle.Release()
+	i.blockIter.cacheHandle = h
+	i.blockIter.invalidate()
+	return i.col.init(cmp, h.Get(), globalSeqNum)
+}
+
+func (i *dataBlockIter) invalidate() {
+	if i.columnar {
+		i.col.invalidate()
+		return
+	}
+	i.blockIter.invalidate()
+}
+
+func (i *dataBlockIter) resetForReuse() dataBlockIter {
+	return dataBlockIter{
+		blockIter: i.blockIter.resetForReuse(),
+		col:       columnarBlockIter{keyBuf: i.col.keyBuf[:0]},
+	}
+}
+
+// seekHash positions the iterator using the data block hash index. See
+// blockIter.seekHash. Columnar blocks do not have a hash index.
+func (i *dataBlockIter) seekHash(prefix []byte, split Split) (*InternalKey, []byte, bool) {
+	if i.columnar || !i.hashIndexed {
+		return nil, nil, false
+	}
+	return i.blockIter.seekHash(prefix, split)
+}
+
+// SeekGE implements internalIterator.SeekGE, as documented in the pebble
+// package.
+func (i *dataBlockIter) SeekGE(key []byte) (*InternalKey, []byte) {
+	if i.columnar {
+		return i.col.SeekGE(key)
+	}
+	return i.blockIter.SeekGE(key)
+}
+
+// SeekLT implements internalIterator.SeekLT, as documented in the pebble
+// package.
+func (i *dataBlockIter) SeekLT(key []byte) (*InternalKey, []byte) {
+	if i.columnar {
+		return i.col.SeekLT(key)
+	}
+	return i.blockIter.SeekLT(key)
+}
+
+// First implements internalIterator.First, as documented in the pebble
+// package.
+func (i *dataBlockIter) First() (*InternalKey, []byte) {
+	if i.columnar {
+		return i.col.First()
+	}
+	return i.blockIter.First()
+}
+
+// Last implements internalIterator.Last, as documented in the pebble package.
+func (i *dataBlockIter) Last() (*InternalKey, []byte) {
+	if i.columnar {
+		return i.col.Last()
+	}
+	return i.blockIter.Last()
+}
+
+// Next implements internalIterator.Next, as documented in the pebble package.
+func (i *dataBlockIter) Next() (*InternalKey, []byte) {
+	if i.columnar {
+		return i.col.Next()
+	}
+	return i.blockIter.Next()
+}
+
+// Prev implements internalIterator.Prev, as documented in the pebble package.
+func (i *dataBlockIter) Prev() (*InternalKey, []byte) {
+	if i.columnar {
+		return i.col.Prev()
+	}
+	return i.blockIter.Prev()
+}
+
+// Key implements internalIterator.Key, as documented in the pebble package.
+func (i *dataBlockIter) Key() *InternalKey {
+	if i.columnar {
+		return &i.col.ikey
+	}
+	return i.blockIter.Key()
+}
+
+// Value implements internalIterator.Value, as documented in the pebble
+// package.
+func (i *dataBlockIter) Value() []byte {
+	if i.columnar {
+		return i.col.val
+	}
+	return i.blockIter.Value()
+}
+
+// Valid implements internalIterator.Valid, as documented in the pebble
+// package.
+func (i *dataBlockIter) Valid() bool {
+	if i.columnar {
+		return i.col.Valid()
+	}
+	return i.blockIter.Valid()
+}
+
+// Close implements internalIterator.Close, as documented in the pebble
+// package.
+func (i *dataBlockIter) Close() error {
+	i.col.val = nil
+	return i.blockIter.Close()
+}
+
+// offsetAndLen returns the uncompressed offset of the entry following the
+// current one and the uncompressed length of the block.
+func (i *dataBlockIter) offsetAndLen() (int32, int) {
+	if i.columnar {
+		return i.col.nextOffset(), len(i.col.data)
+	}
+	return i.blockIter.nextOffset, len(i.blockIter.data)
+}
+
+// decodeColumnarBlockRows calls fn for every row in a columnar data block. It
+// is used for debugging output.
+func decodeColumnarBlockRows(cmp Compare, b block, fn func(key *InternalKey, value []byte)) error {
+	var i columnarBlockIter
+	if err := i.init(cmp, b, 0); err != nil {
+		return err
+	}
+	for key, value := i.First(); key != nil; key, value = i.Next() {
+		fn(key, value)
+	}
+	return nil
+}
+
+// columnarBlockStats returns the number of rows and distinct prefixes in a
+// columnar data block.
+func columnarBlockStats(b block) (rows, prefixes int, err error) {
+	if len(b) < columnarHeaderLen {
+		return 0, 0, errCorruptColumnarBlock
+	}
+	return int(binary.LittleEndian.Uint32(b[0:])), int(binary.LittleEndian.Uint32(b[4:])), nil
+}
@@ -0,0 +1,320 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/rand"
+)
+
+// testColumnarSplit splits keys of the form "<prefix>@<suffix>" before the
+// '@'.
+func testColumnarSplit(key []byte) int {
+	if i := bytes.IndexByte(key, '@'); i >= 0 {
+		return i
+	}
+	return len(key)
+}
+
+func makeColumnarTestKeys(rng *rand.Rand, n int) []InternalKey {
+	var keys []InternalKey
+	for i := 0; len(keys) < n; i++ {
+		prefix := fmt.Sprintf("%06d", i*(1+rng.Intn(3)))
+		if len(keys) > 0 && bytes.HasPrefix(keys[len(keys)-1].UserKey, []byte(prefix+"@")) {
+			continue
+		}
+		versions := 1 + rng.Intn(4)
+		for v := versions; v > 0 && len(keys) < n; v-- {
+			var userKey []byte
+			if v == 1 && rng.Intn(2) == 0 {
+				userKey = []byte(prefix)
+			} else {
+				userKey = []byte(fmt.Sprintf("%s@%d", prefix, v))
+			}
+			if len(keys) > 0 && bytes.Compare(keys[len(keys)-1].UserKey, userKey) >= 0 {
+				break
+			}
+			var kind InternalKeyKind = InternalKeyKindSet
+			if rng.Intn(8) == 0 {
+				kind = InternalKeyKindDelete
+			}
+			keys = append(keys, base.MakeInternalKey(userKey, uint64(rng.Intn(1<<20)), kind))
+		}
+	}
+	return keys
+}
+
+func TestColumnarBlockUintColumn(t *testing.T) {
+	for _, vals := range [][]uint64{
+		{},
+		{7, 7, 7},
+		{1, 2, 200},
+		{1000, 1, 65535},
+		{1 << 20, 0, 5},
+		{1 << 40, 3},
+		{0, 1<<64 - 1},
+	} {
+		buf := appendUintColumn([]byte("x"), vals)
+		c, n, err := decodeUintColumn(buf[1:], len(vals))
+		require.NoError(t, err)
+		require.Equal(t, len(buf)-1, n)
+		for i, v := range vals {
+			require.Equal(t, v, c.at(i))
+		}
+	}
+}
+
+func TestColumnarBlockIter(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	for _, n := range []int{0, 1, 2, 15, 16, 17, 100, 1000} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			keys := makeColumnarTestKeys(rng, n)
+			w := &columnarBlockWriter{split: testColumnarSplit}
+			ref := &blockWriter{restartInterval: 16}
+			for _, k := range keys {
+				value := []byte(fmt.Sprintf("value-%s", k.UserKey))
+				w.add(k, value)
+				ref.add(k, value)
+			}
+			require.Equal(t, len(keys), w.nEntries)
+			colBlock := w.finish()
+			require.Equal(t, 0, w.nEntries)
+
+			var it columnarBlockIter
+			require.NoError(t, it.init(bytes.Compare, colBlock, 0))
+			refIt, err := newBlockIter(bytes.Compare, ref.finish())
+			require.NoError(t, err)
+
+			// Iterate forward and backward over the full block.
+			i := 0
+			for key, value := it.First(); key != nil; key, value = it.Next() {
+				require.Equal(t, keys[i], *key)
+				require.Equal(t, fmt.Sprintf("value-%s", keys[i].UserKey), string(value))
+				i++
+			}
+			require.Equal(t, len(keys), i)
+			for key, _ := it.Last(); key != nil; key, _ = it.Prev() {
+				i--
+				require.Equal(t, keys[i], *key)
+			}
+			require.Equal(t, 0, i)
+
+			// Compare random operations against the row-oriented block iterator.
+			check := func(op string, key *InternalKey, value []byte, refKey *InternalKey, refValue []byte) {
+				if refKey == nil {
+					require.Nil(t, key, op)
+					require.False(t, it.Valid(), op)
+					return
+				}
+				require.NotNil(t, key, op)
+				require.Equal(t, *refKey, *key, op)
+				require.Equal(t, refValue, value, op)
+				require.True(t, it.Valid(), op)
+			}
+			randKey := func() []byte {
+				if len(keys) > 0 && rng.Intn(2) == 0 {
+					return keys[rng.Intn(len(keys))].UserKey
+				}
+				return []byte(fmt.Sprintf("%06d@%d", rng.Intn(3*n+1), rng.Intn(5)))
+			}
+			for j := 0; j < 1000; j++ {
+				switch op := rng.Intn(6); op {
+				case 0:
+					k := randKey()
+					key, value := it.SeekGE(k)
+					refKey, refValue := refIt.SeekGE(k)
+					check(fmt.Sprintf("SeekGE(%s)", k), key, value, refKey, refValue)
+				case 1:
+					k := randKey()
+					key, value := it.SeekLT(k)
+					refKey, refValue := refIt.SeekLT(k)
+					check(fmt.Sprintf("SeekLT(%s)", k), key, value, refKey, refValue)
+				case 2:
+					key, value := it.First()
+					refKey, refValue := refIt.First()
+					check("First", key, value, refKey, refValue)
+				case 3:
+					key, value := it.Last()
+					refKey, refValue := refIt.Last()
+					check("Last", key, value, refKey, refValue)
+				case 4:
+					if !refIt.Valid() {
+						continue
+					}
+					key, value := it.Next()
+					refKey, refValue := refIt.Next()
+					check("Next", key, value, refKey, refValue)
+				case 5:
+					if !refIt.Valid() {
+						continue
+					}
+					key, value := it.Prev()
+					refKey, refValue := refIt.Prev()
+					check("Prev", key, value, refKey, refValue)
+				}
+			}
+		})
+	}
+}
+
+func TestColumnarBlockIterGlobalSeqNum(t *testing.T) {
+	w := &columnarBlockWriter{split: testColumnarSplit}
+	w.add(base.MakeInternalKey([]byte("a@2"), 0, InternalKeyKindSet), []byte("1"))
+	w.add(base.MakeInternalKey([]byte("a@1"), 0, InternalKeyKindDelete), nil)
+	w.add(base.MakeInternalKey([]byte("b"), 0, InternalKeyKindSet), []byte("2"))
+
+	var it columnarBlockIter
+	require.NoError(t, it.init(bytes.Compare, w.finish(), 10))
+	var got []string
+	for key, _ := it.First(); key != nil; key, _ = it.Next() {
+		got = append(got, key.String())
+	}
+	require.Equal(t, []string{"a@2#10,1", "a@1#10,0", "b#10,1"}, got)
+}
+
+func TestColumnarBlockCorrupt(t *testing.T) {
+	w := &columnarBlockWriter{split: testColumnarSplit}
+	for i := 0; i < 20; i++ {
+		w.add(base.MakeInternalKey([]byte(fmt.Sprintf("%03d@1", i)), 1, InternalKeyKindSet), []byte("v"))
+	}
+	b := w.finish()
+
+	var it columnarBlockIter
+	require.NoError(t, it.init(bytes.Compare, b, 0))
+	for _, n := range []int{0, columnarHeaderLen - 1, columnarHeaderLen, len(b) / 2, len(b) - 1} {
+		require.Error(t, it.init(bytes.Compare, b[:n], 0), "length %d", n)
+	}
+}
+
+func TestColumnarTableRoundTrip(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+	keys := makeColumnarTestKeys(rng, 5000)
+
+	comparer := *DefaultComparer
+	comparer.Split = testColumnarSplit
+	for _, blockSize := range []int{1, 100, 4096} {
+		t.Run(fmt.Sprintf("block-size=%d", blockSize), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(f, WriterOptions{
+				BlockSize:      blockSize,
+				IndexBlockSize: blockSize,
+				Comparer:       &comparer,
+				TableFormat:    TableFormatPebblev1,
+			})
+			for _, k := range keys {
+				require.NoError(t, w.Add(k, k.UserKey))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			r, err := NewReader(f, ReaderOptions{Comparer: &comparer})
+			require.NoError(t, err)
+			require.Equal(t, TableFormatPebblev1, r.tableFormat)
+			defer r.Close()
+
+			iter, err := r.NewIter(nil, nil)
+			require.NoError(t, err)
+			i := 0
+			for key, value := iter.First(); key != nil; key, value = iter.Next() {
+				require.Equal(t, keys[i], *key)
+				require.Equal(t, keys[i].UserKey, value)
+				i++
+			}
+			require.Equal(t, len(keys), i)
+			for j := 0; j < 100; j++ {
+				k := keys[rng.Intn(len(keys))]
+				key, _ := iter.SeekGE(k.UserKey)
+				require.NotNil(t, key)
+				require.Equal(t, k, *key)
+			}
+			require.NoError(t, iter.Close())
+		})
+	}
+}
+
+func buildColumnarBenchmarkBlock(versions int) ([]byte, [][]byte) {
+	const blockSize = 32 << 10
+	w := &columnarBlockWriter{split: testColumnarSplit}
+	var keys [][]byte
+	for i := 0; w.estimatedSize() < blockSize; i++ {
+		key := []byte(fmt.Sprintf("%05d@%d", i/versions, versions-i%versions))
+		keys = append(keys, key)
+		w.add(InternalKey{UserKey: key}, nil)
+	}
+	return w.finish(), keys
+}
+
+func BenchmarkColumnarBlockIterSeekGE(b *testing.B) {
+	for _, versions := range []int{1, 4} {
+		b.Run(fmt.Sprintf("versions=%d", versions), func(b *testing.B) {
+			block, keys := buildColumnarBenchmarkBlock(versions)
+			var it columnarBlockIter
+			if err := it.init(bytes.Compare, block, 0); err != nil {
+				b.Fatal(err)
+			}
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				it.SeekGE(keys[rng.Intn(len(keys))])
+			}
+		})
+	}
+}
+
+func BenchmarkColumnarBlockIterNext(b *testing.B) {
+	for _, versions := range []int{1, 4} {
+		b.Run(fmt.Sprintf("versions=%d", versions), func(b *testing.B) {
+			block, _ := buildColumnarBenchmarkBlock(versions)
+			var it columnarBlockIter
+			if err := it.init(bytes.Compare, block, 0); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !it.Valid() {
+					it.First()
+				}
+				it.Next()
+			}
+		})
+	}
+}
+
+func BenchmarkColumnarBlockIterPrev(b *testing.B) {
+	for _, versions := range []int{1, 4} {
+		b.Run(fmt.Sprintf("versions=%d", versions), func(b *testing.B) {
+			block, _ := buildColumnarBenchmarkBlock(versions)
+			var it columnarBlockIter
+			if err := it.init(bytes.Compare, block, 0); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !it.Valid() {
+					it.Last()
+				}
+				it.Prev()
+			}
+		})
+	}
+}
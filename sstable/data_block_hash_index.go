@@ -0,0 +1,220 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// DataBlockIndexType specifies the index used to search within a data block.
+type DataBlockIndexType uint32
+
+// The available data block index types. These values are persisted in the
+// table properties and must not be changed.
+const (
+	// DataBlockBinarySearch searches data blocks using a binary search over
+	// the block's restart points. This is the default.
+	DataBlockBinarySearch DataBlockIndexType = iota
+	// DataBlockBinaryAndHash additionally writes a hash index at the end of
+	// each data block which maps the prefix of each key (as defined by
+	// Comparer.Split, or the full key if Split is nil) to the restart interval
+	// containing it. Point lookups use the hash index to avoid the binary
+	// search when it is unambiguous. The hash index is only written to
+	// TableFormatPebblev2 tables. Its layout resembles RocksDB's
+	// kDataBlockBinaryAndHash, but it uses a different hash function and
+	// hashes key prefixes rather than full user keys, so it is not compatible
+	// with RocksDB.
+	DataBlockBinaryAndHash
+)
+
+// String implements fmt.Stringer.
+func (t DataBlockIndexType) String() string {
+	switch t {
+	case DataBlockBinarySearch:
+		return "binary_search"
+	case DataBlockBinaryAndHash:
+		return "binary_search_and_hash"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint32(t))
+	}
+}
+
+// The hash index of a data block is written after the restart points and
+// consists of one byte per bucket followed by the number of buckets as a
+// uint16. The bucket for a key prefix holds the index of the restart interval
+// containing every key with that prefix, or one of the following sentinels.
+// The presence of the hash index is indicated by the high bit of the restart
+// count in the block trailer.
+const (
+	// dataBlockHashEmpty indicates that no prefix hashed to the bucket.
+	dataBlockHashEmpty = 255
+	// dataBlockHashCollision indicates that prefixes in more than one restart
+	// interval hashed to the bucket.
+	dataBlockHashCollision = 254
+	// dataBlockHashMaxRestarts is the maximum number of restart points in a
+	// block with a hash index. Restart indexes must be representable in a
+	// bucket without clashing with the sentinels.
+	dataBlockHashMaxRestarts = dataBlockHashCollision
+	// dataBlockHashIndexFlag is set in the restart count of blocks containing
+	// a hash index.
+	dataBlockHashIndexFlag = 1 << 31
+	// dataBlockHashMaxBuckets is the maximum number of buckets, limited by the
+	// uint16 bucket count.
+	dataBlockHashMaxBuckets = 1<<16 - 1
+	// defaultDataBlockHashUtilRatio is the default ratio of prefixes to
+	// buckets.
+	defaultDataBlockHashUtilRatio = 0.75
+)
+
+// dataBlockHash is the hash function for the data block hash index.
+func dataBlockHash(b []byte) uint32 {
+	const (
+		seed = 0x54f3a9c1
+		m    = 0xc6a4a793
+	)
+	h := uint32(seed) ^ uint32(len(b)*m)
+	for ; len(b) >= 4; b = b[4:] {
+		h += binary.LittleEndian.Uint32(b)
+		h *= m
+		h ^= h >> 16
+	}
+	switch len(b) {
+	case 3:
+		h += uint32(b[2]) << 16
+		fallthrough
+	case 2:
+		h += uint32(b[1]) << 8
+		fallthrough
+	case 1:
+		h += uint32(b[0])
+		h *= m
+		h ^= h >> 24
+	}
+	return h
+}
+
+type dataBlockHashEntry struct {
+	hash    uint32
+	restart uint8
+}
+
+// dataBlockHashIndexBuilder accumulates the prefixes added to a data block
+// and builds its hash index.
+type dataBlockHashIndexBuilder struct {
+	split     Split
+	utilRatio float64
+	entries   []dataBlockHashEntry
+	lastKey   []byte
+	// valid is false if the block has too many restart points to be indexed.
+	valid   bool
+	buckets []byte
+}
+
+func newDataBlockHashIndexBuilder(split Split, utilRatio float64) *dataBlockHashIndexBuilder {
+	if utilRatio <= 0 {
+		utilRatio = defaultDataBlockHashUtilRatio
+	}
+	return &dataBlockHashIndexBuilder{split: split, utilRatio: utilRatio, valid: true}
+}
+
+// add records that a key with the given user key was added to the restart
+// interval with the specified index.
+func (b *dataBlockHashIndexBuilder) add(userKey []byte, restart int) {
+	if !b.valid {
+		return
+	}
+	if restart >= dataBlockHashMaxRestarts {
+		b.valid = false
+		return
+	}
+	prefix := userKey
+	if b.split != nil {
+		prefix = userKey[:b.split(userKey)]
+	}
+	if n := len(b.entries); n > 0 && int(b.entries[n-1].restart) == restart && bytes.Equal(b.lastKey, prefix) {
+		// Consecutive keys frequently share a prefix, such as the versions of
+		// an MVCC key.
+		return
+	}
+	b.lastKey = append(b.lastKey[:0], prefix...)
+	b.entries = append(b.entries, dataBlockHashEntry{
+		hash:    dataBlockHash(prefix),
+		restart: uint8(restart),
+	})
+}
+
+func (b *dataBlockHashIndexBuilder) numBuckets() int {
+	n := int(float64(len(b.entries)) / b.utilRatio)
+	if n > dataBlockHashMaxBuckets {
+		n = dataBlockHashMaxBuckets
+	}
+	// An odd number of buckets improves the distribution of the hash values.
+	return n | 1
+}
+
+// estimatedSize returns the size of the hash index if the block were
+// finished with the keys added so far.
+func (b *dataBlockHashIndexBuilder) estimatedSize() int {
+	if !b.valid {
+		return 0
+	}
+	return b.numBuckets() + 2
+}
+
+// finish appends the hash index to buf and returns true, or returns false
+// if the block cannot be indexed. The builder is reset in either case.
+func (b *dataBlockHashIndexBuilder) finish(buf []byte) ([]byte, bool) {
+	defer b.reset()
+	if !b.valid || len(b.entries) == 0 {
+		return buf, false
+	}
+
+	n := b.numBuckets()
+	if cap(b.buckets) < n {
+		b.buckets = make([]byte, n)
+	}
+	b.buckets = b.buckets[:n]
+	for i := range b.buckets {
+		b.buckets[i] = dataBlockHashEmpty
+	}
+	for _, e := range b.entries {
+		switch bucket := &b.buckets[e.hash%uint32(n)]; *bucket {
+		case dataBlockHashEmpty:
+			*bucket = e.restart
+		case e.restart, dataBlockHashCollision:
+		default:
+			*bucket = dataBlockHashCollision
+		}
+	}
+	buf = append(buf, b.buckets...)
+	var tmp [2]byte
+	binary.LittleEndian.PutUint16(tmp[:], uint16(n))
+	return append(buf, tmp[:]...), true
+}
+
+func (b *dataBlockHashIndexBuilder) reset() {
+	b.entries = b.entries[:0]
+	b.lastKey = b.lastKey[:0]
+	b.valid = true
+}
+
+// lookupDataBlockHashIndex returns the restart interval which contains the
+// keys with the given prefix, and whether the lookup was conclusive. If the
+// bucket is empty, no key in the block has the prefix and -1 is returned.
+func lookupDataBlockHashIndex(index []byte, numRestarts int32, prefix []byte) (int32, bool) {
+	if len(index) == 0 {
+		return 0, false
+	}
+	switch r := index[dataBlockHash(prefix)%uint32(len(index))]; {
+	case r == dataBlockHashEmpty:
+		return -1, true
+	case r == dataBlockHashCollision || int32(r) >= numRestarts:
+		return 0, false
+	default:
+		return int32(r), true
+	}
+}
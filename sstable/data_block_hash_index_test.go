@@ -0,0 +1,276 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"unsafe"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func buildHashIndexBlock(
+	t *testing.T, keys []InternalKey, restartInterval int, split Split, utilRatio float64,
+) (*blockIter, []byte) {
+	w := &blockWriter{
+		restartInterval: restartInterval,
+		hashIndex:       newDataBlockHashIndexBuilder(split, utilRatio),
+	}
+	for _, k := range keys {
+		w.add(k, k.UserKey)
+	}
+	b := w.finish()
+	it, err := newBlockIter(bytes.Compare, b)
+	require.NoError(t, err)
+	return it, b
+}
+
+func TestDataBlockHashIndex(t *testing.T) {
+	var keys []InternalKey
+	for i := 0; i < 250; i++ {
+		keys = append(keys, base.MakeInternalKey([]byte(fmt.Sprintf("%05d", 2*i)), 1, InternalKeyKindSet))
+	}
+
+	for _, restartInterval := range []int{1, 2, 16} {
+		for _, utilRatio := range []float64{0.75, 0.1} {
+			t.Run(fmt.Sprintf("restart-interval=%d,util-ratio=%.2f", restartInterval, utilRatio), func(t *testing.T) {
+				testDataBlockHashIndex(t, keys, restartInterval, utilRatio)
+			})
+		}
+	}
+}
+
+func testDataBlockHashIndex(t *testing.T, keys []InternalKey, restartInterval int, utilRatio float64) {
+	it, _ := buildHashIndexBlock(t, keys, restartInterval, nil, utilRatio)
+	require.NotEmpty(t, it.hashIndex)
+	require.Equal(t, int32((len(keys)+restartInterval-1)/restartInterval), it.numRestarts)
+
+	// The block must behave like a block without a hash index.
+	i := 0
+	for key, value := it.First(); key != nil; key, value = it.Next() {
+		require.Equal(t, keys[i], *key)
+		require.Equal(t, keys[i].UserKey, value)
+		i++
+	}
+	require.Equal(t, len(keys), i)
+	for key, _ := it.Last(); key != nil; key, _ = it.Prev() {
+		i--
+		require.Equal(t, keys[i], *key)
+	}
+
+	var found int
+	for i, k := range keys {
+		key, value, ok := it.seekHash(k.UserKey, nil)
+		if !ok {
+			// Collisions force a fallback to binary search.
+			continue
+		}
+		found++
+		require.Equal(t, k, *key)
+		require.Equal(t, k.UserKey, value)
+		// The iterator must be positioned for iteration in both directions.
+		if i+1 < len(keys) {
+			key, _ = it.Next()
+			require.Equal(t, keys[i+1], *key)
+			key, _ = it.Prev()
+			require.Equal(t, k, *key)
+		}
+		if i > 0 {
+			key, _ = it.Prev()
+			require.Equal(t, keys[i-1], *key)
+		}
+	}
+	// Buckets are only ambiguous if keys from different restart
+	// intervals hash to them. With a low utilization ratio, nearly all
+	// lookups are served by the hash index.
+	if utilRatio < 0.5 {
+		require.True(t, found > len(keys)*3/4, "found %d of %d keys", found, len(keys))
+	} else {
+		require.True(t, found > len(keys)/4, "found %d of %d keys", found, len(keys))
+	}
+
+	// Keys not present in the block are never found.
+	for i := 0; i < 1000; i++ {
+		_, _, ok := it.seekHash([]byte(fmt.Sprintf("%05d", 2*i+1)), nil)
+		require.False(t, ok)
+	}
+}
+
+func TestDataBlockHashIndexPrefix(t *testing.T) {
+	// Versions of the same prefix which span restart intervals cause a
+	// collision in the bucket for the prefix.
+	var keys []InternalKey
+	for _, k := range []string{"a@3", "a@2", "a@1", "b@5", "b@4", "c", "d@9", "d@8", "d@7", "d@6", "d@5"} {
+		keys = append(keys, base.MakeInternalKey([]byte(k), 1, InternalKeyKindSet))
+	}
+	it, _ := buildHashIndexBlock(t, keys, 4, testColumnarSplit, 0.05)
+
+	for _, c := range []struct {
+		prefix string
+		want   string
+	}{
+		{"a", "a@3"},
+		{"b", ""},
+		{"c", "c"},
+		{"d", ""},
+		{"bb", ""},
+		{"e", ""},
+	} {
+		key, _, ok := it.seekHash([]byte(c.prefix), testColumnarSplit)
+		if c.want == "" {
+			require.False(t, ok, c.prefix)
+			continue
+		}
+		require.True(t, ok, c.prefix)
+		require.Equal(t, c.want, string(key.UserKey))
+	}
+}
+
+func TestDataBlockHashIndexTooManyRestarts(t *testing.T) {
+	var keys []InternalKey
+	for i := 0; i < dataBlockHashMaxRestarts+1; i++ {
+		keys = append(keys, base.MakeInternalKey([]byte(fmt.Sprintf("%05d", i)), 1, InternalKeyKindSet))
+	}
+	it, _ := buildHashIndexBlock(t, keys, 1, nil, 0)
+	require.Empty(t, it.hashIndex)
+	_, _, ok := it.seekHash(keys[0].UserKey, nil)
+	require.False(t, ok)
+
+	it, _ = buildHashIndexBlock(t, keys[:dataBlockHashMaxRestarts], 1, nil, 0)
+	require.NotEmpty(t, it.hashIndex)
+}
+
+func TestDataBlockHashIndexIgnored(t *testing.T) {
+	keys := []InternalKey{base.MakeInternalKey([]byte("a"), 1, InternalKeyKindSet)}
+	_, b := buildHashIndexBlock(t, keys, 1, nil, 0)
+
+	// The hash index of a block is only used in tables of a format which
+	// allows it, though the block can be read in any case.
+	for _, hashIndexed := range []bool{false, true} {
+		i := &dataBlockIter{hashIndexed: hashIndexed}
+		require.NoError(t, i.init(bytes.Compare, b, 0))
+		require.NotEmpty(t, i.hashIndex)
+		_, _, ok := i.seekHash([]byte("a"), nil)
+		require.Equal(t, hashIndexed, ok)
+		key, _ := i.SeekGE([]byte("a"))
+		require.Equal(t, "a", string(key.UserKey))
+	}
+}
+
+func TestDataBlockHashIndexTable(t *testing.T) {
+	build := func(o WriterOptions, n int) *Reader {
+		mem := vfs.NewMem()
+		f, err := mem.Create("test")
+		require.NoError(t, err)
+		w := NewWriter(f, o)
+		for i := 0; i < n; i++ {
+			k := []byte(fmt.Sprintf("%06d", 2*i))
+			require.NoError(t, w.Set(k, k))
+		}
+		require.NoError(t, w.Close())
+		f, err = mem.Open("test")
+		require.NoError(t, err)
+		r, err := NewReader(f, ReaderOptions{})
+		require.NoError(t, err)
+		return r
+	}
+
+	r := build(WriterOptions{
+		DataBlockIndexType: DataBlockBinaryAndHash,
+		TableFormat:        TableFormatPebblev2,
+	}, 10000)
+	require.Equal(t, TableFormatPebblev2, r.tableFormat)
+	require.Equal(t, uint32(DataBlockBinaryAndHash), r.Properties.DataBlockIndexType)
+	for i := 0; i < 10000; i++ {
+		k := []byte(fmt.Sprintf("%06d", 2*i))
+		v, err := r.get(k)
+		require.NoError(t, err)
+		require.Equal(t, k, v)
+		_, err = r.get([]byte(fmt.Sprintf("%06d", 2*i+1)))
+		require.Equal(t, base.ErrNotFound, err)
+	}
+
+	// Iterating after a hash lookup proceeds to the following keys, across
+	// data blocks.
+	iter, err := r.NewIter(nil, nil)
+	require.NoError(t, err)
+	for i := 0; i < 10000; i += 97 {
+		k := []byte(fmt.Sprintf("%06d", 2*i))
+		key, _ := iter.SeekPrefixGE(k, k)
+		require.NotNil(t, key)
+		require.Equal(t, k, key.UserKey)
+		for j := i + 1; j < i+5 && j < 10000; j++ {
+			key, _ = iter.Next()
+			require.Equal(t, fmt.Sprintf("%06d", 2*j), string(key.UserKey))
+		}
+	}
+	require.NoError(t, iter.Close())
+	require.NoError(t, r.Close())
+
+	// Tables without a hash index do not record the index type. RocksDB
+	// tables never contain a hash index, as RocksDB could not read it.
+	for _, o := range []WriterOptions{
+		{},
+		{DataBlockIndexType: DataBlockBinaryAndHash},
+		{TableFormat: TableFormatPebblev2},
+	} {
+		r = build(o, 10)
+		require.Equal(t, o.TableFormat, r.tableFormat)
+		require.Equal(t, uint32(0), r.Properties.DataBlockIndexType)
+		_, ok := r.Properties.Loaded[unsafe.Offsetof(r.Properties.DataBlockIndexType)]
+		require.False(t, ok)
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestDataBlockHashIndexUnsupported(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(f, WriterOptions{})
+	require.NoError(t, w.Set([]byte("a"), nil))
+	// Simulate a table written with an index type unknown to this reader.
+	w.props.DataBlockIndexType = uint32(DataBlockBinaryAndHash) + 1
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	_, err = NewReader(f, ReaderOptions{})
+	require.Regexp(t, `unsupported data block index type unknown\(2\)`, err)
+}
+
+func BenchmarkDataBlockHashIndexSeek(b *testing.B) {
+	const blockSize = 32 << 10
+	for _, hash := range []bool{false, true} {
+		b.Run(fmt.Sprintf("hash=%t", hash), func(b *testing.B) {
+			w := &blockWriter{restartInterval: 16}
+			if hash {
+				w.hashIndex = newDataBlockHashIndexBuilder(nil, 0)
+			}
+			var keys [][]byte
+			for i := 0; w.estimatedSize() < blockSize; i++ {
+				key := []byte(fmt.Sprintf("%05d", i))
+				keys = append(keys, key)
+				w.add(InternalKey{UserKey: key}, nil)
+			}
+			it, err := newBlockIter(bytes.Compare, w.finish())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				k := keys[i%len(keys)]
+				if _, _, ok := it.seekHash(k, nil); !ok {
+					it.SeekGE(k)
+				}
+			}
+		})
+	}
+}
@@ -41,6 +41,9 @@ type filterWriter interface {
 type tableFilterReader struct {
 	policy  FilterPolicy
 	metrics *FilterMetrics
+	// partitioned is true if the filter block is the top-level index of a
+	// partitioned filter rather than the filter itself.
+	partitioned bool
 }
 
 func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
@@ -50,6 +53,12 @@ func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
 	}
 }
 
+// recordHit records that the filter ruled out a key without consulting the
+// filter policy, such as when a key lies beyond the last filter partition.
+func (f *tableFilterReader) recordHit() {
+	atomic.AddInt64(&f.metrics.Hits, 1)
+}
+
 func (f *tableFilterReader) mayContain(data, key []byte) bool {
 	mayContain := f.policy.MayContain(TableFilter, data, key)
 	if mayContain {
@@ -93,3 +102,105 @@ func (f *tableFilterWriter) metaName() string {
 func (f *tableFilterWriter) policyName() string {
 	return f.policy.Name()
 }
+
+// partitionedFilterWriter builds one filter partition per index partition of
+// a table with a two-level index, along with a top-level filter index mapping
+// the separator of each index partition to its filter partition. Readers only
+// need to load the top-level index and the single partition covering a key,
+// rather than a filter for the entire table.
+//
+// The keys added for a data block are buffered until the block is flushed,
+// at which point the writer knows which index partition the block belongs to.
+// If the table only ends up with a single index block, the filter is written
+// as a regular table filter.
+type partitionedFilterWriter struct {
+	policy FilterPolicy
+	writer FilterWriter
+	// count is the count of the number of keys added to the current partition.
+	count int
+	// pendingBuf and pendingEnds hold the keys added for the current data
+	// block.
+	pendingBuf  []byte
+	pendingEnds []int
+	// partitions holds the finished filter partitions, excluding the current
+	// partition.
+	partitions [][]byte
+}
+
+func newPartitionedFilterWriter(policy FilterPolicy) *partitionedFilterWriter {
+	return &partitionedFilterWriter{
+		policy: policy,
+		writer: policy.NewWriter(TableFilter),
+	}
+}
+
+func (f *partitionedFilterWriter) addKey(key []byte) {
+	f.pendingBuf = append(f.pendingBuf, key...)
+	f.pendingEnds = append(f.pendingEnds, len(f.pendingBuf))
+}
+
+// addPending adds the keys of the current data block to the current
+// partition.
+func (f *partitionedFilterWriter) addPending() {
+	var start int
+	for _, end := range f.pendingEnds {
+		f.writer.AddKey(f.pendingBuf[start:end])
+		start = end
+	}
+	f.count += len(f.pendingEnds)
+}
+
+func (f *partitionedFilterWriter) clearPending() {
+	f.pendingBuf = f.pendingBuf[:0]
+	f.pendingEnds = f.pendingEnds[:0]
+}
+
+// finishDataBlock adds the keys of the data block which was just flushed to
+// the current partition. If newPartition is true, the data block is the first
+// block of a new index partition and the current filter partition is finished
+// first. The keys of the block are added to the finished partition as well,
+// which ensures that a lookup for a key which falls between the last key of a
+// partition and the partition's separator consults the keys which follow it.
+func (f *partitionedFilterWriter) finishDataBlock(newPartition bool) {
+	if newPartition && f.count > 0 {
+		f.addPending()
+		f.partitions = append(f.partitions, f.writer.Finish(nil))
+		f.writer = f.policy.NewWriter(TableFilter)
+		f.count = 0
+	}
+	f.addPending()
+	f.clearPending()
+}
+
+// partitioned returns true if the filter spans more than one partition.
+func (f *partitionedFilterWriter) partitioned() bool {
+	return len(f.partitions) > 0
+}
+
+// finishPartitions finishes the current partition and returns all of the
+// partitions.
+func (f *partitionedFilterWriter) finishPartitions() [][]byte {
+	f.addPending()
+	f.clearPending()
+	return append(f.partitions, f.writer.Finish(nil))
+}
+
+func (f *partitionedFilterWriter) finish() ([]byte, error) {
+	f.addPending()
+	f.clearPending()
+	if f.count == 0 {
+		return nil, nil
+	}
+	return f.writer.Finish(nil), nil
+}
+
+func (f *partitionedFilterWriter) metaName() string {
+	if f.partitioned() {
+		return "partitionedfilter." + f.policy.Name()
+	}
+	return "fullfilter." + f.policy.Name()
+}
+
+func (f *partitionedFilterWriter) policyName() string {
+	return f.policy.Name()
+}
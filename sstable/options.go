@@ -33,6 +33,36 @@ func (c Compression) String() string {
 	}
 }
 
+// ChecksumType specifies the checksum used to protect the blocks of an
+// sstable. The checksum type is recorded in the table footer. The values of
+// the constants match RocksDB's and are part of the file format.
+type ChecksumType uint8
+
+// The available checksum types. ChecksumTypeXXHash64 uses the lower 32 bits
+// of the 64-bit xxHash of each block.
+const (
+	ChecksumTypeNone     ChecksumType = 0
+	ChecksumTypeCRC32c   ChecksumType = 1
+	ChecksumTypeXXHash   ChecksumType = 2
+	ChecksumTypeXXHash64 ChecksumType = 3
+)
+
+// String implements fmt.Stringer.
+func (t ChecksumType) String() string {
+	switch t {
+	case ChecksumTypeNone:
+		return "none"
+	case ChecksumTypeCRC32c:
+		return "crc32c"
+	case ChecksumTypeXXHash:
+		return "xxhash"
+	case ChecksumTypeXXHash64:
+		return "xxhash64"
+	default:
+		return "unknown"
+	}
+}
+
 // FilterType exports the base.FilterType type.
 type FilterType = base.FilterType
 
@@ -47,6 +77,12 @@ type FilterWriter = base.FilterWriter
 // FilterPolicy exports the base.FilterPolicy type.
 type FilterPolicy = base.FilterPolicy
 
+// PrefixExtractor exports the base.PrefixExtractor type.
+type PrefixExtractor = base.PrefixExtractor
+
+// FixedPrefixExtractor exports the base.FixedPrefixExtractor type.
+type FixedPrefixExtractor = base.FixedPrefixExtractor
+
 // TableFormat specifies the format version for sstables. The legacy LevelDB
 // format is format version 0.
 type TableFormat uint32
@@ -54,9 +90,22 @@ type TableFormat uint32
 // The available table formats. Note that these values are not (and should not)
 // be serialized to disk. TableFormatRocksDBv2 is the default if otherwise
 // unspecified.
+//
+// TableFormatPebblev1 uses the RocksDB table layout, but stores data blocks in
+// a columnar layout which separates the key prefixes, key suffixes and values
+// of the entries. Sstables written with this format cannot be read by RocksDB.
+//
+// TableFormatPebblev2 uses the RocksDB table layout and row-oriented data
+// blocks, which may additionally contain a Pebble data block hash index (see
+// DataBlockBinaryAndHash). Its footer carries a Pebble format version, so
+// readers which do not support the hash index reject the table rather than
+// misreading its data blocks. Sstables written with this format cannot be read
+// by RocksDB.
 const (
 	TableFormatRocksDBv2 TableFormat = iota
 	TableFormatLevelDB
+	TableFormatPebblev1
+	TableFormatPebblev2
 )
 
 // TablePropertyCollector provides a hook for collecting user-defined
@@ -113,6 +162,23 @@ type ReaderOptions struct {
 	// written with {Batch,DB}.Merge. The MergerName is checked for consistency
 	// with the value stored in the sstable when it was written.
 	MergerName string
+
+	// PrefixExtractors is a map from prefix extractor name to prefix
+	// extractor. The prefix extractor recorded in an sstable's properties is
+	// looked up in this map in order to use the table's filter to skip tables
+	// for iterators whose bounds share a common prefix. FixedPrefixExtractors
+	// are recognized by name and do not need to be present in the map.
+	PrefixExtractors map[string]PrefixExtractor
+
+	// ReadaheadBlocks is the maximum number of data blocks an iterator
+	// prefetches into the block cache in the background once it detects that
+	// it is loading blocks sequentially in the forward direction. The number of
+	// blocks prefetched at a time starts small and doubles as the sequential
+	// access continues, up to this limit. Prefetching never extends past the
+	// iterator's upper bound.
+	//
+	// The default value of 0 disables background prefetching.
+	ReadaheadBlocks int
 }
 
 func (o ReaderOptions) ensureDefaults() ReaderOptions {
@@ -157,6 +223,14 @@ type WriterOptions struct {
 	// The default value uses the same ordering as bytes.Compare.
 	Comparer *Comparer
 
+	// Checksum specifies the checksum used to protect each block. The
+	// checksum type is recorded in the table footer. Only ChecksumTypeCRC32c
+	// and ChecksumTypeXXHash64 are supported, and TableFormatLevelDB tables
+	// always use ChecksumTypeCRC32c.
+	//
+	// The default value is ChecksumTypeCRC32c.
+	Checksum ChecksumType
+
 	// Compression defines the per-block compression to use.
 	//
 	// The default value (DefaultCompression) uses snappy compression.
@@ -166,7 +240,8 @@ type WriterOptions struct {
 	// reduce disk reads for Get calls.
 	//
 	// One such implementation is bloom.FilterPolicy(10) from the pebble/bloom
-	// package.
+	// package. ribbon.FilterPolicy from the pebble/ribbon package uses less
+	// space for the same false positive rate at a higher construction cost.
 	//
 	// The default value means to use no filter.
 	FilterPolicy FilterPolicy
@@ -180,6 +255,15 @@ type WriterOptions struct {
 	// filters should be preferred except under constrained memory situations.
 	FilterType FilterType
 
+	// PrefixExtractor, if non-nil, causes the prefix of each key extracted by
+	// the PrefixExtractor to be added to the filter in addition to the key
+	// itself (or the key's prefix as determined by Comparer.Split). The
+	// extractor's name is recorded in the table properties. The option has no
+	// effect if FilterPolicy is nil.
+	//
+	// The default value means to use no prefix extractor.
+	PrefixExtractor PrefixExtractor
+
 	// IndexBlockSize is the target uncompressed size in bytes of each index
 	// block. When the index block size is larger than this target, two-level
 	// indexes are automatically enabled. Setting this option to a large value
@@ -189,6 +273,33 @@ type WriterOptions struct {
 	// The default value is the value of BlockSize.
 	IndexBlockSize int
 
+	// PartitionFilters, if true, partitions the table filter in tables with a
+	// two-level index: one filter partition is written per index partition,
+	// along with a top-level filter index. Readers only need to keep the
+	// top-level filter index in the block cache, and load the partition
+	// covering a key on demand. Tables with a single index block are written
+	// with a regular table filter. The option has no effect if FilterPolicy is
+	// nil or the table format does not support two-level indexes.
+	PartitionFilters bool
+
+	// DataBlockIndexType specifies the index used to search within data
+	// blocks. DataBlockBinaryAndHash adds a hash index to each data block
+	// which speeds up point lookups at the cost of a small amount of space.
+	// The index type is recorded in the table properties, and readers reject
+	// tables with an index type they do not support. The option is ignored
+	// for table formats other than TableFormatPebblev2.
+	//
+	// The default value is DataBlockBinarySearch.
+	DataBlockIndexType DataBlockIndexType
+
+	// DataBlockHashUtilRatio is the target ratio of distinct key prefixes to
+	// hash buckets in a data block hash index. Lower values reduce the
+	// probability of collisions, which force a fallback to binary search, at
+	// the expense of space.
+	//
+	// The default value is 0.75.
+	DataBlockHashUtilRatio float64
+
 	// Merger defines the associative merge operation to use for merging values
 	// written with {Batch,DB}.Merge. The MergerName is checked for consistency
 	// with the value stored in the sstable when it was written.
@@ -219,12 +330,18 @@ func (o WriterOptions) ensureDefaults() WriterOptions {
 	if o.Comparer == nil {
 		o.Comparer = base.DefaultComparer
 	}
+	if o.Checksum != ChecksumTypeXXHash64 || o.TableFormat == TableFormatLevelDB {
+		o.Checksum = ChecksumTypeCRC32c
+	}
 	if o.Compression <= DefaultCompression || o.Compression >= NCompression {
 		o.Compression = SnappyCompression
 	}
 	if o.IndexBlockSize <= 0 {
 		o.IndexBlockSize = o.BlockSize
 	}
+	if o.DataBlockHashUtilRatio <= 0 {
+		o.DataBlockHashUtilRatio = defaultDataBlockHashUtilRatio
+	}
 	if o.MergerName == "" {
 		o.MergerName = base.DefaultMerger.Name
 	}
@@ -0,0 +1,241 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// initialPrefetchBlocks is the number of data blocks prefetched by the first
+// background prefetch of a sequential scan.
+const initialPrefetchBlocks = 2
+
+// ReadaheadMetrics holds metrics for the background prefetching of data blocks
+// by sstable iterators. See ReaderOptions.ReadaheadBlocks.
+type ReadaheadMetrics struct {
+	// The number of data blocks prefetched into the block cache.
+	Count int64
+	// The number of bytes prefetched into the block cache.
+	Bytes int64
+	// The number of prefetched bytes which were subsequently loaded by the
+	// iterator that prefetched them.
+	BytesUsed int64
+	// The number of prefetched bytes which were never loaded by the iterator
+	// that prefetched them, because the iterator was repositioned past them or
+	// closed.
+	BytesWasted int64
+}
+
+var dummyReadaheadMetrics ReadaheadMetrics
+
+func (m *ReadaheadMetrics) readerApply(r *Reader) {
+	r.readaheadMetrics = m
+}
+
+// blockPrefetcher holds the state of an iterator's background prefetching of
+// data blocks. Sequential access is detected by the iterator loading data
+// blocks in file order, which is the order in which they are written.
+type blockPrefetcher struct {
+	// lastEnd is the end offset of the last data block loaded by the iterator.
+	lastEnd uint64
+	// seqLoads is the number of consecutive data blocks loaded in file order.
+	seqLoads int
+	// blocks is the number of blocks to prefetch in the next batch. It doubles
+	// with every batch up to ReaderOptions.ReadaheadBlocks.
+	blocks int
+	// limit is the end offset of the last block prefetched.
+	limit uint64
+	// pending holds the prefetched blocks which have not been loaded by the
+	// iterator yet, in file order.
+	pending []BlockHandle
+	// done is non-nil while a batch of blocks is being read in the background,
+	// and is closed once the batch has been read.
+	done chan struct{}
+	// index is used to read the index entries following the iterator's
+	// position without disturbing the iterator's index block iterator.
+	index blockIter
+}
+
+func (p *blockPrefetcher) resetForReuse() blockPrefetcher {
+	return blockPrefetcher{
+		pending: p.pending[:0],
+		index:   p.index.resetForReuse(),
+	}
+}
+
+// recordLoad updates the prefetch state for the iterator loading the data
+// block bh.
+func (p *blockPrefetcher) recordLoad(bh BlockHandle, m *ReadaheadMetrics) {
+	// Any pending blocks before bh were skipped over by the iterator.
+	for len(p.pending) > 0 && p.pending[0].Offset <= bh.Offset {
+		n := int64(p.pending[0].Length + blockTrailerLen)
+		if p.pending[0].Offset == bh.Offset {
+			atomic.AddInt64(&m.BytesUsed, n)
+		} else {
+			atomic.AddInt64(&m.BytesWasted, n)
+		}
+		p.pending = p.pending[1:]
+	}
+
+	if bh.Offset == p.lastEnd && p.seqLoads > 0 {
+		p.seqLoads++
+	} else {
+		p.seqLoads = 1
+		p.blocks = 0
+	}
+	p.lastEnd = bh.Offset + bh.Length + blockTrailerLen
+}
+
+// wait waits for the in-flight batch of prefetched blocks, if any.
+func (p *blockPrefetcher) wait() {
+	if p.done != nil {
+		<-p.done
+		p.done = nil
+	}
+}
+
+// busy returns true if a batch of prefetched blocks is still being read.
+func (p *blockPrefetcher) busy() bool {
+	if p.done == nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		p.done = nil
+		return false
+	default:
+		return true
+	}
+}
+
+// maybePrefetch starts reading the data blocks following the current data
+// block into the block cache in the background if the iterator is loading
+// blocks sequentially, and less than half of the last batch of prefetched
+// blocks remains ahead of the iterator. Prefetching is limited to the blocks
+// in the current index block, and stops at the block containing the upper
+// bound.
+func (i *singleLevelIterator) maybePrefetch() {
+	p := &i.prefetch
+	maxBlocks := i.reader.opts.ReadaheadBlocks
+	if maxBlocks <= 0 || p.seqLoads < minFileReadsForReadahead {
+		return
+	}
+	if p.blocks == 0 {
+		p.blocks = initialPrefetchBlocks
+		if p.blocks > maxBlocks {
+			p.blocks = maxBlocks
+		}
+	}
+	if len(p.pending) > p.blocks/2 || p.busy() {
+		return
+	}
+	if i.upper != nil && i.cmp(i.index.Key().UserKey, i.upper) >= 0 {
+		// The current block contains the upper bound.
+		return
+	}
+
+	// Position p.index at the iterator's index entry.
+	ahead := &p.index
+	if ahead.init(i.cmp, i.index.data, i.reader.Properties.GlobalSeqNum) != nil {
+		return
+	}
+	key, _ := ahead.SeekGE(i.index.Key().UserKey)
+	for key != nil && ahead.offset < i.index.offset {
+		key, _ = ahead.Next()
+	}
+	if key == nil || ahead.offset != i.index.offset {
+		return
+	}
+
+	start := p.lastEnd
+	if p.limit > start {
+		start = p.limit
+	}
+	var batch []BlockHandle
+	for n := 0; n < p.blocks; {
+		var val []byte
+		if key, val = ahead.Next(); key == nil {
+			break
+		}
+		bh, l := decodeBlockHandle(val)
+		if l == 0 || l != len(val) {
+			break
+		}
+		if bh.Offset >= start {
+			n++
+			p.limit = bh.Offset + bh.Length + blockTrailerLen
+			// Blocks which are already cached don't need to be prefetched.
+			h := i.reader.opts.Cache.Get(i.reader.cacheID, i.reader.fileNum, bh.Offset)
+			if h.Get() == nil {
+				batch = append(batch, bh)
+			}
+			h.Release()
+		}
+		if i.upper != nil && i.cmp(key.UserKey, i.upper) >= 0 {
+			break
+		}
+	}
+	ahead.invalidate()
+
+	p.blocks *= 2
+	if p.blocks > maxBlocks {
+		p.blocks = maxBlocks
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	// Read the blocks through a file handle opened with the sequential access
+	// hint if possible. The iterator switches to the handle as well.
+	r := i.reader
+	if i.dataRS.sequentialFile == nil && r.fs != nil {
+		if f, err := r.fs.Open(r.filename, vfs.SequentialReadsOption); err == nil {
+			i.dataRS.sequentialFile = f
+		}
+	}
+	var rs *readaheadState
+	if i.dataRS.sequentialFile != nil {
+		rs = &readaheadState{sequentialFile: i.dataRS.sequentialFile}
+	}
+
+	m := r.readaheadMetrics
+	for _, bh := range batch {
+		atomic.AddInt64(&m.Count, 1)
+		atomic.AddInt64(&m.Bytes, int64(bh.Length+blockTrailerLen))
+	}
+	p.pending = append(p.pending, batch...)
+	done := make(chan struct{})
+	p.done = done
+	go func() {
+		defer close(done)
+		for _, bh := range batch {
+			h, err := r.readBlock(bh, nil /* transform */, rs)
+			if err != nil {
+				// The iterator will encounter the error itself if it loads the
+				// block.
+				return
+			}
+			h.Release()
+		}
+	}()
+}
+
+// closePrefetch waits for any in-flight prefetching, and records the pending
+// prefetched blocks as wasted.
+func (i *singleLevelIterator) closePrefetch() {
+	p := &i.prefetch
+	p.wait()
+	if len(p.pending) == 0 {
+		return
+	}
+	var n int64
+	for _, bh := range p.pending {
+		n += int64(bh.Length + blockTrailerLen)
+	}
+	atomic.AddInt64(&i.reader.readaheadMetrics.BytesWasted, n)
+	p.pending = p.pending[:0]
+}
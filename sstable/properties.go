@@ -71,6 +71,9 @@ type Properties struct {
 	// The time when the SST file was created. Since SST files are immutable,
 	// this is equivalent to last modified time.
 	CreationTime uint64 `prop:"rocksdb.creation.time"`
+	// The index used to search within data blocks. Readers reject tables with
+	// a data block index type they do not support.
+	DataBlockIndexType uint32 `prop:"pebble.data.block.index.type"`
 	// The total size of all data blocks.
 	DataSize uint64 `prop:"rocksdb.data.size"`
 	// The external sstable version format. Version 2 is the one RocksDB has been
@@ -282,6 +285,9 @@ func (p *Properties) save(w *rawBlockWriter) {
 		p.saveString(m, unsafe.Offsetof(p.CompressionOptions), p.CompressionOptions)
 	}
 	p.saveUvarint(m, unsafe.Offsetof(p.CreationTime), p.CreationTime)
+	if p.DataBlockIndexType != 0 {
+		p.saveUint32(m, unsafe.Offsetof(p.DataBlockIndexType), p.DataBlockIndexType)
+	}
 	p.saveUvarint(m, unsafe.Offsetof(p.DataSize), p.DataSize)
 	if p.ExternalFormatVersion != 0 {
 		p.saveUint32(m, unsafe.Offsetof(p.ExternalFormatVersion), p.ExternalFormatVersion)
@@ -18,7 +18,6 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
-	"github.com/cockroachdb/pebble/internal/crc"
 	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/internal/rangedel"
@@ -66,6 +65,11 @@ type Iterator interface {
 	base.InternalIterator
 
 	SetCloseHook(fn func(i Iterator) error)
+
+	// SetStats sets the stats which the iterator accumulates into as it loads
+	// data blocks and consults the table filter. A nil stats disables
+	// accumulation. SetStats must be called before the iterator is positioned.
+	SetStats(stats *base.InternalIteratorStats)
 }
 
 // singleLevelIterator iterates over an entire table of data. To seek for a given
@@ -82,11 +86,13 @@ type singleLevelIterator struct {
 	blockUpper []byte
 	reader     *Reader
 	index      blockIter
-	data       blockIter
+	data       dataBlockIter
 	dataRS     readaheadState
+	prefetch   blockPrefetcher
 	dataBH     BlockHandle
 	err        error
 	closeHook  func(i Iterator) error
+	stats      *base.InternalIteratorStats
 }
 
 // singleLevelIterator implements the base.InternalIterator interface.
@@ -152,6 +158,8 @@ func (i *singleLevelIterator) init(r *Reader, lower, upper []byte) error {
 	i.upper = upper
 	i.reader = r
 	i.cmp = r.Compare
+	i.data.columnar = r.tableFormat == TableFormatPebblev1
+	i.data.hashIndexed = r.tableFormat == TableFormatPebblev2
 	err = i.index.initHandle(i.cmp, indexH, r.Properties.GlobalSeqNum)
 	if err != nil {
 		// blockIter.Close releases indexH and always returns a nil error
@@ -164,8 +172,9 @@ func (i *singleLevelIterator) init(r *Reader, lower, upper []byte) error {
 
 func (i *singleLevelIterator) resetForReuse() singleLevelIterator {
 	return singleLevelIterator{
-		index: i.index.resetForReuse(),
-		data:  i.data.resetForReuse(),
+		index:    i.index.resetForReuse(),
+		data:     i.data.resetForReuse(),
+		prefetch: i.prefetch.resetForReuse(),
 	}
 }
 
@@ -209,29 +218,33 @@ func (i *singleLevelIterator) loadBlock() bool {
 		i.err = errCorruptIndexEntry
 		return false
 	}
-	block, err := i.reader.readBlock(i.dataBH, nil /* transform */, &i.dataRS)
+	block, err := i.reader.readBlockWithPriority(
+		i.dataBH, nil /* transform */, &i.dataRS, cache.NormalPriority, i.stats)
 	if err != nil {
 		i.err = err
 		return false
 	}
+	i.prefetch.recordLoad(i.dataBH, i.reader.readaheadMetrics)
 	i.err = i.data.initHandle(i.cmp, block, i.reader.Properties.GlobalSeqNum)
 	if i.err != nil {
 		return false
 	}
 	i.initBounds()
+	i.maybePrefetch()
 	return true
 }
 
 func (i *singleLevelIterator) recordOffset() uint64 {
 	offset := i.dataBH.Offset
 	if i.data.Valid() {
-		// - i.dataBH.Length/len(i.data.data) is the compression ratio. If
+		// - i.dataBH.Length/blockLen is the compression ratio. If
 		//   uncompressed, this is 1.
-		// - i.data.nextOffset is the uncompressed position of the current record
+		// - nextOffset is the uncompressed position of the current record
 		//   in the block.
 		// - i.dataBH.Offset is the offset of the block in the sstable before
 		//   decompression.
-		offset += (uint64(i.data.nextOffset) * i.dataBH.Length) / uint64(len(i.data.data))
+		nextOffset, blockLen := i.data.offsetAndLen()
+		offset += (uint64(nextOffset) * i.dataBH.Length) / uint64(blockLen)
 	} else {
 		// Last entry in the block must increment bytes iterated by the size of the block trailer
 		// and restart points.
@@ -273,15 +286,16 @@ func (i *singleLevelIterator) SeekPrefixGE(prefix, key []byte) (*InternalKey, []
 
 	// Check prefix bloom filter.
 	if i.reader.tableFilter != nil {
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter()
-		if i.err != nil {
-			i.data.invalidate()
-			return nil, nil
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(prefix, key)
+		if i.stats != nil && i.err == nil {
+			if mayContain {
+				i.stats.FilterMisses++
+			} else {
+				i.stats.FilterHits++
+			}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
-		if !mayContain {
+		if i.err != nil || !mayContain {
 			i.data.invalidate()
 			return nil, nil
 		}
@@ -294,6 +308,16 @@ func (i *singleLevelIterator) SeekPrefixGE(prefix, key []byte) (*InternalKey, []
 	if !i.loadBlock() {
 		return nil, nil
 	}
+	// When the prefix is the full key, the data block's hash index (if any)
+	// can locate the key without a binary search.
+	if len(prefix) == len(key) {
+		if ikey, val, ok := i.data.seekHash(prefix, i.reader.Split); ok {
+			if i.blockUpper != nil && i.cmp(ikey.UserKey, i.blockUpper) >= 0 {
+				return nil, nil
+			}
+			return ikey, val
+		}
+	}
 	if ikey, val := i.data.SeekGE(key); ikey != nil {
 		if i.blockUpper != nil && i.cmp(ikey.UserKey, i.blockUpper) >= 0 {
 			return nil, nil
@@ -482,6 +506,11 @@ func (i *singleLevelIterator) SetCloseHook(fn func(i Iterator) error) {
 	i.closeHook = fn
 }
 
+// SetStats implements Iterator.SetStats.
+func (i *singleLevelIterator) SetStats(stats *base.InternalIteratorStats) {
+	i.stats = stats
+}
+
 func firstError(err0, err1 error) error {
 	if err0 != nil {
 		return err0
@@ -492,6 +521,9 @@ func firstError(err0, err1 error) error {
 // Close implements internalIterator.Close, as documented in the pebble
 // package.
 func (i *singleLevelIterator) Close() error {
+	// Wait for any background prefetching before the reader may be released
+	// by the close hook.
+	i.closePrefetch()
 	var err error
 	if i.closeHook != nil {
 		err = firstError(err, i.closeHook(i))
@@ -642,6 +674,8 @@ func (i *twoLevelIterator) init(r *Reader, lower, upper []byte) error {
 	i.upper = upper
 	i.reader = r
 	i.cmp = r.Compare
+	i.data.columnar = r.tableFormat == TableFormatPebblev1
+	i.data.hashIndexed = r.tableFormat == TableFormatPebblev2
 	err = i.topLevelIndex.initHandle(i.cmp, topLevelIndexH, r.Properties.GlobalSeqNum)
 	if err != nil {
 		// blockIter.Close releases topLevelIndexH and always returns a nil error
@@ -848,6 +882,7 @@ func (i *twoLevelIterator) skipBackward() (*InternalKey, []byte) {
 // Close implements internalIterator.Close, as documented in the pebble
 // package.
 func (i *twoLevelIterator) Close() error {
+	i.closePrefetch()
 	var err error
 	if i.closeHook != nil {
 		err = firstError(err, i.closeHook(i))
@@ -1258,6 +1293,10 @@ type Reader struct {
 	Split             Split
 	mergerOK          bool
 	tableFilter       *tableFilterReader
+	readaheadMetrics  *ReadaheadMetrics
+	prefixExtractor   PrefixExtractor
+	tableFormat       TableFormat
+	checksumType      ChecksumType
 	Properties        Properties
 }
 
@@ -1291,19 +1330,15 @@ func (r *Reader) get(key []byte) (value []byte, err error) {
 		return nil, r.err
 	}
 
-	if r.tableFilter != nil {
-		dataH, err := r.readFilter()
+	// If the prefix of the key is the full key, SeekPrefixGE checks the filter
+	// and may use the data block hash index. Otherwise, check the filter for
+	// the prefix and use SeekGE.
+	prefixIsKey := r.Split == nil || r.Split(key) == len(key)
+	if r.tableFilter != nil && !prefixIsKey {
+		mayContain, err := r.filterMayContain(key[:r.Split(key)], key)
 		if err != nil {
 			return nil, err
 		}
-		var lookupKey []byte
-		if r.Split != nil {
-			lookupKey = key[:r.Split(key)]
-		} else {
-			lookupKey = key
-		}
-		mayContain := r.tableFilter.mayContain(dataH.Get(), lookupKey)
-		dataH.Release()
 		if !mayContain {
 			return nil, base.ErrNotFound
 		}
@@ -1313,7 +1348,12 @@ func (r *Reader) get(key []byte) (value []byte, err error) {
 	if err != nil {
 		return nil, err
 	}
-	ikey, value := i.SeekGE(key)
+	var ikey *InternalKey
+	if prefixIsKey {
+		ikey, value = i.SeekPrefixGE(key, key)
+	} else {
+		ikey, value = i.SeekGE(key)
+	}
 
 	if ikey == nil || r.Compare(key, ikey.UserKey) != 0 {
 		err := i.Close()
@@ -1333,6 +1373,79 @@ func (r *Reader) get(key []byte) (value []byte, err error) {
 	return newValue, nil
 }
 
+// PrefixMayMatch returns whether the table may contain keys within the
+// iteration bounds [lower, upper). It returns false only if the table was
+// written with the DefaultComparer and a PrefixExtractor known to the reader,
+// both bounds share the same extracted prefix (or upper is the immediate
+// successor of the prefix extracted from lower), and the table's filter rules
+// that prefix out.
+func (r *Reader) PrefixMayMatch(lower, upper []byte) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	if r.tableFilter == nil || r.prefixExtractor == nil || lower == nil || upper == nil {
+		return true, nil
+	}
+	prefix, ok := r.prefixExtractor.Prefix(lower)
+	if !ok {
+		return true, nil
+	}
+	if upperPrefix, ok := r.prefixExtractor.Prefix(upper); !ok || !bytes.Equal(prefix, upperPrefix) {
+		if !isPrefixSuccessor(prefix, upper) {
+			return true, nil
+		}
+	}
+
+	return r.filterMayContain(prefix, lower)
+}
+
+// filterMayContain returns whether the table filter may contain the specified
+// filter key (the prefix of a key or a key itself). For a partitioned filter,
+// the partition is located using key, which must be greater than or equal to
+// prefix, and is the smallest key of interest with that prefix.
+func (r *Reader) filterMayContain(prefix, key []byte) (bool, error) {
+	dataH, err := r.readFilter()
+	if err != nil {
+		return false, err
+	}
+	defer dataH.Release()
+	if !r.tableFilter.partitioned {
+		return r.tableFilter.mayContain(dataH.Get(), prefix), nil
+	}
+
+	var topLevelIndex blockIter
+	if err := topLevelIndex.init(r.Compare, dataH.Get(), 0 /* globalSeqNum */); err != nil {
+		return false, err
+	}
+	_, value := topLevelIndex.SeekGE(key)
+	if value == nil {
+		// The key is greater than every key in the table.
+		r.tableFilter.recordHit()
+		return false, nil
+	}
+	bh, n := decodeBlockHandle(value)
+	if n == 0 || n != len(value) {
+		return false, errCorruptIndexEntry
+	}
+	partitionH, err := r.readBlock(bh, nil /* transform */, nil /* readaheadState */)
+	if err != nil {
+		return false, err
+	}
+	defer partitionH.Release()
+	return r.tableFilter.mayContain(partitionH.Get(), prefix), nil
+}
+
+// isPrefixSuccessor returns whether key is the smallest key which is larger
+// than all keys with the specified prefix under a bytewise ordering.
+func isPrefixSuccessor(prefix, key []byte) bool {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			return len(key) == i+1 && key[i] == prefix[i]+1 && bytes.Equal(key[:i], prefix[:i])
+		}
+	}
+	return false
+}
+
 // NewIter returns an iterator for the contents of the table. If an error
 // occurs, NewIter cleans up after itself and returns a nil iterator.
 func (r *Reader) NewIter(lower, upper []byte) (Iterator, error) {
@@ -1405,7 +1518,15 @@ func (r *Reader) readIndex() (cache.Handle, error) {
 }
 
 func (r *Reader) readFilter() (cache.Handle, error) {
-	return r.readBlock(r.filterBH, nil /* transform */, nil /* readaheadState */)
+	// The top-level index of a partitioned filter is small and consulted for
+	// every lookup, so it is cached with a high priority. The partitions it
+	// refers to are cached with normal priority, allowing them to be evicted
+	// under memory pressure.
+	pri := cache.NormalPriority
+	if r.tableFilter != nil && r.tableFilter.partitioned {
+		pri = cache.HighPriority
+	}
+	return r.readBlockWithPriority(r.filterBH, nil /* transform */, nil /* readaheadState */, pri, nil /* stats */)
 }
 
 func (r *Reader) readRangeDel() (cache.Handle, error) {
@@ -1416,12 +1537,35 @@ func (r *Reader) readRangeDel() (cache.Handle, error) {
 func (r *Reader) readBlock(
 	bh BlockHandle, transform blockTransform, raState *readaheadState,
 ) (cache.Handle, error) {
+	return r.readBlockWithPriority(bh, transform, raState, cache.NormalPriority, nil /* stats */)
+}
+
+// readBlockWithPriority is like readBlock, but caches the block with the
+// specified priority. If stats is non-nil, the block is counted as a loaded
+// data block.
+func (r *Reader) readBlockWithPriority(
+	bh BlockHandle,
+	transform blockTransform,
+	raState *readaheadState,
+	pri cache.Priority,
+	stats *base.InternalIteratorStats,
+) (cache.Handle, error) {
+	if stats != nil {
+		stats.BlocksLoaded++
+		stats.BlockBytes += bh.Length + blockTrailerLen
+	}
 	if h := r.opts.Cache.Get(r.cacheID, r.fileNum, bh.Offset); h.Get() != nil {
 		if raState != nil {
 			raState.recordCacheHit(int64(bh.Offset), int64(bh.Length+blockTrailerLen))
 		}
+		if stats != nil {
+			stats.BlocksCached++
+		}
 		return h, nil
 	}
+	if stats != nil {
+		stats.BlockBytesRead += bh.Length + blockTrailerLen
+	}
 	file := r.file
 
 	if raState != nil {
@@ -1457,13 +1601,9 @@ func (r *Reader) readBlock(
 		return cache.Handle{}, err
 	}
 
-	checksum0 := binary.LittleEndian.Uint32(b[bh.Length+1:])
-	checksum1 := crc.New(b[:bh.Length+1]).Value()
-	if checksum0 != checksum1 {
+	if err := r.verifyChecksum(b, bh); err != nil {
 		r.opts.Cache.Free(v)
-		return cache.Handle{}, errors.Newf(
-			"pebble/table: invalid table %s (checksum mismatch at %d/%d)",
-			errors.Safe(r.fileNum), errors.Safe(bh.Offset), errors.Safe(bh.Length))
+		return cache.Handle{}, err
 	}
 
 	typ := b[bh.Length]
@@ -1514,10 +1654,62 @@ func (r *Reader) readBlock(
 		v = newV
 	}
 
-	h := r.opts.Cache.Set(r.cacheID, r.fileNum, bh.Offset, v)
+	h := r.opts.Cache.SetWithPriority(r.cacheID, r.fileNum, bh.Offset, v, pri)
 	return h, nil
 }
 
+// verifyChecksum verifies the checksum in the trailer of the block b, which
+// holds the block's data followed by its trailer.
+func (r *Reader) verifyChecksum(b []byte, bh BlockHandle) error {
+	checksum0 := binary.LittleEndian.Uint32(b[bh.Length+1:])
+	checksum1 := blockChecksum(r.checksumType, b[:bh.Length], b[bh.Length:bh.Length+1])
+	if checksum0 != checksum1 {
+		return errors.Newf(
+			"pebble/table: invalid table %s (checksum mismatch at %d/%d)",
+			errors.Safe(r.fileNum), errors.Safe(bh.Offset), errors.Safe(bh.Length))
+	}
+	return nil
+}
+
+// ValidateBlockChecksums reads every block in the table directly from the
+// file, bypassing the block cache, and verifies its checksum. The returned
+// error identifies the file number and offset of the first corrupt block.
+func (r *Reader) ValidateBlockChecksums() error {
+	if r.err != nil {
+		return r.err
+	}
+	l, err := r.Layout()
+	if err != nil {
+		return err
+	}
+
+	blocks := make([]BlockHandle, 0, len(l.Data)+len(l.Index)+len(l.FilterPartitions)+6)
+	blocks = append(blocks, l.Data...)
+	blocks = append(blocks, l.Index...)
+	blocks = append(blocks, l.FilterPartitions...)
+	blocks = append(blocks, l.TopIndex, l.Filter, l.TopFilter, l.RangeDel, l.Properties, l.MetaIndex)
+
+	var buf []byte
+	for _, bh := range blocks {
+		if bh == (BlockHandle{}) {
+			continue
+		}
+		n := int(bh.Length + blockTrailerLen)
+		if cap(buf) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := r.file.ReadAt(buf, int64(bh.Offset)); err != nil {
+			return errors.Wrapf(err, "pebble/table: invalid table %s (could not read block at %d/%d)",
+				errors.Safe(r.fileNum), errors.Safe(bh.Offset), errors.Safe(bh.Length))
+		}
+		if err := r.verifyChecksum(buf, bh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *Reader) transformRangeDelV1(b []byte) ([]byte, error) {
 	// Convert v1 (RocksDB format) range-del blocks to v2 blocks on the fly. The
 	// v1 format range-del blocks have unfragmented and unsorted range
@@ -1601,6 +1793,9 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 		if err != nil {
 			return err
 		}
+		if t := DataBlockIndexType(r.Properties.DataBlockIndexType); t > DataBlockBinaryAndHash {
+			return errors.Errorf("pebble/table: unsupported data block index type %s", errors.Safe(t))
+		}
 	}
 
 	if bh, ok := meta[metaRangeDelV2Name]; ok {
@@ -1614,10 +1809,12 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 
 	for name, fp := range r.opts.Filters {
 		types := []struct {
-			ftype  FilterType
-			prefix string
+			ftype       FilterType
+			prefix      string
+			partitioned bool
 		}{
-			{TableFilter, "fullfilter."},
+			{TableFilter, "fullfilter.", false},
+			{TableFilter, "partitionedfilter.", true},
 		}
 		var done bool
 		for _, t := range types {
@@ -1627,6 +1824,7 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 				switch t.ftype {
 				case TableFilter:
 					r.tableFilter = newTableFilterReader(fp)
+					r.tableFilter.partitioned = t.partitioned
 				default:
 					return errors.Errorf("unknown filter type: %v", errors.Safe(t.ftype))
 				}
@@ -1657,6 +1855,24 @@ func (r *Reader) Layout() (*Layout, error) {
 		Footer:     r.footerBH,
 	}
 
+	if r.tableFilter != nil && r.tableFilter.partitioned {
+		l.Filter, l.TopFilter = BlockHandle{}, r.filterBH
+		filterH, err := r.readFilter()
+		if err != nil {
+			return nil, err
+		}
+		iter, _ := newBlockIter(r.Compare, filterH.Get())
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			bh, n := decodeBlockHandle(value)
+			if n == 0 || n != len(value) {
+				filterH.Release()
+				return nil, errCorruptIndexEntry
+			}
+			l.FilterPartitions = append(l.FilterPartitions, bh)
+		}
+		filterH.Release()
+	}
+
 	indexH, err := r.readIndex()
 	if err != nil {
 		return nil, err
@@ -1812,13 +2028,97 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 	return endBH.Offset + endBH.Length + blockTrailerLen - startBH.Offset, nil
 }
 
+// EstimateSplitKeys returns up to n keys within the range (start, end) which
+// divide the table's data in that range into roughly equal parts. The keys are
+// chosen from the separators in the table's index, so each part consists of
+// roughly the same number of data blocks. Fewer than n keys are returned if
+// the range spans fewer than n+1 data blocks. A nil start or end leaves that
+// side of the range unbounded.
+func (r *Reader) EstimateSplitKeys(start, end []byte, n int) ([][]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	indexH, err := r.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer indexH.Release()
+
+	// Collect the separators of the data blocks within the range. The
+	// separator of a block is greater than or equal to every key in the block,
+	// so the separator of the block containing end is not collected.
+	var separators [][]byte
+	collect := func(iter *blockIter) bool {
+		key, _ := iter.First()
+		if start != nil {
+			key, _ = iter.SeekGE(start)
+		}
+		for ; key != nil; key, _ = iter.Next() {
+			if end != nil && r.Compare(key.UserKey, end) >= 0 {
+				return false
+			}
+			if start == nil || r.Compare(key.UserKey, start) > 0 {
+				separators = append(separators, append([]byte(nil), key.UserKey...))
+			}
+		}
+		return true
+	}
+
+	topIter, err := newBlockIter(r.Compare, indexH.Get())
+	if err != nil {
+		return nil, err
+	}
+	if r.Properties.IndexPartitions == 0 {
+		collect(topIter)
+	} else {
+		key, val := topIter.First()
+		if start != nil {
+			key, val = topIter.SeekGE(start)
+		}
+		for ; key != nil; key, val = topIter.Next() {
+			bh, n := decodeBlockHandle(val)
+			if n == 0 || n != len(val) {
+				return nil, errCorruptIndexEntry
+			}
+			partitionH, err := r.readBlock(bh, nil /* transform */, nil /* readaheadState */)
+			if err != nil {
+				return nil, err
+			}
+			iter, err := newBlockIter(r.Compare, partitionH.Get())
+			more := err == nil && collect(iter)
+			partitionH.Release()
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				break
+			}
+		}
+	}
+
+	if len(separators) <= n {
+		return separators, nil
+	}
+	// Pick n separators, evenly spaced.
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = separators[(i+1)*len(separators)/(n+1)]
+	}
+	return keys, nil
+}
+
 // NewReader returns a new table reader for the file. Closing the reader will
 // close the file.
 func NewReader(f vfs.File, o ReaderOptions, extraOpts ...ReaderOption) (*Reader, error) {
 	o = o.ensureDefaults()
 	r := &Reader{
-		file: f,
-		opts: o,
+		file:             f,
+		opts:             o,
+		readaheadMetrics: &dummyReadaheadMetrics,
 	}
 	if r.opts.Cache == nil {
 		r.opts.Cache = cache.New(0)
@@ -1849,6 +2149,7 @@ func NewReader(f vfs.File, o ReaderOptions, extraOpts ...ReaderOption) (*Reader,
 		r.err = err
 		return nil, r.Close()
 	}
+	r.checksumType = footer.checksum
 	// Read the metaindex.
 	if err := r.readMetaindex(footer.metaindexBH); err != nil {
 		r.err = err
@@ -1857,12 +2158,29 @@ func NewReader(f vfs.File, o ReaderOptions, extraOpts ...ReaderOption) (*Reader,
 	r.indexBH = footer.indexBH
 	r.metaIndexBH = footer.metaindexBH
 	r.footerBH = footer.footerBH
+	r.tableFormat = footer.format
 
 	if r.Properties.ComparerName == "" || o.Comparer.Name == r.Properties.ComparerName {
 		r.Compare = o.Comparer.Compare
 		r.Split = o.Comparer.Split
 	}
 
+	// Skipping tables by prefix assumes that the keys sharing a byte prefix
+	// are contiguous and bounded by the prefix's bytewise successor, which
+	// only holds for a bytewise ordering.
+	comparerName := r.Properties.ComparerName
+	if comparerName == "" {
+		comparerName = o.Comparer.Name
+	}
+	name := r.Properties.PrefixExtractorName
+	if name != "" && name != "nullptr" && comparerName == base.DefaultComparer.Name {
+		if e, ok := o.PrefixExtractors[name]; ok {
+			r.prefixExtractor = e
+		} else if e, ok := base.ParseFixedPrefixExtractor(name); ok {
+			r.prefixExtractor = e
+		}
+	}
+
 	if o.MergerName == r.Properties.MergerName {
 		r.mergerOK = true
 	}
@@ -1893,14 +2211,18 @@ func NewReader(f vfs.File, o ReaderOptions, extraOpts ...ReaderOption) (*Reader,
 
 // Layout describes the block organization of an sstable.
 type Layout struct {
-	Data       []BlockHandle
-	Index      []BlockHandle
-	TopIndex   BlockHandle
-	Filter     BlockHandle
-	RangeDel   BlockHandle
-	Properties BlockHandle
-	MetaIndex  BlockHandle
-	Footer     BlockHandle
+	Data     []BlockHandle
+	Index    []BlockHandle
+	TopIndex BlockHandle
+	Filter   BlockHandle
+	// FilterPartitions and TopFilter are populated in place of Filter for
+	// tables with a partitioned filter.
+	FilterPartitions []BlockHandle
+	TopFilter        BlockHandle
+	RangeDel         BlockHandle
+	Properties       BlockHandle
+	MetaIndex        BlockHandle
+	Footer           BlockHandle
 }
 
 // Describe returns a description of the layout. If the verbose parameter is
@@ -1926,6 +2248,12 @@ func (l *Layout) Describe(
 	if l.Filter.Length != 0 {
 		blocks = append(blocks, block{l.Filter, "filter"})
 	}
+	for i := range l.FilterPartitions {
+		blocks = append(blocks, block{l.FilterPartitions[i], "filter"})
+	}
+	if l.TopFilter.Length != 0 {
+		blocks = append(blocks, block{l.TopFilter, "top-filter"})
+	}
 	if l.RangeDel.Length != 0 {
 		blocks = append(blocks, block{l.RangeDel, "range-del"})
 	}
@@ -1988,6 +2316,32 @@ func (l *Layout) Describe(
 		}
 
 		var lastKey InternalKey
+		if b.name == "data" && r.tableFormat == TableFormatPebblev1 {
+			rows, prefixes, err := columnarBlockStats(h.Get())
+			if err != nil {
+				fmt.Fprintf(w, "%10d    [err: %s]\n", b.Offset, err)
+				h.Release()
+				continue
+			}
+			fmt.Fprintf(w, "%10d    columnar (%d rows, %d prefixes)\n", b.Offset, rows, prefixes)
+			err = decodeColumnarBlockRows(r.Compare, h.Get(), func(key *InternalKey, value []byte) {
+				if fmtRecord != nil {
+					fmt.Fprintf(w, "              ")
+					fmtRecord(key, value)
+				}
+				if base.InternalCompare(r.Compare, lastKey, *key) >= 0 {
+					fmt.Fprintf(w, "              WARNING: OUT OF ORDER KEYS!\n")
+				}
+				lastKey.Trailer = key.Trailer
+				lastKey.UserKey = append(lastKey.UserKey[:0], key.UserKey...)
+			})
+			if err != nil {
+				fmt.Fprintf(w, "%10d    [err: %s]\n", b.Offset, err)
+			}
+			h.Release()
+			continue
+		}
+
 		switch b.name {
 		case "data", "range-del":
 			iter, _ := newBlockIter(r.Compare, h.Get())
@@ -2024,7 +2378,11 @@ func (l *Layout) Describe(
 				lastKey.UserKey = append(lastKey.UserKey[:0], key.UserKey...)
 			}
 			formatRestarts(iter.data, iter.restarts, iter.numRestarts)
-		case "index", "top-index":
+			if len(iter.hashIndex) > 0 {
+				fmt.Fprintf(w, "%10d    [hash index %d buckets]\n",
+					b.Offset+uint64(iter.restarts+4*iter.numRestarts), len(iter.hashIndex))
+			}
+		case "index", "top-index", "top-filter":
 			iter, _ := newBlockIter(r.Compare, h.Get())
 			for key, value := iter.First(); key != nil; key, value = iter.Next() {
 				bh, n := decodeBlockHandle(value)
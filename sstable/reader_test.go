@@ -117,6 +117,18 @@ func TestReader(t *testing.T) {
 			FilterPolicy: bloom.FilterPolicy(100),
 			FilterType:   base.TableFilter,
 		},
+		"columnar": WriterOptions{
+			TableFormat: TableFormatPebblev1,
+		},
+		"hashIndex": WriterOptions{
+			DataBlockIndexType: DataBlockBinaryAndHash,
+			TableFormat:        TableFormatPebblev2,
+		},
+		"partitionedBloom10bit": WriterOptions{
+			FilterPolicy:     bloom.FilterPolicy(10),
+			FilterType:       base.TableFilter,
+			PartitionFilters: true,
+		},
 	}
 
 	blockSizes := map[string]int{
@@ -499,89 +511,258 @@ func TestMaybeReadahead(t *testing.T) {
 	})
 }
 
-func TestReaderChecksumErrors(t *testing.T) {
-	for _, twoLevelIndex := range []bool{false, true} {
-		t.Run(fmt.Sprintf("two-level-index=%t", twoLevelIndex), func(t *testing.T) {
-			mem := vfs.NewMem()
+func TestReaderPrefetch(t *testing.T) {
+	mem := vfs.NewMem()
+	build := func(indexBlockSize int) {
+		f, err := mem.Create("test")
+		require.NoError(t, err)
+		w := NewWriter(f, WriterOptions{
+			BlockSize:      100,
+			IndexBlockSize: indexBlockSize,
+		})
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, w.Set([]byte(fmt.Sprintf("%04d", i)), bytes.Repeat([]byte("x"), 50)))
+		}
+		require.NoError(t, w.Close())
+	}
+	open := func(m *ReadaheadMetrics) *Reader {
+		f, err := mem.Open("test")
+		require.NoError(t, err)
+		c := cache.New(128 << 20)
+		defer c.Unref()
+		r, err := NewReader(f, ReaderOptions{
+			Cache:           c,
+			ReadaheadBlocks: 8,
+		}, m, FileReopenOpt{FS: mem, Filename: "test"})
+		require.NoError(t, err)
+		return r
+	}
 
-			{
-				// Create an sstable with 3 data blocks.
-				f, err := mem.Create("test")
-				require.NoError(t, err)
+	for _, indexBlockSize := range []int{math.MaxInt32, 500} {
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			build(indexBlockSize)
 
-				const blockSize = 32
-				indexBlockSize := 4096
-				if twoLevelIndex {
-					indexBlockSize = 1
+			t.Run("forward", func(t *testing.T) {
+				var m ReadaheadMetrics
+				r := open(&m)
+				iter, err := r.NewIter(nil, nil)
+				require.NoError(t, err)
+				n := 0
+				for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+					n++
 				}
+				require.Equal(t, 1000, n)
+				require.NoError(t, iter.Close())
+				require.NoError(t, r.Close())
+				require.True(t, m.Count > 0)
+				require.Equal(t, m.Bytes, m.BytesUsed)
+				require.EqualValues(t, 0, m.BytesWasted)
+			})
 
-				w := NewWriter(f, WriterOptions{
-					BlockSize:      blockSize,
-					IndexBlockSize: indexBlockSize,
-				})
-				require.NoError(t, w.Set(bytes.Repeat([]byte("a"), blockSize), nil))
-				require.NoError(t, w.Set(bytes.Repeat([]byte("b"), blockSize), nil))
-				require.NoError(t, w.Set(bytes.Repeat([]byte("c"), blockSize), nil))
-				require.NoError(t, w.Close())
-			}
-
-			// Load the layout so that we no the location of the data blocks.
-			var layout *Layout
-			{
-				f, err := mem.Open("test")
+			t.Run("upper-bound", func(t *testing.T) {
+				var m ReadaheadMetrics
+				r := open(&m)
+				iter, err := r.NewIter(nil, []byte("0500"))
 				require.NoError(t, err)
+				n := 0
+				for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+					n++
+				}
+				require.Equal(t, 500, n)
+				require.NoError(t, iter.Close())
+				require.NoError(t, r.Close())
+				require.True(t, m.Count > 0)
+				require.Equal(t, m.Bytes, m.BytesUsed)
+				require.EqualValues(t, 0, m.BytesWasted)
+			})
 
-				r, err := NewReader(f, ReaderOptions{})
-				require.NoError(t, err)
-				layout, err = r.Layout()
+			t.Run("close-early", func(t *testing.T) {
+				var m ReadaheadMetrics
+				r := open(&m)
+				iter, err := r.NewIter(nil, nil)
 				require.NoError(t, err)
-				require.EqualValues(t, len(layout.Data), 3)
+				for key, _ := iter.First(); key != nil && m.Count == 0; key, _ = iter.Next() {
+				}
+				require.NoError(t, iter.Close())
 				require.NoError(t, r.Close())
-			}
+				require.True(t, m.Count > 0)
+				require.EqualValues(t, 0, m.BytesUsed)
+				require.Equal(t, m.Bytes, m.BytesWasted)
+			})
 
-			for _, bh := range layout.Data {
-				// Read the sstable and corrupt the first byte in the target data
-				// block.
-				orig, err := mem.Open("test")
-				require.NoError(t, err)
-				data, err := ioutil.ReadAll(orig)
+			t.Run("reverse", func(t *testing.T) {
+				var m ReadaheadMetrics
+				r := open(&m)
+				iter, err := r.NewIter(nil, nil)
 				require.NoError(t, err)
-				require.NoError(t, orig.Close())
+				for key, _ := iter.Last(); key != nil; key, _ = iter.Prev() {
+				}
+				require.NoError(t, iter.Close())
+				require.NoError(t, r.Close())
+				require.EqualValues(t, 0, m.Count)
+			})
+		})
+	}
+}
 
-				// Corrupt the first byte in the block.
-				data[bh.Offset] ^= 0xff
+func TestReaderEstimateSplitKeys(t *testing.T) {
+	for _, indexBlockSize := range []int{math.MaxInt32, 100} {
+		r := buildTestTable(t, 10000, 100, indexBlockSize, NoCompression)
+		key := func(i uint64) []byte {
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, i)
+			return k
+		}
+		for _, c := range []struct {
+			start, end []byte
+			n          int
+		}{
+			{nil, nil, 1},
+			{nil, nil, 7},
+			{key(1000), key(2000), 3},
+			{key(1000), key(1010), 100},
+		} {
+			keys, err := r.EstimateSplitKeys(c.start, c.end, c.n)
+			require.NoError(t, err)
+			require.True(t, len(keys) > 0 && len(keys) <= c.n)
+			for i, k := range keys {
+				require.True(t, c.start == nil || bytes.Compare(c.start, k) < 0)
+				require.True(t, c.end == nil || bytes.Compare(k, c.end) < 0)
+				require.True(t, i == 0 || bytes.Compare(keys[i-1], k) < 0)
+			}
+		}
+		require.NoError(t, r.Close())
+	}
+}
 
-				corrupted, err := mem.Create("corrupted")
-				require.NoError(t, err)
-				_, err = corrupted.Write(data)
-				require.NoError(t, err)
-				require.NoError(t, corrupted.Close())
+func TestReaderIterStats(t *testing.T) {
+	for _, indexBlockSize := range []int{math.MaxInt32, 100} {
+		r := buildTestTable(t, 1000, 100, indexBlockSize, NoCompression)
+		scan := func() base.InternalIteratorStats {
+			var stats base.InternalIteratorStats
+			iter, err := r.NewIter(nil, nil)
+			require.NoError(t, err)
+			iter.SetStats(&stats)
+			for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+			}
+			require.NoError(t, iter.Close())
+			return stats
+		}
 
-				// Verify that we encounter a checksum mismatch error while iterating
-				// over the sstable.
-				corrupted, err = mem.Open("corrupted")
-				require.NoError(t, err)
+		// The first scan reads every data block from disk, and the second finds
+		// them in the block cache.
+		stats := scan()
+		require.True(t, stats.BlocksLoaded > 1)
+		require.EqualValues(t, 0, stats.BlocksCached)
+		require.Equal(t, stats.BlockBytes, stats.BlockBytesRead)
+
+		cached := scan()
+		require.Equal(t, stats.BlocksLoaded, cached.BlocksLoaded)
+		require.Equal(t, stats.BlocksLoaded, cached.BlocksCached)
+		require.Equal(t, stats.BlockBytes, cached.BlockBytes)
+		require.EqualValues(t, 0, cached.BlockBytesRead)
+		require.NoError(t, r.Close())
+	}
+}
 
-				r, err := NewReader(corrupted, ReaderOptions{})
-				require.NoError(t, err)
+func TestReaderChecksumErrors(t *testing.T) {
+	for _, checksumType := range []ChecksumType{ChecksumTypeCRC32c, ChecksumTypeXXHash64} {
+		t.Run(fmt.Sprintf("checksum-type=%s", checksumType), func(t *testing.T) {
+			for _, twoLevelIndex := range []bool{false, true} {
+				t.Run(fmt.Sprintf("two-level-index=%t", twoLevelIndex), func(t *testing.T) {
+					testReaderChecksumErrors(t, checksumType, twoLevelIndex)
+				})
+			}
+		})
+	}
+}
 
-				iter, err := r.NewIter(nil, nil)
-				require.NoError(t, err)
-				for k, _ := iter.First(); k != nil; k, _ = iter.Next() {
-				}
-				require.Regexp(t, `checksum mismatch`, iter.Error())
-				require.Regexp(t, `checksum mismatch`, iter.Close())
+func testReaderChecksumErrors(t *testing.T, checksumType ChecksumType, twoLevelIndex bool) {
+	mem := vfs.NewMem()
 
-				iter, err = r.NewIter(nil, nil)
-				require.NoError(t, err)
-				for k, _ := iter.Last(); k != nil; k, _ = iter.Prev() {
-				}
-				require.Regexp(t, `checksum mismatch`, iter.Error())
-				require.Regexp(t, `checksum mismatch`, iter.Close())
+	{
+		// Create an sstable with 3 data blocks.
+		f, err := mem.Create("test")
+		require.NoError(t, err)
 
-				require.NoError(t, r.Close())
-			}
+		const blockSize = 32
+		indexBlockSize := 4096
+		if twoLevelIndex {
+			indexBlockSize = 1
+		}
+
+		w := NewWriter(f, WriterOptions{
+			BlockSize:      blockSize,
+			Checksum:       checksumType,
+			IndexBlockSize: indexBlockSize,
 		})
+		require.NoError(t, w.Set(bytes.Repeat([]byte("a"), blockSize), nil))
+		require.NoError(t, w.Set(bytes.Repeat([]byte("b"), blockSize), nil))
+		require.NoError(t, w.Set(bytes.Repeat([]byte("c"), blockSize), nil))
+		require.NoError(t, w.Close())
+	}
+
+	// Load the layout so that we no the location of the data blocks.
+	var layout *Layout
+	{
+		f, err := mem.Open("test")
+		require.NoError(t, err)
+
+		r, err := NewReader(f, ReaderOptions{})
+		require.NoError(t, err)
+		require.Equal(t, checksumType, r.checksumType)
+		require.NoError(t, r.ValidateBlockChecksums())
+		layout, err = r.Layout()
+		require.NoError(t, err)
+		require.EqualValues(t, len(layout.Data), 3)
+		require.NoError(t, r.Close())
+	}
+
+	for _, bh := range layout.Data {
+		// Read the sstable and corrupt the first byte in the target data
+		// block.
+		orig, err := mem.Open("test")
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(orig)
+		require.NoError(t, err)
+		require.NoError(t, orig.Close())
+
+		// Corrupt the first byte in the block.
+		data[bh.Offset] ^= 0xff
+
+		corrupted, err := mem.Create("corrupted")
+		require.NoError(t, err)
+		_, err = corrupted.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, corrupted.Close())
+
+		// Verify that we encounter a checksum mismatch error while iterating
+		// over the sstable.
+		corrupted, err = mem.Open("corrupted")
+		require.NoError(t, err)
+
+		r, err := NewReader(corrupted, ReaderOptions{})
+		require.NoError(t, err)
+
+		// Validating the block checksums identifies the corrupt block.
+		require.Regexp(t, fmt.Sprintf(`checksum mismatch at %d/%d`, bh.Offset, bh.Length),
+			r.ValidateBlockChecksums())
+
+		iter, err := r.NewIter(nil, nil)
+		require.NoError(t, err)
+		for k, _ := iter.First(); k != nil; k, _ = iter.Next() {
+		}
+		require.Regexp(t, `checksum mismatch`, iter.Error())
+		require.Regexp(t, `checksum mismatch`, iter.Close())
+
+		iter, err = r.NewIter(nil, nil)
+		require.NoError(t, err)
+		for k, _ := iter.Last(); k != nil; k, _ = iter.Prev() {
+		}
+		require.Regexp(t, `checksum mismatch`, iter.Error())
+		require.Regexp(t, `checksum mismatch`, iter.Close())
+
+		require.NoError(t, r.Close())
 	}
 }
 
@@ -623,7 +804,9 @@ func buildTestTable(
 	return r
 }
 
-func buildBenchmarkTable(b *testing.B, blockSize, restartInterval int) (*Reader, [][]byte) {
+func buildBenchmarkTable(
+	b *testing.B, blockSize, restartInterval, indexBlockSize int,
+) (*Reader, [][]byte) {
 	mem := vfs.NewMem()
 	f0, err := mem.Create("bench")
 	if err != nil {
@@ -633,6 +816,7 @@ func buildBenchmarkTable(b *testing.B, blockSize, restartInterval int) (*Reader,
 	w := NewWriter(f0, WriterOptions{
 		BlockRestartInterval: restartInterval,
 		BlockSize:            blockSize,
+		IndexBlockSize:       indexBlockSize,
 		FilterPolicy:         nil,
 	})
 
@@ -672,7 +856,7 @@ func BenchmarkTableIterSeekGE(b *testing.B) {
 	for _, restartInterval := range []int{16} {
 		b.Run(fmt.Sprintf("restart=%d", restartInterval),
 			func(b *testing.B) {
-				r, keys := buildBenchmarkTable(b, blockSize, restartInterval)
+				r, keys := buildBenchmarkTable(b, blockSize, restartInterval, math.MaxInt32)
 				it, err := r.NewIter(nil /* lower */, nil /* upper */)
 				require.NoError(b, err)
 				rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
@@ -695,7 +879,7 @@ func BenchmarkTableIterSeekLT(b *testing.B) {
 	for _, restartInterval := range []int{16} {
 		b.Run(fmt.Sprintf("restart=%d", restartInterval),
 			func(b *testing.B) {
-				r, keys := buildBenchmarkTable(b, blockSize, restartInterval)
+				r, keys := buildBenchmarkTable(b, blockSize, restartInterval, math.MaxInt32)
 				it, err := r.NewIter(nil /* lower */, nil /* upper */)
 				require.NoError(b, err)
 				rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
@@ -718,7 +902,7 @@ func BenchmarkTableIterNext(b *testing.B) {
 	for _, restartInterval := range []int{16} {
 		b.Run(fmt.Sprintf("restart=%d", restartInterval),
 			func(b *testing.B) {
-				r, _ := buildBenchmarkTable(b, blockSize, restartInterval)
+				r, _ := buildBenchmarkTable(b, blockSize, restartInterval, math.MaxInt32)
 				it, err := r.NewIter(nil /* lower */, nil /* upper */)
 				require.NoError(b, err)
 
@@ -749,7 +933,7 @@ func BenchmarkTableIterPrev(b *testing.B) {
 	for _, restartInterval := range []int{16} {
 		b.Run(fmt.Sprintf("restart=%d", restartInterval),
 			func(b *testing.B) {
-				r, _ := buildBenchmarkTable(b, blockSize, restartInterval)
+				r, _ := buildBenchmarkTable(b, blockSize, restartInterval, math.MaxInt32)
 				it, err := r.NewIter(nil /* lower */, nil /* upper */)
 				require.NoError(b, err)
 
@@ -773,3 +957,254 @@ func BenchmarkTableIterPrev(b *testing.B) {
 			})
 	}
 }
+
+// BenchmarkTableIterScan compares the throughput of full forward and reverse
+// scans of a table, with single-level and two-level indexes.
+func BenchmarkTableIterScan(b *testing.B) {
+	const blockSize = 4 << 10
+	const restartInterval = 16
+
+	for _, indexBlockSize := range []int{math.MaxInt32, 1 << 10} {
+		b.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(b *testing.B) {
+			r, keys := buildBenchmarkTable(b, blockSize, restartInterval, indexBlockSize)
+			defer r.Close()
+
+			for _, reverse := range []bool{false, true} {
+				b.Run(fmt.Sprintf("reverse=%t", reverse), func(b *testing.B) {
+					it, err := r.NewIter(nil /* lower */, nil /* upper */)
+					require.NoError(b, err)
+
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						n := 0
+						if reverse {
+							for key, _ := it.Last(); key != nil; key, _ = it.Prev() {
+								n++
+							}
+						} else {
+							for key, _ := it.First(); key != nil; key, _ = it.Next() {
+								n++
+							}
+						}
+						if n != len(keys) {
+							b.Fatalf("expected %d keys, but found %d", len(keys), n)
+						}
+					}
+
+					b.StopTimer()
+					it.Close()
+				})
+			}
+		})
+	}
+}
+
+func TestReaderPartitionedFilter(t *testing.T) {
+	comparer := *DefaultComparer
+	comparer.Split = testColumnarSplit
+	// Use the longest prefix of the following key as the separator (if it is
+	// no longer than the preceding key), so that seeks to keys greater than the
+	// last key of a partition locate that partition even though the following
+	// key, which may share their prefix, is in the next partition.
+	comparer.Separator = func(dst, a, b []byte) []byte {
+		for n := len(b) - 1; n > 0; n-- {
+			if n <= len(a) && bytes.Compare(a, b[:n]) < 0 {
+				return append(dst, b[:n]...)
+			}
+		}
+		return append(dst, a...)
+	}
+	extractor := FixedPrefixExtractor(3)
+
+	// Each prefix has a number of even versions, so that seeks to odd versions
+	// need to find the following version, which may be in the following
+	// partition.
+	var keys [][]byte
+	for i := 0; i < 2000; i++ {
+		for v := 2; v <= 2*(1+i%4); v += 2 {
+			keys = append(keys, []byte(fmt.Sprintf("%05d@%d", 2*i, v)))
+		}
+	}
+
+	build := func(partition bool) (*Reader, *FilterMetrics) {
+		mem := vfs.NewMem()
+		f, err := mem.Create("test")
+		require.NoError(t, err)
+		w := NewWriter(f, WriterOptions{
+			BlockSize:        256,
+			IndexBlockSize:   256,
+			Comparer:         &comparer,
+			FilterPolicy:     bloom.FilterPolicy(10),
+			PartitionFilters: partition,
+			PrefixExtractor:  extractor,
+		})
+		for _, k := range keys {
+			require.NoError(t, w.Set(k, k))
+		}
+		require.NoError(t, w.Close())
+
+		f, err = mem.Open("test")
+		require.NoError(t, err)
+		fp := bloom.FilterPolicy(10)
+		m := &FilterMetrics{}
+		r, err := NewReader(f, ReaderOptions{
+			Comparer: &comparer,
+			Filters:  map[string]FilterPolicy{fp.Name(): fp},
+		}, m)
+		require.NoError(t, err)
+		return r, m
+	}
+
+	for _, partition := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partition=%t", partition), func(t *testing.T) {
+			r, m := build(partition)
+			defer r.Close()
+			require.NotNil(t, r.tableFilter)
+			require.Equal(t, partition, r.tableFilter.partitioned)
+
+			l, err := r.Layout()
+			require.NoError(t, err)
+			if partition {
+				require.True(t, len(l.Index) > 1)
+				require.Equal(t, len(l.Index), len(l.FilterPartitions))
+				require.NotZero(t, l.TopFilter.Length)
+				require.Zero(t, l.Filter.Length)
+			} else {
+				require.Empty(t, l.FilterPartitions)
+				require.NotZero(t, l.Filter.Length)
+			}
+
+			iter, err := r.NewIter(nil, nil)
+			require.NoError(t, err)
+			for _, k := range keys {
+				prefix := k[:testColumnarSplit(k)]
+				key, _ := iter.SeekPrefixGE(prefix, k)
+				require.NotNil(t, key, "%s", k)
+				require.Equal(t, string(k), string(key.UserKey))
+
+				// Seeking to the preceding odd version, or to the prefix itself for
+				// the first version, must find the key, even if it is the first key
+				// in a partition.
+				seekKey := []byte(fmt.Sprintf("%s@%d", prefix, k[len(k)-1]-'0'-1))
+				if k[len(k)-1] == '2' {
+					seekKey = prefix
+				}
+				key, _ = iter.SeekPrefixGE(prefix, seekKey)
+				require.NotNil(t, key, "%s", seekKey)
+				require.Equal(t, string(k), string(key.UserKey))
+				mayContain, err := r.filterMayContain(prefix, seekKey)
+				require.NoError(t, err)
+				require.True(t, mayContain, "%s", seekKey)
+
+				mayMatch, err := r.PrefixMayMatch(k, []byte(fmt.Sprintf("%s%c", k[:2], k[2]+1)))
+				require.NoError(t, err)
+				require.True(t, mayMatch, "%s", k)
+			}
+			require.NoError(t, iter.Close())
+
+			// Keys which are not present are mostly ruled out by the filter.
+			hits := m.Hits
+			for i := 0; i < 2000; i++ {
+				k := []byte(fmt.Sprintf("%05d@2", 2*i+1))
+				_, err := r.get(k)
+				require.Equal(t, base.ErrNotFound, err)
+			}
+			require.True(t, m.Hits-hits > 1900, "filter hits: %d", m.Hits-hits)
+		})
+	}
+}
+
+func TestReaderPrefixMayMatch(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+
+	w := NewWriter(f, WriterOptions{
+		FilterPolicy:    bloom.FilterPolicy(10),
+		PrefixExtractor: FixedPrefixExtractor(3),
+	})
+	for _, k := range []string{"aaa1", "aaa2", "bbb1", "ccc"} {
+		require.NoError(t, w.Set([]byte(k), nil))
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	fp := bloom.FilterPolicy(10)
+	r, err := NewReader(f, ReaderOptions{
+		Filters: map[string]FilterPolicy{fp.Name(): fp},
+	})
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, "pebble.FixedPrefix.3", r.Properties.PrefixExtractorName)
+
+	testCases := []struct {
+		lower, upper string
+		expected     bool
+	}{
+		{"aaa", "aab", true},
+		{"aaa1", "aaa5", true},
+		{"bbb", "bbc", true},
+		{"ccc", "ccd", true},
+		{"ddd", "dde", false},
+		{"ddd1", "ddd9", false},
+		{"zz\xff", "z{", false},
+		// Bounds which do not share a prefix cannot use the filter.
+		{"ddd", "eee", true},
+		{"dd", "de", true},
+		{"ddd", "", true},
+	}
+	for _, c := range testCases {
+		var lower, upper []byte
+		if c.lower != "" {
+			lower = []byte(c.lower)
+		}
+		if c.upper != "" {
+			upper = []byte(c.upper)
+		}
+		mayMatch, err := r.PrefixMayMatch(lower, upper)
+		require.NoError(t, err)
+		require.Equal(t, c.expected, mayMatch, "[%q, %q)", c.lower, c.upper)
+	}
+
+	// The keys sharing a byte prefix need not be contiguous under a comparer
+	// other than the bytewise DefaultComparer, so its tables are never
+	// skipped. Under a shortlex ordering, [ddd1, ddd12) contains eee1.
+	shortlex := *base.DefaultComparer
+	shortlex.Name = "shortlex"
+	shortlex.Compare = func(a, b []byte) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return bytes.Compare(a, b)
+	}
+	shortlex.Separator = func(dst, a, b []byte) []byte {
+		return append(dst, a...)
+	}
+	shortlex.Successor = func(dst, a []byte) []byte {
+		return append(dst, a...)
+	}
+	f, err = mem.Create("shortlex")
+	require.NoError(t, err)
+	w = NewWriter(f, WriterOptions{
+		Comparer:        &shortlex,
+		FilterPolicy:    bloom.FilterPolicy(10),
+		PrefixExtractor: FixedPrefixExtractor(3),
+	})
+	for _, k := range []string{"ccc", "aaa1", "eee1"} {
+		require.NoError(t, w.Set([]byte(k), nil))
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("shortlex")
+	require.NoError(t, err)
+	r, err = NewReader(f, ReaderOptions{
+		Comparer: &shortlex,
+		Filters:  map[string]FilterPolicy{fp.Name(): fp},
+	})
+	require.NoError(t, err)
+	defer r.Close()
+	mayMatch, err := r.PrefixMayMatch([]byte("ddd1"), []byte("ddd12"))
+	require.NoError(t, err)
+	require.True(t, mayMatch)
+}
@@ -65,6 +65,8 @@ import (
 	"io"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/cockroachdb/pebble/internal/xxhash"
 	"github.com/cockroachdb/pebble/vfs"
 )
 
@@ -86,9 +88,10 @@ The table file format looks like:
 <end_of_file>
 
 Each block consists of some data and a 5 byte trailer: a 1 byte block type and
-a 4 byte checksum of the compressed data. The block type gives the per-block
-compression used; each block is compressed independently. The checksum
-algorithm is described in the pebble/crc package.
+a 4 byte checksum of the compressed data and the block type. The block type
+gives the per-block compression used; each block is compressed independently.
+The checksum algorithm is recorded in the footer and is either crc32c (as
+described in the pebble/crc package) or the lower 32 bits of xxHash64.
 
 The decompressed block data consists of a sequence of key/value entries
 followed by a trailer. Each key is encoded as a shared prefix length and a
@@ -134,6 +137,8 @@ const (
 	rocksDBMagicOffset   = rocksDBFooterLen - len(rocksDBMagic)
 	rocksDBVersionOffset = rocksDBMagicOffset - 4
 
+	pebbleDBMagic = "\xf0\x9f\xaa\xb3\xf0\x9f\xa6\x80"
+
 	rocksDBExternalFormatVersion = 2
 
 	minFooterLen = levelDBFooterLen
@@ -141,10 +146,8 @@ const (
 
 	levelDBFormatVersion  = 0
 	rocksDBFormatVersion2 = 2
-
-	noChecksum     = 0
-	checksumCRC32c = 1
-	checksumXXHash = 2
+	pebbleFormatVersion1  = 1
+	pebbleFormatVersion2  = 2
 
 	// The block type gives the per-block compression format.
 	// These constants are part of the file format and should not be changed.
@@ -186,9 +189,15 @@ const (
 //    <padding> to make the total size 2 * BlockHandle::kMaxEncodedLength + 1
 //    footer version (4 bytes)
 //    table_magic_number (8 bytes)
+// Pebble footer format:
+//    identical to the RocksDB footer format, but with the Pebble magic number
+//    and a Pebble specific footer version. Version 1 indicates that data blocks
+//    use the columnar layout (see columnar_block.go). Version 2 indicates that
+//    data blocks use the row layout, and may contain a hash index (see
+//    data_block_hash_index.go).
 type footer struct {
 	format      TableFormat
-	checksum    uint8
+	checksum    ChecksumType
 	metaindexBH BlockHandle
 	indexBH     BlockHandle
 	footerBH    BlockHandle
@@ -224,9 +233,9 @@ func readFooter(f vfs.File) (footer, error) {
 		buf = buf[len(buf)-levelDBFooterLen:]
 		footer.footerBH.Length = uint64(len(buf))
 		footer.format = TableFormatLevelDB
-		footer.checksum = checksumCRC32c
+		footer.checksum = ChecksumTypeCRC32c
 
-	case rocksDBMagic:
+	case rocksDBMagic, pebbleDBMagic:
 		if len(buf) < rocksDBFooterLen {
 			return footer, errors.Errorf("pebble/table: invalid table (footer too short): %d", errors.Safe(len(buf)))
 		}
@@ -234,12 +243,18 @@ func readFooter(f vfs.File) (footer, error) {
 		buf = buf[len(buf)-rocksDBFooterLen:]
 		footer.footerBH.Length = uint64(len(buf))
 		version := binary.LittleEndian.Uint32(buf[rocksDBVersionOffset:rocksDBMagicOffset])
-		if version != rocksDBFormatVersion2 {
+		switch magic := string(buf[rocksDBMagicOffset:]); {
+		case magic == rocksDBMagic && version == rocksDBFormatVersion2:
+			footer.format = TableFormatRocksDBv2
+		case magic == pebbleDBMagic && version == pebbleFormatVersion1:
+			footer.format = TableFormatPebblev1
+		case magic == pebbleDBMagic && version == pebbleFormatVersion2:
+			footer.format = TableFormatPebblev2
+		default:
 			return footer, errors.Errorf("pebble/table: unsupported format version %d", errors.Safe(version))
 		}
-		footer.format = TableFormatRocksDBv2
-		footer.checksum = uint8(buf[0])
-		if footer.checksum != checksumCRC32c {
+		footer.checksum = ChecksumType(buf[0])
+		if footer.checksum != ChecksumTypeCRC32c && footer.checksum != ChecksumTypeXXHash64 {
 			return footer, errors.Errorf("pebble/table: unsupported checksum type %d", errors.Safe(footer.checksum))
 		}
 		buf = buf[1:]
@@ -276,17 +291,26 @@ func (f footer) encode(buf []byte) []byte {
 		n += encodeBlockHandle(buf[n:], f.indexBH)
 		copy(buf[len(buf)-len(levelDBMagic):], levelDBMagic)
 
-	case TableFormatRocksDBv2:
+	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2:
 		buf = buf[:rocksDBFooterLen]
 		for i := range buf {
 			buf[i] = 0
 		}
-		buf[0] = f.checksum
+		buf[0] = byte(f.checksum)
 		n := 1
 		n += encodeBlockHandle(buf[n:], f.metaindexBH)
 		n += encodeBlockHandle(buf[n:], f.indexBH)
-		binary.LittleEndian.PutUint32(buf[rocksDBVersionOffset:], rocksDBFormatVersion2)
-		copy(buf[len(buf)-len(rocksDBMagic):], rocksDBMagic)
+		switch f.format {
+		case TableFormatPebblev1:
+			binary.LittleEndian.PutUint32(buf[rocksDBVersionOffset:], pebbleFormatVersion1)
+			copy(buf[len(buf)-len(pebbleDBMagic):], pebbleDBMagic)
+		case TableFormatPebblev2:
+			binary.LittleEndian.PutUint32(buf[rocksDBVersionOffset:], pebbleFormatVersion2)
+			copy(buf[len(buf)-len(pebbleDBMagic):], pebbleDBMagic)
+		default:
+			binary.LittleEndian.PutUint32(buf[rocksDBVersionOffset:], rocksDBFormatVersion2)
+			copy(buf[len(buf)-len(rocksDBMagic):], rocksDBMagic)
+		}
 	}
 
 	return buf
@@ -296,8 +320,22 @@ func supportsTwoLevelIndex(format TableFormat) bool {
 	switch format {
 	case TableFormatLevelDB:
 		return false
-	case TableFormatRocksDBv2:
+	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2:
 		return true
 	}
 	return true
 }
+
+// blockChecksum returns the checksum of the specified type of the block data
+// b followed by the block type byte.
+func blockChecksum(checksumType ChecksumType, b []byte, blockType []byte) uint32 {
+	switch checksumType {
+	case ChecksumTypeXXHash64:
+		var d xxhash.Digest
+		_, _ = d.Write(b)
+		_, _ = d.Write(blockType)
+		return uint32(d.Sum64())
+	default:
+		return crc.New(b).Update(blockType).Value()
+	}
+}
@@ -720,10 +720,16 @@ func TestFooterRoundTrip(t *testing.T) {
 	for _, format := range []TableFormat{
 		TableFormatRocksDBv2,
 		TableFormatLevelDB,
+		TableFormatPebblev1,
+		TableFormatPebblev2,
 	} {
 		t.Run(fmt.Sprintf("format=%d", format), func(t *testing.T) {
-			for _, checksum := range []uint8{checksumCRC32c} {
-				t.Run(fmt.Sprintf("checksum=%d", checksum), func(t *testing.T) {
+			checksums := []ChecksumType{ChecksumTypeCRC32c}
+			if format != TableFormatLevelDB {
+				checksums = append(checksums, ChecksumTypeXXHash64)
+			}
+			for _, checksum := range checksums {
+				t.Run(fmt.Sprintf("checksum=%s", checksum), func(t *testing.T) {
 					footer := footer{
 						format:      format,
 						checksum:    checksum,
@@ -767,13 +773,20 @@ func TestFooterRoundTrip(t *testing.T) {
 }
 
 func TestReadFooter(t *testing.T) {
-	encode := func(format TableFormat, checksum uint8) string {
+	encode := func(format TableFormat, checksum ChecksumType) string {
 		f := footer{
 			format:   format,
 			checksum: checksum,
 		}
 		return string(f.encode(make([]byte, maxFooterLen)))
 	}
+	// withVersion replaces the footer version of an encoded footer, simulating
+	// a table written in a format version unknown to this reader.
+	withVersion := func(encoded string, version uint32) string {
+		b := []byte(encoded)
+		binary.LittleEndian.PutUint32(b[rocksDBVersionOffset:], version)
+		return string(b)
+	}
 
 	testCases := []struct {
 		encoded  string
@@ -784,8 +797,10 @@ func TestReadFooter(t *testing.T) {
 		{strings.Repeat("a", rocksDBFooterLen), "bad magic number"},
 		{encode(TableFormatLevelDB, 0)[1:], "file size is too small"},
 		{encode(TableFormatRocksDBv2, 0)[1:], "footer too short"},
-		{encode(TableFormatRocksDBv2, noChecksum), "unsupported checksum type"},
-		{encode(TableFormatRocksDBv2, checksumXXHash), "unsupported checksum type"},
+		{encode(TableFormatRocksDBv2, ChecksumTypeNone), "unsupported checksum type"},
+		{encode(TableFormatRocksDBv2, ChecksumTypeXXHash), "unsupported checksum type"},
+		{withVersion(encode(TableFormatRocksDBv2, ChecksumTypeCRC32c), pebbleFormatVersion1), "unsupported format version 1"},
+		{withVersion(encode(TableFormatPebblev2, ChecksumTypeCRC32c), 3), "unsupported format version 3"},
 	}
 	for _, c := range testCases {
 		t.Run("", func(t *testing.T) {
@@ -15,7 +15,6 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
-	"github.com/cockroachdb/pebble/internal/crc"
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/internal/rangedel"
 	"github.com/golang/snappy"
@@ -104,6 +103,7 @@ type Writer struct {
 	separator               Separator
 	successor               Successor
 	tableFormat             TableFormat
+	checksumType            ChecksumType
 	cache                   *cache.Cache
 	// disableKeyOrderChecks disables the checks that keys are added to an
 	// sstable in order. It is intended for internal use only in the construction
@@ -130,18 +130,27 @@ type Writer struct {
 	// format blocks.
 	rangeDelV1Format bool
 	block            blockWriter
-	indexBlock       blockWriter
-	rangeDelBlock    blockWriter
-	props            Properties
-	propCollectors   []TablePropertyCollector
+	// colBlock is used in place of block to build columnar data blocks when
+	// the table format is TableFormatPebblev1.
+	colBlock       *columnarBlockWriter
+	indexBlock     blockWriter
+	rangeDelBlock  blockWriter
+	props          Properties
+	propCollectors []TablePropertyCollector
 	// compressedBuf is the destination buffer for snappy compression. It is
 	// re-used over the lifetime of the writer, avoiding the allocation of a
 	// temporary buffer for each block.
 	compressedBuf []byte
 	// filter accumulates the filter block. If populated, the filter ingests
 	// either the output of w.split (i.e. a prefix extractor) if w.split is not
-	// nil, or the full keys otherwise.
-	filter filterWriter
+	// nil, or the full keys otherwise. If prefixExtractor is not nil, the
+	// extracted prefixes are added as well.
+	filter          filterWriter
+	prefixExtractor PrefixExtractor
+	// lastPrefix is the last prefix extracted by prefixExtractor and added to
+	// the filter. Consecutive keys frequently share a prefix, so tracking it
+	// avoids adding the same prefix repeatedly.
+	lastPrefix []byte
 	// tmp is a scratch buffer, large enough to hold either footerLen bytes,
 	// blockTrailerLen bytes, or (5 * binary.MaxVarintLen64) bytes.
 	tmp [rocksDBFooterLen]byte
@@ -241,14 +250,21 @@ func (w *Writer) addPoint(key InternalKey, value []byte) error {
 	}
 
 	w.maybeAddToFilter(key.UserKey)
-	w.block.add(key, value)
+	var curKey []byte
+	if w.colBlock != nil {
+		w.colBlock.add(key, value)
+		curKey = w.colBlock.curKey
+	} else {
+		w.block.add(key, value)
+		curKey = w.block.curKey
+	}
 
 	w.meta.updateSeqNum(key.SeqNum())
 	if w.props.NumEntries == 0 {
 		w.meta.SmallestPoint = key.Clone()
 	}
-	// block.curKey contains the most recently added key to the block.
-	w.meta.LargestPoint.UserKey = w.block.curKey[:len(w.block.curKey)-8]
+	// curKey contains the most recently added key to the block.
+	w.meta.LargestPoint.UserKey = curKey[:len(curKey)-8]
 	w.meta.LargestPoint.Trailer = key.Trailer
 
 	w.props.NumEntries++
@@ -334,15 +350,26 @@ func (w *Writer) maybeAddToFilter(key []byte) {
 		} else {
 			w.filter.addKey(key)
 		}
+		if w.prefixExtractor != nil {
+			if prefix, ok := w.prefixExtractor.Prefix(key); ok && (w.lastPrefix == nil ||
+				!bytes.Equal(prefix, w.lastPrefix)) {
+				w.filter.addKey(prefix)
+				w.lastPrefix = append(w.lastPrefix[:0], prefix...)
+			}
+		}
 	}
 }
 
 func (w *Writer) maybeFlush(key InternalKey, value []byte) error {
-	if !shouldFlush(key, value, &w.block, w.blockSize, w.blockSizeThreshold) {
+	if w.colBlock != nil {
+		if !w.colBlock.shouldFlush(key, value, w.blockSize, w.blockSizeThreshold) {
+			return nil
+		}
+	} else if !shouldFlush(key, value, &w.block, w.blockSize, w.blockSizeThreshold) {
 		return nil
 	}
 
-	bh, err := w.writeBlock(w.block.finish(), w.compression)
+	bh, err := w.writeBlock(w.finishDataBlock(), w.compression)
 	if err != nil {
 		w.err = err
 		return w.err
@@ -351,6 +378,14 @@ func (w *Writer) maybeFlush(key InternalKey, value []byte) error {
 	return nil
 }
 
+// finishDataBlock finishes the current data block, returning its contents.
+func (w *Writer) finishDataBlock() []byte {
+	if w.colBlock != nil {
+		return w.colBlock.finish()
+	}
+	return w.block.finish()
+}
+
 // addIndexEntry adds an index entry for the specified key and block handle.
 func (w *Writer) addIndexEntry(key InternalKey, bh BlockHandle) {
 	if bh.Length == 0 {
@@ -358,7 +393,11 @@ func (w *Writer) addIndexEntry(key InternalKey, bh BlockHandle) {
 		// In particular, it must have a non-zero length.
 		return
 	}
-	prevKey := base.DecodeInternalKey(w.block.curKey)
+	curKey := w.block.curKey
+	if w.colBlock != nil {
+		curKey = w.colBlock.curKey
+	}
+	prevKey := base.DecodeInternalKey(curKey)
 	var sep InternalKey
 	if key.UserKey == nil && key.Trailer == 0 {
 		sep = prevKey.Successor(w.compare, w.successor, nil)
@@ -367,13 +406,21 @@ func (w *Writer) addIndexEntry(key InternalKey, bh BlockHandle) {
 	}
 	n := encodeBlockHandle(w.tmp[:], bh)
 
-	if supportsTwoLevelIndex(w.tableFormat) &&
-		shouldFlush(sep, w.tmp[:n], &w.indexBlock, w.indexBlockSize, w.indexBlockSizeThreshold) {
+	newPartition := supportsTwoLevelIndex(w.tableFormat) &&
+		shouldFlush(sep, w.tmp[:n], &w.indexBlock, w.indexBlockSize, w.indexBlockSizeThreshold)
+	if newPartition {
 		// Enable two level indexes if there is more than one index block.
 		w.twoLevelIndex = true
 		w.finishIndexBlock()
 	}
 
+	if pf, ok := w.filter.(*partitionedFilterWriter); ok {
+		pf.finishDataBlock(newPartition)
+		// The prefix of the first key of every data block is added to the
+		// filter so that the block's filter partition contains it.
+		w.lastPrefix = nil
+	}
+
 	w.indexBlock.add(sep, w.tmp[:n])
 }
 
@@ -451,7 +498,7 @@ func (w *Writer) writeBlock(b []byte, compression Compression) (BlockHandle, err
 		// least 12.5%.
 		compressed := snappy.Encode(w.compressedBuf, b)
 		w.compressedBuf = compressed[:cap(compressed)]
-		if len(compressed) < len(b)-len(b)/8 {
+		if compressionWorthwhile(len(b), len(compressed)) {
 			blockType = snappyCompressionBlockType
 			b = compressed
 		}
@@ -459,7 +506,7 @@ func (w *Writer) writeBlock(b []byte, compression Compression) (BlockHandle, err
 	w.tmp[0] = blockType
 
 	// Calculate the checksum.
-	checksum := crc.New(b).Update(w.tmp[:1]).Value()
+	checksum := blockChecksum(w.checksumType, b, w.tmp[:1])
 	binary.LittleEndian.PutUint32(w.tmp[1:5], checksum)
 	bh := BlockHandle{w.meta.Size, uint64(len(b))}
 
@@ -487,6 +534,37 @@ func (w *Writer) writeBlock(b []byte, compression Compression) (BlockHandle, err
 	return bh, nil
 }
 
+// writePartitionedFilter writes the filter partitions followed by the
+// top-level filter index, returning the handle of the latter. The separator of
+// each filter partition is the separator of the corresponding index
+// partition.
+func (w *Writer) writePartitionedFilter(pf *partitionedFilterWriter) (BlockHandle, error) {
+	partitions := pf.finishPartitions()
+	if len(partitions) != len(w.indexPartitions)+1 {
+		return BlockHandle{}, errors.Errorf(
+			"pebble: %d filter partitions do not match %d index partitions",
+			errors.Safe(len(partitions)), errors.Safe(len(w.indexPartitions)+1))
+	}
+	topLevelFilterBlock := blockWriter{restartInterval: 1}
+	for i, data := range partitions {
+		b := &w.indexBlock
+		if i < len(w.indexPartitions) {
+			b = &w.indexPartitions[i]
+		}
+		sep := base.DecodeInternalKey(b.curKey)
+		bh, err := w.writeBlock(data, NoCompression)
+		if err != nil {
+			return BlockHandle{}, err
+		}
+		w.props.FilterSize += bh.Length
+		n := encodeBlockHandle(w.tmp[:], bh)
+		topLevelFilterBlock.add(sep, w.tmp[:n])
+	}
+	bh, err := w.writeBlock(topLevelFilterBlock.finish(), NoCompression)
+	w.props.FilterSize += bh.Length
+	return bh, err
+}
+
 // Close finishes writing the table and closes the underlying file that the
 // table was written to.
 func (w *Writer) Close() (err error) {
@@ -506,8 +584,12 @@ func (w *Writer) Close() (err error) {
 
 	// Finish the last data block, or force an empty data block if there
 	// aren't any data blocks at all.
-	if w.block.nEntries > 0 || w.indexBlock.nEntries == 0 {
-		bh, err := w.writeBlock(w.block.finish(), w.compression)
+	nEntries := w.block.nEntries
+	if w.colBlock != nil {
+		nEntries = w.colBlock.nEntries
+	}
+	if nEntries > 0 || w.indexBlock.nEntries == 0 {
+		bh, err := w.writeBlock(w.finishDataBlock(), w.compression)
 		if err != nil {
 			w.err = err
 			return w.err
@@ -520,12 +602,17 @@ func (w *Writer) Close() (err error) {
 	var metaindex rawBlockWriter
 	metaindex.restartInterval = 1
 	if w.filter != nil {
-		b, err := w.filter.finish()
-		if err != nil {
-			w.err = err
-			return w.err
+		var bh BlockHandle
+		if pf, ok := w.filter.(*partitionedFilterWriter); ok && pf.partitioned() {
+			bh, err = w.writePartitionedFilter(pf)
+		} else {
+			var b []byte
+			b, err = w.filter.finish()
+			if err == nil {
+				bh, err = w.writeBlock(b, NoCompression)
+				w.props.FilterSize = bh.Length
+			}
 		}
-		bh, err := w.writeBlock(b, NoCompression)
 		if err != nil {
 			w.err = err
 			return w.err
@@ -533,7 +620,6 @@ func (w *Writer) Close() (err error) {
 		n := encodeBlockHandle(w.tmp[:], bh)
 		metaindex.add(InternalKey{UserKey: []byte(w.filter.metaName())}, w.tmp[:n])
 		w.props.FilterPolicyName = w.filter.policyName()
-		w.props.FilterSize = bh.Length
 	}
 
 	var indexBH BlockHandle
@@ -644,7 +730,7 @@ func (w *Writer) Close() (err error) {
 	// Write the table footer.
 	footer := footer{
 		format:      w.tableFormat,
-		checksum:    checksumCRC32c,
+		checksum:    w.checksumType,
 		metaindexBH: metaindexBH,
 		indexBH:     indexBH,
 	}
@@ -677,7 +763,11 @@ func (w *Writer) Close() (err error) {
 // EstimatedSize returns the estimated size of the sstable being written if a
 // called to Finish() was made without adding additional keys.
 func (w *Writer) EstimatedSize() uint64 {
-	return w.meta.Size + uint64(w.block.estimatedSize()+w.indexBlock.estimatedSize())
+	blockSize := w.block.estimatedSize()
+	if w.colBlock != nil {
+		blockSize = w.colBlock.estimatedSize()
+	}
+	return w.meta.Size + uint64(blockSize+w.indexBlock.estimatedSize())
 }
 
 // Metadata returns the metadata for the finished sstable. Only valid to call
@@ -728,6 +818,7 @@ func NewWriter(f writeCloseSyncer, o WriterOptions, extraOpts ...WriterOption) *
 		separator:               o.Comparer.Separator,
 		successor:               o.Comparer.Successor,
 		tableFormat:             o.TableFormat,
+		checksumType:            o.Checksum,
 		cache:                   o.Cache,
 		block: blockWriter{
 			restartInterval: o.BlockRestartInterval,
@@ -742,6 +833,12 @@ func NewWriter(f writeCloseSyncer, o WriterOptions, extraOpts ...WriterOption) *
 			restartInterval: 1,
 		},
 	}
+	if o.TableFormat == TableFormatPebblev1 {
+		w.colBlock = &columnarBlockWriter{split: o.Comparer.Split}
+	} else if o.TableFormat == TableFormatPebblev2 && o.DataBlockIndexType == DataBlockBinaryAndHash {
+		w.block.hashIndex = newDataBlockHashIndexBuilder(o.Comparer.Split, o.DataBlockHashUtilRatio)
+		w.props.DataBlockIndexType = uint32(DataBlockBinaryAndHash)
+	}
 	if f == nil {
 		w.err = errors.New("pebble: nil file")
 		return w
@@ -761,13 +858,22 @@ func NewWriter(f writeCloseSyncer, o WriterOptions, extraOpts ...WriterOption) *
 	if o.FilterPolicy != nil {
 		switch o.FilterType {
 		case TableFilter:
-			w.filter = newTableFilterWriter(o.FilterPolicy)
+			if o.PartitionFilters && supportsTwoLevelIndex(o.TableFormat) {
+				w.filter = newPartitionedFilterWriter(o.FilterPolicy)
+			} else {
+				w.filter = newTableFilterWriter(o.FilterPolicy)
+			}
 			if w.split != nil {
 				w.props.PrefixExtractorName = o.Comparer.Name
 				w.props.PrefixFiltering = true
 			} else {
 				w.props.WholeKeyFiltering = true
 			}
+			if o.PrefixExtractor != nil {
+				w.prefixExtractor = o.PrefixExtractor
+				w.props.PrefixExtractorName = o.PrefixExtractor.Name()
+				w.props.PrefixFiltering = true
+			}
 		default:
 			panic(fmt.Sprintf("unknown filter type: %v", o.FilterType))
 		}
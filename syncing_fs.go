@@ -7,10 +7,13 @@ package pebble
 import "github.com/cockroachdb/pebble/vfs"
 
 // syncingFS wraps a vfs.FS with one that wraps newly created files with
-// vfs.NewSyncingFile.
+// vfs.NewSyncingFile. If limiter is non-nil, writes to newly created files are
+// additionally subject to the write bandwidth limit at the given priority.
 type syncingFS struct {
 	vfs.FS
 	syncOpts vfs.SyncingFileOptions
+	limiter  *writeLimiter
+	priority writePriority
 }
 
 func (fs syncingFS) Create(name string) (vfs.File, error) {
@@ -18,5 +21,5 @@ func (fs syncingFS) Create(name string) (vfs.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	return vfs.NewSyncingFile(f, fs.syncOpts), nil
+	return newLimitedFile(vfs.NewSyncingFile(f, fs.syncOpts), fs.limiter, fs.priority), nil
 }
@@ -29,9 +29,10 @@ var emptyIter = &errorIter{err: nil}
 var tableCacheLabels = pprof.Labels("pebble", "table-cache")
 
 type tableCache struct {
-	cache         *Cache
-	shards        []tableCacheShard
-	filterMetrics FilterMetrics
+	cache            *Cache
+	shards           []tableCacheShard
+	filterMetrics    FilterMetrics
+	readaheadMetrics ReadaheadMetrics
 }
 
 func (c *tableCache) init(cacheID uint64, dirname string, fs vfs.FS, opts *Options, size int) {
@@ -42,6 +43,7 @@ func (c *tableCache) init(cacheID uint64, dirname string, fs vfs.FS, opts *Optio
 	for i := range c.shards {
 		c.shards[i].init(cacheID, dirname, fs, opts, size/len(c.shards))
 		c.shards[i].filterMetrics = &c.filterMetrics
+		c.shards[i].readaheadMetrics = &c.readaheadMetrics
 	}
 }
 
@@ -59,7 +61,7 @@ func (c *tableCache) evict(fileNum FileNum) {
 	c.getShard(fileNum).evict(fileNum)
 }
 
-func (c *tableCache) metrics() (CacheMetrics, FilterMetrics) {
+func (c *tableCache) metrics() (CacheMetrics, FilterMetrics, ReadaheadMetrics) {
 	var m CacheMetrics
 	for i := range c.shards {
 		s := &c.shards[i]
@@ -74,7 +76,13 @@ func (c *tableCache) metrics() (CacheMetrics, FilterMetrics) {
 		Hits:   atomic.LoadInt64(&c.filterMetrics.Hits),
 		Misses: atomic.LoadInt64(&c.filterMetrics.Misses),
 	}
-	return m, f
+	r := ReadaheadMetrics{
+		Count:       atomic.LoadInt64(&c.readaheadMetrics.Count),
+		Bytes:       atomic.LoadInt64(&c.readaheadMetrics.Bytes),
+		BytesUsed:   atomic.LoadInt64(&c.readaheadMetrics.BytesUsed),
+		BytesWasted: atomic.LoadInt64(&c.readaheadMetrics.BytesWasted),
+	}
+	return m, f, r
 }
 
 func (c *tableCache) withReader(meta *fileMetadata, fn func(*sstable.Reader) error) error {
@@ -128,12 +136,13 @@ type tableCacheShard struct {
 		sizeTest   int
 	}
 
-	hits          int64
-	misses        int64
-	iterCount     int32
-	releasing     sync.WaitGroup
-	releasingCh   chan *tableCacheValue
-	filterMetrics *FilterMetrics
+	hits             int64
+	misses           int64
+	iterCount        int32
+	releasing        sync.WaitGroup
+	releasingCh      chan *tableCacheValue
+	filterMetrics    *FilterMetrics
+	readaheadMetrics *ReadaheadMetrics
 }
 
 func (c *tableCacheShard) init(cacheID uint64, dirname string, fs vfs.FS, opts *Options, size int) {
@@ -184,6 +193,28 @@ func (c *tableCacheShard) newIters(
 		return emptyIter, nil, nil
 	}
 
+	if bytesIterated == nil {
+		// If the iteration bounds share a common prefix which the table's filter
+		// rules out, there is no need to iterate over the table's point keys. The
+		// table's range deletions may still apply to keys in other tables.
+		mayMatch, err := v.reader.PrefixMayMatch(opts.GetLowerBound(), opts.GetUpperBound())
+		if err != nil {
+			c.unrefValue(v)
+			return nil, nil, err
+		}
+		if !mayMatch {
+			rangeDelIter, err := v.reader.NewRawRangeDelIter()
+			c.unrefValue(v)
+			if err != nil {
+				return nil, nil, err
+			}
+			if rangeDelIter != nil {
+				return emptyIter, rangeDelIter, nil
+			}
+			return emptyIter, nil, nil
+		}
+	}
+
 	var iter sstable.Iterator
 	var err error
 	if bytesIterated != nil {
@@ -197,6 +228,9 @@ func (c *tableCacheShard) newIters(
 	}
 	// NB: v.closeHook takes responsibility for calling unrefValue(v) here.
 	iter.SetCloseHook(v.closeHook)
+	if opts != nil {
+		iter.SetStats(opts.stats)
+	}
 
 	atomic.AddInt32(&c.iterCount, 1)
 	if invariants.RaceEnabled {
@@ -562,7 +596,7 @@ func (v *tableCacheValue) load(meta *fileMetadata, c *tableCacheShard) {
 	if v.err == nil {
 		cacheOpts := private.SSTableCacheOpts(c.cacheID, meta.FileNum).(sstable.ReaderOption)
 		reopenOpt := sstable.FileReopenOpt{FS: c.fs, Filename: filename}
-		v.reader, v.err = sstable.NewReader(f, c.opts, cacheOpts, c.filterMetrics, reopenOpt)
+		v.reader, v.err = sstable.NewReader(f, c.opts, cacheOpts, c.filterMetrics, c.readaheadMetrics, reopenOpt)
 	}
 	if v.err == nil {
 		if meta.SmallestSeqNum == meta.LargestSeqNum {
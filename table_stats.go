@@ -250,7 +250,10 @@ func (d *DB) loadTableStats(
 ) (manifest.TableStats, []deleteCompactionHint, error) {
 	var totalRangeDeletionEstimate uint64
 	var compactionHints []deleteCompactionHint
+	var numEntries, numDeletions uint64
 	err := d.tableCache.withReader(meta, func(r *sstable.Reader) (err error) {
+		numEntries = r.Properties.NumEntries
+		numDeletions = r.Properties.NumDeletions
 		if r.Properties.NumRangeDeletions == 0 {
 			return nil
 		}
@@ -303,6 +306,8 @@ func (d *DB) loadTableStats(
 		return stats, nil, err
 	}
 	stats.Valid = true
+	stats.NumEntries = numEntries
+	stats.NumDeletions = numDeletions
 	stats.RangeDeletionsBytesEstimate = totalRangeDeletionEstimate
 	return stats, compactionHints, nil
 }
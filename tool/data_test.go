@@ -7,6 +7,7 @@ package tool
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -50,7 +51,14 @@ func runTests(t *testing.T, path string) {
 				for _, arg := range d.CmdArgs {
 					args = append(args, arg.String())
 				}
-				args = append(args, strings.Fields(d.Input)...)
+				// The shell reads its commands from stdin, while the other
+				// commands take the input as additional arguments.
+				input := io.Reader(strings.NewReader(""))
+				if len(args) > 1 && args[1] == "shell" {
+					input = strings.NewReader(d.Input)
+				} else {
+					args = append(args, strings.Fields(d.Input)...)
+				}
 
 				// The testdata files contain paths with "/" path separators, but we
 				// might be running on a sytem with a different path separator
@@ -68,6 +76,7 @@ func runTests(t *testing.T, path string) {
 				}
 
 				var buf bytes.Buffer
+				stdin = input
 				stdout = &buf
 				stderr = &buf
 				osExit = func(int) {}
@@ -76,6 +85,7 @@ func runTests(t *testing.T, path string) {
 				timeNow = func() time.Time { secs++; return time.Unix(secs, 0) }
 
 				defer func() {
+					stdin = os.Stdin
 					stdout = os.Stdout
 					stderr = os.Stderr
 					osExit = os.Exit
@@ -25,12 +25,19 @@ import (
 // dbT implements db-level tools, including both configuration state and the
 // commands themselves.
 type dbT struct {
-	Root       *cobra.Command
-	Check      *cobra.Command
-	LSM        *cobra.Command
-	Properties *cobra.Command
-	Scan       *cobra.Command
-	Space      *cobra.Command
+	Root        *cobra.Command
+	AnalyzeData *cobra.Command
+	Check       *cobra.Command
+	Dump        *cobra.Command
+	Export      *cobra.Command
+	Import      *cobra.Command
+	Load        *cobra.Command
+	LSM         *cobra.Command
+	Properties  *cobra.Command
+	Repair      *cobra.Command
+	Scan        *cobra.Command
+	Shell       *cobra.Command
+	Space       *cobra.Command
 
 	// Configuration.
 	opts      *pebble.Options
@@ -45,7 +52,20 @@ type dbT struct {
 	start        key
 	end          key
 	count        int64
+	readOnly     bool
+	checkpoint   string
+	dumpFormat   string
 	verbose      bool
+	analyze      struct {
+		samples          int
+		blockSizes       []int
+		restartIntervals []int
+		seed             int64
+	}
+	export struct {
+		targetFileSize int64
+		rangeDels      bool
+	}
 }
 
 func newDB(opts *pebble.Options, comparers sstable.Comparers, mergers sstable.Mergers) *dbT {
@@ -61,6 +81,20 @@ func newDB(opts *pebble.Options, comparers sstable.Comparers, mergers sstable.Me
 		Use:   "db",
 		Short: "DB introspection tools",
 	}
+	d.AnalyzeData = &cobra.Command{
+		Use:   "analyze-data <dir>",
+		Short: "analyze data block compression and block size settings",
+		Long: `
+Sample data blocks across the LSM and re-encode them under every supported
+compression and each combination of --block-sizes and --restart-intervals,
+printing CSV with the compression ratio, compression and decompression time,
+and the estimated on-disk size of each level's data. The estimate scales the
+current size of the level by the ratio of re-encoded to sampled data block
+size. Requires that the specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runAnalyzeData,
+	}
 	d.Check = &cobra.Command{
 		Use:   "check <dir>",
 		Short: "verify checksums and metadata",
@@ -71,6 +105,58 @@ database not be in use by another process.
 		Args: cobra.ExactArgs(1),
 		Run:  d.runCheck,
 	}
+	d.Dump = &cobra.Command{
+		Use:   "dump <dir> <file>",
+		Short: "dump db records to a portable stream",
+		Long: `
+Write the records in the range specified by --start and --end, as of a
+consistent snapshot, to a checksummed stream in the format specified by
+--format ("binary" or "text"). A file of "-" writes the stream to stdout. With
+--verbose, each record is also printed using the --key and --value formatters.
+Requires that the specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  d.runDump,
+	}
+	d.Export = &cobra.Command{
+		Use:   "export <dir> <export-dir>",
+		Short: "export a key range as ingestible sstables",
+		Long: `
+Write the records in the range specified by --start and --end, as of a
+consistent snapshot, to sstables in the export directory suitable for ingestion
+with "db import". An interrupted export is resumed by running the command again
+with the same range and export directory. Requires that the specified database
+not be in use by another process.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  d.runExport,
+	}
+	d.Import = &cobra.Command{
+		Use:   "import <dir> <export-dir>",
+		Short: "ingest the sstables written by export",
+		Long: `
+Ingest the sstables written to the export directory by "db export". The
+sstables are ingested one at a time and removed from the export directory once
+ingested, so an interrupted import is resumed by running the command again.
+Requires that the specified database not be in use by another process.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  d.runImport,
+	}
+	d.Load = &cobra.Command{
+		Use:   "load <dir> <file>",
+		Short: "load db records from a dump stream",
+		Long: `
+Load the records from a stream written by "db dump" into the DB, creating the
+DB if it does not exist. The records are written to sorted sstables which are
+ingested, rather than being applied as individual writes. A file of "-" reads
+the stream from stdin. The key range loaded is printed using the --key
+formatter. Requires that the specified database not be in use by another
+process.
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  d.runLoad,
+	}
 	d.LSM = &cobra.Command{
 		Use:   "lsm <dir>",
 		Short: "print LSM structure",
@@ -90,6 +176,19 @@ Print SSTable properties, aggregated per level of the LSM.
 		Args: cobra.ExactArgs(1),
 		Run:  d.runProperties,
 	}
+	d.Repair = &cobra.Command{
+		Use:   "repair <dir>",
+		Short: "rebuild the MANIFEST and salvage WALs",
+		Long: `
+Rebuild the MANIFEST from the sstables present in the directory and salvage the
+readable records from damaged WALs. Unreadable files are moved to the
+quarantine subdirectory, and the key ranges and WAL regions which were lost are
+reported. Requires that the specified database not be in use by another
+process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runRepair,
+	}
 	d.Scan = &cobra.Command{
 		Use:   "scan <dir>",
 		Short: "print db records",
@@ -100,6 +199,20 @@ by another process.
 		Args: cobra.ExactArgs(1),
 		Run:  d.runScan,
 	}
+	d.Shell = &cobra.Command{
+		Use:   "shell <dir>",
+		Short: "interactive DB shell",
+		Long: `
+Open the DB once and read commands from stdin to get, scan and iterate over
+records, write batches, print the LSM structure and metrics, and trigger
+flushes and compactions. Use --read-only to disallow writes, or --checkpoint to
+operate on a checkpoint of the DB so that writes do not affect the original.
+Type "help" for a list of commands. Requires that the specified database not be in use by
+another process.
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  d.runShell,
+	}
 	d.Space = &cobra.Command{
 		Use:   "space <dir>",
 		Short: "print filesystem space used",
@@ -112,29 +225,58 @@ use by another process.
 		Run:  d.runSpace,
 	}
 
-	d.Root.AddCommand(d.Check, d.LSM, d.Properties, d.Scan, d.Space)
+	d.Root.AddCommand(d.AnalyzeData, d.Check, d.Dump, d.Export, d.Import, d.Load, d.LSM, d.Properties, d.Repair, d.Scan, d.Shell, d.Space)
 	d.Root.PersistentFlags().BoolVarP(&d.verbose, "verbose", "v", false, "verbose output")
 
-	for _, cmd := range []*cobra.Command{d.Check, d.LSM, d.Properties, d.Scan, d.Space} {
+	for _, cmd := range []*cobra.Command{d.AnalyzeData, d.Check, d.Dump, d.Export, d.Import, d.Load, d.LSM, d.Properties, d.Repair, d.Scan, d.Shell, d.Space} {
 		cmd.Flags().StringVar(
 			&d.comparerName, "comparer", "", "comparer name (use default if empty)")
 		cmd.Flags().StringVar(
 			&d.mergerName, "merger", "", "merger name (use default if empty)")
 	}
 
-	for _, cmd := range []*cobra.Command{d.Scan, d.Space} {
+	for _, cmd := range []*cobra.Command{d.Dump, d.Export, d.Scan, d.Space} {
 		cmd.Flags().Var(
 			&d.start, "start", "start key for the range")
 		cmd.Flags().Var(
 			&d.end, "end", "end key for the range")
 	}
 
-	d.Scan.Flags().Var(
-		&d.fmtKey, "key", "key formatter")
-	d.Scan.Flags().Var(
-		&d.fmtValue, "value", "value formatter")
-	d.Scan.Flags().Int64Var(
-		&d.count, "count", 0, "key count for scan (0 is unlimited)")
+	for _, cmd := range []*cobra.Command{d.Dump, d.Load, d.Scan, d.Shell} {
+		cmd.Flags().Var(
+			&d.fmtKey, "key", "key formatter")
+		cmd.Flags().Var(
+			&d.fmtValue, "value", "value formatter")
+	}
+	for _, cmd := range []*cobra.Command{d.Scan, d.Shell} {
+		cmd.Flags().Int64Var(
+			&d.count, "count", 0, "key count for scan (0 is unlimited)")
+	}
+
+	d.AnalyzeData.Flags().IntVar(
+		&d.analyze.samples, "samples", 16, "number of block samples per level")
+	d.AnalyzeData.Flags().IntSliceVar(
+		&d.analyze.blockSizes, "block-sizes", []int{4 << 10, 8 << 10, 16 << 10, 32 << 10, 64 << 10},
+		"data block sizes to evaluate")
+	d.AnalyzeData.Flags().IntSliceVar(
+		&d.analyze.restartIntervals, "restart-intervals", []int{8, 16, 32},
+		"block restart intervals to evaluate")
+	d.AnalyzeData.Flags().Int64Var(
+		&d.analyze.seed, "seed", 0, "random seed for sampling (0 uses the current time)")
+
+	d.Dump.Flags().StringVar(
+		&d.dumpFormat, "format", "binary", "dump stream format (binary or text)")
+
+	d.Export.Flags().Int64Var(
+		&d.export.targetFileSize, "target-file-size", 64<<20, "target size of the exported sstables")
+	d.Export.Flags().BoolVar(
+		&d.export.rangeDels, "range-dels", false,
+		"add range deletions spanning the exported range so that ingestion replaces the range")
+
+	d.Shell.Flags().BoolVar(
+		&d.readOnly, "read-only", false, "open the DB in read-only mode")
+	d.Shell.Flags().StringVar(
+		&d.checkpoint, "checkpoint", "", "checkpoint the DB to this directory and open the checkpoint")
 	return d
 }
 
@@ -209,28 +351,52 @@ func (d *dbT) loadOptions(dir string) error {
 	return nil
 }
 
-func (d *dbT) openDB(dir string) (*pebble.DB, error) {
+func (d *dbT) setOptions(dir string) error {
 	if err := d.loadOptions(dir); err != nil {
-		return nil, err
+		return err
 	}
 	if d.comparerName != "" {
 		d.opts.Comparer = d.comparers[d.comparerName]
 		if d.opts.Comparer == nil {
-			return nil, errors.Errorf("unknown comparer %q", errors.Safe(d.comparerName))
+			return errors.Errorf("unknown comparer %q", errors.Safe(d.comparerName))
 		}
 	}
 	if d.mergerName != "" {
 		d.opts.Merger = d.mergers[d.mergerName]
 		if d.opts.Merger == nil {
-			return nil, errors.Errorf("unknown merger %q", errors.Safe(d.mergerName))
+			return errors.Errorf("unknown merger %q", errors.Safe(d.mergerName))
 		}
 	}
+	return nil
+}
+
+func (d *dbT) openDB(dir string) (*pebble.DB, error) {
+	if err := d.setOptions(dir); err != nil {
+		return nil, err
+	}
 	opts := *d.opts
 	opts.Cache = pebble.NewCache(128 << 20 /* 128 MB */)
 	defer opts.Cache.Unref()
 	return pebble.Open(dir, &opts)
 }
 
+// openWritableDB opens the DB for writing, creating it if it does not exist,
+// and returns it along with the options it was opened with.
+func (d *dbT) openWritableDB(dir string) (*pebble.DB, *pebble.Options, error) {
+	if err := d.setOptions(dir); err != nil {
+		return nil, nil, err
+	}
+	opts := *d.opts
+	opts.ReadOnly = false
+	opts.Cache = pebble.NewCache(128 << 20 /* 128 MB */)
+	defer opts.Cache.Unref()
+	db, err := pebble.Open(dir, &opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, &opts, nil
+}
+
 func (d *dbT) closeDB(db *pebble.DB) {
 	if err := db.Close(); err != nil {
 		fmt.Fprintf(stdout, "%s\n", err)
@@ -264,6 +430,19 @@ func (d *dbT) runLSM(cmd *cobra.Command, args []string) {
 	fmt.Fprintf(stdout, "%s", db.Metrics())
 }
 
+func (d *dbT) runRepair(cmd *cobra.Command, args []string) {
+	if err := d.setOptions(args[0]); err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	report, err := pebble.Repair(args[0], d.opts)
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(stdout, "%s", report)
+}
+
 func (d *dbT) runScan(cmd *cobra.Command, args []string) {
 	db, err := d.openDB(args[0])
 	if err != nil {
@@ -0,0 +1,241 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/spf13/cobra"
+)
+
+// analyzeConfig is a combination of data block settings evaluated by
+// analyze-data.
+type analyzeConfig struct {
+	compression     sstable.Compression
+	blockSize       int
+	restartInterval int
+}
+
+// analyzeStats accumulates the result of re-encoding the sampled data blocks
+// of a level with an analyzeConfig.
+type analyzeStats struct {
+	// blocks is the number of blocks produced by re-encoding the samples.
+	blocks int
+	// uncompressedBytes and compressedBytes are the sizes of the re-encoded
+	// blocks before and after compression. Blocks which do not compress well
+	// enough are stored uncompressed, as they would be by a Writer.
+	uncompressedBytes uint64
+	compressedBytes   uint64
+	compressSeconds   float64
+	decompressSeconds float64
+}
+
+// analyzeSample holds the records of a run of consecutive data blocks.
+type analyzeSample struct {
+	keys   []sstable.InternalKey
+	values [][]byte
+	// size is the on-disk size of the sampled blocks.
+	size uint64
+}
+
+func (d *dbT) runAnalyzeData(cmd *cobra.Command, args []string) {
+	db, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	defer d.closeDB(db)
+
+	var configs []analyzeConfig
+	for c := sstable.NoCompression; c < sstable.NCompression; c++ {
+		for _, blockSize := range d.analyze.blockSizes {
+			for _, restartInterval := range d.analyze.restartIntervals {
+				configs = append(configs, analyzeConfig{c, blockSize, restartInterval})
+			}
+		}
+	}
+	// Each sample covers at least the largest block size so that the samples
+	// can fill blocks of every evaluated size.
+	var sampleSize uint64
+	for _, c := range configs {
+		if uint64(c.blockSize) > sampleSize {
+			sampleSize = uint64(c.blockSize)
+		}
+	}
+
+	seed := d.analyze.seed
+	if seed == 0 {
+		seed = timeNow().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	w := csv.NewWriter(stdout)
+	_ = w.Write([]string{
+		"level", "compression", "block_size", "restart_interval", "samples",
+		"sampled_bytes", "blocks", "uncompressed_bytes", "compressed_bytes",
+		"compression_ratio", "compress_seconds", "decompress_seconds",
+		"level_size", "estimated_level_size",
+	})
+	for level, tables := range db.SSTables() {
+		if len(tables) == 0 {
+			continue
+		}
+		samples, err := d.sampleLevel(args[0], tables, rng, sampleSize)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s\n", err)
+			return
+		}
+		var levelSize, sampledBytes uint64
+		for i := range tables {
+			levelSize += tables[i].Size
+		}
+		for i := range samples {
+			sampledBytes += samples[i].size
+		}
+
+		for _, c := range configs {
+			stats := analyzeSamples(c, samples)
+			var ratio float64
+			var estimate uint64
+			if stats.compressedBytes > 0 {
+				ratio = float64(stats.uncompressedBytes) / float64(stats.compressedBytes)
+			}
+			if sampledBytes > 0 {
+				estimate = uint64(float64(levelSize) * float64(stats.compressedBytes) / float64(sampledBytes))
+			}
+			_ = w.Write([]string{
+				strconv.Itoa(level),
+				c.compression.String(),
+				strconv.Itoa(c.blockSize),
+				strconv.Itoa(c.restartInterval),
+				strconv.Itoa(len(samples)),
+				strconv.FormatUint(sampledBytes, 10),
+				strconv.Itoa(stats.blocks),
+				strconv.FormatUint(stats.uncompressedBytes, 10),
+				strconv.FormatUint(stats.compressedBytes, 10),
+				strconv.FormatFloat(ratio, 'f', 3, 64),
+				strconv.FormatFloat(stats.compressSeconds, 'f', 6, 64),
+				strconv.FormatFloat(stats.decompressSeconds, 'f', 6, 64),
+				strconv.FormatUint(levelSize, 10),
+				strconv.FormatUint(estimate, 10),
+			})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+	}
+}
+
+// sampleLevel reads d.analyze.samples runs of consecutive data blocks from the
+// tables of a level. Each run starts at a random data block of a table chosen
+// with probability proportional to its size, and extends until the run
+// decodes to at least sampleSize bytes or reaches the end of the table.
+func (d *dbT) sampleLevel(
+	dir string, tables []pebble.TableInfo, rng *rand.Rand, sampleSize uint64,
+) ([]analyzeSample, error) {
+	cumulative := make([]uint64, len(tables))
+	var total uint64
+	for i := range tables {
+		total += tables[i].Size
+		cumulative[i] = total
+	}
+
+	readers := make(map[int]*sstable.Reader)
+	layouts := make(map[int]*sstable.Layout)
+	defer func() {
+		for _, r := range readers {
+			_ = r.Close()
+		}
+	}()
+
+	var samples []analyzeSample
+	for len(samples) < d.analyze.samples && total > 0 {
+		offset := uint64(rng.Int63n(int64(total)))
+		i := sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > offset })
+		r, ok := readers[i]
+		if !ok {
+			path := base.MakeFilename(d.opts.FS, dir, base.FileTypeTable, tables[i].FileNum)
+			f, err := d.opts.FS.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			r, err = sstable.NewReader(f, sstable.ReaderOptions{}, d.mergers, d.comparers)
+			if err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+			readers[i] = r
+			if layouts[i], err = r.Layout(); err != nil {
+				return nil, err
+			}
+		}
+		layout := layouts[i]
+		if len(layout.Data) == 0 {
+			// A table holding only range deletions has no data blocks.
+			samples = append(samples, analyzeSample{})
+			continue
+		}
+
+		var s analyzeSample
+		var decoded uint64
+		for j := rng.Intn(len(layout.Data)); j < len(layout.Data) && decoded < sampleSize; j++ {
+			bh := layout.Data[j]
+			s.size += bh.Length
+			err := r.DataBlockRecords(bh, func(key *sstable.InternalKey, value []byte) {
+				s.keys = append(s.keys, key.Clone())
+				s.values = append(s.values, append([]byte(nil), value...))
+				decoded += uint64(key.Size() + len(value))
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// analyzeSamples re-encodes and compresses the samples with the specified
+// configuration, timing compression and decompression with timeNow.
+func analyzeSamples(c analyzeConfig, samples []analyzeSample) analyzeStats {
+	var stats analyzeStats
+	var compressBuf, decompressBuf []byte
+	rw := sstable.NewDataBlockRewriter(c.blockSize, c.restartInterval)
+	for i := range samples {
+		s := &samples[i]
+		for j := range s.keys {
+			rw.Add(s.keys[j], s.values[j])
+		}
+		for _, b := range rw.Finish() {
+			stats.blocks++
+			stats.uncompressedBytes += uint64(len(b))
+
+			start := timeNow()
+			compressed, ok := sstable.CompressBlock(c.compression, compressBuf, b)
+			stats.compressSeconds += timeNow().Sub(start).Seconds()
+			stats.compressedBytes += uint64(len(compressed))
+			if !ok {
+				continue
+			}
+			compressBuf = compressed
+
+			start = timeNow()
+			decompressed, err := sstable.DecompressBlock(c.compression, decompressBuf, compressed)
+			stats.decompressSeconds += timeNow().Sub(start).Seconds()
+			if err == nil {
+				decompressBuf = decompressed
+			}
+		}
+	}
+	return stats
+}
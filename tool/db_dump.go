@@ -0,0 +1,147 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/dump"
+	"github.com/spf13/cobra"
+)
+
+// dumpTempDir is the directory within the DB directory in which db load
+// builds sstables before ingesting them.
+const dumpTempDir = "load-tmp"
+
+func (d *dbT) runDump(cmd *cobra.Command, args []string) {
+	format, err := dump.ParseFormat(d.dumpFormat)
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	db, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	defer d.closeDB(db)
+
+	// Update the internal formatter if this comparator has one specified.
+	if d.opts.Comparer != nil {
+		d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+		d.fmtValue.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+
+	// Messages go to stderr when the stream is written to stdout.
+	out, msgs := io.Writer(nil), stdout
+	if args[1] == "-" {
+		out, msgs = stdout, stderr
+	} else {
+		f, err := d.opts.FS.Create(args[1])
+		if err != nil {
+			fmt.Fprintf(stdout, "%s\n", err)
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+
+	comparerName := pebble.DefaultComparer.Name
+	if d.opts.Comparer != nil {
+		comparerName = d.opts.Comparer.Name
+	}
+	w, err := dump.NewWriter(out, format, comparerName)
+	if err != nil {
+		fmt.Fprintf(msgs, "%s\n", err)
+		return
+	}
+
+	var start, end []byte
+	if len(d.start) > 0 {
+		start = d.start
+	}
+	if len(d.end) > 0 {
+		end = d.end
+	}
+	// The records are written from a snapshot, as dump.Dump would, so that
+	// they can also be printed with the formatters in verbose mode.
+	snap := db.NewSnapshot()
+	defer snap.Close()
+	iter := snap.NewIter(&pebble.IterOptions{LowerBound: start, UpperBound: end})
+	for valid := iter.First(); valid && err == nil; valid = iter.Next() {
+		if d.verbose {
+			fmt.Fprintf(msgs, "%s %s\n", d.fmtKey.fn(iter.Key()), d.fmtValue.fn(iter.Key(), iter.Value()))
+		}
+		err = w.Add(iter.Key(), iter.Value())
+	}
+	if err1 := iter.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(msgs, "%s\n", err)
+		return
+	}
+	fmt.Fprintf(msgs, "dumped %d %s\n", w.Count(), makePlural("record", int64(w.Count())))
+}
+
+func (d *dbT) runLoad(cmd *cobra.Command, args []string) {
+	in := stdin
+	if args[1] != "-" {
+		f, err := d.opts.FS.Open(args[1])
+		if err != nil {
+			fmt.Fprintf(stdout, "%s\n", err)
+			return
+		}
+		defer f.Close()
+		in = f
+	}
+	r, err := dump.NewReader(in)
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+
+	db, opts, err := d.openWritableDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	defer d.closeDB(db)
+
+	n, err := dump.Load(db, opts, r, dump.LoadOptions{
+		TempDir: d.opts.FS.PathJoin(args[0], dumpTempDir),
+		Progress: func(records uint64) {
+			if d.verbose {
+				fmt.Fprintf(stdout, "ingested sstable: %d %s loaded\n", records, makePlural("record", int64(records)))
+			}
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+
+	// Summarize the loaded key range using the key formatter.
+	if d.opts.Comparer != nil {
+		d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+	iter := db.NewIter(nil)
+	if iter.First() {
+		first := append([]byte(nil), iter.Key()...)
+		iter.Last()
+		fmt.Fprintf(stdout, "loaded %d %s: [%s, %s]\n", n, makePlural("record", int64(n)),
+			d.fmtKey.fn(first), d.fmtKey.fn(iter.Key()))
+	} else {
+		fmt.Fprintf(stdout, "loaded %d %s\n", n, makePlural("record", int64(n)))
+	}
+	if err := iter.Close(); err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+	}
+}
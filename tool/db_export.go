@@ -0,0 +1,85 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/spf13/cobra"
+)
+
+func (d *dbT) runExport(cmd *cobra.Command, args []string) {
+	db, err := d.openDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	defer d.closeDB(db)
+
+	var start, end []byte
+	if len(d.start) > 0 {
+		start = d.start
+	}
+	if len(d.end) > 0 {
+		end = d.end
+	}
+	files, err := db.Export(start, end, args[1], d.export.targetFileSize, &pebble.ExportOptions{
+		IncludeRangeDeletions: d.export.rangeDels,
+		Progress: func(f pebble.ExportedFile) {
+			fmt.Fprintf(stdout, "exported %s: %d %s, %s\n", d.opts.FS.PathBase(f.Path),
+				f.Keys, makePlural("key", int64(f.Keys)), humanize.IEC.Uint64(f.Size))
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	var keys int64
+	for i := range files {
+		keys += int64(files[i].Keys)
+	}
+	fmt.Fprintf(stdout, "export complete: %d %s in %d %s\n",
+		keys, makePlural("key", keys), len(files), makePlural("file", int64(len(files))))
+}
+
+func (d *dbT) runImport(cmd *cobra.Command, args []string) {
+	files, done, err := pebble.ReadExport(d.opts.FS, args[1])
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	if !done {
+		fmt.Fprintf(stdout, "export in %s is incomplete\n", args[1])
+		return
+	}
+
+	db, _, err := d.openWritableDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+	defer d.closeDB(db)
+
+	// The files are ingested one at a time. Ingestion removes each file once
+	// it has been ingested, so an interrupted import can be resumed by running
+	// it again.
+	var ingested int64
+	for _, f := range files {
+		name := d.opts.FS.PathBase(f.Path)
+		if _, err := d.opts.FS.Stat(f.Path); err != nil {
+			fmt.Fprintf(stdout, "skipped %s: already ingested\n", name)
+			continue
+		}
+		if err := db.Ingest([]string{f.Path}); err != nil {
+			fmt.Fprintf(stdout, "%s: %s\n", name, err)
+			return
+		}
+		ingested++
+		fmt.Fprintf(stdout, "ingested %s: %d %s\n", name, f.Keys, makePlural("key", int64(f.Keys)))
+	}
+	fmt.Fprintf(stdout, "import complete: ingested %d %s\n", ingested, makePlural("file", ingested))
+}
@@ -0,0 +1,447 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+)
+
+const shellHelp = `commands:
+  get <key>                 print the value of key
+  scan [<start> [<end>]]    print the records in [start, end)
+  first | last              position the iterator at the first or last record
+  seek-ge <key>             position the iterator at the first record >= key
+  seek-lt <key>             position the iterator at the last record < key
+  next | prev               step the iterator
+  batch                     start a batch
+  put <key> <value>         add a set operation to the batch
+  delete <key>              add a delete operation to the batch
+  commit | abort            commit or discard the batch
+  lsm                       print a per-level summary of the LSM
+  files [<level>]           list the sstables in each level (or one level)
+  metrics                   print the DB metrics
+  flush                     flush the memtable
+  compact [<start> <end>]   compact the range [start, end] (default: everything)
+  help                      print this message
+  quit | exit               close the DB and exit
+`
+
+// dbShell holds the state of an interactive shell session.
+type dbShell struct {
+	d     *dbT
+	db    *pebble.DB
+	iter  *pebble.Iterator
+	batch *pebble.Batch
+}
+
+func (d *dbT) openShellDB(dir string) (*pebble.DB, error) {
+	if err := d.setOptions(dir); err != nil {
+		return nil, err
+	}
+	opts := *d.opts
+	opts.Cache = pebble.NewCache(128 << 20 /* 128 MB */)
+	defer opts.Cache.Unref()
+	opts.ReadOnly = d.readOnly
+	opts.ErrorIfNotExists = true
+
+	if d.checkpoint != "" {
+		// Open a checkpoint of the DB in its place so that the session does not
+		// affect the original DB.
+		if err := checkpointDB(opts.FS, dir, opts.WALDir, d.checkpoint); err != nil {
+			return nil, err
+		}
+		dir = d.checkpoint
+		// The WAL files are copied into the checkpoint directory.
+		opts.WALDir = ""
+	}
+	return pebble.Open(dir, &opts)
+}
+
+// checkpointDB creates a checkpoint of the DB in dir in the directory
+// destDir. Unlike DB.Checkpoint, it does not open the DB, which would replay
+// and flush the WAL and write a new MANIFEST and OPTIONS file, modifying the
+// DB. The DB is locked while its files are copied. The sstables are linked
+// where possible, as they are never modified, while the other files are
+// copied. Obsolete files are included, and are deleted when the checkpoint is
+// opened.
+func checkpointDB(fs vfs.FS, dir, walDir, destDir string) (err error) {
+	if _, err := fs.Stat(base.MakeFilename(fs, dir, base.FileTypeCurrent, 0)); err != nil {
+		return errors.Wrapf(err, "pebble: database %q", dir)
+	}
+	if _, err := fs.Stat(destDir); !os.IsNotExist(err) {
+		if err == nil {
+			return &os.PathError{Op: "checkpoint", Path: destDir, Err: os.ErrExist}
+		}
+		return err
+	}
+	lock, err := fs.Lock(base.MakeFilename(fs, dir, base.FileTypeLock, 0))
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := fs.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = fs.RemoveAll(destDir)
+		}
+	}()
+
+	// copyFiles copies the files of the specified types in srcDir to destDir.
+	copyFiles := func(srcDir string, types ...base.FileType) error {
+		ls, err := fs.List(srcDir)
+		if err != nil {
+			return err
+		}
+		for _, name := range ls {
+			ft, _, ok := base.ParseFilename(fs, name)
+			if !ok {
+				continue
+			}
+			for _, t := range types {
+				if ft != t {
+					continue
+				}
+				src, dest := fs.PathJoin(srcDir, name), fs.PathJoin(destDir, name)
+				if ft == base.FileTypeTable {
+					err = vfs.LinkOrCopy(fs, src, dest)
+				} else {
+					err = vfs.Copy(fs, src, dest)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	types := []base.FileType{
+		base.FileTypeCurrent, base.FileTypeManifest, base.FileTypeOptions, base.FileTypeTable,
+	}
+	if walDir == "" || walDir == dir {
+		types = append(types, base.FileTypeLog)
+	} else if err := copyFiles(walDir, base.FileTypeLog); err != nil {
+		return err
+	}
+	return copyFiles(dir, types...)
+}
+
+func (d *dbT) runShell(cmd *cobra.Command, args []string) {
+	db, err := d.openShellDB(args[0])
+	if err != nil {
+		fmt.Fprintf(stdout, "%s\n", err)
+		return
+	}
+
+	// Update the internal formatter if this comparator has one specified.
+	if d.opts.Comparer != nil {
+		d.fmtKey.setForComparer(d.opts.Comparer.Name, d.comparers)
+		d.fmtValue.setForComparer(d.opts.Comparer.Name, d.comparers)
+	}
+
+	s := &dbShell{d: d, db: db}
+	defer s.close()
+
+	// Only prompt when reading commands from a terminal.
+	prompt := false
+	if f, ok := stdin.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			prompt = true
+		}
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	for {
+		if prompt {
+			fmt.Fprintf(stdout, "pebble> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			break
+		}
+		if err := s.exec(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(stdout, "%s\n", err)
+		}
+	}
+}
+
+func (s *dbShell) close() {
+	if s.iter != nil {
+		_ = s.iter.Close()
+	}
+	if s.batch != nil {
+		_ = s.batch.Close()
+	}
+	s.d.closeDB(s.db)
+}
+
+// resetIter closes the shell's iterator so that a subsequent iterator
+// positioning command observes the effect of a write.
+func (s *dbShell) resetIter() error {
+	if s.iter == nil {
+		return nil
+	}
+	err := s.iter.Close()
+	s.iter = nil
+	return err
+}
+
+func parseShellKeys(args []string, min, max int) ([][]byte, error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return nil, errors.Errorf("expected %d %s", errors.Safe(min), makePlural("argument", int64(min)))
+		}
+		return nil, errors.Errorf("expected %d to %d arguments", errors.Safe(min), errors.Safe(max))
+	}
+	keys := make([][]byte, len(args))
+	for i := range args {
+		var k key
+		if err := k.Set(args[i]); err != nil {
+			return nil, err
+		}
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+func (s *dbShell) printRecord(k, v []byte) {
+	var fields []string
+	if s.d.fmtKey.spec != "null" {
+		fields = append(fields, fmt.Sprint(s.d.fmtKey.fn(k)))
+	}
+	if s.d.fmtValue.spec != "null" {
+		fields = append(fields, fmt.Sprint(s.d.fmtValue.fn(k, v)))
+	}
+	fmt.Fprintf(stdout, "%s\n", strings.Join(fields, " "))
+}
+
+func (s *dbShell) printIter(valid bool) error {
+	if !valid {
+		fmt.Fprintf(stdout, ".\n")
+		return s.iter.Error()
+	}
+	s.printRecord(s.iter.Key(), s.iter.Value())
+	return nil
+}
+
+func (s *dbShell) exec(cmd string, args []string) error {
+	switch cmd {
+	case "help":
+		fmt.Fprint(stdout, shellHelp)
+
+	case "get":
+		keys, err := parseShellKeys(args, 1, 1)
+		if err != nil {
+			return err
+		}
+		v, closer, err := s.db.Get(keys[0])
+		if err != nil {
+			return err
+		}
+		s.printRecord(keys[0], v)
+		return closer.Close()
+
+	case "scan":
+		keys, err := parseShellKeys(args, 0, 2)
+		if err != nil {
+			return err
+		}
+		var opts pebble.IterOptions
+		if len(keys) > 0 {
+			opts.LowerBound = keys[0]
+		}
+		if len(keys) > 1 {
+			opts.UpperBound = keys[1]
+		}
+		iter := s.db.NewIter(&opts)
+		var count int64
+		for valid := iter.First(); valid; valid = iter.Next() {
+			s.printRecord(iter.Key(), iter.Value())
+			count++
+			if s.d.count > 0 && count >= s.d.count {
+				break
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "scanned %d %s\n", count, makePlural("record", count))
+
+	case "first", "last", "next", "prev", "seek-ge", "seek-lt":
+		n := 0
+		if cmd == "seek-ge" || cmd == "seek-lt" {
+			n = 1
+		}
+		keys, err := parseShellKeys(args, n, n)
+		if err != nil {
+			return err
+		}
+		if s.iter == nil {
+			if cmd == "next" || cmd == "prev" {
+				return errors.New("iterator is not positioned")
+			}
+			s.iter = s.db.NewIter(nil)
+		}
+		var valid bool
+		switch cmd {
+		case "first":
+			valid = s.iter.First()
+		case "last":
+			valid = s.iter.Last()
+		case "next":
+			valid = s.iter.Next()
+		case "prev":
+			valid = s.iter.Prev()
+		case "seek-ge":
+			valid = s.iter.SeekGE(keys[0])
+		case "seek-lt":
+			valid = s.iter.SeekLT(keys[0])
+		}
+		return s.printIter(valid)
+
+	case "batch":
+		if s.batch != nil {
+			return errors.New("batch already in progress")
+		}
+		s.batch = s.db.NewBatch()
+
+	case "put", "delete":
+		if s.batch == nil {
+			return errors.New("no batch in progress; use 'batch' to start one")
+		}
+		n := 1
+		if cmd == "put" {
+			n = 2
+		}
+		keys, err := parseShellKeys(args, n, n)
+		if err != nil {
+			return err
+		}
+		if cmd == "put" {
+			return s.batch.Set(keys[0], keys[1], nil)
+		}
+		return s.batch.Delete(keys[0], nil)
+
+	case "commit", "abort":
+		if s.batch == nil {
+			return errors.New("no batch in progress")
+		}
+		b := s.batch
+		s.batch = nil
+		if cmd == "abort" {
+			return b.Close()
+		}
+		count := b.Count()
+		if err := b.Commit(pebble.Sync); err != nil {
+			_ = b.Close()
+			return err
+		}
+		fmt.Fprintf(stdout, "committed %d %s\n", count, makePlural("operation", int64(count)))
+		if err := b.Close(); err != nil {
+			return err
+		}
+		return s.resetIter()
+
+	case "lsm":
+		tw := tabwriter.NewWriter(stdout, 2, 1, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintf(tw, "level\tfiles\tsize\t\n")
+		for level, tables := range s.db.SSTables() {
+			var size uint64
+			for i := range tables {
+				size += tables[i].Size
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%s\t\n", level, len(tables), humanize.IEC.Uint64(size))
+		}
+		return tw.Flush()
+
+	case "files":
+		level := -1
+		if len(args) > 1 {
+			return errors.New("expected 0 to 1 arguments")
+		} else if len(args) == 1 {
+			var err error
+			if level, err = strconv.Atoi(args[0]); err != nil {
+				return err
+			}
+		}
+		for l, tables := range s.db.SSTables() {
+			if level >= 0 && l != level {
+				continue
+			}
+			fmt.Fprintf(stdout, "--- L%d ---\n", l)
+			for _, t := range tables {
+				fmt.Fprintf(stdout, "%s:%d[%s-%s]\n", t.FileNum, t.Size,
+					t.Smallest.Pretty(s.d.fmtKey.fn), t.Largest.Pretty(s.d.fmtKey.fn))
+			}
+		}
+
+	case "metrics":
+		fmt.Fprintf(stdout, "%s", s.db.Metrics())
+
+	case "flush":
+		if len(args) != 0 {
+			return errors.New("expected 0 arguments")
+		}
+		if err := s.db.Flush(); err != nil {
+			return err
+		}
+		return s.resetIter()
+
+	case "compact":
+		if len(args) != 0 && len(args) != 2 {
+			return errors.New("expected 0 or 2 arguments")
+		}
+		keys, err := parseShellKeys(args, 0, 2)
+		if err != nil {
+			return err
+		}
+		var start, end []byte
+		if len(keys) == 2 {
+			start, end = keys[0], keys[1]
+		} else {
+			iter := s.db.NewIter(nil)
+			if iter.First() {
+				start = append(start, iter.Key()...)
+			}
+			if iter.Last() {
+				end = append(end, iter.Key()...)
+			}
+			if err := iter.Close(); err != nil {
+				return err
+			}
+			if start == nil {
+				return nil
+			}
+		}
+		if err := s.db.Compact(start, end); err != nil {
+			return err
+		}
+		return s.resetIter()
+
+	default:
+		return errors.Errorf("unknown command %q; use 'help' for a list of commands", errors.Safe(cmd))
+	}
+	return nil
+}
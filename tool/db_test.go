@@ -5,9 +5,72 @@
 package tool
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDB(t *testing.T) {
 	runTests(t, "testdata/db_*")
 }
+
+func TestDBShellCheckpoint(t *testing.T) {
+	// The DB has an unflushed WAL, which opening the DB would flush. Operating
+	// on a checkpoint must leave every file of the DB untouched.
+	for _, readOnly := range []bool{false, true} {
+		t.Run(fmt.Sprintf("read-only=%t", readOnly), func(t *testing.T) {
+			fs := vfs.NewMem()
+			ok, err := vfs.Clone(vfs.Default, fs, "../testdata/db-stage-4", "db")
+			require.NoError(t, err)
+			require.True(t, ok)
+			contents := func() map[string]string {
+				ls, err := fs.List("db")
+				require.NoError(t, err)
+				m := make(map[string]string)
+				for _, name := range ls {
+					f, err := fs.Open(fs.PathJoin("db", name))
+					require.NoError(t, err)
+					data, err := ioutil.ReadAll(f)
+					require.NoError(t, err)
+					require.NoError(t, f.Close())
+					m[name] = string(data)
+				}
+				return m
+			}
+			before := contents()
+
+			args := []string{"db", "shell", "db", "--checkpoint=ckpt"}
+			input := "get foo\n"
+			if readOnly {
+				args = append(args, "--read-only")
+			} else {
+				input += "batch\nput a b\ncommit\nflush\n"
+			}
+			var buf bytes.Buffer
+			stdin, stdout = strings.NewReader(input), &buf
+			defer func() {
+				stdin, stdout = os.Stdin, os.Stdout
+			}()
+
+			tool := New()
+			tool.setFS(fs)
+			c := &cobra.Command{}
+			c.AddCommand(tool.Commands...)
+			c.SetArgs(args)
+			c.SetOutput(&buf)
+			require.NoError(t, c.Execute())
+			require.True(t, strings.HasPrefix(buf.String(), "foo [66697665]\n"), buf.String())
+
+			require.Equal(t, before, contents())
+			_, err = fs.Stat(fs.PathJoin("ckpt", "CURRENT"))
+			require.NoError(t, err)
+		})
+	}
+}
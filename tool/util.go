@@ -19,6 +19,7 @@ import (
 	"github.com/cockroachdb/pebble/vfs"
 )
 
+var stdin = io.Reader(os.Stdin)
 var stdout = io.Writer(os.Stdout)
 var stderr = io.Writer(os.Stderr)
 var osExit = os.Exit
@@ -0,0 +1,320 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiskHealthCheckingOptions holds the options for a disk-health-checking FS.
+type DiskHealthCheckingOptions struct {
+	// SlowThreshold is the duration after which an in-progress write, sync,
+	// create or remove is reported via OnSlowDisk. Slow disk detection is
+	// disabled if SlowThreshold is zero.
+	SlowThreshold time.Duration
+	// OnSlowDisk is invoked with the path of the file and the elapsed duration
+	// when an operation exceeds SlowThreshold. OnSlowDisk is invoked
+	// periodically for as long as the operation remains outstanding.
+	OnSlowDisk func(name string, duration time.Duration)
+	// StallThreshold is the duration after which an in-progress operation is
+	// considered stalled and OnStall is invoked. StallThreshold should be
+	// larger than SlowThreshold. Stall detection is disabled if StallThreshold
+	// is zero.
+	StallThreshold time.Duration
+	// OnStall is invoked with the path of the file and the elapsed duration
+	// when an operation exceeds StallThreshold. It is typically used to
+	// terminate the process rather than wait forever on a wedged disk.
+	OnStall func(name string, duration time.Duration)
+}
+
+func (o *DiskHealthCheckingOptions) enabled() bool {
+	return (o.SlowThreshold > 0 && o.OnSlowDisk != nil) ||
+		(o.StallThreshold > 0 && o.OnStall != nil)
+}
+
+// tickInterval returns the interval at which outstanding operations are
+// checked against the thresholds.
+func (o *DiskHealthCheckingOptions) tickInterval() time.Duration {
+	threshold := o.SlowThreshold
+	if threshold <= 0 || (o.StallThreshold > 0 && o.StallThreshold < threshold) {
+		threshold = o.StallThreshold
+	}
+	if interval := threshold / 4; interval > 0 {
+		return interval
+	}
+	return time.Millisecond
+}
+
+// check reports the operation on the named file if it has been outstanding
+// since startNanos for longer than the slow or stall thresholds.
+func (o *DiskHealthCheckingOptions) check(name string, startNanos int64, now time.Time) {
+	if startNanos == 0 {
+		return
+	}
+	elapsed := now.Sub(time.Unix(0, startNanos))
+	if o.StallThreshold > 0 && o.OnStall != nil && elapsed >= o.StallThreshold {
+		o.OnStall(name, elapsed)
+		return
+	}
+	if o.SlowThreshold > 0 && o.OnSlowDisk != nil && elapsed >= o.SlowThreshold {
+		o.OnSlowDisk(name, elapsed)
+	}
+}
+
+// diskHealthCheckingFile wraps a writable file and monitors the duration of
+// its Write, Sync and Close operations. A background goroutine, started when
+// the file is created and stopped when it is closed, periodically checks for
+// an outstanding operation that has exceeded the configured thresholds.
+//
+// NewSyncingFile inserts the syncing file beneath a diskHealthCheckingFile,
+// so that the syncs it issues on the file descriptor are monitored as part of
+// the Write, Sync or Close that triggered them.
+type diskHealthCheckingFile struct {
+	File
+	name     string
+	opts     *DiskHealthCheckingOptions
+	stopper  chan struct{}
+	stopOnce sync.Once
+	atomic   struct {
+		// The start time of the outstanding Write or Sync operation, in
+		// nanoseconds since the Unix epoch, or zero if no operation is
+		// outstanding.
+		opStartNanos int64
+	}
+}
+
+func newDiskHealthCheckingFile(
+	f File, name string, opts *DiskHealthCheckingOptions,
+) *diskHealthCheckingFile {
+	d := &diskHealthCheckingFile{
+		File:    f,
+		name:    name,
+		opts:    opts,
+		stopper: make(chan struct{}),
+	}
+	go d.monitor()
+	return d
+}
+
+func (d *diskHealthCheckingFile) monitor() {
+	ticker := time.NewTicker(d.opts.tickInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopper:
+			return
+		case now := <-ticker.C:
+			d.opts.check(d.name, atomic.LoadInt64(&d.atomic.opStartNanos), now)
+		}
+	}
+}
+
+func (d *diskHealthCheckingFile) timeOperation(op func()) {
+	atomic.StoreInt64(&d.atomic.opStartNanos, time.Now().UnixNano())
+	op()
+	atomic.StoreInt64(&d.atomic.opStartNanos, 0)
+}
+
+// Write implements the io.Writer interface.
+func (d *diskHealthCheckingFile) Write(p []byte) (n int, err error) {
+	d.timeOperation(func() {
+		n, err = d.File.Write(p)
+	})
+	return n, err
+}
+
+// Sync implements the File interface.
+func (d *diskHealthCheckingFile) Sync() (err error) {
+	d.timeOperation(func() {
+		err = d.File.Sync()
+	})
+	return err
+}
+
+// Close implements the io.Closer interface. Closing the file more than once
+// returns the error of the wrapped file.
+func (d *diskHealthCheckingFile) Close() (err error) {
+	d.timeOperation(func() {
+		err = d.File.Close()
+	})
+	d.stopOnce.Do(func() {
+		close(d.stopper)
+	})
+	return err
+}
+
+// Fd returns the file descriptor of the wrapped file, or zero if it does not
+// have one.
+func (d *diskHealthCheckingFile) Fd() uintptr {
+	if f, ok := d.File.(interface{ Fd() uintptr }); ok {
+		return f.Fd()
+	}
+	return 0
+}
+
+type diskHealthCheckingFS struct {
+	FS
+	opts DiskHealthCheckingOptions
+	mu   struct {
+		sync.Mutex
+		// inflight holds the filesystem operations started since the monitor
+		// last checked them. Completed operations are removed by the monitor.
+		inflight []*diskHealthCheckingOp
+		// monitoring is set while the monitor goroutine is running.
+		monitoring bool
+	}
+}
+
+// diskHealthCheckingOp is a filesystem operation, such as the creation or
+// removal of a file, monitored by a diskHealthCheckingFS.
+type diskHealthCheckingOp struct {
+	name string
+	// The start time of the operation in nanoseconds since the Unix epoch, or
+	// zero once the operation has completed. Accessed atomically.
+	startNanos int64
+}
+
+// NewDiskHealthCheckingFS wraps a filesystem and monitors the duration of
+// operations which modify it: file creation and removal, and writes and syncs
+// of files opened for writing. Operations that exceed opts.SlowThreshold are
+// reported via opts.OnSlowDisk, and operations that exceed
+// opts.StallThreshold via opts.OnStall. If neither check is enabled the
+// supplied FS is returned unwrapped.
+func NewDiskHealthCheckingFS(fs FS, opts DiskHealthCheckingOptions) FS {
+	if !opts.enabled() {
+		return fs
+	}
+	return &diskHealthCheckingFS{
+		FS:   fs,
+		opts: opts,
+	}
+}
+
+// timeFilesystemOp runs op, reporting it against the named file if it does
+// not complete within the configured thresholds. The operation is checked by
+// the FS's monitor goroutine, which is started if it is not already running.
+func (d *diskHealthCheckingFS) timeFilesystemOp(name string, op func()) {
+	o := &diskHealthCheckingOp{name: name, startNanos: time.Now().UnixNano()}
+	d.mu.Lock()
+	d.mu.inflight = append(d.mu.inflight, o)
+	if !d.mu.monitoring {
+		d.mu.monitoring = true
+		go d.monitor()
+	}
+	d.mu.Unlock()
+
+	op()
+	atomic.StoreInt64(&o.startNanos, 0)
+}
+
+// monitor periodically checks the outstanding filesystem operations against
+// the configured thresholds. It exits once no operations are outstanding, so
+// that an idle FS has no goroutine, and is restarted by timeFilesystemOp.
+func (d *diskHealthCheckingFS) monitor() {
+	ticker := time.NewTicker(d.opts.tickInterval())
+	defer ticker.Stop()
+
+	var outstanding []*diskHealthCheckingOp
+	for now := range ticker.C {
+		d.mu.Lock()
+		outstanding = outstanding[:0]
+		for _, o := range d.mu.inflight {
+			if atomic.LoadInt64(&o.startNanos) != 0 {
+				outstanding = append(outstanding, o)
+			}
+		}
+		d.mu.inflight = append(d.mu.inflight[:0], outstanding...)
+		if len(outstanding) == 0 {
+			d.mu.monitoring = false
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+
+		for _, o := range outstanding {
+			d.opts.check(o.name, atomic.LoadInt64(&o.startNanos), now)
+		}
+	}
+}
+
+// Unwrap returns the underlying FS.
+func (d *diskHealthCheckingFS) Unwrap() FS {
+	return d.FS
+}
+
+// Create implements the FS interface.
+func (d *diskHealthCheckingFS) Create(name string) (File, error) {
+	var f File
+	var err error
+	d.timeFilesystemOp(name, func() {
+		f, err = d.FS.Create(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newDiskHealthCheckingFile(f, name, &d.opts), nil
+}
+
+// Link implements the FS interface.
+func (d *diskHealthCheckingFS) Link(oldname, newname string) error {
+	var err error
+	d.timeFilesystemOp(newname, func() {
+		err = d.FS.Link(oldname, newname)
+	})
+	return err
+}
+
+// OpenDir implements the FS interface. Directories are wrapped so that syncs
+// of the directory are monitored.
+func (d *diskHealthCheckingFS) OpenDir(name string) (File, error) {
+	f, err := d.FS.OpenDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return newDiskHealthCheckingFile(f, name, &d.opts), nil
+}
+
+// Remove implements the FS interface.
+func (d *diskHealthCheckingFS) Remove(name string) error {
+	var err error
+	d.timeFilesystemOp(name, func() {
+		err = d.FS.Remove(name)
+	})
+	return err
+}
+
+// RemoveAll implements the FS interface.
+func (d *diskHealthCheckingFS) RemoveAll(name string) error {
+	var err error
+	d.timeFilesystemOp(name, func() {
+		err = d.FS.RemoveAll(name)
+	})
+	return err
+}
+
+// Rename implements the FS interface.
+func (d *diskHealthCheckingFS) Rename(oldname, newname string) error {
+	var err error
+	d.timeFilesystemOp(newname, func() {
+		err = d.FS.Rename(oldname, newname)
+	})
+	return err
+}
+
+// ReuseForWrite implements the FS interface.
+func (d *diskHealthCheckingFS) ReuseForWrite(oldname, newname string) (File, error) {
+	var f File
+	var err error
+	d.timeFilesystemOp(newname, func() {
+		f, err = d.FS.ReuseForWrite(oldname, newname)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newDiskHealthCheckingFile(f, newname, &d.opts), nil
+}
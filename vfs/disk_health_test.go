@@ -0,0 +1,204 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingFS is an FS whose files block in Write and Sync, and which blocks
+// in Remove, until the unblock channel is closed.
+type blockingFS struct {
+	FS
+	unblock chan struct{}
+}
+
+func (fs blockingFS) Create(name string) (File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return blockingFile{File: f, unblock: fs.unblock}, nil
+}
+
+func (fs blockingFS) Remove(name string) error {
+	<-fs.unblock
+	return fs.FS.Remove(name)
+}
+
+type blockingFile struct {
+	File
+	unblock chan struct{}
+}
+
+func (f blockingFile) Write(p []byte) (int, error) {
+	<-f.unblock
+	return f.File.Write(p)
+}
+
+func (f blockingFile) Sync() error {
+	<-f.unblock
+	return f.File.Sync()
+}
+
+func TestDiskHealthChecking(t *testing.T) {
+	if _, ok := NewDiskHealthCheckingFS(NewMem(), DiskHealthCheckingOptions{}).(*MemFS); !ok {
+		t.Fatalf("expected unwrapped FS when disk health checking is disabled")
+	}
+
+	testCases := []struct {
+		name  string
+		stall bool
+		op    func(fs, mem FS) error
+	}{
+		{"write", false, func(fs, _ FS) error {
+			f, err := fs.Create("foo")
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Write([]byte("bar"))
+			return err
+		}},
+		{"sync", true, func(fs, _ FS) error {
+			f, err := fs.Create("foo")
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return f.Sync()
+		}},
+		{"remove", true, func(fs, mem FS) error {
+			f, err := mem.Create("foo")
+			if err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			return fs.Remove("foo")
+		}},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			slowCh := make(chan string, 1)
+			stallCh := make(chan string, 1)
+			opts := DiskHealthCheckingOptions{
+				SlowThreshold: 10 * time.Millisecond,
+				OnSlowDisk: func(name string, duration time.Duration) {
+					select {
+					case slowCh <- name:
+					default:
+					}
+				},
+			}
+			if c.stall {
+				opts.StallThreshold = 50 * time.Millisecond
+				opts.OnStall = func(name string, duration time.Duration) {
+					stallCh <- name
+				}
+			}
+
+			unblock := make(chan struct{})
+			mem := NewMem()
+			fs := NewDiskHealthCheckingFS(blockingFS{FS: mem, unblock: unblock}, opts)
+			require.Equal(t, fs.(*diskHealthCheckingFS).FS, Root(fs).(blockingFS))
+
+			errCh := make(chan error, 1)
+			go func() { errCh <- c.op(fs, mem) }()
+
+			select {
+			case name := <-slowCh:
+				require.Equal(t, "foo", name)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("slow disk not reported")
+			}
+			if c.stall {
+				select {
+				case name := <-stallCh:
+					require.Equal(t, "foo", name)
+				case <-time.After(10 * time.Second):
+					t.Fatalf("disk stall not reported")
+				}
+			}
+
+			close(unblock)
+			require.NoError(t, <-errCh)
+		})
+	}
+}
+
+func TestDiskHealthCheckingSyncingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pebble-disk-health")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	slowCh := make(chan string, 1)
+	fs := NewDiskHealthCheckingFS(Default, DiskHealthCheckingOptions{
+		SlowThreshold: 10 * time.Millisecond,
+		OnSlowDisk: func(name string, duration time.Duration) {
+			select {
+			case slowCh <- name:
+			default:
+			}
+		},
+	})
+
+	// The monitored file exposes the file descriptor of the wrapped file, so
+	// that a syncing file can sync it directly.
+	name := filepath.Join(dir, "foo")
+	f, err := fs.Create(name)
+	require.NoError(t, err)
+	fd, ok := f.(interface{ Fd() uintptr })
+	require.True(t, ok)
+	require.NotEqual(t, uintptr(0), fd.Fd())
+
+	f = NewSyncingFile(f, SyncingFileOptions{BytesPerSync: 512 << 10})
+	s := f.(*diskHealthCheckingFile).File.(*syncingFile)
+	require.NotEqual(t, uintptr(0), s.fd)
+
+	// A sync of the file descriptor must be monitored.
+	unblock := make(chan struct{})
+	syncData := s.syncData
+	s.syncData = func() error {
+		<-unblock
+		return syncData()
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- f.Sync() }()
+
+	select {
+	case n := <-slowCh:
+		require.Equal(t, name, n)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("slow disk not reported")
+	}
+
+	close(unblock)
+	require.NoError(t, <-errCh)
+	require.NoError(t, f.Close())
+}
+
+func TestDiskHealthCheckingFileDoubleClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pebble-disk-health")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := NewDiskHealthCheckingFS(Default, DiskHealthCheckingOptions{
+		SlowThreshold: time.Second,
+		OnSlowDisk:    func(string, time.Duration) {},
+	})
+	f, err := fs.Create(filepath.Join(dir, "foo"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Error(t, f.Close())
+}
@@ -39,6 +39,13 @@ type syncingFile struct {
 // the OS automatically decides to write out a large chunk of dirty filesystem
 // buffers. The underlying file is fully synced upon close.
 func NewSyncingFile(f File, opts SyncingFileOptions) File {
+	if d, ok := f.(*diskHealthCheckingFile); ok {
+		// Sync the file beneath the disk health checks, so that the syncs of
+		// the file descriptor are monitored.
+		d.File = NewSyncingFile(d.File, opts)
+		return d
+	}
+
 	s := &syncingFile{
 		File:            f,
 		bytesPerSync:    int64(opts.BytesPerSync),
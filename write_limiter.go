@@ -0,0 +1,179 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/rate"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// writePriority is the priority class of a write subject to the shared write
+// bandwidth limit. Lower values have higher priority: a write waits while any
+// write of a higher priority class is waiting for bandwidth.
+type writePriority int
+
+const (
+	// writePriorityWAL is used for writes to the WAL. WAL writes are accounted
+	// against the limit, but are never delayed as doing so would directly
+	// delay user writes.
+	writePriorityWAL writePriority = iota
+	// writePriorityFlush is used for memtable flushes.
+	writePriorityFlush
+	// writePriorityCopy is used for the copies of sstables performed by
+	// ingestion and checkpoints when hard linking is not possible.
+	writePriorityCopy
+	// writePriorityCompaction is used for compactions.
+	writePriorityCompaction
+	numWritePriorities
+)
+
+// writeLimiterBurst is the maximum number of bytes that are requested from
+// the underlying rate limiter at once. Larger writes are split into multiple
+// requests, which also bounds how long a lower priority write can delay a
+// higher priority one.
+const writeLimiterBurst = 256 << 10 // 256 KB
+
+// writeLimiter is a write bandwidth limiter shared by flushes, compactions,
+// ingestion copies, checkpoint copies and the WAL. Writes are admitted in
+// priority order: a write of a given class waits while writes of a higher
+// priority class are waiting for bandwidth.
+type writeLimiter struct {
+	limiter *rate.Limiter
+
+	mu struct {
+		sync.Mutex
+		cond sync.Cond
+		// The limit in bytes per second, or zero if unlimited.
+		bytesPerSecond int
+		// The number of writes of each class waiting for bandwidth.
+		waiting [numWritePriorities]int
+		metrics [numWritePriorities]WriteCategoryMetrics
+	}
+}
+
+func newWriteLimiter(bytesPerSecond int) *writeLimiter {
+	l := &writeLimiter{
+		limiter: rate.NewLimiter(rate.Inf, writeLimiterBurst),
+	}
+	l.mu.cond.L = &l.mu.Mutex
+	l.setLimit(bytesPerSecond)
+	return l
+}
+
+// setLimit sets the limit in bytes per second. A value of zero or less
+// removes the limit.
+func (l *writeLimiter) setLimit(bytesPerSecond int) {
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.mu.Lock()
+	l.mu.bytesPerSecond = bytesPerSecond
+	l.mu.Unlock()
+
+	if bytesPerSecond == 0 {
+		l.limiter.SetLimit(rate.Inf)
+	} else {
+		l.limiter.SetLimit(rate.Limit(bytesPerSecond))
+	}
+}
+
+// limit returns the limit in bytes per second, or zero if unlimited.
+func (l *writeLimiter) limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mu.bytesPerSecond
+}
+
+// higherPriorityWaitingLocked returns true if a write with a higher priority
+// than pri is waiting for bandwidth. l.mu must be held.
+func (l *writeLimiter) higherPriorityWaitingLocked(pri writePriority) bool {
+	for i := writePriority(0); i < pri; i++ {
+		if l.mu.waiting[i] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until n bytes of the given priority class may be written. WAL
+// writes are accounted for but never block.
+func (l *writeLimiter) wait(pri writePriority, n int) {
+	l.mu.Lock()
+	l.mu.metrics[pri].BytesWritten += uint64(n)
+	if l.mu.bytesPerSecond == 0 {
+		l.mu.Unlock()
+		return
+	}
+	if pri == writePriorityWAL {
+		l.mu.Unlock()
+		for n > 0 {
+			chunk := n
+			if chunk > writeLimiterBurst {
+				chunk = writeLimiterBurst
+			}
+			// Consume the tokens, ignoring the resulting delay. Lower priority
+			// writes will absorb the delay instead.
+			_ = l.limiter.DelayN(time.Now(), chunk)
+			n -= chunk
+		}
+		return
+	}
+
+	start := time.Now()
+	l.mu.waiting[pri]++
+	for n > 0 {
+		for l.higherPriorityWaitingLocked(pri) {
+			l.mu.cond.Wait()
+		}
+		chunk := n
+		if chunk > writeLimiterBurst {
+			chunk = writeLimiterBurst
+		}
+		l.mu.Unlock()
+		if d := l.limiter.DelayN(time.Now(), chunk); d > 0 && d != rate.InfDuration {
+			time.Sleep(d)
+		}
+		l.mu.Lock()
+		n -= chunk
+	}
+	l.mu.waiting[pri]--
+	l.mu.metrics[pri].ThrottledDuration += time.Since(start)
+	l.mu.cond.Broadcast()
+	l.mu.Unlock()
+}
+
+// metrics returns the per-class write metrics, indexed by writePriority.
+func (l *writeLimiter) metrics() [numWritePriorities]WriteCategoryMetrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mu.metrics
+}
+
+// limitedFile wraps a vfs.File, subjecting writes to a writeLimiter.
+type limitedFile struct {
+	vfs.File
+	limiter  *writeLimiter
+	priority writePriority
+}
+
+func newLimitedFile(f vfs.File, limiter *writeLimiter, pri writePriority) vfs.File {
+	if limiter == nil {
+		return f
+	}
+	return &limitedFile{
+		File:     f,
+		limiter:  limiter,
+		priority: pri,
+	}
+}
+
+// Write implements the io.Writer interface.
+func (f *limitedFile) Write(p []byte) (int, error) {
+	f.limiter.wait(f.priority, len(p))
+	return f.File.Write(p)
+}
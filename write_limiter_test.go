@@ -0,0 +1,105 @@
+// Copyright 2020 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLimiterUnlimited(t *testing.T) {
+	l := newWriteLimiter(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		l.wait(writePriorityCompaction, 1<<20)
+	}
+	require.True(t, time.Since(start) < time.Second)
+
+	m := l.metrics()
+	require.EqualValues(t, 100<<20, m[writePriorityCompaction].BytesWritten)
+	require.EqualValues(t, 0, m[writePriorityFlush].BytesWritten)
+	require.Equal(t, 0, l.limit())
+}
+
+func TestWriteLimiterPriority(t *testing.T) {
+	const bytesPerSecond = 4 << 20 // 4 MB/s
+	l := newWriteLimiter(bytesPerSecond)
+	require.Equal(t, bytesPerSecond, l.limit())
+
+	// Exhaust the burst so that subsequent writes must wait.
+	l.wait(writePriorityCompaction, writeLimiterBurst)
+
+	// Queue a large compaction write, and then a flush write. The flush should
+	// complete before the compaction even though it was requested later.
+	var mu sync.Mutex
+	var order []writePriority
+	var wg sync.WaitGroup
+	record := func(pri writePriority, n int) {
+		defer wg.Done()
+		l.wait(pri, n)
+		mu.Lock()
+		order = append(order, pri)
+		mu.Unlock()
+	}
+	wg.Add(2)
+	go record(writePriorityCompaction, 4*writeLimiterBurst)
+	// Wait for the compaction to register as waiting.
+	for {
+		l.mu.Lock()
+		waiting := l.mu.waiting[writePriorityCompaction]
+		l.mu.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go record(writePriorityFlush, writeLimiterBurst)
+
+	// WAL writes are never delayed.
+	start := time.Now()
+	l.wait(writePriorityWAL, 4*writeLimiterBurst)
+	require.True(t, time.Since(start) < 100*time.Millisecond)
+
+	wg.Wait()
+	require.Equal(t, []writePriority{writePriorityFlush, writePriorityCompaction}, order)
+
+	m := l.metrics()
+	require.EqualValues(t, 4*writeLimiterBurst, m[writePriorityWAL].BytesWritten)
+	require.EqualValues(t, 0, m[writePriorityWAL].ThrottledDuration)
+	require.True(t, m[writePriorityCompaction].ThrottledDuration > 0)
+
+	// Removing the limit releases writes immediately.
+	l.setLimit(0)
+	start = time.Now()
+	l.wait(writePriorityCompaction, 64*writeLimiterBurst)
+	require.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestWriteLimiterMetrics(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                     vfs.NewMem(),
+		MaxWriteBytesPerSecond: 64 << 20,
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("b"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("b")))
+
+	m := d.Metrics()
+	require.Equal(t, 64<<20, m.WriteBandwidth.Limit)
+	require.NotZero(t, m.WriteBandwidth.WAL.BytesWritten)
+	require.NotZero(t, m.WriteBandwidth.Flush.BytesWritten)
+
+	d.SetMaxWriteBytesPerSecond(0)
+	require.Equal(t, 0, d.Metrics().WriteBandwidth.Limit)
+}